@@ -3,6 +3,7 @@ module api_gateway
 go 1.22.3
 
 require (
+	github.com/golang-jwt/jwt/v5 v5.2.2
 	github.com/gorilla/mux v1.8.1
 	github.com/redis/go-redis/v9 v9.11.0
 )
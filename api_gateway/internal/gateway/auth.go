@@ -1,20 +1,182 @@
 package gateway
 
 import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"log"
+	"math/big"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
 )
 
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
+// JWKSVerifier checks access tokens against the keys the service publishes
+// at /.well-known/jwks.json. Keys are cached and refetched when a token names
+// an unknown kid, which is how a key rotation reaches the gateway.
+type JWKSVerifier struct {
+	url      string
+	issuer   string
+	audience string
+	client   *http.Client
+
+	mu        sync.RWMutex
+	keys      map[string]verificationKey
+	fetchedAt time.Time
+}
+
+type verificationKey struct {
+	alg string
+	key any
+}
+
+// minimum time between refetches, so bogus kids can't hammer the service
+const jwksMinRefresh = 30 * time.Second
+
+func NewJWKSVerifier(url, issuer, audience string) *JWKSVerifier {
+	return &JWKSVerifier{
+		url:      url,
+		issuer:   issuer,
+		audience: audience,
+		client:   &http.Client{Timeout: 5 * time.Second},
+		keys:     make(map[string]verificationKey),
+	}
+}
+
+func (v *JWKSVerifier) Verify(tokenStr string) error {
+	_, err := jwt.Parse(tokenStr, v.keyFunc,
+		jwt.WithValidMethods([]string{"RS256", "EdDSA"}),
+		jwt.WithIssuer(v.issuer),
+		jwt.WithAudience(v.audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30*time.Second),
+	)
+	return err
+}
+
+func (v *JWKSVerifier) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, fmt.Errorf("token has no kid")
+	}
+
+	k, ok := v.lookup(kid)
+	if !ok {
+		if err := v.refresh(); err != nil {
+			return nil, err
+		}
+		if k, ok = v.lookup(kid); !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+	}
+
+	if token.Method.Alg() != k.alg {
+		return nil, fmt.Errorf("algorithm %s does not match key %q", token.Method.Alg(), kid)
+	}
+	return k.key, nil
+}
+
+func (v *JWKSVerifier) lookup(kid string) (verificationKey, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	k, ok := v.keys[kid]
+	return k, ok
+}
+
+func (v *JWKSVerifier) refresh() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if time.Since(v.fetchedAt) < jwksMinRefresh {
+		return nil
+	}
+	v.fetchedAt = time.Now()
+
+	resp, err := v.client.Get(v.url)
+	if err != nil {
+		return fmt.Errorf("fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch jwks: unexpected status %d", resp.StatusCode)
+	}
 
-		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("decode jwks: %w", err)
+	}
+
+	keys := make(map[string]verificationKey)
+	for _, k := range set.Keys {
+		switch {
+		case k.Kty == "RSA" && k.Alg == "RS256":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil {
+				log.Printf("skipping malformed jwk %s", k.Kid)
+				continue
+			}
+			keys[k.Kid] = verificationKey{alg: k.Alg, key: &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}}
+		case k.Kty == "OKP" && k.Crv == "Ed25519" && k.Alg == "EdDSA":
+			x, err := base64.RawURLEncoding.DecodeString(k.X)
+			if err != nil || len(x) != ed25519.PublicKeySize {
+				log.Printf("skipping malformed jwk %s", k.Kid)
+				continue
+			}
+			keys[k.Kid] = verificationKey{alg: k.Alg, key: ed25519.PublicKey(x)}
 		}
-		log.Println("Authenticated request")
-		next.ServeHTTP(w, r)
-	})
+	}
+
+	v.keys = keys
+	return nil
+}
+
+// AuthMiddleware rejects requests without a bearer token or API key. With a
+// verifier it also checks the signature, issuer, audience and expiry of
+// bearer tokens before forwarding; revocation and API keys are checked by the
+// service itself.
+func AuthMiddleware(verifier *JWKSVerifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+
+			if strings.HasPrefix(authHeader, "ApiKey ") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			if verifier != nil {
+				if err := verifier.Verify(strings.TrimPrefix(authHeader, "Bearer ")); err != nil {
+					log.Println("Rejected token:", err)
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				}
+			}
+
+			log.Println("Authenticated request")
+			next.ServeHTTP(w, r)
+		})
+	}
 }
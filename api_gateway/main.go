@@ -4,6 +4,7 @@ import (
 	"api_gateway/internal/gateway"
 	"log"
 	"net/http"
+	"os"
 
 	"github.com/gorilla/mux"
 )
@@ -19,12 +20,35 @@ func main() {
 	// public routes no token required
 	r.PathPrefix("/register").HandlerFunc(gateway.ForwardTo("http://localhost:8090")).Methods("POST")
 	r.PathPrefix("/login").HandlerFunc(gateway.ForwardTo("http://localhost:8090")).Methods("POST")
+	r.PathPrefix("/auth/refresh").HandlerFunc(gateway.ForwardTo("http://localhost:8090")).Methods("POST")
+	r.PathPrefix("/auth/verify-email").HandlerFunc(gateway.ForwardTo("http://localhost:8090")).Methods("POST")
+	r.PathPrefix("/auth/password/").HandlerFunc(gateway.ForwardTo("http://localhost:8090")).Methods("POST")
+	r.PathPrefix("/auth/mfa/verify").HandlerFunc(gateway.ForwardTo("http://localhost:8090")).Methods("POST")
+	r.PathPrefix("/auth/mfa/enroll").HandlerFunc(gateway.ForwardTo("http://localhost:8090")).Methods("POST")
+	r.PathPrefix("/auth/invitations/accept").HandlerFunc(gateway.ForwardTo("http://localhost:8090")).Methods("POST")
+	r.PathPrefix("/auth/oidc/").HandlerFunc(gateway.ForwardTo("http://localhost:8090")).Methods("GET")
+	r.PathPrefix("/.well-known/jwks.json").HandlerFunc(gateway.ForwardTo("http://localhost:8090")).Methods("GET")
+
+	// verify tokens at the edge when the service publishes signing keys
+	var verifier *gateway.JWKSVerifier
+	if jwksURL := os.Getenv("JWKS_URL"); jwksURL != "" {
+		verifier = gateway.NewJWKSVerifier(jwksURL, getEnv("JWT_ISSUER", "complaingo"), getEnv("JWT_AUDIENCE", "complaingo-api"))
+	} else {
+		log.Println("JWKS_URL not set, tokens are only verified by the service")
+	}
 
 	// protected routes that require auth token
 	protected := r.PathPrefix("/").Subrouter()
-	protected.Use(gateway.AuthMiddleware)
+	protected.Use(gateway.AuthMiddleware(verifier))
 	protected.PathPrefix("/").HandlerFunc(gateway.ForwardTo("http://localhost:8090"))
 
 	log.Println("API Gateway listeninig on port :8000")
 	log.Fatal(http.ListenAndServe(":8000", r))
 }
+
+func getEnv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -3,6 +3,9 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	appErrors "Complaingo/internal/errors"
 
@@ -13,6 +16,125 @@ type Config struct {
 	DBUrl      string
 	JWTSecret  string
 	ServerPort string
+	UploadDir  string
+	// where documents were written before storage keys existed, read for
+	// legacy/ keys whose files weren't moved to UPLOAD_DIR/legacy/
+	LegacyUploadDir string
+
+	// blob storage, STORAGE_BACKEND is "local" (default) or "s3"
+	StorageBackend string
+	S3Endpoint     string
+	S3Region       string
+	S3Bucket       string
+	S3AccessKey    string
+	S3SecretKey    string
+	S3UsePathStyle bool
+
+	// upload pipeline
+	UploadMaxBytesUser  int64
+	UploadMaxBytesAdmin int64
+	UploadAllowedTypes  []string
+	Scanner             string // "none" (default), "clamav" or "fake"
+	ClamAVAddr          string
+
+	// signed download links
+	DownloadURLSecret string
+	DownloadURLTTL    time.Duration
+
+	// token lifetimes
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// access token signing; without a signing key tokens use HS256 and the secret
+	JWTIssuer         string
+	JWTAudience       string
+	JWTSigningKeyFile string
+	JWTVerifyKeyFiles []string
+
+	// default storage quota per role, overridable per user
+	QuotaBytesUser  int64
+	QuotaBytesAdmin int64
+
+	// outgoing mail, MAILER is "log" (default), "file" or "smtp"
+	Mailer       string
+	MailFrom     string
+	MailDir      string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+
+	// links in emails point at the frontend
+	AppBaseURL       string
+	EmailVerifyTTL   time.Duration
+	PasswordResetTTL time.Duration
+	InviteTTL        time.Duration
+
+	// two-factor authentication, MFA_REQUIRED_ROLES=admin forces it for admins
+	MFAIssuer        string
+	MFAChallengeTTL  time.Duration
+	MFARequiredRoles []string
+	MFAEncryptionKey string
+
+	// failed login throttling, see auth.LoginPolicy
+	LoginMaxAccountFailures int
+	LoginMaxIPFailures      int
+	LoginBackoffAfter       int
+	LoginBackoffBase        time.Duration
+	LoginBackoffMax         time.Duration
+	LoginFailureWindow      time.Duration
+	LoginLockout            time.Duration
+
+	// OpenID Connect single sign-on, enabled by OIDC_ISSUER_URL.
+	// OIDC_ROLE_MAPPING maps provider groups to roles: "staff-admins=admin,staff=user"
+	OIDCIssuerURL    string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCScopes       []string
+	OIDCGroupsClaim  string
+	OIDCRoleMapping  map[string]string
+	OIDCDefaultRole  string
+
+	// how long role permissions are cached before changes made elsewhere show up
+	PermissionCacheTTL time.Duration
+
+	// default lifetime of api keys issued without expires_in_days
+	APIKeyTTL time.Duration
+
+	// how long responses to requests with an Idempotency-Key are replayed,
+	// and how long a request may run before a retry can take its key over
+	IdempotencyTTL  time.Duration
+	IdempotencyLock time.Duration
+
+	// how long users, complaint lists and messages stay cached
+	CacheTTL time.Duration
+	// how many values each instance keeps in process, and for how long at
+	// most, in front of redis
+	LocalCacheSize int64
+	LocalCacheTTL  time.Duration
+	// redis is skipped for RedisCooldown after RedisFailureThreshold failed
+	// calls in a row, each cache call may take RedisTimeout
+	RedisFailureThreshold int64
+	RedisCooldown         time.Duration
+	RedisTimeout          time.Duration
+
+	// language model, AI_PROVIDER is "openai" or "mock"; unset it is openai
+	// when OPENAI_API_KEY is set and mock otherwise. AI_BASE_URL may point at
+	// any OpenAI compatible server.
+	AIProvider       string
+	AIBaseURL        string
+	OpenAIAPIKey     string
+	AIChatModel      string
+	AIEmbeddingModel string
+	AITimeout        time.Duration
+	AIMaxRetries     int64
+	AIRetryBackoff   time.Duration
+
+	// new complaints are triaged into TRIAGE_CATEGORIES; suggestions at least
+	// TRIAGE_AUTO_APPLY_THRESHOLD confident are applied without review
+	TriageCategories         []string
+	TriageAutoApplyThreshold float64
 }
 
 func LoadConfig() *Config {
@@ -51,9 +173,176 @@ func LoadConfig() *Config {
 		panic(appErrors.ErrInvalidPayload.New("port must be a number"))
 	}
 
+	uploadDir := os.Getenv("UPLOAD_DIR")
+	if uploadDir == "" {
+		uploadDir = "uploads"
+	}
+
 	return &Config{
 		DBUrl:      dbUrl,
 		JWTSecret:  jwtSecret,
 		ServerPort: serverPort,
+		UploadDir:  uploadDir,
+
+		LegacyUploadDir: getEnv("LEGACY_UPLOAD_DIR", "uploads_doc"),
+
+		StorageBackend: os.Getenv("STORAGE_BACKEND"),
+		S3Endpoint:     os.Getenv("S3_ENDPOINT"),
+		S3Region:       os.Getenv("S3_REGION"),
+		S3Bucket:       os.Getenv("S3_BUCKET"),
+		S3AccessKey:    os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey:    os.Getenv("S3_SECRET_KEY"),
+		S3UsePathStyle: os.Getenv("S3_USE_PATH_STYLE") != "false",
+
+		UploadMaxBytesUser:  getEnvInt64("UPLOAD_MAX_BYTES_USER", 10<<20),
+		UploadMaxBytesAdmin: getEnvInt64("UPLOAD_MAX_BYTES_ADMIN", 25<<20),
+		UploadAllowedTypes:  getEnvList("UPLOAD_ALLOWED_TYPES"),
+		Scanner:             os.Getenv("SCANNER"),
+		ClamAVAddr:          os.Getenv("CLAMAV_ADDR"),
+
+		DownloadURLSecret: getEnv("DOWNLOAD_URL_SECRET", jwtSecret),
+		DownloadURLTTL:    getEnvDuration("DOWNLOAD_URL_TTL", 15*time.Minute),
+
+		AccessTokenTTL:  getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL: getEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+
+		JWTIssuer:         getEnv("JWT_ISSUER", "complaingo"),
+		JWTAudience:       getEnv("JWT_AUDIENCE", "complaingo-api"),
+		JWTSigningKeyFile: os.Getenv("JWT_SIGNING_KEY_FILE"),
+		JWTVerifyKeyFiles: getEnvList("JWT_VERIFY_KEY_FILES"),
+
+		QuotaBytesUser:  getEnvInt64("QUOTA_BYTES_USER", 100<<20),
+		QuotaBytesAdmin: getEnvInt64("QUOTA_BYTES_ADMIN", 1<<30),
+
+		Mailer:       os.Getenv("MAILER"),
+		MailFrom:     getEnv("MAIL_FROM", "no-reply@complaingo.local"),
+		MailDir:      getEnv("MAIL_DIR", "mail"),
+		SMTPHost:     os.Getenv("SMTP_HOST"),
+		SMTPPort:     getEnv("SMTP_PORT", "587"),
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+
+		AppBaseURL:       getEnv("APP_BASE_URL", "http://localhost:8090"),
+		EmailVerifyTTL:   getEnvDuration("EMAIL_VERIFY_TTL", 48*time.Hour),
+		PasswordResetTTL: getEnvDuration("PASSWORD_RESET_TTL", time.Hour),
+		InviteTTL:        getEnvDuration("INVITE_TTL", 7*24*time.Hour),
+
+		MFAIssuer:        getEnv("MFA_ISSUER", "Complaingo"),
+		MFAChallengeTTL:  getEnvDuration("MFA_CHALLENGE_TTL", 5*time.Minute),
+		MFARequiredRoles: getEnvList("MFA_REQUIRED_ROLES"),
+		MFAEncryptionKey: getEnv("MFA_ENCRYPTION_KEY", jwtSecret),
+
+		LoginMaxAccountFailures: int(getEnvInt64("LOGIN_MAX_ACCOUNT_FAILURES", 10)),
+		LoginMaxIPFailures:      int(getEnvInt64("LOGIN_MAX_IP_FAILURES", 100)),
+		LoginBackoffAfter:       int(getEnvInt64("LOGIN_BACKOFF_AFTER", 3)),
+		LoginBackoffBase:        getEnvDuration("LOGIN_BACKOFF_BASE", time.Second),
+		LoginBackoffMax:         getEnvDuration("LOGIN_BACKOFF_MAX", time.Minute),
+		LoginFailureWindow:      getEnvDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		LoginLockout:            getEnvDuration("LOGIN_LOCKOUT", 15*time.Minute),
+
+		OIDCIssuerURL:    os.Getenv("OIDC_ISSUER_URL"),
+		OIDCClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		OIDCClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		OIDCRedirectURL:  getEnv("OIDC_REDIRECT_URL", "http://localhost:8090/auth/oidc/callback"),
+		OIDCScopes:       getEnvList("OIDC_SCOPES"),
+		OIDCGroupsClaim:  getEnv("OIDC_GROUPS_CLAIM", "groups"),
+		OIDCRoleMapping:  getEnvMap("OIDC_ROLE_MAPPING"),
+		OIDCDefaultRole:  getEnv("OIDC_DEFAULT_ROLE", "user"),
+
+		PermissionCacheTTL: getEnvDuration("PERMISSION_CACHE_TTL", time.Minute),
+
+		APIKeyTTL: getEnvDuration("API_KEY_TTL", 90*24*time.Hour),
+
+		IdempotencyTTL:  getEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+		IdempotencyLock: getEnvDuration("IDEMPOTENCY_LOCK", time.Minute),
+
+		CacheTTL:              getEnvDuration("CACHE_TTL", 10*time.Minute),
+		LocalCacheSize:        getEnvInt64("LOCAL_CACHE_SIZE", 10000),
+		LocalCacheTTL:         getEnvDuration("LOCAL_CACHE_TTL", 30*time.Second),
+		RedisFailureThreshold: getEnvInt64("REDIS_FAILURE_THRESHOLD", 5),
+		RedisCooldown:         getEnvDuration("REDIS_COOLDOWN", 30*time.Second),
+		RedisTimeout:          getEnvDuration("REDIS_TIMEOUT", 200*time.Millisecond),
+
+		AIProvider:       os.Getenv("AI_PROVIDER"),
+		AIBaseURL:        getEnv("AI_BASE_URL", "https://api.openai.com/v1"),
+		OpenAIAPIKey:     os.Getenv("OPENAI_API_KEY"),
+		AIChatModel:      getEnv("AI_CHAT_MODEL", "gpt-3.5-turbo"),
+		AIEmbeddingModel: getEnv("AI_EMBEDDING_MODEL", "text-embedding-3-small"),
+		AITimeout:        getEnvDuration("AI_TIMEOUT", 30*time.Second),
+		AIMaxRetries:     getEnvInt64("AI_MAX_RETRIES", 2),
+		AIRetryBackoff:   getEnvDuration("AI_RETRY_BACKOFF", 500*time.Millisecond),
+
+		TriageCategories:         getEnvList("TRIAGE_CATEGORIES"),
+		TriageAutoApplyThreshold: getEnvFloat("TRIAGE_AUTO_APPLY_THRESHOLD", 0.85),
+	}
+}
+
+func getEnv(key, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
+
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		panic(appErrors.ErrInvalidPayload.New("%s must be a duration such as 15m", key))
+	}
+	return d
+}
+
+func getEnvInt64(key string, def int64) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		panic(appErrors.ErrInvalidPayload.New("%s must be a number", key))
+	}
+	return n
+}
+
+func getEnvFloat(key string, def float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		panic(appErrors.ErrInvalidPayload.New("%s must be a number", key))
+	}
+	return f
+}
+
+// getEnvList splits a comma separated variable, ignoring empty items.
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvMap reads comma separated key=value pairs.
+func getEnvMap(key string) map[string]string {
+	m := make(map[string]string)
+	for _, item := range getEnvList(key) {
+		k, v, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			panic(appErrors.ErrInvalidPayload.New("%s must be a list of key=value pairs", key))
+		}
+		m[strings.TrimSpace(k)] = strings.TrimSpace(v)
 	}
+	return m
 }
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS attachments (
+    id BIGSERIAL PRIMARY KEY,
+    uploaded_by BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+    complaint_id BIGINT REFERENCES complaints(id) ON DELETE CASCADE,
+    message_id BIGINT REFERENCES complaint_messages(id) ON DELETE CASCADE,
+    document_id INT REFERENCES documents(id) ON DELETE CASCADE,
+    file_name TEXT NOT NULL,
+    file_path TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    sha256 CHAR(64) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachments_complaint_id ON attachments(complaint_id);
+CREATE INDEX IF NOT EXISTS idx_attachments_message_id ON attachments(message_id);
+CREATE INDEX IF NOT EXISTS idx_attachments_document_id ON attachments(document_id);
+CREATE INDEX IF NOT EXISTS idx_attachments_user_id ON attachments(user_id);
@@ -0,0 +1,7 @@
+UPDATE documents SET storage_key = 'uploads_doc/' || substring(storage_key FROM 8)
+WHERE storage_key LIKE 'legacy/%';
+UPDATE documents SET storage_key = 'uploads/' || storage_key WHERE storage_key NOT LIKE 'uploads_doc/%';
+UPDATE attachments SET storage_key = 'uploads/' || storage_key;
+
+ALTER TABLE attachments RENAME COLUMN storage_key TO file_path;
+ALTER TABLE documents RENAME COLUMN storage_key TO file_path;
@@ -0,0 +1,13 @@
+-- documents and attachments reference blobs by storage key instead of a host path
+ALTER TABLE documents RENAME COLUMN file_path TO storage_key;
+ALTER TABLE attachments RENAME COLUMN file_path TO storage_key;
+
+-- files written by the attachment service live directly under the upload dir
+UPDATE attachments SET storage_key = regexp_replace(storage_key, '^(\./)?uploads/', '');
+UPDATE documents SET storage_key = regexp_replace(storage_key, '^(\./)?uploads/', '');
+
+-- documents uploaded before attachments existed were written to uploads_doc/
+-- with the raw client file name; the local store reads legacy/ keys from
+-- LEGACY_UPLOAD_DIR until the files are moved to <UPLOAD_DIR>/legacy/
+UPDATE documents SET storage_key = 'legacy/' || regexp_replace(storage_key, '^(\./)?uploads_doc/', '')
+WHERE storage_key ~ '^(\./)?uploads_doc/';
@@ -0,0 +1,8 @@
+ALTER TABLE users DROP COLUMN IF EXISTS storage_quota_bytes;
+
+DROP TABLE IF EXISTS document_versions;
+
+ALTER TABLE documents
+    DROP COLUMN IF EXISTS current_version,
+    DROP COLUMN IF EXISTS mime_type,
+    DROP COLUMN IF EXISTS size_bytes;
@@ -0,0 +1,35 @@
+ALTER TABLE documents
+    ADD COLUMN IF NOT EXISTS current_version INT NOT NULL DEFAULT 1,
+    ADD COLUMN IF NOT EXISTS mime_type TEXT NOT NULL DEFAULT 'application/octet-stream',
+    ADD COLUMN IF NOT EXISTS size_bytes BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS document_versions (
+    id BIGSERIAL PRIMARY KEY,
+    document_id INT NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    file_name TEXT NOT NULL,
+    storage_key TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    sha256 TEXT NOT NULL DEFAULT '',
+    uploaded_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    restored_from INT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (document_id, version)
+);
+
+-- per user override of the role quota, NULL means use the role default
+ALTER TABLE users ADD COLUMN IF NOT EXISTS storage_quota_bytes BIGINT;
+
+-- existing documents become version 1 of themselves
+UPDATE documents d
+SET mime_type = a.mime_type, size_bytes = a.size_bytes
+FROM attachments a
+WHERE a.document_id = d.id AND a.storage_key = d.storage_key;
+
+INSERT INTO document_versions (document_id, version, file_name, storage_key, mime_type, size_bytes, sha256, uploaded_by, created_at)
+SELECT d.id, 1, d.file_name, d.storage_key, d.mime_type, d.size_bytes,
+    COALESCE((SELECT a.sha256 FROM attachments a WHERE a.document_id = d.id AND a.storage_key = d.storage_key LIMIT 1), ''),
+    d.user_id, COALESCE(d.uploaded_at, NOW())
+FROM documents d
+ON CONFLICT DO NOTHING;
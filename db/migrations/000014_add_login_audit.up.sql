@@ -0,0 +1,16 @@
+-- every login attempt, kept for admins investigating account abuse.
+-- user_id is NULL when the email matched no account.
+CREATE TABLE IF NOT EXISTS login_audit (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INT REFERENCES users(id) ON DELETE SET NULL,
+    email TEXT NOT NULL,
+    success BOOLEAN NOT NULL,
+    reason TEXT NOT NULL,
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_audit_user_id ON login_audit(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_login_audit_email ON login_audit(email, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_login_audit_ip ON login_audit(ip, created_at DESC);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+ALTER TABLE roles DROP COLUMN IF EXISTS built_in;
+ALTER TABLE roles DROP COLUMN IF EXISTS description;
@@ -0,0 +1,51 @@
+-- roles get a description, and the ones the app relies on are marked built in
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS built_in BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE roles SET built_in = TRUE WHERE name IN ('admin', 'user');
+
+-- the catalogue of permissions a role can be granted
+CREATE TABLE IF NOT EXISTS permissions (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id INT NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission TEXT NOT NULL REFERENCES permissions(name) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission)
+);
+
+INSERT INTO permissions (name, description) VALUES
+    ('complaint:create', 'File complaints'),
+    ('complaint:read:own', 'List own complaints'),
+    ('complaint:read:any', 'List and read every complaint'),
+    ('complaint:resolve', 'Mark own complaints resolved'),
+    ('complaint:update_status', 'Change the status of any complaint'),
+    ('complaint:message', 'Post and read messages and attachments on accessible complaints'),
+    ('document:write', 'Upload and manage own documents'),
+    ('document:read:any', 'Read every document and storage usage'),
+    ('document:manage:any', 'Change and delete every document'),
+    ('user:read', 'List and read users'),
+    ('user:update', 'Update users'),
+    ('user:delete', 'Delete users'),
+    ('user:unlock', 'Lift login lockouts'),
+    ('role:assign', 'Change the role of users'),
+    ('role:manage', 'Create, change and delete roles'),
+    ('audit:read', 'Read the login audit log'),
+    ('ai:ask', 'Use the AI assistant')
+ON CONFLICT DO NOTHING;
+
+-- admins can do everything except file and close complaints of their own
+INSERT INTO role_permissions (role_id, permission)
+SELECT r.id, p.name FROM roles r CROSS JOIN permissions p
+WHERE r.name = 'admin' AND p.name NOT IN ('complaint:create', 'complaint:read:own', 'complaint:resolve')
+ON CONFLICT DO NOTHING;
+
+-- users keep what the hard coded checks allowed them
+INSERT INTO role_permissions (role_id, permission)
+SELECT r.id, p.name FROM roles r CROSS JOIN permissions p
+WHERE r.name = 'user' AND p.name IN (
+    'complaint:create', 'complaint:read:own', 'complaint:resolve', 'complaint:message',
+    'document:write', 'user:read', 'ai:ask'
+)
+ON CONFLICT DO NOTHING;
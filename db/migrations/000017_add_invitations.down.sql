@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS invitations;
+DELETE FROM permissions WHERE name = 'user:invite';
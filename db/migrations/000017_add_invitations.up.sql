@@ -0,0 +1,22 @@
+-- invitations to join with a role, the mailed token is stored as a sha256 hash
+CREATE TABLE IF NOT EXISTS invitations (
+    id BIGSERIAL PRIMARY KEY,
+    email TEXT NOT NULL,
+    role_id INT NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    invited_by INT REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    accepted_at TIMESTAMPTZ,
+    accepted_user_id INT REFERENCES users(id) ON DELETE SET NULL,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_invitations_email ON invitations(email);
+
+INSERT INTO permissions (name, description) VALUES ('user:invite', 'Invite people to join with a role')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT id, 'user:invite' FROM roles WHERE name = 'admin'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,4 @@
+-- deactivated users can't log in; anonymized ones had their personal data
+-- scrubbed but keep their complaints for reporting
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deactivated_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS anonymized_at TIMESTAMPTZ;
@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS version;
+ALTER TABLE complaints DROP COLUMN IF EXISTS version;
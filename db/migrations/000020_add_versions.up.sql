@@ -0,0 +1,3 @@
+-- bumped on every change, sent as the ETag and checked against If-Match
+ALTER TABLE complaints ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
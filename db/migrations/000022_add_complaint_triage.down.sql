@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS complaint_triage_decisions;
+DROP TABLE IF EXISTS complaint_triage_suggestions;
+ALTER TABLE complaints DROP COLUMN IF EXISTS category;
+ALTER TABLE complaints DROP COLUMN IF EXISTS priority;
+ALTER TABLE complaints DROP COLUMN IF EXISTS sentiment;
+ALTER TABLE complaints DROP COLUMN IF EXISTS language;
+DELETE FROM permissions WHERE name = 'complaint:triage';
@@ -0,0 +1,43 @@
+-- what triage settled on for each complaint, empty until it or an admin decides
+ALTER TABLE complaints ADD COLUMN IF NOT EXISTS category TEXT NOT NULL DEFAULT '';
+ALTER TABLE complaints ADD COLUMN IF NOT EXISTS priority TEXT NOT NULL DEFAULT '';
+ALTER TABLE complaints ADD COLUMN IF NOT EXISTS sentiment TEXT NOT NULL DEFAULT '';
+ALTER TABLE complaints ADD COLUMN IF NOT EXISTS language TEXT NOT NULL DEFAULT '';
+
+-- the model's latest suggestion for each field of a complaint, with its
+-- status: pending, auto_applied, accepted or overridden
+CREATE TABLE IF NOT EXISTS complaint_triage_suggestions (
+    id BIGSERIAL PRIMARY KEY,
+    complaint_id INT NOT NULL REFERENCES complaints(id) ON DELETE CASCADE,
+    field TEXT NOT NULL,
+    value TEXT NOT NULL,
+    confidence REAL NOT NULL,
+    model TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    decided_at TIMESTAMPTZ,
+    UNIQUE (complaint_id, field)
+);
+
+-- every admin decision on a suggestion, kept to measure how often the model is right
+CREATE TABLE IF NOT EXISTS complaint_triage_decisions (
+    id BIGSERIAL PRIMARY KEY,
+    complaint_id INT NOT NULL REFERENCES complaints(id) ON DELETE CASCADE,
+    field TEXT NOT NULL,
+    suggested_value TEXT NOT NULL,
+    confidence REAL NOT NULL,
+    auto_applied BOOLEAN NOT NULL,
+    final_value TEXT NOT NULL,
+    decision TEXT NOT NULL,
+    decided_by INT REFERENCES users(id) ON DELETE SET NULL,
+    decided_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_complaint_triage_decisions_field ON complaint_triage_decisions(field);
+
+INSERT INTO permissions (name, description) VALUES ('complaint:triage', 'Review AI triage suggestions')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT id, 'complaint:triage' FROM roles WHERE name = 'admin'
+ON CONFLICT DO NOTHING;
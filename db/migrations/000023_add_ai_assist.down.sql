@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS ai_usage;
+DROP TABLE IF EXISTS knowledge_entries;
+DELETE FROM permissions WHERE name = 'knowledge:manage';
@@ -0,0 +1,36 @@
+-- canned responses and knowledge base articles drafted replies draw on; the
+-- embedding is computed on first use, and again when the model changes
+CREATE TABLE IF NOT EXISTS knowledge_entries (
+    id SERIAL PRIMARY KEY,
+    kind TEXT NOT NULL CHECK (kind IN ('canned_response', 'article')),
+    title TEXT NOT NULL,
+    body TEXT NOT NULL,
+    embedding DOUBLE PRECISION[],
+    embedding_model TEXT NOT NULL DEFAULT '',
+    created_by INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_knowledge_entries_kind ON knowledge_entries(kind);
+
+-- tokens spent on each request to the model
+CREATE TABLE IF NOT EXISTS ai_usage (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INT REFERENCES users(id) ON DELETE SET NULL,
+    complaint_id INT REFERENCES complaints(id) ON DELETE SET NULL,
+    feature TEXT NOT NULL,
+    model TEXT NOT NULL,
+    prompt_tokens INT NOT NULL DEFAULT 0,
+    completion_tokens INT NOT NULL DEFAULT 0,
+    total_tokens INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_ai_usage_created_at ON ai_usage(created_at);
+
+INSERT INTO permissions (name, description) VALUES ('knowledge:manage', 'Manage canned responses and knowledge base articles')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT id, 'knowledge:manage' FROM roles WHERE name = 'admin'
+ON CONFLICT DO NOTHING;
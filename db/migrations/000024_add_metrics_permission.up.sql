@@ -0,0 +1,7 @@
+-- /debug/vars exposes runtime and cache internals, only admins read it
+INSERT INTO permissions (name, description) VALUES ('metrics:read', 'Read runtime metrics on /debug/vars')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT id, 'metrics:read' FROM roles WHERE name = 'admin'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,133 @@
+package ai
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	mockModel     = "mock"
+	mockDimension = 64
+)
+
+// MockProvider answers without any network, the same way every time, so AI
+// features work offline and in tests. Features register how to answer their
+// requests with On. Embeddings hash the words of each input, so texts
+// sharing words end up close to each other.
+type MockProvider struct {
+	// Reply, when set, decides the answer to any other request
+	Reply func(req ChatRequest) string
+
+	mu      sync.RWMutex
+	replies map[string]func(req ChatRequest) string
+}
+
+func NewMockProvider() *MockProvider {
+	return &MockProvider{replies: make(map[string]func(req ChatRequest) string)}
+}
+
+// On answers requests made for purpose with reply.
+func (m *MockProvider) On(purpose string, reply func(req ChatRequest) string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.replies[purpose] = reply
+}
+
+func (m *MockProvider) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	answer := m.answer(req)
+	return &ChatResponse{Content: answer, Model: mockModel, Usage: mockUsage(req, answer)}, nil
+}
+
+func (m *MockProvider) ChatStream(ctx context.Context, req ChatRequest, onDelta func(delta string) error) (*ChatResponse, error) {
+	answer := m.answer(req)
+	for _, word := range strings.SplitAfter(answer, " ") {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := onDelta(word); err != nil {
+			return nil, err
+		}
+	}
+	return &ChatResponse{Content: answer, Model: mockModel, Usage: mockUsage(req, answer)}, nil
+}
+
+func (m *MockProvider) Embed(ctx context.Context, inputs []string) (*EmbeddingResponse, error) {
+	res := &EmbeddingResponse{Model: mockModel, Vectors: make([][]float64, len(inputs))}
+	for i, input := range inputs {
+		vector := make([]float64, mockDimension)
+		words := mockWords(input)
+		for _, w := range words {
+			h := fnv.New32a()
+			h.Write([]byte(w))
+			vector[h.Sum32()%mockDimension]++
+		}
+		normalize(vector)
+		res.Vectors[i] = vector
+		res.Usage.PromptTokens += len(words)
+	}
+	res.Usage.TotalTokens = res.Usage.PromptTokens
+	return res, nil
+}
+
+func (m *MockProvider) answer(req ChatRequest) string {
+	m.mu.RLock()
+	reply, ok := m.replies[req.Purpose]
+	m.mu.RUnlock()
+	if ok {
+		return reply(req)
+	}
+	if m.Reply != nil {
+		return m.Reply(req)
+	}
+	if req.JSON {
+		return "{}"
+	}
+
+	var prompt string
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == RoleUser {
+			prompt = req.Messages[i].Content
+			break
+		}
+	}
+	prompt = strings.Join(strings.Fields(prompt), " ")
+	if runes := []rune(prompt); len(runes) > 200 {
+		prompt = string(runes[:200]) + "..."
+	}
+	return "Mock answer to: " + prompt
+}
+
+// mockUsage counts words as tokens, near enough for tests.
+func mockUsage(req ChatRequest, answer string) Usage {
+	var usage Usage
+	for _, msg := range req.Messages {
+		usage.PromptTokens += len(strings.Fields(msg.Content))
+	}
+	usage.CompletionTokens = len(strings.Fields(answer))
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+func mockWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func normalize(v []float64) {
+	var sum float64
+	for _, x := range v {
+		sum += x * x
+	}
+	if sum == 0 {
+		return
+	}
+	norm := math.Sqrt(sum)
+	for i := range v {
+		v[i] /= norm
+	}
+}
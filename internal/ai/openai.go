@@ -0,0 +1,298 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+const defaultBaseURL = "https://api.openai.com/v1"
+
+// OpenAIProvider talks to the OpenAI API, or anything compatible with it.
+type OpenAIProvider struct {
+	cfg    Config
+	client *http.Client
+}
+
+func NewOpenAIProvider(cfg Config) *OpenAIProvider {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = defaultBaseURL
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	if cfg.ChatModel == "" {
+		cfg.ChatModel = "gpt-3.5-turbo"
+	}
+	if cfg.EmbeddingModel == "" {
+		cfg.EmbeddingModel = "text-embedding-3-small"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = 500 * time.Millisecond
+	}
+
+	// streams may take longer than Timeout, but must start within it
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = cfg.Timeout
+	return &OpenAIProvider{cfg: cfg, client: &http.Client{Transport: transport}}
+}
+
+type responseFormat struct {
+	Type string `json:"type"`
+}
+
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type chatCompletionRequest struct {
+	Model          string          `json:"model"`
+	Messages       []Message       `json:"messages"`
+	MaxTokens      int             `json:"max_tokens,omitempty"`
+	Temperature    *float64        `json:"temperature,omitempty"`
+	ResponseFormat *responseFormat `json:"response_format,omitempty"`
+	Stream         bool            `json:"stream,omitempty"`
+	StreamOptions  *streamOptions  `json:"stream_options,omitempty"`
+}
+
+type chatCompletionResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message Message `json:"message"`
+		Delta   Message `json:"delta"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+}
+
+type embeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type embeddingResponse struct {
+	Model string `json:"model"`
+	Data  []struct {
+		Index     int       `json:"index"`
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+	Usage Usage `json:"usage"`
+}
+
+func (p *OpenAIProvider) completionRequest(req ChatRequest, stream bool) chatCompletionRequest {
+	body := chatCompletionRequest{
+		Model:       p.cfg.ChatModel,
+		Messages:    req.Messages,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		Stream:      stream,
+	}
+	if req.JSON {
+		body.ResponseFormat = &responseFormat{Type: "json_object"}
+	}
+	if stream {
+		body.StreamOptions = &streamOptions{IncludeUsage: true}
+	}
+	return body
+}
+
+func (p *OpenAIProvider) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	var res chatCompletionResponse
+	err := p.post(ctx, "/chat/completions", p.completionRequest(req, false), false, func(body io.Reader) error {
+		return decode(body, &res)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Choices) == 0 {
+		return nil, appErrors.ErrUpstreamFailure.New("ai provider returned no choices")
+	}
+
+	out := &ChatResponse{Content: res.Choices[0].Message.Content, Model: res.Model}
+	if res.Usage != nil {
+		out.Usage = *res.Usage
+	}
+	return out, nil
+}
+
+func (p *OpenAIProvider) ChatStream(ctx context.Context, req ChatRequest, onDelta func(delta string) error) (*ChatResponse, error) {
+	out := &ChatResponse{Model: p.cfg.ChatModel}
+	var content strings.Builder
+	err := p.post(ctx, "/chat/completions", p.completionRequest(req, true), true, func(body io.Reader) error {
+		// server-sent events, one "data: {chunk}" line each, "data: [DONE]" at the end
+		lines := bufio.NewScanner(body)
+		lines.Buffer(make([]byte, 64<<10), 1<<20)
+		for lines.Scan() {
+			data, ok := strings.CutPrefix(lines.Text(), "data:")
+			if !ok {
+				continue
+			}
+			data = strings.TrimSpace(data)
+			if data == "[DONE]" {
+				return nil
+			}
+
+			var chunk chatCompletionResponse
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				return appErrors.ErrUpstreamFailure.Wrap(err, "invalid stream chunk from ai provider")
+			}
+			if chunk.Model != "" {
+				out.Model = chunk.Model
+			}
+			if chunk.Usage != nil {
+				out.Usage = *chunk.Usage
+			}
+			if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+				continue
+			}
+			delta := chunk.Choices[0].Delta.Content
+			content.WriteString(delta)
+			if err := onDelta(delta); err != nil {
+				return err
+			}
+		}
+		if err := lines.Err(); err != nil {
+			return appErrors.ErrUpstreamFailure.Wrap(err, "ai provider stream broke off")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out.Content = content.String()
+	return out, nil
+}
+
+func (p *OpenAIProvider) Embed(ctx context.Context, inputs []string) (*EmbeddingResponse, error) {
+	var res embeddingResponse
+	err := p.post(ctx, "/embeddings", embeddingRequest{Model: p.cfg.EmbeddingModel, Input: inputs}, false, func(body io.Reader) error {
+		return decode(body, &res)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Data) != len(inputs) {
+		return nil, appErrors.ErrUpstreamFailure.New("ai provider returned %d embeddings for %d inputs", len(res.Data), len(inputs))
+	}
+
+	sort.Slice(res.Data, func(i, j int) bool { return res.Data[i].Index < res.Data[j].Index })
+	out := &EmbeddingResponse{Model: res.Model, Usage: res.Usage, Vectors: make([][]float64, len(res.Data))}
+	for i, d := range res.Data {
+		out.Vectors[i] = d.Embedding
+	}
+	return out, nil
+}
+
+// post sends body to path and hands a successful response to read. Network
+// errors, 429 and 5xx are retried with backoff; nothing is retried once read
+// has started, so a stream never repeats itself.
+func (p *OpenAIProvider) post(ctx context.Context, path string, body any, stream bool, read func(io.Reader) error) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	var wait time.Duration
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			if wait < p.cfg.RetryBackoff<<(attempt-1) {
+				wait = p.cfg.RetryBackoff << (attempt - 1)
+			}
+			select {
+			case <-ctx.Done():
+				return appErrors.ErrUpstreamFailure.Wrap(ctx.Err(), "ai provider request cancelled")
+			case <-time.After(wait):
+			}
+		}
+
+		var retry bool
+		wait, retry, err = p.attempt(ctx, path, payload, stream, read)
+		if err == nil || !retry || attempt >= p.cfg.MaxRetries {
+			return err
+		}
+	}
+}
+
+// attempt makes one request, and says whether its failure is worth retrying
+// and how long the provider asked to wait first.
+func (p *OpenAIProvider) attempt(ctx context.Context, path string, payload []byte, stream bool, read func(io.Reader) error) (time.Duration, bool, error) {
+	reqCtx := ctx
+	if !stream {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithTimeout(ctx, p.cfg.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, p.cfg.BaseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.cfg.APIKey)
+	}
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		// the caller giving up isn't worth retrying, our own timeout is
+		return 0, ctx.Err() == nil, appErrors.ErrUpstreamFailure.Wrap(err, "ai provider request failed")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		wait := retryAfter(res.Header.Get("Retry-After"))
+		return wait, res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500, statusError(res, wait)
+	}
+	return 0, false, read(res.Body)
+}
+
+func statusError(res *http.Response, wait time.Duration) error {
+	raw, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	msg := strings.TrimSpace(string(raw))
+	var apiErr struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(raw, &apiErr) == nil && apiErr.Error.Message != "" {
+		msg = apiErr.Error.Message
+	}
+
+	if res.StatusCode == http.StatusTooManyRequests {
+		err := appErrors.ErrTooManyRequests.New("ai provider rate limit: %s", msg)
+		if wait > 0 {
+			err = err.WithProperty(appErrors.RetryAfter, wait)
+		}
+		return err
+	}
+	return appErrors.ErrUpstreamFailure.New("ai provider returned %d: %s", res.StatusCode, msg)
+}
+
+func decode(body io.Reader, v any) error {
+	if err := json.NewDecoder(body).Decode(v); err != nil {
+		return appErrors.ErrUpstreamFailure.Wrap(err, "invalid response from ai provider")
+	}
+	return nil
+}
+
+// retryAfter reads a Retry-After header given in seconds.
+func retryAfter(header string) time.Duration {
+	seconds, err := strconv.Atoi(strings.TrimSpace(header))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
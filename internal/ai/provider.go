@@ -0,0 +1,95 @@
+package ai
+
+import (
+	"context"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type ChatRequest struct {
+	// Purpose names the feature asking, such as "triage"; the mock provider
+	// answers by it
+	Purpose  string
+	Messages []Message
+	// zero values leave the provider's defaults
+	MaxTokens   int
+	Temperature *float64
+	// JSON asks for a single JSON object as the answer
+	JSON bool
+}
+
+// Usage is what a call cost, in tokens.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type ChatResponse struct {
+	Content string `json:"content"`
+	Model   string `json:"model"`
+	Usage   Usage  `json:"usage"`
+}
+
+type EmbeddingResponse struct {
+	Vectors [][]float64 `json:"vectors"`
+	Model   string      `json:"model"`
+	Usage   Usage       `json:"usage"`
+}
+
+// LLMProvider talks to a large language model.
+type LLMProvider interface {
+	Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error)
+	// ChatStream calls onDelta with each part of the answer as it arrives,
+	// and returns the whole of it. An error from onDelta stops the stream.
+	ChatStream(ctx context.Context, req ChatRequest, onDelta func(delta string) error) (*ChatResponse, error)
+	// Embed returns one vector per input, in order.
+	Embed(ctx context.Context, inputs []string) (*EmbeddingResponse, error)
+}
+
+type Config struct {
+	Kind           string // "openai" or "mock"; empty picks openai when APIKey is set
+	BaseURL        string // any OpenAI compatible API, e.g. a local model server
+	APIKey         string
+	ChatModel      string
+	EmbeddingModel string
+	Timeout        time.Duration // per attempt, until the first byte for streams
+	MaxRetries     int           // extra attempts on network errors, 429 and 5xx
+	RetryBackoff   time.Duration // wait before the first retry, doubled for each next one
+}
+
+// New returns the provider selected by AI_PROVIDER.
+func New(cfg Config) (LLMProvider, error) {
+	kind := cfg.Kind
+	if kind == "" {
+		kind = "mock"
+		if cfg.APIKey != "" {
+			kind = "openai"
+		}
+	}
+
+	switch kind {
+	case "openai":
+		// local model servers usually don't want a key, api.openai.com does
+		if cfg.APIKey == "" && (cfg.BaseURL == "" || cfg.BaseURL == defaultBaseURL) {
+			return nil, appErrors.ErrInvalidPayload.New("openai provider needs OPENAI_API_KEY")
+		}
+		return NewOpenAIProvider(cfg), nil
+	case "mock":
+		return NewMockProvider(), nil
+	default:
+		return nil, appErrors.ErrInvalidPayload.New("unknown ai provider %q", cfg.Kind)
+	}
+}
@@ -0,0 +1,61 @@
+package assist
+
+import (
+	"Complaingo/internal/ai"
+	"fmt"
+	"strings"
+)
+
+// MockSummary answers summary requests for the mock provider from the
+// rendered thread, so summaries work offline and in tests.
+func MockSummary(req ai.ChatRequest) string {
+	thread := lastMessage(req, ai.RoleUser)
+	subject, _ := field(thread, "Subject: ")
+
+	var count int
+	var last string
+	for _, line := range strings.Split(thread, "\n") {
+		if strings.HasPrefix(line, "[customer ") || strings.HasPrefix(line, "[agent ") {
+			count++
+			last = strings.TrimPrefix(strings.Fields(line)[0], "[")
+		}
+	}
+	if count == 0 {
+		return fmt.Sprintf("The customer complains about %q. Nobody has replied yet.", subject)
+	}
+	return fmt.Sprintf("The customer complains about %q. Messages in the thread: %d, the latest from the %s.", subject, count, last)
+}
+
+// MockReply answers reply requests for the mock provider with the best
+// matching canned response, or a generic acknowledgement without one.
+func MockReply(req ai.ChatRequest) string {
+	subject, _ := field(lastMessage(req, ai.RoleUser), "Subject: ")
+	body := fmt.Sprintf("Thank you for reaching out about %q. We are looking into it and will get back to you shortly.", subject)
+
+	_, canned, _ := strings.Cut(lastMessage(req, ai.RoleSystem), "<canned_responses>\n")
+	canned, _, _ = strings.Cut(canned, "</canned_responses>")
+	if _, entry, ok := strings.Cut(canned, "<entry "); ok {
+		_, entry, _ = strings.Cut(entry, ">\n")
+		body, _, _ = strings.Cut(entry, "\n</entry>")
+	}
+	return "Hello,\n\n" + body + "\n\nKind regards,\nCustomer Support"
+}
+
+func lastMessage(req ai.ChatRequest, role string) string {
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == role {
+			return req.Messages[i].Content
+		}
+	}
+	return ""
+}
+
+// field returns the rest of the first line starting with prefix.
+func field(text, prefix string) (string, bool) {
+	for _, line := range strings.Split(text, "\n") {
+		if rest, ok := strings.CutPrefix(line, prefix); ok {
+			return rest, true
+		}
+	}
+	return "", false
+}
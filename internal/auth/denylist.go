@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"Complaingo/internal/breaker"
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Denylist revokes access tokens before they expire. Single tokens are keyed
+// on their jti claim; RevokeUser invalidates every token a user was issued
+// before a point in time (logout everywhere, account deletion).
+type Denylist interface {
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+	RevokeUser(ctx context.Context, userID int, before time.Time, ttl time.Duration) error
+	RevokedBefore(ctx context.Context, userID int) (time.Time, error)
+}
+
+// RedisDenylist shares revocations between every instance of the service.
+// Entries expire with the tokens they cover, so the set stays small.
+type RedisDenylist struct {
+	client *redis.Client
+}
+
+func NewRedisDenylist(client *redis.Client) *RedisDenylist {
+	return &RedisDenylist{client: client}
+}
+
+func (d *RedisDenylist) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	if err := d.client.Set(ctx, "auth:denylist:"+jti, 1, ttl).Err(); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to revoke token")
+	}
+	return nil
+}
+
+func (d *RedisDenylist) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	n, err := d.client.Exists(ctx, "auth:denylist:"+jti).Result()
+	if err != nil {
+		return false, appErrors.ErrDbFailure.Wrap(err, "failed to check token denylist")
+	}
+	return n > 0, nil
+}
+
+// legacyCutoffMillis tells cutoffs stored in seconds from those stored in
+// milliseconds: as milliseconds it is 1973, as seconds the year 5138.
+const legacyCutoffMillis = 100_000_000_000
+
+func (d *RedisDenylist) RevokeUser(ctx context.Context, userID int, before time.Time, ttl time.Duration) error {
+	key := fmt.Sprintf("auth:revoked_before:%d", userID)
+	if err := d.client.Set(ctx, key, before.UnixMilli(), ttl).Err(); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to revoke user tokens")
+	}
+	return nil
+}
+
+func (d *RedisDenylist) RevokedBefore(ctx context.Context, userID int) (time.Time, error) {
+	raw, err := d.client.Get(ctx, fmt.Sprintf("auth:revoked_before:%d", userID)).Result()
+	if err == redis.Nil {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, appErrors.ErrDbFailure.Wrap(err, "failed to check user revocation")
+	}
+	millis, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return time.Time{}, appErrors.ErrDbFailure.Wrap(err, "invalid user revocation entry")
+	}
+	// entries written before cutoffs had millisecond precision are in
+	// seconds; round them up so nothing issued in that second gets through
+	if millis < legacyCutoffMillis {
+		return time.Unix(millis+1, 0), nil
+	}
+	return time.UnixMilli(millis), nil
+}
+
+// MemoryDenylist keeps revocations in process. It is only suitable for a
+// single instance, e.g. local development and tests without Redis.
+type MemoryDenylist struct {
+	mu    sync.Mutex
+	jtis  map[string]time.Time
+	users map[int]memoryCutoff
+	now   func() time.Time
+}
+
+type memoryCutoff struct {
+	before    time.Time
+	expiresAt time.Time
+}
+
+func NewMemoryDenylist() *MemoryDenylist {
+	return &MemoryDenylist{
+		jtis:  make(map[string]time.Time),
+		users: make(map[int]memoryCutoff),
+		now:   time.Now,
+	}
+}
+
+func (d *MemoryDenylist) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.jtis[jti] = expiresAt
+	return nil
+}
+
+func (d *MemoryDenylist) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	expiresAt, ok := d.jtis[jti]
+	if ok && d.now().After(expiresAt) {
+		delete(d.jtis, jti)
+		return false, nil
+	}
+	return ok, nil
+}
+
+func (d *MemoryDenylist) RevokeUser(ctx context.Context, userID int, before time.Time, ttl time.Duration) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// iat has millisecond precision, like cutoffs kept in redis
+	before = before.Truncate(time.Millisecond)
+	d.users[userID] = memoryCutoff{before: before, expiresAt: d.now().Add(ttl)}
+	return nil
+}
+
+func (d *MemoryDenylist) RevokedBefore(ctx context.Context, userID int) (time.Time, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cutoff, ok := d.users[userID]
+	if !ok {
+		return time.Time{}, nil
+	}
+	if d.now().After(cutoff.expiresAt) {
+		delete(d.users, userID)
+		return time.Time{}, nil
+	}
+	return cutoff.before, nil
+}
+
+// FallbackDenylist keeps revocations in primary, normally Redis, and in
+// fallback while breaker skips primary or primary fails, so that an outage
+// doesn't refuse every request. Checks read both; revocations kept only in
+// the primary aren't seen during an outage. Those made meanwhile are written
+// to primary once it is back.
+type FallbackDenylist struct {
+	primary  Denylist
+	fallback Denylist
+	breaker  *breaker.Breaker
+
+	mu      sync.Mutex
+	pending []func(ctx context.Context) error
+}
+
+func NewFallbackDenylist(primary, fallback Denylist, b *breaker.Breaker) *FallbackDenylist {
+	d := &FallbackDenylist{primary: primary, fallback: fallback, breaker: b}
+	b.OnRecover(func() {
+		go d.flush(context.Background())
+	})
+	return d
+}
+
+func (d *FallbackDenylist) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	err := d.write(ctx, func(ctx context.Context) error {
+		return d.primary.Revoke(ctx, jti, expiresAt)
+	})
+	if err != nil {
+		return d.fallback.Revoke(ctx, jti, expiresAt)
+	}
+	return nil
+}
+
+func (d *FallbackDenylist) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	if revoked, err := d.fallback.IsRevoked(ctx, jti); err != nil || revoked {
+		return revoked, err
+	}
+
+	var revoked bool
+	d.breaker.Call(ctx, func(ctx context.Context) (err error) {
+		revoked, err = d.primary.IsRevoked(ctx, jti)
+		return err
+	})
+	return revoked, nil
+}
+
+func (d *FallbackDenylist) RevokeUser(ctx context.Context, userID int, before time.Time, ttl time.Duration) error {
+	err := d.write(ctx, func(ctx context.Context) error {
+		return d.primary.RevokeUser(ctx, userID, before, ttl)
+	})
+	if err != nil {
+		return d.fallback.RevokeUser(ctx, userID, before, ttl)
+	}
+	return nil
+}
+
+// RevokedBefore is the later of the two cutoffs.
+func (d *FallbackDenylist) RevokedBefore(ctx context.Context, userID int) (time.Time, error) {
+	before, err := d.fallback.RevokedBefore(ctx, userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var shared time.Time
+	err = d.breaker.Call(ctx, func(ctx context.Context) (err error) {
+		shared, err = d.primary.RevokedBefore(ctx, userID)
+		return err
+	})
+	if err == nil && shared.After(before) {
+		before = shared
+	}
+	return before, nil
+}
+
+// write runs fn against primary, and keeps it for later when it can't.
+func (d *FallbackDenylist) write(ctx context.Context, fn func(ctx context.Context) error) error {
+	err := d.breaker.Call(ctx, fn)
+	if err != nil {
+		d.mu.Lock()
+		d.pending = append(d.pending, fn)
+		d.mu.Unlock()
+	}
+	return err
+}
+
+func (d *FallbackDenylist) flush(ctx context.Context) {
+	d.mu.Lock()
+	pending := d.pending
+	d.pending = nil
+	d.mu.Unlock()
+
+	for _, fn := range pending {
+		d.write(ctx, fn)
+	}
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key is an asymmetric key used to sign or verify access tokens. Private is
+// nil for keys that are only kept to verify tokens signed before a rotation.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.PrivateKey
+	Public  crypto.PublicKey
+}
+
+// JWK is the public half of a key as published in the JWKS document.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// LoadKeyFile reads a PEM encoded RSA or Ed25519 key, private or public.
+func LoadKeyFile(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, appErrors.ErrInvalidPayload.Wrap(err, "failed to read key file %s", path)
+	}
+	return ParseKeyPEM(data)
+}
+
+// ParseKeyPEM accepts PKCS#8 and PKCS#1 private keys and PKIX public keys.
+// The key id is the RFC 7638 thumbprint, so every instance derives the same
+// kid from the same key without extra configuration.
+func ParseKeyPEM(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, appErrors.ErrInvalidPayload.New("no PEM block found in key")
+	}
+
+	var parsed any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, appErrors.ErrInvalidPayload.New("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, appErrors.ErrInvalidPayload.Wrap(err, "failed to parse key")
+	}
+
+	return NewKey(parsed)
+}
+
+// NewKey wraps an RSA or Ed25519 key, private or public.
+func NewKey(k any) (*Key, error) {
+	key := &Key{}
+	switch k := k.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, appErrors.ErrInvalidPayload.New("unsupported key type %T, use RSA or Ed25519", k)
+	}
+
+	if rsaKey, ok := key.Public.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < 2048 {
+		return nil, appErrors.ErrInvalidPayload.New("RSA keys must be at least 2048 bits")
+	}
+
+	key.ID = key.thumbprint()
+	return key, nil
+}
+
+func (k *Key) JWK() JWK {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+	switch pub := k.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = b64(pub.N.Bytes())
+		jwk.E = b64(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = b64(pub)
+	}
+	return jwk
+}
+
+// thumbprint hashes the required JWK members in lexical order (RFC 7638).
+func (k *Key) thumbprint() string {
+	jwk := k.JWK()
+
+	var members any
+	if jwk.Kty == "RSA" {
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	} else {
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return b64(sum[:])
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
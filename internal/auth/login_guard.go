@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+// LoginPolicy sets how hard failed logins are punished.
+type LoginPolicy struct {
+	// failures before an account or an IP address is locked out
+	MaxAccountFailures int
+	MaxIPFailures      int
+	// after BackoffAfter failures an account waits BackoffBase, doubling with
+	// every further failure up to BackoffMax
+	BackoffAfter int
+	BackoffBase  time.Duration
+	BackoffMax   time.Duration
+	// failures are forgotten after Window without one; a lockout lasts Lockout
+	Window  time.Duration
+	Lockout time.Duration
+}
+
+// LoginGuard throttles password guessing per account and per IP address.
+// Accounts back off exponentially and lock after a few failures; an IP is
+// only locked, at a higher threshold, since many users can share one.
+type LoginGuard struct {
+	counter FailureCounter
+	policy  LoginPolicy
+	now     func() time.Time
+}
+
+func NewLoginGuard(counter FailureCounter, policy LoginPolicy) *LoginGuard {
+	return &LoginGuard{counter: counter, policy: policy, now: time.Now}
+}
+
+// Check refuses an attempt while the account or IP is locked or backing off.
+// It runs before the password is checked, so unknown emails are throttled
+// exactly like real ones.
+func (g *LoginGuard) Check(ctx context.Context, email, ip string) error {
+	account, err := g.counter.Get(ctx, accountKey(email))
+	if err != nil {
+		return err
+	}
+	if account.LockedFor > 0 {
+		return appErrors.ErrAccountLocked.New("account is temporarily locked after too many failed logins").
+			WithProperty(appErrors.RetryAfter, account.LockedFor)
+	}
+	if wait := account.Last.Add(g.Backoff(account.Count)).Sub(g.now()); wait > 0 {
+		return tooManyRequests("too many failed logins, try again later", wait)
+	}
+
+	if ip == "" {
+		return nil
+	}
+	addr, err := g.counter.Get(ctx, ipKey(ip))
+	if err != nil {
+		return err
+	}
+	if addr.LockedFor > 0 {
+		return tooManyRequests("too many failed logins from this address", addr.LockedFor)
+	}
+	return nil
+}
+
+// Fail records a failed attempt and reports whether it locked the account.
+func (g *LoginGuard) Fail(ctx context.Context, email, ip string) (bool, error) {
+	now := g.now()
+
+	count, err := g.counter.Add(ctx, accountKey(email), now, g.policy.Window)
+	if err != nil {
+		return false, err
+	}
+	locked := count >= g.policy.MaxAccountFailures
+	if locked {
+		if err := g.counter.Lock(ctx, accountKey(email), g.policy.Lockout); err != nil {
+			return false, err
+		}
+	}
+
+	if ip != "" {
+		count, err := g.counter.Add(ctx, ipKey(ip), now, g.policy.Window)
+		if err != nil {
+			return locked, err
+		}
+		if count >= g.policy.MaxIPFailures {
+			if err := g.counter.Lock(ctx, ipKey(ip), g.policy.Lockout); err != nil {
+				return locked, err
+			}
+		}
+	}
+	return locked, nil
+}
+
+// Succeed clears the account's failures. The IP keeps its count, otherwise
+// an attacker could reset it by logging into an account of their own.
+func (g *LoginGuard) Succeed(ctx context.Context, email string) error {
+	return g.counter.Reset(ctx, accountKey(email))
+}
+
+// Unlock lifts a lockout and forgets the failures, for admins.
+func (g *LoginGuard) Unlock(ctx context.Context, email string) error {
+	return g.counter.Reset(ctx, accountKey(email))
+}
+
+func (g *LoginGuard) UnlockIP(ctx context.Context, ip string) error {
+	return g.counter.Reset(ctx, ipKey(ip))
+}
+
+// Backoff is how long an account waits after its n-th consecutive failure.
+func (g *LoginGuard) Backoff(failures int) time.Duration {
+	if failures < g.policy.BackoffAfter || g.policy.BackoffBase <= 0 {
+		return 0
+	}
+
+	d := g.policy.BackoffBase
+	for i := g.policy.BackoffAfter; i < failures && d < g.policy.BackoffMax; i++ {
+		d *= 2
+	}
+	if g.policy.BackoffMax > 0 && d > g.policy.BackoffMax {
+		d = g.policy.BackoffMax
+	}
+	return d
+}
+
+func tooManyRequests(msg string, wait time.Duration) error {
+	return appErrors.ErrTooManyRequests.New(msg).WithProperty(appErrors.RetryAfter, wait)
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
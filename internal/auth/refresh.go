@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+// NewOpaqueToken returns a random token for the client and the hash to
+// store. Only the hash is persisted, so a database leak exposes no tokens.
+func NewOpaqueToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", appErrors.ErrDbFailure.Wrap(err, "failed to generate token")
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewID returns a random identifier for jti claims and session families.
+func NewID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", appErrors.ErrDbFailure.Wrap(err, "failed to generate id")
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+// SecretBox encrypts small secrets, such as TOTP seeds, before they are
+// stored. Unlike tokens they must be readable again, so hashing won't do.
+type SecretBox struct {
+	aead cipher.AEAD
+}
+
+// NewSecretBox derives an AES-256-GCM key from the passphrase.
+func NewSecretBox(passphrase string) (*SecretBox, error) {
+	if passphrase == "" {
+		return nil, appErrors.ErrInvalidPayload.New("secret box needs a key")
+	}
+
+	key := sha256.Sum256([]byte(passphrase))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, appErrors.ErrInvalidPayload.Wrap(err, "failed to create cipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, appErrors.ErrInvalidPayload.Wrap(err, "failed to create cipher")
+	}
+	return &SecretBox{aead: aead}, nil
+}
+
+func (b *SecretBox) Seal(plaintext string) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", appErrors.ErrDbFailure.Wrap(err, "failed to generate nonce")
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (b *SecretBox) Open(ciphertext string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(raw) < b.aead.NonceSize() {
+		return "", appErrors.ErrDbFailure.New("stored secret is malformed")
+	}
+
+	n := b.aead.NonceSize()
+	plain, err := b.aead.Open(nil, raw[:n], raw[n:], nil)
+	if err != nil {
+		return "", appErrors.ErrDbFailure.Wrap(err, "failed to decrypt stored secret")
+	}
+	return string(plain), nil
+}
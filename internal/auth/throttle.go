@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"Complaingo/internal/breaker"
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// FailureState is what a FailureCounter knows about one key.
+type FailureState struct {
+	Count     int
+	Last      time.Time
+	LockedFor time.Duration
+}
+
+// FailureCounter tracks failed logins per key, such as an account or an IP
+// address. Counts expire after a quiet window; locks expire on their own.
+type FailureCounter interface {
+	Get(ctx context.Context, key string) (FailureState, error)
+	Add(ctx context.Context, key string, now time.Time, window time.Duration) (int, error)
+	Lock(ctx context.Context, key string, d time.Duration) error
+	Reset(ctx context.Context, key string) error
+}
+
+// RedisFailureCounter shares counts between instances, so spreading attempts
+// over several of them doesn't help an attacker.
+type RedisFailureCounter struct {
+	client *redis.Client
+}
+
+func NewRedisFailureCounter(client *redis.Client) *RedisFailureCounter {
+	return &RedisFailureCounter{client: client}
+}
+
+func (c *RedisFailureCounter) Get(ctx context.Context, key string) (FailureState, error) {
+	var fields *redis.MapStringStringCmd
+	var lock *redis.DurationCmd
+	_, err := c.client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		fields = p.HGetAll(ctx, "auth:login:fail:"+key)
+		lock = p.PTTL(ctx, "auth:login:lock:"+key)
+		return nil
+	})
+	if err != nil {
+		return FailureState{}, appErrors.ErrDbFailure.Wrap(err, "failed to read login failures")
+	}
+
+	var state FailureState
+	state.Count, _ = strconv.Atoi(fields.Val()["count"])
+	if ms, err := strconv.ParseInt(fields.Val()["last"], 10, 64); err == nil {
+		state.Last = time.UnixMilli(ms)
+	}
+	if ttl := lock.Val(); ttl > 0 {
+		state.LockedFor = ttl
+	}
+	return state, nil
+}
+
+func (c *RedisFailureCounter) Add(ctx context.Context, key string, now time.Time, window time.Duration) (int, error) {
+	k := "auth:login:fail:" + key
+	var count *redis.IntCmd
+	_, err := c.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		count = p.HIncrBy(ctx, k, "count", 1)
+		p.HSet(ctx, k, "last", now.UnixMilli())
+		p.PExpire(ctx, k, window)
+		return nil
+	})
+	if err != nil {
+		return 0, appErrors.ErrDbFailure.Wrap(err, "failed to record login failure")
+	}
+	return int(count.Val()), nil
+}
+
+func (c *RedisFailureCounter) Lock(ctx context.Context, key string, d time.Duration) error {
+	if err := c.client.Set(ctx, "auth:login:lock:"+key, 1, d).Err(); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to lock login")
+	}
+	return nil
+}
+
+func (c *RedisFailureCounter) Reset(ctx context.Context, key string) error {
+	if err := c.client.Del(ctx, "auth:login:fail:"+key, "auth:login:lock:"+key).Err(); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to reset login failures")
+	}
+	return nil
+}
+
+// MemoryFailureCounter is the single instance fallback when Redis is not
+// connected, like MemoryDenylist.
+type MemoryFailureCounter struct {
+	mu      sync.Mutex
+	entries map[string]*memoryFailures
+	now     func() time.Time
+}
+
+type memoryFailures struct {
+	count       int
+	last        time.Time
+	expiresAt   time.Time
+	lockedUntil time.Time
+}
+
+func NewMemoryFailureCounter() *MemoryFailureCounter {
+	return &MemoryFailureCounter{
+		entries: make(map[string]*memoryFailures),
+		now:     time.Now,
+	}
+}
+
+func (c *MemoryFailureCounter) Get(ctx context.Context, key string) (FailureState, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := c.entry(key)
+	if e == nil {
+		return FailureState{}, nil
+	}
+
+	state := FailureState{Last: e.last}
+	now := c.now()
+	if now.Before(e.expiresAt) {
+		state.Count = e.count
+	}
+	if now.Before(e.lockedUntil) {
+		state.LockedFor = e.lockedUntil.Sub(now)
+	}
+	return state, nil
+}
+
+func (c *MemoryFailureCounter) Add(ctx context.Context, key string, now time.Time, window time.Duration) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := c.entry(key)
+	if e == nil {
+		e = &memoryFailures{}
+		c.entries[key] = e
+	}
+	if c.now().After(e.expiresAt) {
+		e.count = 0
+	}
+	e.count++
+	e.last = now
+	e.expiresAt = c.now().Add(window)
+	return e.count, nil
+}
+
+func (c *MemoryFailureCounter) Lock(ctx context.Context, key string, d time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := c.entry(key)
+	if e == nil {
+		e = &memoryFailures{}
+		c.entries[key] = e
+	}
+	e.lockedUntil = c.now().Add(d)
+	return nil
+}
+
+func (c *MemoryFailureCounter) Reset(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+	return nil
+}
+
+// entry drops keys whose count and lock have both run out.
+func (c *MemoryFailureCounter) entry(key string) *memoryFailures {
+	e, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	now := c.now()
+	if now.After(e.expiresAt) && now.After(e.lockedUntil) {
+		delete(c.entries, key)
+		return nil
+	}
+	return e
+}
+
+// FallbackFailureCounter counts in primary, normally Redis, and in fallback
+// while breaker skips primary or primary fails, so logins stay throttled,
+// per instance, during an outage. Locks set meanwhile outlast it.
+type FallbackFailureCounter struct {
+	primary  FailureCounter
+	fallback FailureCounter
+	breaker  *breaker.Breaker
+}
+
+func NewFallbackFailureCounter(primary, fallback FailureCounter, b *breaker.Breaker) *FallbackFailureCounter {
+	return &FallbackFailureCounter{primary: primary, fallback: fallback, breaker: b}
+}
+
+func (c *FallbackFailureCounter) Get(ctx context.Context, key string) (FailureState, error) {
+	local, err := c.fallback.Get(ctx, key)
+	if err != nil {
+		return FailureState{}, err
+	}
+
+	var state FailureState
+	err = c.breaker.Call(ctx, func(ctx context.Context) (err error) {
+		state, err = c.primary.Get(ctx, key)
+		return err
+	})
+	if err != nil {
+		return local, nil
+	}
+	state.LockedFor = max(state.LockedFor, local.LockedFor)
+	return state, nil
+}
+
+func (c *FallbackFailureCounter) Add(ctx context.Context, key string, now time.Time, window time.Duration) (int, error) {
+	var count int
+	err := c.breaker.Call(ctx, func(ctx context.Context) (err error) {
+		count, err = c.primary.Add(ctx, key, now, window)
+		return err
+	})
+	if err != nil {
+		return c.fallback.Add(ctx, key, now, window)
+	}
+	return count, nil
+}
+
+func (c *FallbackFailureCounter) Lock(ctx context.Context, key string, d time.Duration) error {
+	err := c.breaker.Call(ctx, func(ctx context.Context) error {
+		return c.primary.Lock(ctx, key, d)
+	})
+	if err != nil {
+		return c.fallback.Lock(ctx, key, d)
+	}
+	return nil
+}
+
+// Reset clears key in both, the fallback may hold a lock from an outage.
+func (c *FallbackFailureCounter) Reset(ctx context.Context, key string) error {
+	if err := c.fallback.Reset(ctx, key); err != nil {
+		return err
+	}
+	c.breaker.Call(ctx, func(ctx context.Context) error {
+		return c.primary.Reset(ctx, key)
+	})
+	return nil
+}
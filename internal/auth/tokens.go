@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims carried by every access token. The user id travels in sub.
+type Claims struct {
+	Role  string `json:"role"`
+	Email string `json:"email,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func (c *Claims) UserID() (int, error) {
+	id, err := strconv.Atoi(c.Subject)
+	if err != nil || id < 1 {
+		return 0, appErrors.ErrUnauthorized.New("invalid token subject")
+	}
+	return id, nil
+}
+
+// AccessToken is a signed JWT together with the claims needed to revoke it.
+type AccessToken struct {
+	Token     string
+	JTI       string
+	ExpiresAt time.Time
+}
+
+type TokenConfig struct {
+	Issuer   string
+	Audience string
+	// Secret signs HS256 tokens when no SigningKey is configured. It is meant
+	// for development and tests: HS256 tokens can't be verified by the gateway.
+	Secret     string
+	SigningKey *Key
+	// VerifyKeys are retired keys still accepted while their tokens expire.
+	VerifyKeys []*Key
+	Leeway     time.Duration
+}
+
+// TokenService issues and verifies access tokens. With an asymmetric signing
+// key every token names its key in the kid header, so keys can be rotated by
+// adding the new key, switching the signing key, and dropping the old one
+// once its tokens have expired.
+type TokenService struct {
+	issuer   string
+	audience string
+	secret   []byte
+	signer   *Key
+	keys     map[string]*Key
+	leeway   time.Duration
+	now      func() time.Time
+}
+
+func init() {
+	// iat down to the millisecond, so that a token issued right after a
+	// RevokeUser cutoff can be told from one issued just before it
+	jwt.TimePrecision = time.Millisecond
+}
+
+func NewTokenService(cfg TokenConfig) (*TokenService, error) {
+	if cfg.Issuer == "" || cfg.Audience == "" {
+		return nil, appErrors.ErrInvalidPayload.New("token issuer and audience are required")
+	}
+
+	s := &TokenService{
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+		keys:     make(map[string]*Key),
+		leeway:   cfg.Leeway,
+		now:      time.Now,
+	}
+
+	if cfg.SigningKey != nil {
+		if cfg.SigningKey.Private == nil {
+			return nil, appErrors.ErrInvalidPayload.New("signing key %s has no private part", cfg.SigningKey.ID)
+		}
+		s.signer = cfg.SigningKey
+		s.keys[cfg.SigningKey.ID] = cfg.SigningKey
+	} else {
+		if cfg.Secret == "" {
+			return nil, appErrors.ErrInvalidPayload.New("a signing key or HS256 secret is required")
+		}
+		s.secret = []byte(cfg.Secret)
+	}
+
+	for _, k := range cfg.VerifyKeys {
+		s.keys[k.ID] = k
+	}
+
+	return s, nil
+}
+
+// Issue signs an access token for the user valid for ttl.
+func (s *TokenService) Issue(userID int, email, role string, ttl time.Duration) (*AccessToken, error) {
+	claims := &Claims{Role: role, Email: email}
+	return s.sign(userID, s.audience, ttl, &claims.RegisteredClaims, claims)
+}
+
+// Parse verifies the signature, issuer, audience and lifetime of a token.
+func (s *TokenService) Parse(tokenStr string) (*Claims, error) {
+	claims := &Claims{}
+	if err := s.parse(tokenStr, s.audience, claims, &claims.RegisteredClaims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// ChallengeClaims are carried by the token handed out between the password
+// and the second factor. Enroll is set when the user still has to set up 2FA.
+type ChallengeClaims struct {
+	Enroll bool `json:"mfa_enroll,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func (c *ChallengeClaims) UserID() (int, error) {
+	id, err := strconv.Atoi(c.Subject)
+	if err != nil || id < 1 {
+		return 0, appErrors.ErrUnauthorized.New("invalid token subject")
+	}
+	return id, nil
+}
+
+// IssueChallenge signs an MFA challenge token. It uses its own audience, so
+// it is never accepted as an access token and vice versa.
+func (s *TokenService) IssueChallenge(userID int, enroll bool, ttl time.Duration) (*AccessToken, error) {
+	claims := &ChallengeClaims{Enroll: enroll}
+	return s.sign(userID, s.challengeAudience(), ttl, &claims.RegisteredClaims, claims)
+}
+
+func (s *TokenService) ParseChallenge(tokenStr string) (*ChallengeClaims, error) {
+	claims := &ChallengeClaims{}
+	if err := s.parse(tokenStr, s.challengeAudience(), claims, &claims.RegisteredClaims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (s *TokenService) challengeAudience() string {
+	return s.audience + ":mfa"
+}
+
+// sign fills the registered claims and signs the full claims value.
+func (s *TokenService) sign(userID int, audience string, ttl time.Duration, registered *jwt.RegisteredClaims, claims jwt.Claims) (*AccessToken, error) {
+	jti, err := NewID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	expiresAt := now.Add(ttl)
+	*registered = jwt.RegisteredClaims{
+		Subject:   strconv.Itoa(userID),
+		Issuer:    s.issuer,
+		Audience:  jwt.ClaimStrings{audience},
+		ID:        jti,
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}
+
+	var signed string
+	if s.signer != nil {
+		token := jwt.NewWithClaims(s.signer.Method, claims)
+		token.Header["kid"] = s.signer.ID
+		signed, err = token.SignedString(s.signer.Private)
+	} else {
+		signed, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	}
+	if err != nil {
+		return nil, appErrors.ErrUnauthorized.Wrap(err, "Failed to sign JWT token")
+	}
+
+	return &AccessToken{Token: signed, JTI: jti, ExpiresAt: expiresAt}, nil
+}
+
+func (s *TokenService) parse(tokenStr, audience string, claims jwt.Claims, registered *jwt.RegisteredClaims) error {
+	_, err := jwt.ParseWithClaims(tokenStr, claims, s.keyFunc,
+		jwt.WithValidMethods(s.methods()),
+		jwt.WithIssuer(s.issuer),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(s.leeway),
+		jwt.WithTimeFunc(s.now),
+	)
+	if err != nil {
+		return appErrors.ErrUnauthorized.Wrap(err, "Invalid or expired token")
+	}
+	if registered.ID == "" {
+		return appErrors.ErrUnauthorized.New("token has no jti")
+	}
+
+	return nil
+}
+
+func (s *TokenService) keyFunc(token *jwt.Token) (any, error) {
+	if s.signer == nil {
+		return s.secret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, appErrors.ErrUnauthorized.New("unknown signing key %q", kid)
+	}
+	// a key only verifies tokens made with its own algorithm
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, appErrors.ErrUnauthorized.New("algorithm %s does not match key %q", token.Method.Alg(), kid)
+	}
+	return key.Public, nil
+}
+
+func (s *TokenService) methods() []string {
+	if s.signer == nil {
+		return []string{jwt.SigningMethodHS256.Alg()}
+	}
+
+	seen := map[string]bool{}
+	var methods []string
+	for _, k := range s.keys {
+		if alg := k.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
+
+// JWKS publishes the asymmetric verification keys. A shared HS256 secret is
+// never published, so in that mode the set is empty.
+func (s *TokenService) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, k := range s.keys {
+		set.Keys = append(set.Keys, k.JWK())
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
@@ -0,0 +1,116 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned by Call while the breaker skips calls.
+var ErrOpen = errors.New("circuit breaker open")
+
+// Breaker stops calling a dependency, such as Redis, after threshold
+// failures in a row. Once cooldown has passed a single call is let through
+// to probe it; success closes the breaker again and runs the OnRecover
+// hooks. One breaker can guard every user of the dependency, so they all
+// fall back together.
+type Breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+	timeout   time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	open      bool
+	retryAt   time.Time
+	onRecover []func()
+	now       func() time.Time
+}
+
+// New builds a breaker for the dependency called name, whose calls through
+// Call may take timeout each.
+func New(name string, threshold int, cooldown, timeout time.Duration) *Breaker {
+	return &Breaker{name: name, threshold: threshold, cooldown: cooldown, timeout: timeout, now: time.Now}
+}
+
+// OnRecover adds fn to what runs when the breaker closes again.
+func (b *Breaker) OnRecover(fn func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.onRecover = append(b.onRecover, fn)
+}
+
+// Call runs fn unless the breaker is open, and records its outcome. The
+// caller giving up doesn't count as a failure of the dependency, so fn runs
+// with ctx's values but only the breaker's timeout.
+func (b *Breaker) Call(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !b.Allow() {
+		return ErrOpen
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), b.timeout)
+	defer cancel()
+
+	err := fn(ctx)
+	if b.Record(err) {
+		log.Printf("%s: failing (%v), skipped for %s", b.name, err, b.cooldown)
+	}
+	return err
+}
+
+// Allow reports whether the dependency should be called now.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.open {
+		return true
+	}
+	now := b.now()
+	if now.Before(b.retryAt) {
+		return false
+	}
+	// the probe; everyone else waits for its outcome
+	b.retryAt = now.Add(b.cooldown)
+	return true
+}
+
+// Record feeds the outcome of a call that Allow let through, and reports
+// whether that call opened the breaker.
+func (b *Breaker) Record(err error) bool {
+	b.mu.Lock()
+	if err == nil {
+		recovered := b.open
+		b.failures = 0
+		b.open = false
+		hooks := b.onRecover
+		b.mu.Unlock()
+		if recovered {
+			log.Printf("%s: back", b.name)
+			for _, fn := range hooks {
+				fn()
+			}
+		}
+		return false
+	}
+	defer b.mu.Unlock()
+
+	b.failures++
+	opened := !b.open && b.failures >= b.threshold
+	if b.failures >= b.threshold {
+		b.open = true
+		b.retryAt = b.now().Add(b.cooldown)
+	}
+	return opened
+}
+
+// Open reports whether the dependency is currently being skipped.
+func (b *Breaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.open
+}
@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Store is where cached values live, shared between instances or not.
+//
+// Tags are invalidated by giving them a new version. Keys embed the versions
+// of their tags, so entries written for an old version are never read again
+// and simply expire, even when a slow load writes after the invalidation.
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// TagVersions returns the current version of each tag, "" for tags that
+	// were never invalidated.
+	TagVersions(ctx context.Context, tags []string) ([]string, error)
+	BumpTags(ctx context.Context, tags ...string) error
+}
+
+// Cache stores JSON encoded values in a Store and loads each missing key only
+// once, however many requests ask for it at the same time. A failing store
+// is logged and skipped; the data is loaded from the source instead. A nil
+// Cache caches nothing.
+type Cache struct {
+	store Store
+	ttl   time.Duration
+	group singleflight.Group
+}
+
+// New caches values in store for ttl.
+func New(store Store, ttl time.Duration) *Cache {
+	return &Cache{store: store, ttl: ttl}
+}
+
+// GetOrLoad returns the value cached under key, or loads, caches and returns
+// it. Every caller gets its own copy.
+func GetOrLoad[T any](ctx context.Context, c *Cache, key Key, load func(ctx context.Context) (T, error)) (T, error) {
+	var value T
+	if c == nil {
+		return load(ctx)
+	}
+
+	full, err := c.fullKey(ctx, key)
+	if err != nil {
+		log.Printf("cache: failed to read tags of %s: %v", key.name, err)
+		return load(ctx)
+	}
+
+	raw, err, _ := c.group.Do(full, func() (interface{}, error) {
+		raw, ok, err := c.store.Get(ctx, full)
+		if err != nil {
+			log.Printf("cache: failed to get %s: %v", key.name, err)
+		}
+		if ok {
+			return raw, nil
+		}
+
+		// waiting callers share this load, so one of them leaving must not cancel it
+		count("loads")
+		loaded, err := load(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+		raw, err = json.Marshal(loaded)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.store.Set(ctx, full, raw, c.ttl); err != nil {
+			log.Printf("cache: failed to set %s: %v", key.name, err)
+		}
+		return raw, nil
+	})
+	if err != nil {
+		return value, err
+	}
+
+	if err := json.Unmarshal(raw.([]byte), &value); err != nil {
+		return value, err
+	}
+	return value, nil
+}
+
+// Invalidate drops every entry tagged with one of tags. Errors are only
+// logged: the entries still expire with their ttl.
+func (c *Cache) Invalidate(ctx context.Context, tags ...string) {
+	if c == nil || len(tags) == 0 {
+		return
+	}
+	if err := c.store.BumpTags(ctx, tags...); err != nil {
+		log.Printf("cache: failed to invalidate %v: %v", tags, err)
+	}
+}
+
+func (c *Cache) fullKey(ctx context.Context, key Key) (string, error) {
+	if len(key.tags) == 0 {
+		return key.name, nil
+	}
+	versions, err := c.store.TagVersions(ctx, key.tags)
+	if err != nil {
+		return "", err
+	}
+	return key.name + "@" + strings.Join(versions, "."), nil
+}
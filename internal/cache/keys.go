@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Key names a cached value and the tags that invalidate it.
+type Key struct {
+	name string
+	tags []string
+}
+
+// NewKey joins parts with colons, like "complaints:user:7".
+func NewKey(parts ...any) Key {
+	s := make([]string, len(parts))
+	for i, p := range parts {
+		s[i] = fmt.Sprint(p)
+	}
+	return Key{name: strings.Join(s, ":")}
+}
+
+// With adds the parameters a value depends on, such as pagination and
+// filters, so every page gets its own entry.
+func (k Key) With(params any) Key {
+	raw, _ := json.Marshal(params)
+	sum := sha256.Sum256(raw)
+	k.name += ":" + hex.EncodeToString(sum[:8])
+	return k
+}
+
+// Tagged adds tags to invalidate the key with.
+func (k Key) Tagged(tags ...string) Key {
+	k.tags = append(append([]string(nil), k.tags...), tags...)
+	return k
+}
+
+func (k Key) String() string {
+	return k.name
+}
+
+// Tags shared by the keys below and the writes that invalidate them.
+
+func UserTag(id int) string {
+	return fmt.Sprintf("user:%d", id)
+}
+
+func UserComplaintsTag(userID int) string {
+	return fmt.Sprintf("complaints:user:%d", userID)
+}
+
+func MessagesTag(complaintID int) string {
+	return fmt.Sprintf("complaint:%d:messages", complaintID)
+}
+
+func UserKey(id int) Key {
+	return NewKey("user", id).Tagged(UserTag(id))
+}
+
+func UserComplaintsKey(userID int, params any) Key {
+	return NewKey("complaints", "user", userID).With(params).Tagged(UserComplaintsTag(userID))
+}
+
+func MessagesKey(complaintID int, params any) Key {
+	return NewKey("complaint", complaintID, "messages").With(params).Tagged(MessagesTag(complaintID))
+}
+
+// KnowledgeTag is bumped whenever canned responses or articles change.
+const KnowledgeTag = "knowledge"
+
+// AssistKey caches what the model wrote for a complaint thread, keyed by a
+// hash of the thread so any new message or edit asks again.
+func AssistKey(purpose string, complaintID int, thread any) Key {
+	return NewKey("ai", purpose, "complaint", complaintID).With(thread)
+}
@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MemoryStore keeps up to size values in process, dropping the least
+// recently used first. On its own it only suits a single instance; the
+// TieredStore puts one in front of Redis.
+type MemoryStore struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+	tags    map[string]memoryTag
+	now     func() time.Time
+}
+
+type memoryTag struct {
+	version string
+	seenAt  time.Time
+}
+
+type memoryEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+func NewMemoryStore(size int) *MemoryStore {
+	return &MemoryStore{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+		tags:    make(map[string]memoryTag),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	e := el.Value.(*memoryEntry)
+	if s.now().After(e.expiresAt) {
+		s.order.Remove(el)
+		delete(s.entries, key)
+		return nil, false, nil
+	}
+	s.order.MoveToFront(el)
+	return e.value, true, nil
+}
+
+func (s *MemoryStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := &memoryEntry{key: key, value: value, expiresAt: s.now().Add(ttl)}
+	if el, ok := s.entries[key]; ok {
+		el.Value = e
+		s.order.MoveToFront(el)
+		return nil
+	}
+	s.entries[key] = s.order.PushFront(e)
+	for s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return nil
+}
+
+func (s *MemoryStore) TagVersions(ctx context.Context, tags []string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versions := make([]string, len(tags))
+	for i, t := range tags {
+		versions[i] = s.tags[t].version
+	}
+	return versions, nil
+}
+
+func (s *MemoryStore) BumpTags(ctx context.Context, tags ...string) error {
+	version := newVersion()
+	for _, t := range tags {
+		s.setTag(t, version)
+	}
+	return nil
+}
+
+// Len is the number of values held, expired ones included until evicted.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.order.Len()
+}
+
+// knownTags returns the versions of tags this store has seen within maxAge,
+// and the indexes of those it hasn't.
+func (s *MemoryStore) knownTags(tags []string, maxAge time.Duration) ([]string, []int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versions := make([]string, len(tags))
+	var unknown []int
+	for i, t := range tags {
+		tag, ok := s.tags[t]
+		if !ok || s.now().Sub(tag.seenAt) > maxAge {
+			unknown = append(unknown, i)
+			continue
+		}
+		versions[i] = tag.version
+	}
+	return versions, unknown
+}
+
+func (s *MemoryStore) setTag(tag, version string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tags[tag] = memoryTag{version: version, seenAt: s.now()}
+}
+
+// clear forgets everything, for when invalidations may have been missed.
+func (s *MemoryStore) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.order.Init()
+	s.entries = make(map[string]*list.Element)
+	s.tags = make(map[string]memoryTag)
+}
+
+var versionSeq atomic.Int64
+
+// newVersion is unique across instances for all practical purposes.
+func newVersion() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatInt(versionSeq.Add(1), 36)
+}
@@ -0,0 +1,17 @@
+package cache
+
+import "expvar"
+
+// metrics counts hits and misses per tier, published as "cache" on
+// /debug/vars:
+//
+//	local_hits, local_misses  the in-process tier
+//	redis_hits, redis_misses  redis, asked after a local miss
+//	redis_errors              failed redis calls
+//	redis_skipped             calls not made while the breaker is open
+//	loads                     values loaded from the source
+var metrics = expvar.NewMap("cache")
+
+func count(name string) {
+	metrics.Add(name, 1)
+}
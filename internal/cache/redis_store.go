@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// tagTTL outlives any entry, so a tag that expires can't bring back entries
+// written under a version it had before.
+const tagTTL = 24 * time.Hour
+
+// invalidationChannel carries every tag bump to the other instances.
+const invalidationChannel = "cache:invalidations"
+
+type invalidation struct {
+	Version string   `json:"version"`
+	Tags    []string `json:"tags"`
+}
+
+// RedisStore shares cached values between every instance of the service, and
+// publishes its invalidations so they can drop what they keep in process.
+type RedisStore struct {
+	client *redis.Client
+}
+
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	raw, err := s.client.Get(ctx, "cache:"+key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, appErrors.ErrDbFailure.Wrap(err, "failed to read cache")
+	}
+	return raw, true, nil
+}
+
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := s.client.Set(ctx, "cache:"+key, value, ttl).Err(); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to write cache")
+	}
+	return nil
+}
+
+func (s *RedisStore) TagVersions(ctx context.Context, tags []string) ([]string, error) {
+	keys := make([]string, len(tags))
+	for i, t := range tags {
+		keys[i] = "cache:tag:" + t
+	}
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "failed to read cache tags")
+	}
+
+	versions := make([]string, len(values))
+	for i, v := range values {
+		versions[i], _ = v.(string)
+	}
+	return versions, nil
+}
+
+func (s *RedisStore) BumpTags(ctx context.Context, tags ...string) error {
+	version := newVersion()
+	message, err := json.Marshal(invalidation{Version: version, Tags: tags})
+	if err != nil {
+		return err
+	}
+	_, err = s.client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for _, t := range tags {
+			p.Set(ctx, "cache:tag:"+t, version, tagTTL)
+		}
+		p.Publish(ctx, invalidationChannel, message)
+		return nil
+	})
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to invalidate cache tags")
+	}
+	return nil
+}
+
+// Subscribe calls apply with every invalidation published from now on, this
+// instance's own included, until ctx is done. The subscription reconnects by
+// itself; what is published while it is down is missed.
+func (s *RedisStore) Subscribe(ctx context.Context, apply func(version string, tags []string)) {
+	sub := s.client.Subscribe(ctx, invalidationChannel)
+	go func() {
+		<-ctx.Done()
+		sub.Close()
+	}()
+	go func() {
+		for msg := range sub.Channel() {
+			var inv invalidation
+			if err := json.Unmarshal([]byte(msg.Payload), &inv); err != nil {
+				log.Printf("cache: ignoring invalidation %q: %v", msg.Payload, err)
+				continue
+			}
+			apply(inv.Version, inv.Tags)
+		}
+	}()
+}
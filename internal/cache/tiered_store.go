@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"Complaingo/internal/breaker"
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// Broadcaster is a shared Store that tells every instance about the tags it
+// invalidates.
+type Broadcaster interface {
+	Store
+	// Subscribe calls apply with the new version and tags of every
+	// invalidation, this instance's own included, until ctx is done.
+	Subscribe(ctx context.Context, apply func(version string, tags []string))
+}
+
+type TieredConfig struct {
+	// values and tag versions kept in process, and for how long at most
+	LocalSize int
+	LocalTTL  time.Duration
+	// the shared store is skipped by Breaker, which its other users share;
+	// without one it is skipped for Cooldown after FailureThreshold failed
+	// calls in a row, and each call may take Timeout
+	Breaker          *breaker.Breaker
+	FailureThreshold int
+	Cooldown         time.Duration
+	Timeout          time.Duration
+}
+
+// TieredStore keeps recently used values in process in front of a shared
+// store. Other instances' invalidations arrive through the shared store's
+// subscription; tag versions are also re-read after LocalTTL, which bounds
+// how stale an instance gets when it misses some.
+//
+// A failing shared store is skipped by a circuit breaker and the service
+// carries on with the local tier and the source. Tags invalidated meanwhile
+// are bumped in the shared store once it is back, and the local tier is
+// cleared since it may have missed invalidations from other instances.
+type TieredStore struct {
+	local   *MemoryStore
+	remote  Broadcaster
+	cfg     TieredConfig
+	breaker *breaker.Breaker
+
+	mu      sync.Mutex
+	pending map[string]struct{}
+}
+
+// NewTieredStore subscribes to remote's invalidations until ctx is done.
+func NewTieredStore(ctx context.Context, remote Broadcaster, cfg TieredConfig) *TieredStore {
+	s := &TieredStore{
+		local:   NewMemoryStore(cfg.LocalSize),
+		remote:  remote,
+		cfg:     cfg,
+		pending: make(map[string]struct{}),
+	}
+	s.breaker = cfg.Breaker
+	if s.breaker == nil {
+		s.breaker = breaker.New("cache", cfg.FailureThreshold, cfg.Cooldown, cfg.Timeout)
+	}
+	s.breaker.OnRecover(func() {
+		go s.recovered(context.WithoutCancel(ctx))
+	})
+	remote.Subscribe(ctx, func(version string, tags []string) {
+		for _, t := range tags {
+			s.local.setTag(t, version)
+		}
+	})
+	return s
+}
+
+func (s *TieredStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if value, ok, _ := s.local.Get(ctx, key); ok {
+		count("local_hits")
+		return value, true, nil
+	}
+	count("local_misses")
+
+	var value []byte
+	var ok bool
+	err := s.call(ctx, func(ctx context.Context) (err error) {
+		value, ok, err = s.remote.Get(ctx, key)
+		return err
+	})
+	if err != nil {
+		return nil, false, nil
+	}
+	if !ok {
+		count("redis_misses")
+		return nil, false, nil
+	}
+	count("redis_hits")
+	s.local.Set(ctx, key, value, s.cfg.LocalTTL)
+	return value, true, nil
+}
+
+func (s *TieredStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.local.Set(ctx, key, value, min(ttl, s.cfg.LocalTTL))
+	s.call(ctx, func(ctx context.Context) error {
+		return s.remote.Set(ctx, key, value, ttl)
+	})
+	return nil
+}
+
+func (s *TieredStore) TagVersions(ctx context.Context, tags []string) ([]string, error) {
+	versions, unknown := s.local.knownTags(tags, s.cfg.LocalTTL)
+	if len(unknown) == 0 {
+		return versions, nil
+	}
+
+	missing := make([]string, len(unknown))
+	for i, idx := range unknown {
+		missing[i] = tags[idx]
+	}
+	var fetched []string
+	err := s.call(ctx, func(ctx context.Context) (err error) {
+		fetched, err = s.remote.TagVersions(ctx, missing)
+		return err
+	})
+	if err != nil {
+		// without the shared versions, fall back to what this instance saw last
+		local, _ := s.local.TagVersions(ctx, missing)
+		for i, idx := range unknown {
+			versions[idx] = local[i]
+		}
+		return versions, nil
+	}
+	for i, idx := range unknown {
+		versions[idx] = fetched[i]
+		s.local.setTag(missing[i], fetched[i])
+	}
+	return versions, nil
+}
+
+func (s *TieredStore) BumpTags(ctx context.Context, tags ...string) error {
+	// this instance stops serving the old entries straight away; the version
+	// published by the shared store replaces this one when it arrives
+	s.local.BumpTags(ctx, tags...)
+
+	err := s.call(ctx, func(ctx context.Context) error {
+		return s.remote.BumpTags(ctx, tags...)
+	})
+	if err != nil {
+		s.mu.Lock()
+		for _, t := range tags {
+			s.pending[t] = struct{}{}
+		}
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// call runs fn against the shared store unless the breaker is open.
+func (s *TieredStore) call(ctx context.Context, fn func(ctx context.Context) error) error {
+	err := s.breaker.Call(ctx, fn)
+	switch {
+	case errors.Is(err, breaker.ErrOpen):
+		count("redis_skipped")
+	case err != nil:
+		count("redis_errors")
+	}
+	return err
+}
+
+func (s *TieredStore) recovered(ctx context.Context) {
+	log.Println("cache: shared store is back")
+	s.local.clear()
+
+	s.mu.Lock()
+	tags := make([]string, 0, len(s.pending))
+	for t := range s.pending {
+		tags = append(tags, t)
+	}
+	s.pending = make(map[string]struct{})
+	s.mu.Unlock()
+
+	if len(tags) > 0 {
+		s.BumpTags(ctx, tags...)
+	}
+}
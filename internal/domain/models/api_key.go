@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// APIKey lets an integration call the API without a user session. It acts
+// as the user it belongs to, but may only do what its scopes allow. Only the
+// hash of the key is stored; Prefix is kept to tell keys apart.
+type APIKey struct {
+	ID          int64      `json:"id"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	KeyHash     string     `json:"-"`
+	UserID      int        `json:"user_id"`
+	OwnerRole   string     `json:"-"`
+	OwnerActive bool       `json:"-"`
+	Scopes      []string   `json:"scopes"`
+	CreatedBy   *int       `json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CreatedAPIKey carries the key itself, which is only shown once.
+type CreatedAPIKey struct {
+	*APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Attachment is an uploaded file. It can optionally be linked to a user, a
+// complaint, a complaint message and/or the document it was uploaded as.
+type Attachment struct {
+	ID          int       `json:"id"`
+	UploadedBy  int       `json:"uploaded_by"`
+	UserID      *int      `json:"user_id,omitempty"`
+	ComplaintID *int      `json:"complaint_id,omitempty"`
+	MessageID   *int      `json:"message_id,omitempty"`
+	DocumentID  *int      `json:"document_id,omitempty"`
+	FileName    string    `json:"file_name"`
+	StorageKey  string    `json:"-"`
+	MimeType    string    `json:"mime_type"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	URL         string    `json:"url"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// AttachmentLink says what a new attachment belongs to.
+type AttachmentLink struct {
+	UserID      *int
+	ComplaintID *int
+	MessageID   *int
+	DocumentID  *int
+}
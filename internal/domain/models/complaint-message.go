@@ -3,13 +3,14 @@ package models
 import "time"
 
 type ComplaintMessages struct {
-	ID          int       `json:"id"`
-	ComplaintID int       `json:"complaint_id"`
-	SenderID    int       `json:"sender_id"`
-	ParentID    *int      `json:"parent_id,omitempty"`
-	Message     string    `json:"message"`
-	FileUrl     string    `json:"file_url,omitempty"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          int           `json:"id"`
+	ComplaintID int           `json:"complaint_id"`
+	SenderID    int           `json:"sender_id"`
+	ParentID    *int          `json:"parent_id,omitempty"`
+	Message     string        `json:"message"`
+	FileUrl     string        `json:"file_url,omitempty"`
+	Attachments []*Attachment `json:"attachments,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
 }
 
 type MessageEntity struct {
@@ -21,3 +22,21 @@ type MessageEntity struct {
 	Message    string  `json:"message"`
 	CeatedAt   string  `json:"created_at"`
 }
+
+// ComplaintMessageNode is a message inside a threaded view together with the
+// replies that were loaded for it.
+type ComplaintMessageNode struct {
+	ComplaintMessages
+	Depth      int                     `json:"depth"`
+	ReplyCount int                     `json:"reply_count"`
+	Replies    []*ComplaintMessageNode `json:"replies"`
+}
+
+type MessageThread struct {
+	ComplaintID int                     `json:"complaint_id"`
+	ParentID    *int                    `json:"parent_id,omitempty"`
+	Page        int                     `json:"page"`
+	PerPage     int                     `json:"per_page"`
+	Total       int                     `json:"total"`
+	Messages    []*ComplaintMessageNode `json:"messages"`
+}
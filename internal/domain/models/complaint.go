@@ -9,4 +9,10 @@ type Complaints struct {
 	Message   string    `json:"message"`
 	Status    string    `json:"status"`
 	CreatedAt time.Time `json:"created_at"`
+	Version   int       `json:"version"`
+	// set by triage, empty until it or an admin decides
+	Category  string `json:"category,omitempty"`
+	Priority  string `json:"priority,omitempty"`
+	Sentiment string `json:"sentiment,omitempty"`
+	Language  string `json:"language,omitempty"`
 }
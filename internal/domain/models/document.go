@@ -3,9 +3,36 @@ package models
 import "time"
 
 type Document struct {
-	ID         int32     `json:"id"`
-	UserID     int       `json:"user_id"`
-	FileName   string    `json:"file_name"`
-	FilePath   string    `json:"file_path"`
-	UploadedAt time.Time `json:"uploaded_at"`
+	ID             int32     `json:"id"`
+	UserID         int       `json:"user_id"`
+	FileName       string    `json:"file_name"`
+	StorageKey     string    `json:"storage_key"`
+	MimeType       string    `json:"mime_type"`
+	Size           int64     `json:"size"`
+	CurrentVersion int       `json:"current_version"`
+	UploadedAt     time.Time `json:"uploaded_at"`
+}
+
+type DocumentVersion struct {
+	ID           int       `json:"id"`
+	DocumentID   int       `json:"document_id"`
+	Version      int       `json:"version"`
+	FileName     string    `json:"file_name"`
+	StorageKey   string    `json:"-"`
+	MimeType     string    `json:"mime_type"`
+	Size         int64     `json:"size"`
+	SHA256       string    `json:"sha256"`
+	UploadedBy   *int      `json:"uploaded_by,omitempty"`
+	RestoredFrom *int      `json:"restored_from,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// StorageUsage reports how much of their quota a user has consumed.
+type StorageUsage struct {
+	UserID         int   `json:"user_id"`
+	UsedBytes      int64 `json:"used_bytes"`
+	QuotaBytes     int64 `json:"quota_bytes"`
+	RemainingBytes int64 `json:"remaining_bytes"`
+	Documents      int   `json:"documents"`
+	Versions       int   `json:"versions"`
 }
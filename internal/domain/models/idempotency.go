@@ -0,0 +1,9 @@
+package models
+
+// IdempotentResponse is the first response to a request sent with an
+// Idempotency-Key, replayed to retries of that request.
+type IdempotentResponse struct {
+	StatusCode  int    `json:"status_code"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+}
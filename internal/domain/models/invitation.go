@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+// Invitation lets someone join with a role public registration doesn't give.
+// Only the hash of the mailed token is stored.
+type Invitation struct {
+	ID             int64      `json:"id"`
+	Email          string     `json:"email"`
+	Role           string     `json:"role"`
+	Status         string     `json:"status"`
+	TokenHash      string     `json:"-"`
+	InvitedBy      *int       `json:"invited_by,omitempty"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	AcceptedAt     *time.Time `json:"accepted_at,omitempty"`
+	AcceptedUserID *int       `json:"accepted_user_id,omitempty"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CreatedInvitation carries the accept link, which is only shown once.
+type CreatedInvitation struct {
+	*Invitation
+	AcceptURL string `json:"accept_url"`
+}
+
+// InvitationFilter narrows the invitation list; zero fields are not filtered on.
+type InvitationFilter struct {
+	Status  string
+	Email   string
+	Page    int
+	PerPage int
+}
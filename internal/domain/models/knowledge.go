@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+const (
+	KnowledgeCannedResponse = "canned_response"
+	KnowledgeArticle        = "article"
+)
+
+// KnowledgeEntry is a canned response or a knowledge base article that
+// drafted replies can draw on.
+type KnowledgeEntry struct {
+	ID             int       `json:"id"`
+	Kind           string    `json:"kind"`
+	Title          string    `json:"title"`
+	Body           string    `json:"body"`
+	Embedding      []float64 `json:"-"`
+	EmbeddingModel string    `json:"-"`
+	CreatedBy      *int      `json:"created_by,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// AIUsage is what one request to the model cost.
+type AIUsage struct {
+	ID               int64     `json:"id"`
+	UserID           *int      `json:"user_id,omitempty"`
+	ComplaintID      *int      `json:"complaint_id,omitempty"`
+	Feature          string    `json:"feature"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	TotalTokens      int       `json:"total_tokens"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// AIUsageSummary adds up the usage of one feature with one model.
+type AIUsageSummary struct {
+	Feature          string `json:"feature"`
+	Model            string `json:"model"`
+	Requests         int    `json:"requests"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	TotalTokens      int    `json:"total_tokens"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// why a login attempt ended the way it did
+const (
+	LoginSucceeded    = "success"
+	LoginMFARequired  = "mfa_required"
+	LoginUnknownEmail = "unknown_email"
+	LoginBadPassword  = "bad_password"
+	LoginBadMFACode   = "bad_mfa_code"
+	LoginThrottled    = "throttled"
+	LoginLockedOut    = "locked_out"
+	LoginDeactivated  = "deactivated"
+)
+
+type LoginAttempt struct {
+	ID        int64     `json:"id"`
+	UserID    *int      `json:"user_id,omitempty"`
+	Email     string    `json:"email"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LoginAuditFilter narrows the audit log; zero fields are not filtered on.
+type LoginAuditFilter struct {
+	UserID  int
+	Email   string
+	IP      string
+	Success *bool
+	Since   time.Time
+	Until   time.Time
+	Page    int
+	PerPage int
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// MFA is a user's TOTP enrolment. Secret is stored encrypted.
+type MFA struct {
+	UserID       int
+	Secret       string
+	EnabledAt    *time.Time
+	LastUsedStep int64
+	CreatedAt    time.Time
+}
+
+func (m *MFA) Enabled() bool {
+	return m != nil && m.EnabledAt != nil
+}
+
+// MFAChallenge is returned by login instead of tokens when a second factor is
+// needed. With EnrollmentRequired the user must first set up 2FA.
+type MFAChallenge struct {
+	ChallengeToken     string    `json:"challenge_token"`
+	ExpiresAt          time.Time `json:"expires_at"`
+	EnrollmentRequired bool      `json:"enrollment_required"`
+}
+
+// MFASetup is shown once while enrolling, usually rendered as a QR code.
+type MFASetup struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// MFAEnrollment is returned when enrolment is confirmed. The recovery codes
+// are only ever shown here.
+type MFAEnrollment struct {
+	RecoveryCodes []string   `json:"recovery_codes"`
+	Tokens        *TokenPair `json:"tokens,omitempty"`
+}
@@ -0,0 +1,32 @@
+package models
+
+// Patches carry the fields of a partial update. Nil fields are left alone.
+
+type UserPatch struct {
+	FirstName *string `json:"first_name"`
+	LastName  *string `json:"last_name"`
+	Email     *string `json:"email"`
+}
+
+func (p UserPatch) IsEmpty() bool {
+	return p.FirstName == nil && p.LastName == nil && p.Email == nil
+}
+
+// ComplaintPatch edits what a complaint says, which is only allowed until
+// it is accepted.
+type ComplaintPatch struct {
+	Subject *string `json:"subject"`
+	Message *string `json:"message"`
+}
+
+func (p ComplaintPatch) IsEmpty() bool {
+	return p.Subject == nil && p.Message == nil
+}
+
+type DocumentPatch struct {
+	FileName *string `json:"file_name"`
+}
+
+func (p DocumentPatch) IsEmpty() bool {
+	return p.FileName == nil
+}
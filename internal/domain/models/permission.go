@@ -0,0 +1,62 @@
+package models
+
+// Permissions are the actions a role can be granted. The catalogue lives in
+// the permissions table; these are the names the code checks for.
+const (
+	PermComplaintCreate       = "complaint:create"
+	PermComplaintReadOwn      = "complaint:read:own"
+	PermComplaintReadAny      = "complaint:read:any"
+	PermComplaintResolve      = "complaint:resolve"
+	PermComplaintUpdateStatus = "complaint:update_status"
+	PermComplaintMessage      = "complaint:message"
+	PermComplaintTriage       = "complaint:triage"
+
+	PermDocumentWrite     = "document:write"
+	PermDocumentReadAny   = "document:read:any"
+	PermDocumentManageAny = "document:manage:any"
+
+	PermUserRead   = "user:read"
+	PermUserUpdate = "user:update"
+	PermUserDelete = "user:delete"
+	PermUserUnlock = "user:unlock"
+	PermUserInvite = "user:invite"
+	PermRoleAssign = "role:assign"
+	PermRoleManage = "role:manage"
+	PermAPIKeys    = "apikey:manage"
+	PermAuditRead  = "audit:read"
+
+	PermMetricsRead = "metrics:read"
+
+	PermAIAsk           = "ai:ask"
+	PermKnowledgeManage = "knowledge:manage"
+)
+
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// RoleDefinition is a role with the permissions granted to it. Built in
+// roles can't be deleted.
+type RoleDefinition struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	BuiltIn     bool     `json:"built_in"`
+	Permissions []string `json:"permissions"`
+}
+
+// PermissionSet is what a role may do, for quick lookups.
+type PermissionSet map[string]bool
+
+func NewPermissionSet(perms []string) PermissionSet {
+	set := make(PermissionSet, len(perms))
+	for _, p := range perms {
+		set[p] = true
+	}
+	return set
+}
+
+func (s PermissionSet) Has(perm string) bool {
+	return s[perm]
+}
@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// RefreshToken is one link in a session's rotation chain. Only the hash of
+// the token handed to the client is stored.
+type RefreshToken struct {
+	ID         int64      `json:"id"`
+	UserID     int        `json:"user_id"`
+	FamilyID   string     `json:"family_id"`
+	TokenHash  string     `json:"-"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	ReplacedBy *int64     `json:"replaced_by,omitempty"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	SSO        bool       `json:"sso"`
+}
+
+// TokenPair is returned by login and refresh.
+type TokenPair struct {
+	AccessToken      string    `json:"access_token"`
+	TokenType        string    `json:"token_type"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// ClientInfo identifies where a session was started from.
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
+type UserTokenPurpose string
+
+const (
+	VerifyEmailToken   UserTokenPurpose = "verify_email"
+	ResetPasswordToken UserTokenPurpose = "reset_password"
+)
+
+// UserToken is a single use token mailed to a user, e.g. a reset link.
+type UserToken struct {
+	ID        int64
+	UserID    int
+	Purpose   UserTokenPurpose
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
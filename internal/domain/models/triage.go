@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// The complaint fields triage suggests values for.
+const (
+	TriageCategory  = "category"
+	TriagePriority  = "priority"
+	TriageSentiment = "sentiment"
+	TriageLanguage  = "language"
+)
+
+var TriageFields = []string{TriageCategory, TriagePriority, TriageSentiment, TriageLanguage}
+
+// What became of a suggestion.
+const (
+	TriagePending     = "pending"
+	TriageAutoApplied = "auto_applied"
+	TriageAccepted    = "accepted"
+	TriageOverridden  = "overridden"
+)
+
+// TriageSuggestion is the model's suggestion for one field of a complaint.
+type TriageSuggestion struct {
+	ID          int64      `json:"id"`
+	ComplaintID int        `json:"complaint_id"`
+	Field       string     `json:"field"`
+	Value       string     `json:"value"`
+	Confidence  float64    `json:"confidence"`
+	Model       string     `json:"model"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DecidedAt   *time.Time `json:"decided_at,omitempty"`
+}
+
+// TriageDecision records an admin accepting or overriding a suggestion.
+type TriageDecision struct {
+	ID             int64     `json:"id"`
+	ComplaintID    int       `json:"complaint_id"`
+	Field          string    `json:"field"`
+	SuggestedValue string    `json:"suggested_value"`
+	Confidence     float64   `json:"confidence"`
+	AutoApplied    bool      `json:"auto_applied"`
+	FinalValue     string    `json:"final_value"`
+	Decision       string    `json:"decision"`
+	DecidedBy      int       `json:"decided_by"`
+	DecidedAt      time.Time `json:"decided_at"`
+}
+
+// TriageAccuracy sums up the decisions on one field: Accuracy is the share
+// of reviewed suggestions admins accepted.
+type TriageAccuracy struct {
+	Field                 string  `json:"field"`
+	Decisions             int     `json:"decisions"`
+	Accepted              int     `json:"accepted"`
+	Overridden            int     `json:"overridden"`
+	Accuracy              float64 `json:"accuracy"`
+	AutoApplied           int     `json:"auto_applied"`
+	AutoAppliedOverridden int     `json:"auto_applied_overridden"`
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type Role string
 
 const (
@@ -15,4 +17,12 @@ type User struct {
 	Password  string `json:"password"`
 	Role      string `json:"role"`
 	RoleID    int    `json:"role_id"`
+
+	EmailVerified bool `json:"email_verified"`
+
+	// deactivated users can't log in, anonymized ones are deactivated for good
+	DeactivatedAt *time.Time `json:"deactivated_at,omitempty"`
+	AnonymizedAt  *time.Time `json:"anonymized_at,omitempty"`
+
+	Version int `json:"version"`
 }
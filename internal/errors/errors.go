@@ -9,5 +9,36 @@ var (
 	ErrUserDuplicate  = errorx.NewType(commonErrors, "user_duplicate")
 	ErrInvalidPayload = errorx.NewType(commonErrors, "invalid_payload")
 	ErrUnauthorized   = errorx.NewType(commonErrors, "unauthorized")
+	ErrForbidden      = errorx.NewType(commonErrors, "forbidden")
 	ErrDbFailure      = errorx.NewType(commonErrors, "db_failure")
+
+	// rate limits and lockouts, RetryAfter says when to come back
+	ErrTooManyRequests = errorx.NewType(commonErrors, "too_many_requests")
+	RetryAfter         = errorx.RegisterProperty("retry_after")
+
+	// locked after too many failed logins, until it expires or an admin unlocks it
+	ErrAccountLocked = ErrTooManyRequests.NewSubtype("account_locked")
+
+	// the resource is no longer in a state that allows the change
+	ErrConflict = ErrUserDuplicate.NewSubtype("conflict")
+
+	// conditional requests: the If-Match version is stale, or missing
+	ErrPreconditionFailed   = errorx.NewType(commonErrors, "precondition_failed")
+	ErrPreconditionRequired = ErrPreconditionFailed.NewSubtype("precondition_required")
+
+	// authenticated, but the account may not do this yet
+	ErrEmailNotVerified = ErrForbidden.NewSubtype("email_not_verified")
+
+	// upload rejections, all of them are invalid payloads
+	ErrFileTooLarge        = ErrInvalidPayload.NewSubtype("file_too_large")
+	ErrUnsupportedFileType = ErrInvalidPayload.NewSubtype("unsupported_file_type")
+	ErrInfectedFile        = ErrInvalidPayload.NewSubtype("infected_file")
+	ErrQuotaExceeded       = ErrInvalidPayload.NewSubtype("quota_exceeded")
+
+	// well formed, but can't be processed, such as an Idempotency-Key reused
+	// for a different request
+	ErrUnprocessable = errorx.NewType(commonErrors, "unprocessable")
+
+	// a service we depend on, such as the AI provider, failed or is unreachable
+	ErrUpstreamFailure = errorx.NewType(commonErrors, "upstream_failure")
 )
@@ -0,0 +1,154 @@
+package events
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	DocumentUploaded = "document.uploaded"
+	ComplaintCreated = "complaint.created"
+)
+
+// Event is something that happened which background workers may react to.
+type Event struct {
+	Type       string
+	Payload    any
+	OccurredAt time.Time
+}
+
+// DocumentUploadedPayload is published whenever a document version is stored.
+type DocumentUploadedPayload struct {
+	DocumentID int
+	Version    int
+	StorageKey string
+	MimeType   string
+}
+
+// ComplaintCreatedPayload is published once a complaint is filed.
+type ComplaintCreatedPayload struct {
+	ComplaintID int
+	UserID      int
+}
+
+type Handler func(ctx context.Context, event Event) error
+
+// Publisher hands events to the pipeline without waiting for handlers.
+type Publisher interface {
+	Publish(ctx context.Context, event Event)
+}
+
+// Bus is an in-process event pipeline. Events are queued and dispatched to
+// subscribers by a fixed pool of workers, so publishers never block on slow
+// handlers. When the queue is full the event is dropped and logged.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+	queue    chan Event
+	wg       sync.WaitGroup
+	pending  sync.WaitGroup
+	timeout  time.Duration
+	closed   bool
+}
+
+func NewBus(workers, queueSize int, timeout time.Duration) *Bus {
+	if workers < 1 {
+		workers = 1
+	}
+	b := &Bus{
+		handlers: make(map[string][]Handler),
+		queue:    make(chan Event, queueSize),
+		timeout:  timeout,
+	}
+	for i := 0; i < workers; i++ {
+		b.wg.Add(1)
+		go b.work()
+	}
+	return b
+}
+
+func (b *Bus) Subscribe(eventType string, h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], h)
+}
+
+func (b *Bus) Publish(ctx context.Context, event Event) {
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		log.Printf("event bus closed, dropping %s event", event.Type)
+		return
+	}
+
+	b.pending.Add(1)
+	select {
+	case b.queue <- event:
+	default:
+		b.pending.Done()
+		log.Printf("event queue full, dropping %s event", event.Type)
+	}
+}
+
+// Wait blocks until every queued event has been handled.
+func (b *Bus) Wait() {
+	b.pending.Wait()
+}
+
+// Close stops accepting events and waits for the workers to drain the queue.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	close(b.queue)
+	b.mu.Unlock()
+
+	b.wg.Wait()
+}
+
+func (b *Bus) work() {
+	defer b.wg.Done()
+	for event := range b.queue {
+		b.dispatch(event)
+		b.pending.Done()
+	}
+}
+
+func (b *Bus) dispatch(event Event) {
+	b.mu.RLock()
+	handlers := b.handlers[event.Type]
+	b.mu.RUnlock()
+
+	for _, h := range handlers {
+		b.run(h, event)
+	}
+}
+
+// run isolates handlers from each other: a panic or error is only logged.
+func (b *Bus) run(h Handler, event Event) {
+	ctx := context.Background()
+	if b.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.timeout)
+		defer cancel()
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("%s handler panicked: %v", event.Type, r)
+		}
+	}()
+
+	if err := h(ctx, event); err != nil {
+		log.Printf("%s handler failed: %v", event.Type, err)
+	}
+}
@@ -1,10 +1,15 @@
 package handler
 
 import (
+	"Complaingo/internal/ai"
 	"Complaingo/internal/middleware"
-	"Complaingo/internal/openai"
+	"Complaingo/internal/usecase"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strings"
+
+	appErrors "Complaingo/internal/errors"
 )
 
 type AIRequest struct {
@@ -12,22 +17,74 @@ type AIRequest struct {
 }
 
 type AIResponse struct {
-	Answer string `json:"answer"`
+	Answer string   `json:"answer"`
+	Model  string   `json:"model"`
+	Usage  ai.Usage `json:"usage"`
+}
+
+type AIHandler struct {
+	usecase *usecase.AIUsecase
+}
+
+func NewAIHandler(uc *usecase.AIUsecase) *AIHandler {
+	return &AIHandler{usecase: uc}
 }
 
-func AIChatHandler(w http.ResponseWriter, r *http.Request) {
+// AskAI answers a prompt. With Accept: text/event-stream the answer is sent
+// as it is generated, one "data: {"delta": ...}" event per part, then a
+// "done" event with the whole response.
+func (h *AIHandler) AskAI(w http.ResponseWriter, r *http.Request) {
 	var req AIRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		middleware.WriteError(w, err)
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid request body"))
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		h.streamAnswer(w, r, req.Prompt)
 		return
 	}
 
-	answer, err := openai.CallOpenAI(req.Prompt)
+	res, err := h.usecase.Ask(r.Context(), req.Prompt)
 	if err != nil {
 		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, AIResponse{Answer: res.Content, Model: res.Model, Usage: res.Usage}, "Answer generated successfully", http.StatusOK)
+}
+
+func (h *AIHandler) streamAnswer(w http.ResponseWriter, r *http.Request, prompt string) {
+	rc := http.NewResponseController(w)
+	started := false
+	send := func(event string, data any) error {
+		if !started {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		raw, _ := json.Marshal(data)
+		if event != "" {
+			fmt.Fprintf(w, "event: %s\n", event)
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", raw); err != nil {
+			return err
+		}
+		return rc.Flush()
 	}
 
-	resp := AIResponse{Answer: answer}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
+	res, err := h.usecase.AskStream(r.Context(), prompt, func(delta string) error {
+		return send("", map[string]string{"delta": delta})
+	})
+	if err != nil {
+		// nothing sent yet, so it can still be a normal error response
+		if !started {
+			middleware.WriteError(w, err)
+			return
+		}
+		send("error", map[string]string{"message": err.Error()})
+		return
+	}
+	send("done", AIResponse{Answer: res.Content, Model: res.Model, Usage: res.Usage})
 }
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"Complaingo/internal/middleware"
+	"Complaingo/internal/usecase"
+	"Complaingo/internal/validation"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/gorilla/mux"
+)
+
+type APIKeyHandler struct {
+	usecase *usecase.APIKeyUsecase
+}
+
+func NewAPIKeyHandler(uc *usecase.APIKeyUsecase) *APIKeyHandler {
+	return &APIKeyHandler{usecase: uc}
+}
+
+// CreateAPIKey answers with the key itself, which can't be retrieved later.
+func (h *APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var body validation.APIKeyInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid api key data"))
+		return
+	}
+
+	key, err := h.usecase.Create(r.Context(), body)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, key, "API key created successfully", http.StatusCreated)
+}
+
+func (h *APIKeyHandler) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.usecase.List(r.Context())
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, keys, "API keys retrieved successfully", http.StatusOK)
+}
+
+func (h *APIKeyHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("id invalid"))
+		return
+	}
+
+	if err := h.usecase.Revoke(r.Context(), id); err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, nil, "API key revoked successfully", http.StatusOK)
+}
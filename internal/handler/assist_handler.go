@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"Complaingo/internal/middleware"
+	"Complaingo/internal/usecase"
+	"Complaingo/internal/validation"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/gorilla/mux"
+)
+
+type AssistHandler struct {
+	usecase *usecase.AssistUsecase
+}
+
+func NewAssistHandler(uc *usecase.AssistUsecase) *AssistHandler {
+	return &AssistHandler{usecase: uc}
+}
+
+// SummarizeComplaint summarises a complaint thread the caller may read.
+func (h *AssistHandler) SummarizeComplaint(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid id"))
+		return
+	}
+
+	summary, err := h.usecase.Summarize(r.Context(), id)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, summary, "Summary generated successfully", http.StatusOK)
+}
+
+// SuggestReply drafts the next reply to a complaint thread, along with the
+// canned responses and articles it drew on.
+func (h *AssistHandler) SuggestReply(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid id"))
+		return
+	}
+
+	reply, err := h.usecase.SuggestReply(r.Context(), id)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, reply, "Reply suggested successfully", http.StatusOK)
+}
+
+func (h *AssistHandler) GetAIUsage(w http.ResponseWriter, r *http.Request) {
+	usage, err := h.usecase.GetUsage(r.Context())
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, usage, "AI usage fetched successfully", http.StatusOK)
+}
+
+func (h *AssistHandler) CreateKnowledgeEntry(w http.ResponseWriter, r *http.Request) {
+	var body validation.KnowledgeEntryInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid knowledge entry data"))
+		return
+	}
+
+	entry, err := h.usecase.CreateKnowledgeEntry(r.Context(), body)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, entry, "Knowledge entry created successfully", http.StatusCreated)
+}
+
+// GetKnowledgeEntries lists the entries, of one kind with ?kind=.
+func (h *AssistHandler) GetKnowledgeEntries(w http.ResponseWriter, r *http.Request) {
+	entries, err := h.usecase.GetKnowledgeEntries(r.Context(), r.URL.Query().Get("kind"))
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, entries, "Knowledge entries fetched successfully", http.StatusOK)
+}
+
+func (h *AssistHandler) DeleteKnowledgeEntry(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid id"))
+		return
+	}
+
+	if err := h.usecase.DeleteKnowledgeEntry(r.Context(), id); err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, nil, "Knowledge entry deleted successfully", http.StatusOK)
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"Complaingo/internal/middleware"
+	"Complaingo/internal/upload"
+	"Complaingo/internal/usecase"
+	"net/http"
+	"strconv"
+
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/gorilla/mux"
+)
+
+type AttachmentHandler struct {
+	usecase *usecase.AttachmentUsecase
+}
+
+func NewAttachmentHandler(usecase *usecase.AttachmentUsecase) *AttachmentHandler {
+	return &AttachmentHandler{usecase: usecase}
+}
+
+func (h *AttachmentHandler) UploadToComplaint(w http.ResponseWriter, r *http.Request) {
+	complaintID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid id"))
+		return
+	}
+
+	limitUploadBody(w, r, h.usecase.MaxUploadBytes(r.Context()), upload.MaxFilesPerRequest)
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		middleware.WriteError(w, uploadFormError(err, "can't parse multipart form"))
+		return
+	}
+
+	files := r.MultipartForm.File["file"]
+	if len(files) == 0 {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("at least one file is required"))
+		return
+	}
+
+	attachments, err := h.usecase.UploadToComplaint(r.Context(), complaintID, files)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, attachments, "Attachments uploaded successfully", http.StatusCreated)
+}
+
+func (h *AttachmentHandler) GetAttachmentsByComplaint(w http.ResponseWriter, r *http.Request) {
+	complaintID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid id"))
+		return
+	}
+
+	attachments, err := h.usecase.GetAttachmentsByComplaint(r.Context(), complaintID)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, attachments, "Attachments fetched successfully", http.StatusOK)
+}
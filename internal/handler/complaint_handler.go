@@ -3,14 +3,13 @@ package handler
 import (
 	"Complaingo/internal/domain/models"
 	"Complaingo/internal/middleware"
-	"Complaingo/internal/redis"
+	"Complaingo/internal/upload"
 	"Complaingo/internal/usecase"
 	"Complaingo/internal/utility"
 	"encoding/json"
-	"fmt"
+	"mime/multipart"
 	"net/http"
 	"strconv"
-	"time"
 
 	appErrors "Complaingo/internal/errors"
 
@@ -50,19 +49,6 @@ func (uc *ComplaintHandler) GetComplaintByRole(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	// check redis cache
-	cachKey := fmt.Sprintf("complaints:%d", user_id)
-	cachedComplaint, err := redis.RDB.Get(redis.Ctx, cachKey).Result()
-	if err == nil {
-		// found on cache
-		var complaints []models.Complaints
-		if err := json.Unmarshal([]byte(cachedComplaint), &complaints); err == nil {
-			middleware.WriteSuccess(w, complaints, "Complient from cache", http.StatusOK)
-			return
-		}
-
-	}
-
 	query := r.URL.Query()
 	paginPram := utility.PaginationParam{
 		Page:    query.Get("page"),
@@ -78,18 +64,31 @@ func (uc *ComplaintHandler) GetComplaintByRole(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	// not found in cache fetch from DB
 	complaint, err := uc.usecase.GetComplaintByRole(r.Context(), user_id, filterParam)
 	if err != nil {
 		middleware.WriteError(w, err)
 		return
 	}
 
-	// cache the database result for future use
-	complientJson, _ := json.Marshal(complaint)
-	redis.RDB.Set(redis.Ctx, cachKey, complientJson, time.Minute*10)
+	middleware.WriteSuccessETag(w, r, middleware.ContentETag(complaint), complaint, "complaint get successfully by pk user_id", http.StatusOK)
+}
 
-	middleware.WriteSuccess(w, complaint, "complaint get successfully by pk user_id", http.StatusOK)
+// GetComplaint returns one complaint with its version as the ETag, to send
+// back as If-Match when changing it.
+func (uc *ComplaintHandler) GetComplaint(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid id"))
+		return
+	}
+
+	complaint, err := uc.usecase.GetComplaint(r.Context(), id)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccessETag(w, r, middleware.VersionETag(complaint.Version), complaint, "Complaint fetched successfully", http.StatusOK)
 }
 
 func (uc *ComplaintHandler) UserMarkResolved(w http.ResponseWriter, r *http.Request) {
@@ -100,14 +99,52 @@ func (uc *ComplaintHandler) UserMarkResolved(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	if err := uc.usecase.UserMarkResolved(r.Context(), complaint_id); err != nil {
+	version, err := middleware.IfMatch(r)
+	if err != nil {
 		middleware.WriteError(w, err)
 		return
 	}
 
+	complaint, err := uc.usecase.UserMarkResolved(r.Context(), complaint_id, version)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", middleware.VersionETag(complaint.Version))
 	middleware.WriteSuccess(w, complaint_id, "Complait updated successfully", http.StatusOK)
 }
 
+// EditComplaint only changes the fields present in the body.
+func (uc *ComplaintHandler) EditComplaint(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid id"))
+		return
+	}
+
+	version, err := middleware.IfMatch(r)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	var body models.ComplaintPatch
+	if err := decodePatch(r, &body); err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	complaint, err := uc.usecase.EditComplaint(r.Context(), id, body, version)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", middleware.VersionETag(complaint.Version))
+	middleware.WriteSuccess(w, complaint, "Complaint updated successfully", http.StatusOK)
+}
+
 func (uc *ComplaintHandler) GetAllComplaintByRole(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query()
 	paginationParam := utility.PaginationParam{
@@ -130,7 +167,7 @@ func (uc *ComplaintHandler) GetAllComplaintByRole(w http.ResponseWriter, r *http
 		return
 	}
 
-	middleware.WriteSuccess(w, complaints, "All compliants fetched successfully", http.StatusOK)
+	middleware.WriteSuccessETag(w, r, middleware.ContentETag(complaints), complaints, "All compliants fetched successfully", http.StatusOK)
 }
 
 func (uc *ComplaintHandler) AdminUpdateComplaints(w http.ResponseWriter, r *http.Request) {
@@ -141,6 +178,12 @@ func (uc *ComplaintHandler) AdminUpdateComplaints(w http.ResponseWriter, r *http
 		return
 	}
 
+	version, err := middleware.IfMatch(r)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
 	var body struct {
 		Status string `json:"status"`
 	}
@@ -149,11 +192,13 @@ func (uc *ComplaintHandler) AdminUpdateComplaints(w http.ResponseWriter, r *http
 		return
 	}
 
-	err = uc.usecase.AdminUpdateComplaints(r.Context(), complaintID, body.Status)
+	complaint, err := uc.usecase.AdminUpdateComplaints(r.Context(), complaintID, body.Status, version)
 	if err != nil {
 		middleware.WriteError(w, err)
+		return
 	}
 
+	w.Header().Set("ETag", middleware.VersionETag(complaint.Version))
 	middleware.WriteSuccess(w, body.Status, "Complaint Updated Successfully", http.StatusNoContent)
 }
 
@@ -198,29 +243,42 @@ func (uc *ComplaintHandler) GetMessagesByComplaint(w http.ResponseWriter, r *htt
 		return
 	}
 
-	// check redis cache
-	cacheKey := fmt.Sprintf("Message:%d", complaintID)
-	cachedMessage, err := redis.RDB.Get(redis.Ctx, cacheKey).Result()
-	if err == nil {
-		var message []models.ComplaintMessages
-		if err := json.Unmarshal([]byte(cachedMessage), &message); err == nil {
-			middleware.WriteSuccess(w, message, "Feched from cache", http.StatusOK)
-			return
-		}
+	if r.URL.Query().Get("view") == "thread" {
+		uc.getMessageThread(w, r, complaintID)
+		return
 	}
 
-	// not found in cache -> fetch from DB
 	message, err := uc.usecase.GetMessagesByComplaint(r.Context(), complaintID)
 	if err != nil {
 		middleware.WriteError(w, err)
 		return
 	}
 
-	// save in cache for future
-	messageJson, _ := json.Marshal(message)
-	redis.RDB.Set(redis.Ctx, cacheKey, messageJson, time.Minute*10)
+	middleware.WriteSuccessETag(w, r, middleware.ContentETag(message), message, "Message successfully fetched by complaint id", http.StatusOK)
+}
+
+func (uc *ComplaintHandler) getMessageThread(w http.ResponseWriter, r *http.Request, complaintID int) {
+	query := r.URL.Query()
+	threadParam, err := utility.ExtractThreadParam(utility.ThreadParamInput{
+		ParentID:     query.Get("parent_id"),
+		Page:         query.Get("page"),
+		PerPage:      query.Get("per_page"),
+		MaxDepth:     query.Get("max_depth"),
+		RepliesLimit: query.Get("replies_limit"),
+		Order:        query.Get("order"),
+	})
+	if err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.Wrap(err, "Invalid thread query params"))
+		return
+	}
+
+	thread, err := uc.usecase.GetMessageThread(r.Context(), complaintID, threadParam)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
 
-	middleware.WriteSuccess(w, message, "Message successfully fetched by complaint id", http.StatusOK)
+	middleware.WriteSuccessETag(w, r, middleware.ContentETag(thread), thread, "Message thread successfully fetched by complaint id", http.StatusOK)
 }
 
 func (uc *ComplaintHandler) ReplyToMessage(w http.ResponseWriter, r *http.Request) {
@@ -233,9 +291,10 @@ func (uc *ComplaintHandler) ReplyToMessage(w http.ResponseWriter, r *http.Reques
 	}
 
 	// parse the form (text and file)
+	limitUploadBody(w, r, uc.usecase.MaxUploadBytes(r.Context()), upload.MaxFilesPerRequest)
 	err = r.ParseMultipartForm(10 << 20)
 	if err != nil {
-		middleware.WriteError(w, appErrors.ErrInvalidPayload.Wrap(err, "can't parse multipart form"))
+		middleware.WriteError(w, uploadFormError(err, "can't parse multipart form"))
 		return
 	}
 	// extract text message
@@ -245,26 +304,31 @@ func (uc *ComplaintHandler) ReplyToMessage(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// handle file
-	var fileUrl string
-	file, handler, err := r.FormFile("file")
-	if err == nil && handler != nil {
-		defer file.Close()
-		fileUrl, err = utility.SaveUploadFile(file, *handler)
+	// optional parent message the reply belongs to
+	var parentID *int
+	if parentStr := r.FormValue("parent_id"); parentStr != "" {
+		id, err := strconv.Atoi(parentStr)
 		if err != nil {
-			middleware.WriteError(w, err)
+			middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid parent_id"))
 			return
 		}
+		parentID = &id
+	}
+
+	// every "file" part becomes an attachment of the reply
+	var files []*multipart.FileHeader
+	if r.MultipartForm != nil {
+		files = r.MultipartForm.File["file"]
 	}
 
 	// prepare message model
 	msg := models.ComplaintMessages{
 		Message:     message,
 		ComplaintID: complaintID,
-		FileUrl:     fileUrl,
+		ParentID:    parentID,
 	}
 
-	if err := uc.usecase.ReplyToMessage(r.Context(), &msg); err != nil {
+	if err := uc.usecase.ReplyToMessage(r.Context(), &msg, files); err != nil {
 		middleware.WriteError(w, err)
 		return
 	}
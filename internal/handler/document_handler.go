@@ -3,12 +3,13 @@ package handler
 import (
 	"Complaingo/internal/domain/models"
 	"Complaingo/internal/middleware"
+	"Complaingo/internal/storage"
 	"Complaingo/internal/usecase"
 	"Complaingo/internal/utility"
+	"encoding/json"
 	"io"
+	"mime"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 
 	appErrors "Complaingo/internal/errors"
@@ -27,65 +28,247 @@ func NewDocumentHandler(usecase *usecase.DocumentUsecase) *DocumentHandler {
 }
 
 func (h *DocumentHandler) Uplod(w http.ResponseWriter, r *http.Request) {
-	userID := middleware.GetUserId(r.Context())
+	limitUploadBody(w, r, h.usecase.MaxUploadBytes(r.Context()), 1)
 
 	// parse uploaded file
 	file, header, err := r.FormFile("file")
+	if err != nil {
+		middleware.WriteError(w, uploadFormError(err, "file field is required"))
+		return
+	}
+	defer file.Close()
+
+	doc, err := h.usecase.Uplod(r.Context(), file, header.Filename, header.Size)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, doc, "File uploaded successfully", http.StatusCreated)
+}
+
+func (h *DocumentHandler) GetDocumentByID(w http.ResponseWriter, r *http.Request) {
+	idStr := mux.Vars(r)["id"]
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	doc, content, info, err := h.usecase.OpenDocument(r.Context(), id)
 	if err != nil {
 		middleware.WriteError(w, err)
 		return
 	}
+	defer content.Close()
+
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": doc.FileName}))
+	if info.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, content)
+}
+
+func (h *DocumentHandler) UploadVersion(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid id"))
+		return
+	}
+
+	limitUploadBody(w, r, h.usecase.MaxUploadBytes(r.Context()), 1)
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		middleware.WriteError(w, uploadFormError(err, "file field is required"))
+		return
+	}
 	defer file.Close()
 
-	// save to disc
-	destPath := filepath.Join("uploads_doc", header.Filename)
-	destFile, err := os.Create(destPath)
+	doc, err := h.usecase.UploadVersion(r.Context(), id, file, header.Filename, header.Size)
 	if err != nil {
 		middleware.WriteError(w, err)
 		return
 	}
-	defer destFile.Close()
-	io.Copy(destFile, file)
 
-	doc := &models.Document{
-		UserID:   userID,
-		FileName: header.Filename,
-		FilePath: destPath,
+	middleware.WriteSuccess(w, doc, "Version uploaded successfully", http.StatusCreated)
+}
+
+func (h *DocumentHandler) GetVersions(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid id"))
+		return
 	}
 
-	if err := h.usecase.Uplod(r.Context(), doc); err != nil {
+	versions, err := h.usecase.GetVersions(r.Context(), id)
+	if err != nil {
 		middleware.WriteError(w, err)
 		return
 	}
 
-	middleware.WriteSuccess(w, doc, "File uploaded successfully", http.StatusCreated)
+	middleware.WriteSuccess(w, versions, "Versions retrieved successfully", http.StatusOK)
 }
 
-func (h *DocumentHandler) GetDocumentByID(w http.ResponseWriter, r *http.Request) {
-	idStr := mux.Vars(r)["id"]
-	id, err := strconv.Atoi(idStr)
+func (h *DocumentHandler) GetVersion(w http.ResponseWriter, r *http.Request) {
+	id, version, err := documentVersionVars(r)
 	if err != nil {
 		middleware.WriteError(w, err)
 		return
 	}
 
-	doc, err := h.usecase.GetDocumentByID(r.Context(), id)
+	v, content, info, err := h.usecase.OpenVersion(r.Context(), id, version)
 	if err != nil {
 		middleware.WriteError(w, err)
 		return
 	}
+	defer content.Close()
 
-	http.ServeFile(w, r, doc.FilePath)
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": v.FileName}))
+	if info.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, content)
 }
 
-func (h *DocumentHandler) GetDocumentByUser(w http.ResponseWriter, r *http.Request) {
+func (h *DocumentHandler) RestoreVersion(w http.ResponseWriter, r *http.Request) {
+	id, version, err := documentVersionVars(r)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	doc, err := h.usecase.RestoreVersion(r.Context(), id, version)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, doc, "Version restored successfully", http.StatusOK)
+}
+
+// GetUsage reports the caller's storage usage; admins may pass ?user_id=.
+func (h *DocumentHandler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserId(r.Context())
+	if raw := r.URL.Query().Get("user_id"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil {
+			middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid user_id"))
+			return
+		}
+		userID = id
+	}
+
+	usage, err := h.usecase.GetUsage(r.Context(), userID)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, usage, "Storage usage retrieved successfully", http.StatusOK)
+}
+
+func documentVersionVars(r *http.Request) (int, int, error) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return 0, 0, appErrors.ErrInvalidPayload.New("Invalid id")
+	}
+	version, err := strconv.Atoi(vars["version"])
+	if err != nil || version < 1 {
+		return 0, 0, appErrors.ErrInvalidPayload.New("Invalid version")
+	}
+	return id, version, nil
+}
+
+func (h *DocumentHandler) GetThumbnail(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid id"))
+		return
+	}
+
+	content, info, err := h.usecase.OpenThumbnail(r.Context(), id)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+	defer content.Close()
+
+	writeDerivative(w, content, info)
+}
+
+func (h *DocumentHandler) GetPreview(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid id"))
+		return
+	}
+
+	content, info, err := h.usecase.OpenPreview(r.Context(), id)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+	defer content.Close()
+
+	writeDerivative(w, content, info)
+}
+
+// writeDerivative serves generated content inline; it is never user supplied
+// markup, so sniffing stays disabled and the type is the one we wrote.
+func writeDerivative(w http.ResponseWriter, content io.Reader, info *storage.BlobInfo) {
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", "inline")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	if info.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, content)
+}
+
+func (h *DocumentHandler) GetDownloadURL(w http.ResponseWriter, r *http.Request) {
 	idStr := mux.Vars(r)["id"]
-	userID, err := strconv.Atoi(idStr)
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid id"))
+		return
+	}
+
+	link, err := h.usecase.DownloadURL(r.Context(), id)
 	if err != nil {
 		middleware.WriteError(w, err)
 		return
 	}
 
+	middleware.WriteSuccess(w, link, "Download link created successfully", http.StatusOK)
+}
+
+func (h *DocumentHandler) GetDocumentByUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid id"))
+		return
+	}
+
 	query := r.URL.Query()
 
 	paginParam := utility.PaginationParam{
@@ -111,6 +294,29 @@ func (h *DocumentHandler) GetDocumentByUser(w http.ResponseWriter, r *http.Reque
 	middleware.WriteSuccess(w, doc, "files retrieved successfully by user id", http.StatusOK)
 }
 
+// UpdateDocument renames a document, the only field that can be changed.
+func (h *DocumentHandler) UpdateDocument(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid id"))
+		return
+	}
+
+	var body models.DocumentPatch
+	if err := decodePatch(r, &body); err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	doc, err := h.usecase.UpdateDocument(r.Context(), id, body)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, doc, "Document updated successfully", http.StatusOK)
+}
+
 func (h *DocumentHandler) DeleteDocument(w http.ResponseWriter, r *http.Request) {
 	idStr := mux.Vars(r)["id"]
 	id, err := strconv.Atoi(idStr)
@@ -126,3 +332,28 @@ func (h *DocumentHandler) DeleteDocument(w http.ResponseWriter, r *http.Request)
 
 	middleware.WriteSuccess(w, "", "Document deleted successfully", http.StatusNoContent)
 }
+
+// AttachDocument attaches a document to a complaint, {"complaint_id": ...}.
+func (h *DocumentHandler) AttachDocument(w http.ResponseWriter, r *http.Request) {
+	documentID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid id"))
+		return
+	}
+
+	var body struct {
+		ComplaintID int `json:"complaint_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.ComplaintID <= 0 {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("complaint_id is required"))
+		return
+	}
+
+	attachment, err := h.usecase.AttachDocument(r.Context(), documentID, body.ComplaintID)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, attachment, "Document attached to complaint successfully", http.StatusCreated)
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"Complaingo/internal/middleware"
+	"Complaingo/internal/storage"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// FileHandler serves blob content behind signed, expiring links instead of
+// an open static file server.
+type FileHandler struct {
+	store  storage.BlobStore
+	signer *storage.URLSigner
+}
+
+func NewFileHandler(store storage.BlobStore, signer *storage.URLSigner) *FileHandler {
+	return &FileHandler{
+		store:  store,
+		signer: signer,
+	}
+}
+
+func (h *FileHandler) ServeSignedFile(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/files/")
+	query := r.URL.Query()
+
+	if err := h.signer.Verify(key, query.Get("expires"), query.Get("signature")); err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	content, info, err := h.store.Get(r.Context(), key)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+	defer content.Close()
+
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, no-store")
+	if info.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, content)
+}
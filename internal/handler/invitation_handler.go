@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"Complaingo/internal/domain/models"
+	"Complaingo/internal/middleware"
+	"Complaingo/internal/usecase"
+	"Complaingo/internal/validation"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/gorilla/mux"
+)
+
+type InvitationHandler struct {
+	usecase *usecase.InvitationUsecase
+}
+
+func NewInvitationHandler(uc *usecase.InvitationUsecase) *InvitationHandler {
+	return &InvitationHandler{usecase: uc}
+}
+
+func (h *InvitationHandler) CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	var body validation.InviteInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid invitation data"))
+		return
+	}
+
+	inv, err := h.usecase.Invite(r.Context(), body)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, inv, "Invitation sent successfully", http.StatusCreated)
+}
+
+// GetInvitations lists invitations, filtered by status and email, newest first.
+func (h *InvitationHandler) GetInvitations(w http.ResponseWriter, r *http.Request) {
+	filter, err := invitationFilter(r.URL.Query())
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	invitations, err := h.usecase.GetInvitations(r.Context(), filter)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, invitations, "Invitations retrieved successfully", http.StatusOK)
+}
+
+func (h *InvitationHandler) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("id invalid"))
+		return
+	}
+
+	if err := h.usecase.RevokeInvitation(r.Context(), id); err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, nil, "Invitation revoked successfully", http.StatusOK)
+}
+
+// AcceptInvitation is public: the token in the body is the credential.
+func (h *InvitationHandler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	var body validation.AcceptInviteInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid invitation data"))
+		return
+	}
+
+	user, err := h.usecase.Accept(r.Context(), body)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, user, "Invitation accepted successfully", http.StatusCreated)
+}
+
+func invitationFilter(q url.Values) (models.InvitationFilter, error) {
+	filter := models.InvitationFilter{
+		Status:  q.Get("status"),
+		Email:   q.Get("email"),
+		Page:    1,
+		PerPage: 50,
+	}
+
+	switch filter.Status {
+	case "", models.InvitationPending, models.InvitationAccepted, models.InvitationRevoked, models.InvitationExpired:
+	default:
+		return filter, appErrors.ErrInvalidPayload.New("status must be pending, accepted, revoked or expired")
+	}
+	if v := q.Get("page"); v != "" {
+		page, err := strconv.Atoi(v)
+		if err != nil || page < 1 {
+			return filter, appErrors.ErrInvalidPayload.New("page must be a positive number")
+		}
+		filter.Page = page
+	}
+	if v := q.Get("per_page"); v != "" {
+		perPage, err := strconv.Atoi(v)
+		if err != nil || perPage < 1 || perPage > 200 {
+			return filter, appErrors.ErrInvalidPayload.New("per_page must be between 1 and 200")
+		}
+		filter.PerPage = perPage
+	}
+
+	return filter, nil
+}
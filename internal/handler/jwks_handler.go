@@ -0,0 +1,18 @@
+package handler
+
+import (
+	"Complaingo/internal/auth"
+	"encoding/json"
+	"net/http"
+)
+
+// JWKS serves the public token verification keys in the standard JWK Set
+// format, not wrapped in the usual response envelope, so that off the shelf
+// verifiers such as the API gateway can consume it.
+func JWKS(tokens *auth.TokenService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(tokens.JWKS())
+	}
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"Complaingo/internal/domain/models"
+	"Complaingo/internal/middleware"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/gorilla/mux"
+)
+
+// GetLoginAudit lists login attempts, filtered by user_id, email, ip,
+// success and a since/until window (RFC 3339), newest first.
+func (h *UserHandler) GetLoginAudit(w http.ResponseWriter, r *http.Request) {
+	filter, err := loginAuditFilter(r.URL.Query())
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	attempts, err := h.usecase.GetLoginAttempts(r.Context(), filter)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, attempts, "Login attempts retrieved successfully", http.StatusOK)
+}
+
+func (h *UserHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("id invalid"))
+		return
+	}
+
+	if err := h.usecase.UnlockUser(r.Context(), id); err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, nil, "User unlocked successfully", http.StatusOK)
+}
+
+func loginAuditFilter(q url.Values) (models.LoginAuditFilter, error) {
+	filter := models.LoginAuditFilter{
+		Email:   q.Get("email"),
+		IP:      q.Get("ip"),
+		Page:    1,
+		PerPage: 50,
+	}
+
+	if v := q.Get("user_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 1 {
+			return filter, appErrors.ErrInvalidPayload.New("user_id must be a positive number")
+		}
+		filter.UserID = id
+	}
+	if v := q.Get("success"); v != "" {
+		success, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, appErrors.ErrInvalidPayload.New("success must be true or false")
+		}
+		filter.Success = &success
+	}
+	for name, dst := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, appErrors.ErrInvalidPayload.New("%s must be an RFC 3339 time", name)
+			}
+			*dst = t
+		}
+	}
+	if v := q.Get("page"); v != "" {
+		page, err := strconv.Atoi(v)
+		if err != nil || page < 1 {
+			return filter, appErrors.ErrInvalidPayload.New("page must be a positive number")
+		}
+		filter.Page = page
+	}
+	if v := q.Get("per_page"); v != "" {
+		perPage, err := strconv.Atoi(v)
+		if err != nil || perPage < 1 || perPage > 200 {
+			return filter, appErrors.ErrInvalidPayload.New("per_page must be between 1 and 200")
+		}
+		filter.PerPage = perPage
+	}
+
+	return filter, nil
+}
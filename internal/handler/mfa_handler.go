@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"Complaingo/internal/middleware"
+	"Complaingo/internal/validation"
+	"encoding/json"
+	"net/http"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+// VerifyMFA finishes a login that answered with a challenge.
+func (h *UserHandler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	var body validation.MFAVerifyInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid verification data"))
+		return
+	}
+
+	if err := body.ValidateMFAVerifyInput(); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.Wrap(err, "Validation failed"))
+		return
+	}
+
+	tokens, err := h.usecase.VerifyMFA(r.Context(), body.ChallengeToken, body.Code, body.RecoveryCode, clientInfo(r))
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, tokens, "User login successfully", http.StatusCreated)
+}
+
+// EnrollMFA starts enrolment for a user whose login requires 2FA first.
+func (h *UserHandler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	var body validation.MFAChallengeInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid enrolment data"))
+		return
+	}
+
+	if err := body.ValidateMFAChallengeInput(); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.Wrap(err, "Validation failed"))
+		return
+	}
+
+	setup, err := h.usecase.BeginMFAEnrollment(r.Context(), body.ChallengeToken)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, setup, "Scan the code with an authenticator app", http.StatusOK)
+}
+
+func (h *UserHandler) ConfirmMFAEnrollment(w http.ResponseWriter, r *http.Request) {
+	var body validation.MFAEnrollInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid enrolment data"))
+		return
+	}
+
+	if err := body.ValidateMFAEnrollInput(); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.Wrap(err, "Validation failed"))
+		return
+	}
+
+	enrollment, err := h.usecase.ConfirmMFAEnrollment(r.Context(), body.ChallengeToken, body.Code, clientInfo(r))
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, enrollment, "Two-factor authentication enabled, store the recovery codes safely", http.StatusCreated)
+}
+
+func (h *UserHandler) SetupMFA(w http.ResponseWriter, r *http.Request) {
+	setup, err := h.usecase.BeginMFASetup(r.Context())
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, setup, "Scan the code with an authenticator app", http.StatusOK)
+}
+
+func (h *UserHandler) ConfirmMFASetup(w http.ResponseWriter, r *http.Request) {
+	var body validation.MFACodeInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid code"))
+		return
+	}
+
+	if err := body.ValidateMFACodeInput(); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.Wrap(err, "Validation failed"))
+		return
+	}
+
+	enrollment, err := h.usecase.ConfirmMFASetup(r.Context(), body.Code)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, enrollment, "Two-factor authentication enabled, store the recovery codes safely", http.StatusOK)
+}
+
+func (h *UserHandler) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	var body validation.SecondFactorInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid code"))
+		return
+	}
+
+	if err := body.ValidateSecondFactorInput(); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.Wrap(err, "Validation failed"))
+		return
+	}
+
+	if err := h.usecase.DisableMFA(r.Context(), body.Code, body.RecoveryCode); err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, nil, "Two-factor authentication disabled", http.StatusOK)
+}
+
+func (h *UserHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var body validation.MFACodeInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid code"))
+		return
+	}
+
+	if err := body.ValidateMFACodeInput(); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.Wrap(err, "Validation failed"))
+		return
+	}
+
+	codes, err := h.usecase.RegenerateRecoveryCodes(r.Context(), body.Code)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, codes, "Recovery codes replaced", http.StatusOK)
+}
@@ -0,0 +1,19 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+// decodePatch reads a partial update. Unknown fields are refused so that a
+// misspelt or read only field isn't silently ignored.
+func decodePatch(r *http.Request, patch any) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(patch); err != nil {
+		return appErrors.ErrInvalidPayload.Wrap(err, "Invalid patch")
+	}
+	return nil
+}
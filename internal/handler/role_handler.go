@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"Complaingo/internal/middleware"
+	"Complaingo/internal/usecase"
+	"Complaingo/internal/validation"
+	"encoding/json"
+	"net/http"
+
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/gorilla/mux"
+)
+
+type RoleHandler struct {
+	usecase *usecase.RoleUsecase
+}
+
+func NewRoleHandler(uc *usecase.RoleUsecase) *RoleHandler {
+	return &RoleHandler{usecase: uc}
+}
+
+func (h *RoleHandler) GetPermissions(w http.ResponseWriter, r *http.Request) {
+	perms, err := h.usecase.GetPermissions(r.Context())
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, perms, "Permissions retrieved successfully", http.StatusOK)
+}
+
+func (h *RoleHandler) GetRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.usecase.GetRoles(r.Context())
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, roles, "Roles retrieved successfully", http.StatusOK)
+}
+
+func (h *RoleHandler) GetRole(w http.ResponseWriter, r *http.Request) {
+	role, err := h.usecase.GetRole(r.Context(), mux.Vars(r)["name"])
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, role, "Role retrieved successfully", http.StatusOK)
+}
+
+func (h *RoleHandler) CreateRole(w http.ResponseWriter, r *http.Request) {
+	var body validation.RoleInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid role data"))
+		return
+	}
+
+	role, err := h.usecase.CreateRole(r.Context(), body)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, role, "Role created successfully", http.StatusCreated)
+}
+
+// UpdateRole replaces the role's description and permissions.
+func (h *RoleHandler) UpdateRole(w http.ResponseWriter, r *http.Request) {
+	var body validation.RoleInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid role data"))
+		return
+	}
+	body.Name = mux.Vars(r)["name"]
+
+	role, err := h.usecase.UpdateRole(r.Context(), body)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, role, "Role updated successfully", http.StatusOK)
+}
+
+func (h *RoleHandler) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	if err := h.usecase.DeleteRole(r.Context(), mux.Vars(r)["name"]); err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, nil, "Role deleted successfully", http.StatusOK)
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"Complaingo/internal/middleware"
+	"Complaingo/internal/usecase"
+	"net/http"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+// the sealed login state lives in this cookie between login and callback
+const ssoFlowCookie = "oidc_flow"
+
+type SSOHandler struct {
+	usecase *usecase.SSOUsecase
+}
+
+func NewSSOHandler(uc *usecase.SSOUsecase) *SSOHandler {
+	return &SSOHandler{usecase: uc}
+}
+
+// Login redirects the browser to the identity provider.
+func (h *SSOHandler) Login(w http.ResponseWriter, r *http.Request) {
+	authURL, flow, err := h.usecase.Begin(r.Context())
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     ssoFlowCookie,
+		Value:    flow,
+		Path:     "/auth/oidc",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		// the callback is a top level navigation from the provider
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Callback is where the provider sends the browser back with a code.
+func (h *SSOHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if e := query.Get("error"); e != "" {
+		middleware.WriteError(w, appErrors.ErrUnauthorized.New("identity provider refused the login: %s %s", e, query.Get("error_description")))
+		return
+	}
+
+	var flow string
+	if c, err := r.Cookie(ssoFlowCookie); err == nil {
+		flow = c.Value
+	}
+	// the flow is single use whatever happens next
+	http.SetCookie(w, &http.Cookie{Name: ssoFlowCookie, Value: "", Path: "/auth/oidc", MaxAge: -1, HttpOnly: true, Secure: isHTTPS(r)})
+
+	tokens, err := h.usecase.Callback(r.Context(), flow, query.Get("state"), query.Get("code"), clientInfo(r))
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, tokens, "User login successfully", http.StatusCreated)
+}
+
+func isHTTPS(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
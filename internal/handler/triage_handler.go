@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"Complaingo/internal/middleware"
+	"Complaingo/internal/usecase"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/gorilla/mux"
+)
+
+type TriageHandler struct {
+	usecase *usecase.TriageUsecase
+}
+
+func NewTriageHandler(uc *usecase.TriageUsecase) *TriageHandler {
+	return &TriageHandler{usecase: uc}
+}
+
+// GetTriage lists what the model suggested for a complaint, and what became of it.
+func (h *TriageHandler) GetTriage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid id"))
+		return
+	}
+
+	suggestions, err := h.usecase.GetSuggestions(r.Context(), id)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, suggestions, "Triage suggestions fetched successfully", http.StatusOK)
+}
+
+func (h *TriageHandler) AcceptTriage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid id"))
+		return
+	}
+
+	decision, err := h.usecase.Accept(r.Context(), id, mux.Vars(r)["field"])
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, decision, "Triage suggestion accepted", http.StatusOK)
+}
+
+func (h *TriageHandler) OverrideTriage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid id"))
+		return
+	}
+
+	var body struct {
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid request body"))
+		return
+	}
+
+	decision, err := h.usecase.Override(r.Context(), id, mux.Vars(r)["field"], body.Value)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, decision, "Triage suggestion overridden", http.StatusOK)
+}
+
+// GetTriageAccuracy reports per field how often admins kept what the model suggested.
+func (h *TriageHandler) GetTriageAccuracy(w http.ResponseWriter, r *http.Request) {
+	accuracy, err := h.usecase.GetAccuracy(r.Context())
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, accuracy, "Triage accuracy fetched successfully", http.StatusOK)
+}
@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+// multipartOverhead leaves room for form fields and part headers on top of
+// the file contents.
+const multipartOverhead = 1 << 20
+
+// limitUploadBody caps the request body so oversized uploads are cut off
+// while they are read instead of after they hit the disk.
+func limitUploadBody(w http.ResponseWriter, r *http.Request, maxFileBytes int64, files int) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxFileBytes*int64(files)+multipartOverhead)
+}
+
+// uploadFormError turns multipart parsing failures into typed errors.
+func uploadFormError(err error, message string) error {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return appErrors.ErrFileTooLarge.New("request body exceeds the %d byte limit", maxErr.Limit)
+	}
+	return appErrors.ErrInvalidPayload.Wrap(err, message)
+}
@@ -3,16 +3,15 @@ package handler
 import (
 	"Complaingo/internal/domain/models"
 	"Complaingo/internal/middleware"
-	"Complaingo/internal/redis"
 	"Complaingo/internal/usecase"
 	"Complaingo/internal/utility"
 	"Complaingo/internal/validation"
 	"encoding/json"
-	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"strconv"
-	"time"
+	"strings"
 
 	appErrors "Complaingo/internal/errors"
 
@@ -77,37 +76,20 @@ func (h *UserHandler) GetUserByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// check redis catch first
-	chachKey := fmt.Sprintf("user:%d", id)
-	catchUserJson, err := redis.RDB.Get(redis.Ctx, chachKey).Result()
-
-	if err == nil {
-		// found on catch return it
-		var cathUser models.User
-		if err := json.Unmarshal([]byte(catchUserJson), &cathUser); err == nil {
-			middleware.WriteSuccess(w, cathUser, "user fetched from catch", http.StatusOK)
-			return
-		}
-	}
-
-	// if not found in cache, fetch from DB
 	user, err := h.usecase.GetUserByID(r.Context(), id)
 	if err != nil {
 		middleware.WriteError(w, err)
 		return
 	}
 
-	// cache the result for future use
-	userJson, _ := json.Marshal(user)
-	redis.RDB.Set(redis.Ctx, chachKey, userJson, time.Minute*10)
-
-	middleware.WriteSuccess(w, user, "user successfully get by pk id", http.StatusOK)
+	middleware.WriteSuccessETag(w, r, middleware.VersionETag(user.Version), user, "user successfully get by pk id", http.StatusOK)
 }
 
+// UpdateUser only changes the fields present in the body.
 func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
-	u := &models.User{}
-	if err := json.NewDecoder(r.Body).Decode(u); err != nil {
-		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalide user data"))
+	var body models.UserPatch
+	if err := decodePatch(r, &body); err != nil {
+		middleware.WriteError(w, err)
 		return
 	}
 
@@ -118,14 +100,19 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	u.ID = id
-	err = h.usecase.UpdateUser(r.Context(), u)
+	version, err := middleware.IfMatch(r)
 	if err != nil {
 		middleware.WriteError(w, err)
 		return
 	}
 
-	middleware.WriteSuccess(w, u, "User updated successfully", http.StatusCreated)
+	user, err := h.usecase.UpdateUser(r.Context(), id, body, version)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+	w.Header().Set("ETag", middleware.VersionETag(user.Version))
+	middleware.WriteSuccess(w, user, "User updated successfully", http.StatusOK)
 }
 
 func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
@@ -133,9 +120,16 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
 		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("id invalid"))
+		return
+	}
+
+	version, err := middleware.IfMatch(r)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
 	}
 
-	err = h.usecase.DeleteUser(r.Context(), id)
+	err = h.usecase.DeleteUser(r.Context(), id, version)
 	if err != nil {
 		middleware.WriteError(w, err)
 		return
@@ -144,6 +138,31 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	middleware.WriteSuccess(w, nil, "User Deleted Successfully", http.StatusAccepted)
 }
 
+func (h *UserHandler) AssignRole(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("id invalid"))
+		return
+	}
+
+	var body validation.RoleAssignInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid role data"))
+		return
+	}
+	if err := body.ValidateRoleAssignInput(); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.Wrap(err, "Validation failed"))
+		return
+	}
+
+	if err := h.usecase.AssignRole(r.Context(), id, body.Role); err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, nil, "Role assigned successfully", http.StatusOK)
+}
+
 func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var body validation.LoginInput
 
@@ -161,15 +180,152 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// perform login logic
-	resp, err := h.usecase.Login(r.Context(), body.Email, body.Password)
+	resp, err := h.usecase.Login(r.Context(), body.Email, body.Password, clientInfo(r))
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	// the password was right but a second factor is still needed
+	if resp.Challenge != nil {
+		middleware.WriteSuccess(w, resp.Challenge, "Two-factor authentication required", http.StatusOK)
+		return
+	}
+
+	middleware.WriteSuccess(w, resp.Tokens, "User login successfully", http.StatusCreated)
+}
+
+func (h *UserHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var body validation.RefreshInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid refresh data"))
+		return
+	}
+
+	if err := body.ValidateRefreshInput(); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.Wrap(err, "Validation failed"))
+		return
+	}
+
+	tokens, err := h.usecase.Refresh(r.Context(), body.RefreshToken, clientInfo(r))
 	if err != nil {
 		middleware.WriteError(w, err)
 		return
 	}
 
-	// cache the user login in redis
-	userJson, _ := json.Marshal(resp.User)
-	redis.RDB.Set(redis.Ctx, fmt.Sprintf("User:%d", resp.User.ID), userJson, time.Minute*10)
+	middleware.WriteSuccess(w, tokens, "Token refreshed successfully", http.StatusOK)
+}
+
+// Logout accepts an optional refresh token to end that session as well.
+func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var body validation.RefreshInput
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid logout data"))
+			return
+		}
+	}
+
+	if err := h.usecase.Logout(r.Context(), body.RefreshToken); err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, nil, "Logged out successfully", http.StatusOK)
+}
+
+func (h *UserHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	if err := h.usecase.LogoutAll(r.Context()); err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, nil, "Logged out of all sessions successfully", http.StatusOK)
+}
+
+func (h *UserHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var body validation.TokenInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid verification data"))
+		return
+	}
+
+	if err := body.ValidateTokenInput(); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.Wrap(err, "Validation failed"))
+		return
+	}
+
+	if err := h.usecase.VerifyEmail(r.Context(), body.Token); err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, nil, "Email verified successfully", http.StatusOK)
+}
+
+func (h *UserHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	if err := h.usecase.ResendVerification(r.Context()); err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, nil, "Verification email sent", http.StatusAccepted)
+}
+
+// ForgotPassword answers the same way whether or not the email is known.
+func (h *UserHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var body validation.EmailInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid email data"))
+		return
+	}
+
+	if err := body.ValidateEmailInput(); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.Wrap(err, "Validation failed"))
+		return
+	}
+
+	if err := h.usecase.ForgotPassword(r.Context(), body.Email); err != nil {
+		log.Println("failed to send password reset:", err)
+	}
+
+	middleware.WriteSuccess(w, nil, "If the email is registered, a reset link has been sent", http.StatusAccepted)
+}
+
+func (h *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var body validation.ResetPasswordInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid reset data"))
+		return
+	}
+
+	if err := body.ValidateResetPasswordInput(); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.Wrap(err, "Validation failed"))
+		return
+	}
+
+	if err := h.usecase.ResetPassword(r.Context(), body.Token, body.Password); err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, nil, "Password reset successfully", http.StatusOK)
+}
 
-	middleware.WriteSuccess(w, resp.Token, "User login successfully", http.StatusCreated)
+// clientInfo records where a session comes from. Behind the gateway the
+// last X-Forwarded-For hop is the one the gateway itself appended.
+func clientInfo(r *http.Request) models.ClientInfo {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		ip = strings.TrimSpace(hops[len(hops)-1])
+	}
+
+	return models.ClientInfo{
+		UserAgent: r.UserAgent(),
+		IP:        ip,
+	}
 }
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"Complaingo/internal/middleware"
+	"Complaingo/internal/validation"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/gorilla/mux"
+)
+
+func (h *UserHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
+	user, err := h.usecase.GetProfile(r.Context())
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccessETag(w, r, middleware.VersionETag(user.Version), user, "Profile retrieved successfully", http.StatusOK)
+}
+
+func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	version, err := middleware.IfMatch(r)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	var body validation.ProfilePatch
+	if err := decodePatch(r, &body); err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	user, err := h.usecase.UpdateProfile(r.Context(), body, version)
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", middleware.VersionETag(user.Version))
+	middleware.WriteSuccess(w, user, "Profile updated successfully", http.StatusOK)
+}
+
+// ChangePassword answers with a new token pair, every other session ends.
+func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var body validation.ChangePasswordInput
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("Invalid password data"))
+		return
+	}
+
+	pair, err := h.usecase.ChangePassword(r.Context(), body, clientInfo(r))
+	if err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, pair, "Password changed successfully", http.StatusOK)
+}
+
+func (h *UserHandler) DeactivateUser(w http.ResponseWriter, r *http.Request) {
+	h.changeUser(w, r, h.usecase.Deactivate, "User deactivated successfully")
+}
+
+func (h *UserHandler) ReactivateUser(w http.ResponseWriter, r *http.Request) {
+	h.changeUser(w, r, h.usecase.Reactivate, "User reactivated successfully")
+}
+
+func (h *UserHandler) AnonymizeUser(w http.ResponseWriter, r *http.Request) {
+	h.changeUser(w, r, h.usecase.Anonymize, "User anonymized successfully")
+}
+
+func (h *UserHandler) changeUser(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, id int) error, message string) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		middleware.WriteError(w, appErrors.ErrInvalidPayload.New("id invalid"))
+		return
+	}
+
+	if err := change(r.Context(), id); err != nil {
+		middleware.WriteError(w, err)
+		return
+	}
+
+	middleware.WriteSuccess(w, nil, message, http.StatusOK)
+}
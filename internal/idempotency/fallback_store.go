@@ -0,0 +1,105 @@
+package idempotency
+
+import (
+	"Complaingo/internal/breaker"
+	"Complaingo/internal/domain/models"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/joomcode/errorx"
+)
+
+// FallbackStore uses primary, and fallback while breaker skips primary or
+// primary fails, so that losing Redis doesn't fail every request sent with a
+// key. A key is completed or released in the store that claimed it. Keys
+// answered before the switch aren't seen by the other store, so those
+// retries run again.
+type FallbackStore struct {
+	primary  Store
+	fallback Store
+	breaker  *breaker.Breaker
+
+	mu     sync.Mutex
+	claims map[string]Store
+}
+
+func NewFallbackStore(primary, fallback Store, b *breaker.Breaker) *FallbackStore {
+	return &FallbackStore{
+		primary:  primary,
+		fallback: fallback,
+		breaker:  b,
+		claims:   make(map[string]Store),
+	}
+}
+
+func (s *FallbackStore) Begin(ctx context.Context, req Request, lock time.Duration) (*models.IdempotentResponse, error) {
+	var resp *models.IdempotentResponse
+	// conflicts and mismatches are answers, not failures of the store
+	var answer error
+	store := s.primary
+	err := s.breaker.Call(ctx, func(ctx context.Context) (err error) {
+		resp, err = s.primary.Begin(ctx, req, lock)
+		if err != nil && !errorx.IsOfType(err, appErrors.ErrDbFailure) {
+			answer, err = err, nil
+		}
+		return err
+	})
+	if err != nil {
+		store = s.fallback
+		resp, answer = store.Begin(ctx, req, lock)
+	}
+
+	if answer == nil && resp == nil {
+		s.mu.Lock()
+		s.claims[claimKey(req)] = store
+		s.mu.Unlock()
+	}
+	return resp, answer
+}
+
+func (s *FallbackStore) Complete(ctx context.Context, req Request, resp *models.IdempotentResponse, ttl time.Duration) error {
+	return s.call(ctx, s.claimed(req), func(ctx context.Context, store Store) error {
+		return store.Complete(ctx, req, resp, ttl)
+	})
+}
+
+func (s *FallbackStore) Release(ctx context.Context, req Request) error {
+	return s.call(ctx, s.claimed(req), func(ctx context.Context, store Store) error {
+		return store.Release(ctx, req)
+	})
+}
+
+// call runs fn against store, through the breaker when it is the primary.
+func (s *FallbackStore) call(ctx context.Context, store Store, fn func(ctx context.Context, store Store) error) error {
+	if store != s.primary {
+		return fn(ctx, store)
+	}
+	err := s.breaker.Call(ctx, func(ctx context.Context) error {
+		return fn(ctx, store)
+	})
+	if err == breaker.ErrOpen {
+		return appErrors.ErrDbFailure.New("idempotency store unavailable")
+	}
+	return err
+}
+
+// claimed forgets which store claimed req and returns it.
+func (s *FallbackStore) claimed(req Request) Store {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	store, ok := s.claims[claimKey(req)]
+	if !ok {
+		return s.primary
+	}
+	delete(s.claims, claimKey(req))
+	return store
+}
+
+func claimKey(req Request) string {
+	return fmt.Sprintf("%d:%s", req.UserID, req.Key)
+}
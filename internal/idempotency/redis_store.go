@@ -0,0 +1,78 @@
+package idempotency
+
+import (
+	"Complaingo/internal/domain/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore shares keys between every instance of the service. Entries
+// expire on their own, the in flight ones after the lock.
+type RedisStore struct {
+	client *redis.Client
+}
+
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+type redisEntry struct {
+	Fingerprint string                     `json:"fingerprint"`
+	Response    *models.IdempotentResponse `json:"response,omitempty"`
+}
+
+func redisKey(req Request) string {
+	return fmt.Sprintf("idempotency:%d:%s", req.UserID, req.Key)
+}
+
+func (s *RedisStore) Begin(ctx context.Context, req Request, lock time.Duration) (*models.IdempotentResponse, error) {
+	pending, _ := json.Marshal(redisEntry{Fingerprint: req.Fingerprint})
+	for {
+		claimed, err := s.client.SetNX(ctx, redisKey(req), pending, lock).Result()
+		if err != nil {
+			return nil, appErrors.ErrDbFailure.Wrap(err, "failed to claim idempotency key")
+		}
+		if claimed {
+			return nil, nil
+		}
+
+		raw, err := s.client.Get(ctx, redisKey(req)).Bytes()
+		if err == redis.Nil {
+			// expired in between, try to claim it again
+			continue
+		}
+		if err != nil {
+			return nil, appErrors.ErrDbFailure.Wrap(err, "failed to read idempotency key")
+		}
+
+		var entry redisEntry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return nil, appErrors.ErrDbFailure.Wrap(err, "invalid idempotency entry")
+		}
+		return Existing(req, entry.Fingerprint, entry.Response)
+	}
+}
+
+func (s *RedisStore) Complete(ctx context.Context, req Request, resp *models.IdempotentResponse, ttl time.Duration) error {
+	raw, err := json.Marshal(redisEntry{Fingerprint: req.Fingerprint, Response: resp})
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to encode idempotent response")
+	}
+	if err := s.client.Set(ctx, redisKey(req), raw, ttl).Err(); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to store idempotent response")
+	}
+	return nil
+}
+
+func (s *RedisStore) Release(ctx context.Context, req Request) error {
+	if err := s.client.Del(ctx, redisKey(req)).Err(); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to release idempotency key")
+	}
+	return nil
+}
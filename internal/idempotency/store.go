@@ -0,0 +1,41 @@
+package idempotency
+
+import (
+	"Complaingo/internal/domain/models"
+	"context"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+// Request identifies a request sent with an Idempotency-Key. Keys belong to
+// the user who sent them; the fingerprint catches a key reused for another
+// endpoint or another body.
+type Request struct {
+	UserID      int
+	Key         string
+	Fingerprint string
+}
+
+// Store remembers the first response to each request.
+//
+// Begin claims the key for lock. It returns the stored response once the key
+// has been answered and a conflict while another request holds it. When it
+// returns nil, nil the caller owns the key and must Complete or Release it.
+type Store interface {
+	Begin(ctx context.Context, req Request, lock time.Duration) (*models.IdempotentResponse, error)
+	Complete(ctx context.Context, req Request, resp *models.IdempotentResponse, ttl time.Duration) error
+	Release(ctx context.Context, req Request) error
+}
+
+// Existing decides what a retry gets, given the fingerprint and response
+// stored for its key. A nil response means the first request is in flight.
+func Existing(req Request, fingerprint string, resp *models.IdempotentResponse) (*models.IdempotentResponse, error) {
+	if fingerprint != req.Fingerprint {
+		return nil, appErrors.ErrUnprocessable.New("Idempotency-Key was already used for a different request")
+	}
+	if resp == nil {
+		return nil, appErrors.ErrConflict.New("a request with this Idempotency-Key is still in progress")
+	}
+	return resp, nil
+}
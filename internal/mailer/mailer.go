@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"context"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers transactional email such as verification links.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+type Config struct {
+	Kind     string // "log" (default), "file" or "smtp"
+	From     string
+	Dir      string // where the file sink writes messages
+	SMTPHost string
+	SMTPPort string
+	Username string
+	Password string
+}
+
+// New returns the mailer selected by MAILER.
+func New(cfg Config) (Mailer, error) {
+	switch cfg.Kind {
+	case "", "log":
+		return LogMailer{}, nil
+	case "file":
+		return NewFileMailer(cfg.Dir, cfg.From), nil
+	case "smtp":
+		if cfg.SMTPHost == "" || cfg.From == "" {
+			return nil, appErrors.ErrInvalidPayload.New("smtp mailer needs SMTP_HOST and MAIL_FROM")
+		}
+		return NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.Username, cfg.Password, cfg.From), nil
+	default:
+		return nil, appErrors.ErrInvalidPayload.New("unknown mailer %q", cfg.Kind)
+	}
+}
@@ -0,0 +1,84 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+// LogMailer prints messages to the log, for local development.
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileMailer writes every message to its own .eml file, so links can be
+// picked up by hand or by a test without a mail server.
+type FileMailer struct {
+	dir  string
+	from string
+	mu   sync.Mutex
+	seq  int
+}
+
+func NewFileMailer(dir, from string) *FileMailer {
+	if from == "" {
+		from = "complaingo@localhost"
+	}
+	return &FileMailer{dir: dir, from: from}
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to create mail directory")
+	}
+
+	m.mu.Lock()
+	m.seq++
+	name := fmt.Sprintf("%d-%03d.eml", time.Now().UnixNano(), m.seq)
+	m.mu.Unlock()
+
+	if err := os.WriteFile(filepath.Join(m.dir, name), buildMessage(m.from, msg), 0o644); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to write mail")
+	}
+	return nil
+}
+
+// MemoryMailer keeps sent messages in memory for tests.
+type MemoryMailer struct {
+	mu   sync.Mutex
+	sent []Message
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// Sent returns the messages delivered to the address, oldest first.
+func (m *MemoryMailer) Sent(to string) []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var out []Message
+	for _, msg := range m.sent {
+		if msg.To == to {
+			out = append(out, msg)
+		}
+	}
+	return out
+}
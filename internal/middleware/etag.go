@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+// AnyVersion is what IfMatch returns for "If-Match: *".
+const AnyVersion = 0
+
+// VersionETag is the ETag of a resource with a version column.
+func VersionETag(version int) string {
+	return fmt.Sprintf(`"v%d"`, version)
+}
+
+// ContentETag is a weak ETag for responses without a version, like lists.
+func ContentETag(data any) string {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return `W/"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// IfMatch returns the version the client last saw. Writes to versioned
+// resources must say which version they change, so a missing header is an
+// error rather than a blind overwrite.
+func IfMatch(r *http.Request) (int, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return 0, appErrors.ErrPreconditionRequired.New("If-Match header is required, send the ETag of the version you are changing")
+	}
+	if header == "*" {
+		return AnyVersion, nil
+	}
+
+	v, ok := strings.CutPrefix(strings.Trim(header, `"`), "v")
+	version, err := strconv.Atoi(v)
+	if !ok || err != nil || version < 1 {
+		return 0, appErrors.ErrPreconditionFailed.New("If-Match must be an ETag returned by this API")
+	}
+	return version, nil
+}
+
+// CheckVersion refuses a write based on a stale copy.
+func CheckVersion(expected, current int) error {
+	if expected != AnyVersion && expected != current {
+		return appErrors.ErrPreconditionFailed.New("the resource has changed, fetch it again")
+	}
+	return nil
+}
+
+// WriteSuccessETag writes data with its ETag, or just 304 when the client's
+// If-None-Match shows it already has it.
+func WriteSuccessETag(w http.ResponseWriter, r *http.Request, etag string, data interface{}, message string, status int) {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+		if noneMatch(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	WriteSuccess(w, data, message, status)
+}
+
+// noneMatch compares weakly, as RFC 9110 asks for If-None-Match.
+func noneMatch(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+package middleware
+
+import (
+	"Complaingo/internal/domain/models"
+	"Complaingo/internal/idempotency"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+// Idempotency replays the first response to requests repeated with the same
+// Idempotency-Key header, for ttl. Requests without the header pass through.
+// Server errors aren't stored so the client can retry them.
+//
+// A request holds its key for lock. Retries in that window get a 409; a
+// crashed request frees the key once it runs out, so lock must be longer
+// than the slowest request.
+func Idempotency(store idempotency.Store, ttl, lock time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("Idempotency-Key")
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !validIdempotencyKey(key) {
+				WriteError(w, appErrors.ErrInvalidPayload.New("Idempotency-Key must be 1 to 255 printable characters"))
+				return
+			}
+
+			fingerprint, err := requestFingerprint(r)
+			if err != nil {
+				WriteError(w, err)
+				return
+			}
+			defer r.Body.Close()
+			req := idempotency.Request{
+				UserID:      GetUserId(r.Context()),
+				Key:         key,
+				Fingerprint: fingerprint,
+			}
+			stored, err := store.Begin(r.Context(), req, lock)
+			if err != nil {
+				WriteError(w, err)
+				return
+			}
+			if stored != nil {
+				replay(w, stored)
+				return
+			}
+
+			rec := &responseRecorder{ResponseWriter: w}
+			done := false
+			defer func() {
+				// a panic must not keep the key locked
+				if !done {
+					if err := store.Release(r.Context(), req); err != nil {
+						log.Printf("failed to release idempotency key %q: %v", key, err)
+					}
+				}
+			}()
+
+			next.ServeHTTP(rec, r)
+
+			if rec.status() < http.StatusInternalServerError {
+				err = store.Complete(r.Context(), req, &models.IdempotentResponse{
+					StatusCode:  rec.status(),
+					ContentType: rec.Header().Get("Content-Type"),
+					Body:        rec.body.Bytes(),
+				}, ttl)
+				if err != nil {
+					log.Printf("failed to store response for idempotency key %q: %v", key, err)
+				} else {
+					done = true
+				}
+			}
+		})
+	}
+}
+
+const (
+	// fingerprintMemory is how much of a body is kept in memory while it is
+	// hashed; the rest of an upload is spooled to a temporary file
+	fingerprintMemory = 1 << 20
+	// maxIdempotentBody bounds the spool, handlers apply their own limits
+	maxIdempotentBody = 256 << 20
+)
+
+// requestFingerprint is the method, path and body hash of r. The body is
+// read and replaced by a copy for the handler, which the caller must close.
+func requestFingerprint(r *http.Request) (string, error) {
+	hash := sha256.New()
+	body := io.TeeReader(io.LimitReader(r.Body, maxIdempotentBody+1), hash)
+
+	var head bytes.Buffer
+	if _, err := io.CopyN(&head, body, fingerprintMemory); err == io.EOF {
+		r.Body = io.NopCloser(&head)
+	} else if err != nil {
+		return "", appErrors.ErrInvalidPayload.Wrap(err, "failed to read request body")
+	} else {
+		spool, err := spoolBody(body)
+		if err != nil {
+			return "", err
+		}
+		r.Body = &spooledBody{Reader: io.MultiReader(&head, spool), file: spool}
+	}
+
+	return r.Method + " " + r.URL.Path + " " + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func spoolBody(body io.Reader) (*os.File, error) {
+	spool, err := os.CreateTemp("", "idempotent-body-*")
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "failed to buffer request body")
+	}
+	discard := func(err error) (*os.File, error) {
+		spool.Close()
+		os.Remove(spool.Name())
+		return nil, err
+	}
+
+	n, err := io.Copy(spool, body)
+	if err != nil {
+		return discard(appErrors.ErrInvalidPayload.Wrap(err, "failed to read request body"))
+	}
+	if fingerprintMemory+n > maxIdempotentBody {
+		return discard(appErrors.ErrFileTooLarge.New("request body exceeds the %d byte limit", maxIdempotentBody))
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return discard(appErrors.ErrDbFailure.Wrap(err, "failed to buffer request body"))
+	}
+	return spool, nil
+}
+
+// spooledBody reads a request body back from memory and its spool file,
+// which goes away on Close.
+type spooledBody struct {
+	io.Reader
+	file *os.File
+}
+
+func (b *spooledBody) Close() error {
+	b.file.Close()
+	return os.Remove(b.file.Name())
+}
+
+func validIdempotencyKey(key string) bool {
+	if len(key) > 255 {
+		return false
+	}
+	return !strings.ContainsFunc(key, func(c rune) bool {
+		return c < '!' || c > '~'
+	})
+}
+
+func replay(w http.ResponseWriter, resp *models.IdempotentResponse) {
+	if resp.ContentType != "" {
+		w.Header().Set("Content-Type", resp.ContentType)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(resp.StatusCode)
+	w.Write(resp.Body)
+}
+
+// responseRecorder copies what the handler writes so it can be replayed.
+type responseRecorder struct {
+	http.ResponseWriter
+	code int
+	body bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(code int) {
+	if rec.code == 0 {
+		rec.code = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.code == 0 {
+		rec.code = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *responseRecorder) status() int {
+	if rec.code == 0 {
+		return http.StatusOK
+	}
+	return rec.code
+}
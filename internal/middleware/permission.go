@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"Complaingo/internal/domain/models"
+	"context"
+	"net/http"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+const ContextPermissions ContextKey = "permissions"
+
+// PermissionSource tells what a role may do. Lookups are expected to be
+// cached, they happen on every authenticated request.
+type PermissionSource interface {
+	RolePermissions(ctx context.Context, role string) (models.PermissionSet, error)
+}
+
+// Permissions loads the permissions of the caller's role into the context.
+// It must run after Authentication. An api key only keeps the permissions
+// that are both in its scopes and still held by its owner's role.
+func Permissions(source PermissionSource) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			perms, err := source.RolePermissions(r.Context(), GetUserRole(r.Context()))
+			if err != nil {
+				WriteError(w, err)
+				return
+			}
+
+			if scopes, ok := r.Context().Value(ContextAPIKeyScopes).(models.PermissionSet); ok {
+				perms = intersect(perms, scopes)
+			}
+
+			ctx := context.WithValue(r.Context(), ContextPermissions, perms)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequirePermission lets the request through only when the caller's role has
+// every one of perms. It must run after Permissions.
+func RequirePermission(perms ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, perm := range perms {
+				if !HasPermission(r.Context(), perm) {
+					WriteError(w, appErrors.ErrForbidden.New("missing permission %s", perm))
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// HasPermission reports whether the caller's role has perm. Without loaded
+// permissions the answer is no.
+func HasPermission(ctx context.Context, perm string) bool {
+	perms, _ := ctx.Value(ContextPermissions).(models.PermissionSet)
+	return perms.Has(perm)
+}
+
+func intersect(a, b models.PermissionSet) models.PermissionSet {
+	set := make(models.PermissionSet)
+	for perm := range a {
+		if b.Has(perm) {
+			set[perm] = true
+		}
+	}
+	return set
+}
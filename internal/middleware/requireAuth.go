@@ -1,11 +1,13 @@
 package middleware
 
 import (
-	"Complaingo/internal/utility"
+	"Complaingo/internal/auth"
+	"Complaingo/internal/domain/models"
 	"context"
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	appErrors "Complaingo/internal/errors"
 )
@@ -16,9 +18,30 @@ const (
 	ContextUserID ContextKey = "user_id"
 	ContextRole   ContextKey = "role"
 	ContextEmail  ContextKey = "email"
+	// jti and expiry of the access token, used to revoke it on logout
+	ContextTokenID     ContextKey = "jti"
+	ContextTokenExpiry ContextKey = "token_exp"
+	// set instead of the token fields when the caller is an api key
+	ContextAPIKeyID     ContextKey = "api_key_id"
+	ContextAPIKeyScopes ContextKey = "api_key_scopes"
 )
 
-func Authentication(next http.Handler) http.Handler {
+// APIKeyVerifier resolves the raw key of an "Authorization: ApiKey" header,
+// refusing unknown, revoked and expired keys.
+type APIKeyVerifier interface {
+	VerifyAPIKey(ctx context.Context, raw string) (*models.APIKey, error)
+}
+
+// Authentication validates the bearer token and rejects tokens revoked
+// through the denylist, either individually or by a per-user cutoff. API keys
+// are accepted too; they act as their owner, limited to their scopes.
+func Authentication(tokens *auth.TokenService, denylist auth.Denylist, apiKeys APIKeyVerifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return authenticate(tokens, denylist, apiKeys, next)
+	}
+}
+
+func authenticate(tokens *auth.TokenService, denylist auth.Denylist, apiKeys APIKeyVerifier, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// get the bearer of the req body
 		authHeader := r.Header.Get("Authorization")
@@ -26,34 +49,81 @@ func Authentication(next http.Handler) http.Handler {
 			WriteError(w, appErrors.ErrUnauthorized.New("authorization header not found"))
 			return
 		}
+
+		if raw, ok := strings.CutPrefix(authHeader, "ApiKey "); ok {
+			key, err := apiKeys.VerifyAPIKey(r.Context(), strings.TrimSpace(raw))
+			if err != nil {
+				WriteError(w, err)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), ContextUserID, key.UserID)
+			ctx = context.WithValue(ctx, ContextRole, key.OwnerRole)
+			ctx = context.WithValue(ctx, ContextAPIKeyID, key.ID)
+			ctx = context.WithValue(ctx, ContextAPIKeyScopes, models.NewPermissionSet(key.Scopes))
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		tokeStr := strings.TrimPrefix(authHeader, "Bearer ")
 
-		claims, err := utility.ValidateToken(tokeStr)
+		claims, err := tokens.Parse(tokeStr)
 		if err != nil {
 			WriteError(w, appErrors.ErrUnauthorized.Wrap(err, "Claim not authorized"))
 			return
 		}
 
-		userIdFloat, ok := claims["user_id"].(float64)
-		if !ok {
-			log.Println("user_id not found in claims ", claims)
+		userID, err := claims.UserID()
+		if err != nil {
+			log.Println("invalid subject in claims ", claims.Subject)
 			WriteError(w, appErrors.ErrUnauthorized.New("Invalid user id"))
 			return
 		}
 
-		email := claims["email"]
-		role := claims["role"]
-
-		ctx := context.WithValue(r.Context(), ContextUserID, int(userIdFloat))
-		ctx = context.WithValue(ctx, ContextEmail, email)
-		ctx = context.WithValue(ctx, ContextRole, role)
+		var issuedAt time.Time
+		if claims.IssuedAt != nil {
+			issuedAt = claims.IssuedAt.Time
+		}
+		if err := checkRevoked(r.Context(), denylist, userID, claims.ID, issuedAt); err != nil {
+			WriteError(w, err)
+			return
+		}
 
-		// log.Printf("token claims: %v\n", claims)
+		ctx := context.WithValue(r.Context(), ContextUserID, userID)
+		ctx = context.WithValue(ctx, ContextEmail, claims.Email)
+		ctx = context.WithValue(ctx, ContextRole, claims.Role)
+		ctx = context.WithValue(ctx, ContextTokenID, claims.ID)
+		ctx = context.WithValue(ctx, ContextTokenExpiry, claims.ExpiresAt.Time)
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// checkRevoked fails closed: if the denylist can't be read the request is
+// refused rather than letting a possibly revoked token through. Tokens issued
+// at the cutoff itself are revoked too; iat has millisecond precision, so
+// those issued after it still pass.
+func checkRevoked(ctx context.Context, denylist auth.Denylist, userID int, jti string, issuedAt time.Time) error {
+	revoked, err := denylist.IsRevoked(ctx, jti)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return appErrors.ErrUnauthorized.New("token has been revoked")
+	}
+
+	before, err := denylist.RevokedBefore(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !before.IsZero() && !issuedAt.After(before) {
+		return appErrors.ErrUnauthorized.New("token has been revoked")
+	}
+
+	return nil
+}
+
 func GetUserId(ctx context.Context) int {
 	id, ok := ctx.Value(ContextUserID).(int)
 	if !ok {
@@ -75,3 +145,29 @@ func GetUserRole(ctx context.Context) string {
 func IsAdmin(ctx context.Context) bool {
 	return GetUserRole(ctx) == "admin"
 }
+
+// GetAPIKeyID returns the id of the api key on the request, or 0 when the
+// caller signed in with a token.
+func GetAPIKeyID(ctx context.Context) int64 {
+	id, _ := ctx.Value(ContextAPIKeyID).(int64)
+	return id
+}
+
+// RequireUserSession refuses api keys on routes that only make sense for a
+// person, like logging out or managing a second factor.
+func RequireUserSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if GetAPIKeyID(r.Context()) != 0 {
+			WriteError(w, appErrors.ErrForbidden.New("api keys can't use this endpoint"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GetToken returns the jti and expiry of the access token on the request.
+func GetToken(ctx context.Context) (string, time.Time) {
+	jti, _ := ctx.Value(ContextTokenID).(string)
+	exp, _ := ctx.Value(ContextTokenExpiry).(time.Time)
+	return jti, exp
+}
@@ -2,7 +2,10 @@ package middleware
 
 import (
 	"encoding/json"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/joomcode/errorx"
 
@@ -46,8 +49,25 @@ func WriteError(w http.ResponseWriter, err error) {
 		code = http.StatusConflict
 	case errorx.IsOfType(err, errs.ErrInvalidPayload):
 		code = http.StatusBadRequest
+	case errorx.IsOfType(err, errs.ErrUnprocessable):
+		code = http.StatusUnprocessableEntity
 	case errorx.IsOfType(err, errs.ErrUnauthorized):
 		code = http.StatusUnauthorized
+	case errorx.IsOfType(err, errs.ErrForbidden):
+		code = http.StatusForbidden
+	case errorx.IsOfType(err, errs.ErrPreconditionRequired):
+		code = http.StatusPreconditionRequired
+	case errorx.IsOfType(err, errs.ErrPreconditionFailed):
+		code = http.StatusPreconditionFailed
+	case errorx.IsOfType(err, errs.ErrTooManyRequests):
+		code = http.StatusTooManyRequests
+		if wait, ok := errorx.ExtractProperty(err, errs.RetryAfter); ok {
+			if d, ok := wait.(time.Duration); ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+			}
+		}
+	case errorx.IsOfType(err, errs.ErrUpstreamFailure):
+		code = http.StatusBadGateway
 	case errorx.IsOfType(err, errs.ErrDbFailure):
 		code = http.StatusInternalServerError
 		msg = "Internal server error"
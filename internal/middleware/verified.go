@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+// EmailVerifier reports whether a user has confirmed their email address.
+type EmailVerifier interface {
+	IsEmailVerified(ctx context.Context, userID int) (bool, error)
+}
+
+// RequireVerifiedEmail refuses the request until the caller has verified
+// their email address. It must run after Authentication.
+func RequireVerifiedEmail(verifier EmailVerifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			verified, err := verifier.IsEmailVerified(r.Context(), GetUserId(r.Context()))
+			if err != nil {
+				WriteError(w, err)
+				return
+			}
+			if !verified {
+				WriteError(w, appErrors.ErrEmailNotVerified.New("verify your email address before doing this"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
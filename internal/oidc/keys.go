@@ -0,0 +1,164 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var supportedAlgs = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "EdDSA"}
+
+// minimum time between JWKS refetches, so bogus kids can't hammer the provider
+const jwksMinRefresh = 30 * time.Second
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// keySet caches the provider's signing keys and refetches them when a token
+// names a kid it hasn't seen, which is how provider key rotation arrives.
+type keySet struct {
+	url   string
+	fetch func(ctx context.Context, url string, v any) error
+
+	mu        sync.Mutex
+	keys      map[string]any
+	fetchedAt time.Time
+}
+
+func newKeySet(url string, fetch func(ctx context.Context, url string, v any) error) *keySet {
+	return &keySet{url: url, fetch: fetch, keys: map[string]any{}}
+}
+
+func (s *keySet) lookup(ctx context.Context, t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.find(kid, t.Method.Alg())
+	if !ok && time.Since(s.fetchedAt) >= jwksMinRefresh {
+		if err := s.refresh(ctx); err != nil {
+			return nil, err
+		}
+		key, ok = s.find(kid, t.Method.Alg())
+	}
+	if !ok {
+		return nil, appErrors.ErrUnauthorized.New("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// find matches by kid, or takes the only key of the right type when the
+// token names none.
+func (s *keySet) find(kid, alg string) (any, bool) {
+	if kid != "" {
+		key, ok := s.keys[kid]
+		return key, ok && keyFitsAlg(key, alg)
+	}
+
+	var match any
+	for _, key := range s.keys {
+		if keyFitsAlg(key, alg) {
+			if match != nil {
+				return nil, false
+			}
+			match = key
+		}
+	}
+	return match, match != nil
+}
+
+func (s *keySet) refresh(ctx context.Context) error {
+	s.fetchedAt = time.Now()
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := s.fetch(ctx, s.url, &set); err != nil {
+		return err
+	}
+
+	keys := map[string]any{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := parseJWK(k)
+		if err != nil {
+			log.Printf("skipping jwk %s from identity provider: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	s.keys = keys
+	return nil
+}
+
+func parseJWK(k jwk) (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			return nil, appErrors.ErrInvalidPayload.New("malformed rsa key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, appErrors.ErrInvalidPayload.New("unsupported curve %s", k.Crv)
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		if errX != nil || errY != nil {
+			return nil, appErrors.ErrInvalidPayload.New("malformed ec key")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if k.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, appErrors.ErrInvalidPayload.New("malformed okp key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, appErrors.ErrInvalidPayload.New("unsupported key type %s", k.Kty)
+}
+
+// keyFitsAlg stops a token from choosing how its key is used, e.g. an RSA
+// key can't verify an HMAC token.
+func keyFitsAlg(key any, alg string) bool {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return alg == "RS256" || alg == "RS384" || alg == "RS512"
+	case *ecdsa.PublicKey:
+		return alg == "ES256" || alg == "ES384"
+	case ed25519.PublicKey:
+		return alg == "EdDSA"
+	}
+	return false
+}
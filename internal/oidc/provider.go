@@ -0,0 +1,278 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type Config struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// claim holding the user's groups, "groups" for most providers
+	GroupsClaim string
+	HTTPClient  *http.Client
+}
+
+// Discovery is the part of /.well-known/openid-configuration we use.
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Identity is what a verified ID token says about the user.
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+	Name          string
+	Groups        []string
+}
+
+// Provider runs the authorization code flow with PKCE against one OpenID
+// Connect provider. Discovery happens on first use and is cached, so the
+// service starts even while the provider is unreachable.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *Discovery
+	keys      *keySet
+}
+
+func NewProvider(cfg Config) *Provider {
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	return &Provider{cfg: cfg, client: client}
+}
+
+// AuthCodeURL is where the browser is sent to log in at the provider.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.cfg.RedirectURL)
+	q.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange trades the authorization code for tokens and returns the
+// verified identity from the ID token.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("client_id", p.cfg.ClientID)
+	form.Set("code_verifier", verifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "failed to build token request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "token request failed")
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		// a bad or replayed code is the client's problem, not ours
+		return nil, appErrors.ErrUnauthorized.New("provider rejected the authorization code: %s", strings.TrimSpace(string(body)))
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil || tokens.IDToken == "" {
+		return nil, appErrors.ErrUnauthorized.New("provider returned no id token")
+	}
+
+	return p.VerifyIDToken(ctx, tokens.IDToken, nonce)
+}
+
+// VerifyIDToken checks the signature against the provider's keys and the
+// issuer, audience, lifetime and nonce of an ID token.
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, nonce string) (*Identity, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (any, error) {
+		return p.key(ctx, t)
+	},
+		jwt.WithValidMethods(supportedAlgs),
+		jwt.WithIssuer(d.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, appErrors.ErrUnauthorized.Wrap(err, "invalid id token")
+	}
+
+	if got, _ := claims["nonce"].(string); nonce == "" || got != nonce {
+		return nil, appErrors.ErrUnauthorized.New("id token nonce does not match")
+	}
+	// with several audiences the token must have been issued to us
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.cfg.ClientID {
+			return nil, appErrors.ErrUnauthorized.New("id token was issued to another client")
+		}
+	}
+
+	sub, _ := claims.GetSubject()
+	if sub == "" {
+		return nil, appErrors.ErrUnauthorized.New("id token has no subject")
+	}
+
+	id := &Identity{
+		Issuer:     d.Issuer,
+		Subject:    sub,
+		Email:      strings.ToLower(stringClaim(claims, "email")),
+		GivenName:  stringClaim(claims, "given_name"),
+		FamilyName: stringClaim(claims, "family_name"),
+		Name:       stringClaim(claims, "name"),
+		Groups:     stringsClaim(claims, p.cfg.GroupsClaim),
+	}
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		id.EmailVerified = v
+	case string:
+		// some providers send it as a string
+		id.EmailVerified = v == "true"
+	}
+	return id, nil
+}
+
+func (p *Provider) discover(ctx context.Context) (*Discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	wellKnown := strings.TrimRight(p.cfg.IssuerURL, "/") + "/.well-known/openid-configuration"
+	var d Discovery
+	if err := p.getJSON(ctx, wellKnown, &d); err != nil {
+		return nil, err
+	}
+	// the document must describe the issuer we were configured with
+	if strings.TrimRight(d.Issuer, "/") != strings.TrimRight(p.cfg.IssuerURL, "/") {
+		return nil, appErrors.ErrDbFailure.New("oidc discovery issuer %q does not match %q", d.Issuer, p.cfg.IssuerURL)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, appErrors.ErrDbFailure.New("oidc discovery document is incomplete")
+	}
+
+	p.discovery = &d
+	p.keys = newKeySet(d.JWKSURI, p.getJSON)
+	return p.discovery, nil
+}
+
+func (p *Provider) key(ctx context.Context, t *jwt.Token) (any, error) {
+	p.mu.Lock()
+	keys := p.keys
+	p.mu.Unlock()
+	return keys.lookup(ctx, t)
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to build request")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "request to identity provider failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return appErrors.ErrDbFailure.New("identity provider answered %d for %s", resp.StatusCode, url)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "invalid response from identity provider")
+	}
+	return nil
+}
+
+func stringClaim(claims jwt.MapClaims, name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
+
+// stringsClaim reads a claim that may be a list or a single string.
+func stringsClaim(claims jwt.MapClaims, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var out []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
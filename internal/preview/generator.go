@@ -0,0 +1,242 @@
+package preview
+
+import (
+	"Complaingo/internal/events"
+	"Complaingo/internal/storage"
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	appErrors "Complaingo/internal/errors"
+
+	_ "image/gif"
+	_ "image/png"
+
+	"github.com/ledongthuc/pdf"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	ThumbnailSize   = 256
+	ImagePreviewMax = 1024
+	TextPreviewMax  = 4 << 10
+
+	// inputs larger than this are not decoded, to bound worker memory
+	maxSourceBytes = 25 << 20
+	// decoded images above this many pixels are skipped (decompression bombs)
+	maxSourcePixels = 40_000_000
+	// pages scanned for text before giving up on a pdf
+	maxPDFPages = 10
+)
+
+// Derivatives are stored next to the original blob, under its key plus a
+// suffix, so they can be located without extra bookkeeping.
+func ThumbnailKey(key string) string {
+	return key + ".thumb.jpg"
+}
+
+// PreviewKey depends on the source type: images get a larger JPEG rendition,
+// PDFs and plain text get an extract of their text.
+func PreviewKey(key, mimeType string) string {
+	if IsImage(mimeType) {
+		return key + ".preview.jpg"
+	}
+	return key + ".preview.txt"
+}
+
+// DerivativeKeys lists every key the generator may have written for key.
+func DerivativeKeys(key string) []string {
+	return []string{ThumbnailKey(key), key + ".preview.jpg", key + ".preview.txt"}
+}
+
+func IsImage(mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+func Supported(mimeType string) bool {
+	return IsImage(mimeType) || mimeType == "application/pdf" || strings.HasPrefix(mimeType, "text/plain")
+}
+
+// Generator produces thumbnails and previews for stored documents.
+type Generator struct {
+	store storage.BlobStore
+}
+
+func NewGenerator(store storage.BlobStore) *Generator {
+	return &Generator{store: store}
+}
+
+// HandleDocumentUploaded is subscribed to events.DocumentUploaded.
+func (g *Generator) HandleDocumentUploaded(ctx context.Context, event events.Event) error {
+	payload, ok := event.Payload.(events.DocumentUploadedPayload)
+	if !ok {
+		return appErrors.ErrInvalidPayload.New("unexpected payload %T for %s", event.Payload, event.Type)
+	}
+
+	return g.Generate(ctx, payload.StorageKey, payload.MimeType)
+}
+
+// Generate writes every derivative that applies to the blob at key.
+// Unsupported types are ignored.
+func (g *Generator) Generate(ctx context.Context, key, mimeType string) error {
+	if !Supported(mimeType) {
+		return nil
+	}
+
+	content, err := g.load(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case IsImage(mimeType):
+		return g.generateImage(ctx, key, mimeType, content)
+	case mimeType == "application/pdf":
+		text, err := PDFText(content, TextPreviewMax)
+		if err != nil {
+			return err
+		}
+		return g.put(ctx, PreviewKey(key, mimeType), []byte(text), "text/plain; charset=utf-8")
+	default:
+		return g.put(ctx, PreviewKey(key, mimeType), []byte(TextExcerpt(content, TextPreviewMax)), "text/plain; charset=utf-8")
+	}
+}
+
+func (g *Generator) generateImage(ctx context.Context, key, mimeType string, content []byte) error {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return appErrors.ErrInvalidPayload.Wrap(err, "failed to read image header")
+	}
+	if cfg.Width*cfg.Height > maxSourcePixels {
+		return appErrors.ErrInvalidPayload.New("image of %dx%d is too large to preview", cfg.Width, cfg.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return appErrors.ErrInvalidPayload.Wrap(err, "failed to decode image")
+	}
+
+	thumb, err := EncodeJPEG(Resize(img, ThumbnailSize))
+	if err != nil {
+		return err
+	}
+	if err := g.put(ctx, ThumbnailKey(key), thumb, "image/jpeg"); err != nil {
+		return err
+	}
+
+	preview, err := EncodeJPEG(Resize(img, ImagePreviewMax))
+	if err != nil {
+		return err
+	}
+	return g.put(ctx, PreviewKey(key, mimeType), preview, "image/jpeg")
+}
+
+func (g *Generator) load(ctx context.Context, key string) ([]byte, error) {
+	rc, _, err := g.store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	content, err := io.ReadAll(io.LimitReader(rc, maxSourceBytes+1))
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "failed to read %s", key)
+	}
+	if len(content) > maxSourceBytes {
+		return nil, appErrors.ErrFileTooLarge.New("%s is too large to preview", key)
+	}
+	return content, nil
+}
+
+func (g *Generator) put(ctx context.Context, key string, content []byte, contentType string) error {
+	return g.store.Put(ctx, key, bytes.NewReader(content), int64(len(content)), contentType)
+}
+
+// Resize scales img down so neither side exceeds max, keeping the aspect
+// ratio. Smaller images are returned unchanged.
+func Resize(img image.Image, max int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= max && h <= max {
+		return img
+	}
+
+	if w >= h {
+		h = h * max / w
+		w = max
+	} else {
+		w = w * max / h
+		h = max
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+func EncodeJPEG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "failed to encode jpeg")
+	}
+	return buf.Bytes(), nil
+}
+
+// PDFText extracts up to max bytes of text from the first page that has any.
+// Pure Go PDF rendering is not practical, so text stands in for a page image.
+func PDFText(content []byte, max int) (text string, err error) {
+	// the pdf parser panics on some malformed inputs
+	defer func() {
+		if r := recover(); r != nil {
+			err = appErrors.ErrInvalidPayload.New("failed to parse pdf: %v", r)
+		}
+	}()
+
+	r, err := pdf.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return "", appErrors.ErrInvalidPayload.Wrap(err, "failed to parse pdf")
+	}
+
+	for i := 1; i <= r.NumPage() && i <= maxPDFPages; i++ {
+		page := r.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		pageText, err := page.GetPlainText(nil)
+		if err != nil {
+			return "", appErrors.ErrInvalidPayload.Wrap(err, "failed to read pdf page %d", i)
+		}
+		if pageText = strings.TrimSpace(pageText); pageText != "" {
+			return TextExcerpt([]byte(pageText), max), nil
+		}
+	}
+
+	return "", nil
+}
+
+// TextExcerpt returns at most max bytes of content, cut on a rune boundary.
+func TextExcerpt(content []byte, max int) string {
+	if len(content) > max {
+		cut := max
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		content = content[:cut]
+	}
+	return strings.ToValidUTF8(string(content), "")
+}
@@ -3,27 +3,33 @@ package redis
 import (
 	"context"
 	"fmt"
+	"log"
 
 	"github.com/redis/go-redis/v9"
 )
 
 var (
-	RDB *redis.Client          // declare redis client variable/pointer to redis connection
 	Ctx = context.Background() //cretes background connections for redis to support timeouts/cancellation
 )
 
-// func connect to redis server
-func ConnectRedis() {
-	RDB = redis.NewClient(&redis.Options{ //create new redis client and assign to it to redis
+// func connect to redis server. The client is set up even when redis can't
+// be reached yet: it connects on use, and everything that uses redis rides
+// out the outage behind a circuit breaker, like one that starts later.
+func ConnectRedis() *redis.Client {
+	client := redis.NewClient(&redis.Options{ //create new redis client
 		Addr:     "localhost:6379", // default redis port
 		Password: "",               //no password set
 		DB:       0,                //default database
+		// let callers bound each call with their context
+		ContextTimeoutEnabled: true,
 	})
 
 	//ping the redis server to check connection
-	status, err := RDB.Ping(Ctx).Result()
+	status, err := client.Ping(Ctx).Result()
 	if err != nil {
-		panic(fmt.Sprintf("Failed to connect to redis: %v", err))
+		log.Printf("redis not reachable yet: %v", err)
+		return client
 	}
 	fmt.Printf("Connected to redis! status: %s\n", status)
+	return client
 }
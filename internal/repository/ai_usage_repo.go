@@ -0,0 +1,11 @@
+package repository
+
+import (
+	"Complaingo/internal/domain/models"
+	"context"
+)
+
+type AIUsageRepository interface {
+	RecordUsage(ctx context.Context, u *models.AIUsage) error
+	GetUsageSummary(ctx context.Context) ([]*models.AIUsageSummary, error)
+}
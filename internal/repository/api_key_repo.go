@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"Complaingo/internal/domain/models"
+	"context"
+)
+
+type APIKeyRepository interface {
+	CreateAPIKey(ctx context.Context, k *models.APIKey) error
+	GetAPIKeys(ctx context.Context) ([]*models.APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id int64) error
+	TouchAPIKey(ctx context.Context, id int64) error
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"Complaingo/internal/domain/models"
+	"context"
+)
+
+type AttachmentRepository interface {
+	CreateAttachment(ctx context.Context, a *models.Attachment) error
+	GetAttachmentByID(ctx context.Context, id int) (*models.Attachment, error)
+	GetAttachmentsByComplaint(ctx context.Context, complaintID int) ([]*models.Attachment, error)
+	GetAttachmentsByMessages(ctx context.Context, messageIDs []int) ([]*models.Attachment, error)
+	LinkDocument(ctx context.Context, attachmentID, documentID int) error
+	LinkMessage(ctx context.Context, attachmentIDs []int, messageID int) error
+	DeleteAttachment(ctx context.Context, id int) error
+}
@@ -10,7 +10,8 @@ type ComplaintRepository interface {
 	CreateComplaint(ctx context.Context, c *models.Complaints) error                                             //user only
 	GetComplaintByRole(ctx context.Context, UserID int, param utility.FilterParam) ([]*models.Complaints, error) // user only
 	GetComplaintByID(ctx context.Context, complaintID int) (*models.Complaints, error)
-	UpdateComplaints(ctx context.Context, complaintID int, status string) error
+	UpdateComplaints(ctx context.Context, complaintID int, status string, version int) error
+	EditComplaint(ctx context.Context, complaintID int, p models.ComplaintPatch, version int) error
 	GetAllComplaintByRole(ctx context.Context, param utility.FilterParam) ([]*models.Complaints, error) //admin olny
 }
 
@@ -19,4 +20,5 @@ type ComplaintMessageRepository interface {
 	AddMessage(ctx context.Context, cm *models.ComplaintMessages) error
 	GetMessageByID(ctx context.Context, messageID int) (*models.ComplaintMessages, error)
 	GetMessagesByComplaint(ctx context.Context, complaintID int) ([]*models.ComplaintMessages, error)
+	GetMessageThread(ctx context.Context, complaintID int, param utility.ThreadParam) (*models.MessageThread, error)
 }
@@ -5,6 +5,7 @@ import (
 	"Complaingo/internal/utility"
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	appErrors "Complaingo/internal/errors"
@@ -12,6 +13,11 @@ import (
 	"github.com/jackc/pgx/v5"
 )
 
+const (
+	documentColumns = `id, user_id, file_name, storage_key, mime_type, size_bytes, current_version, uploaded_at`
+	versionColumns  = `id, document_id, version, file_name, storage_key, mime_type, size_bytes, sha256, uploaded_by, restored_from, created_at`
+)
+
 type DocumentRepository struct {
 	db *pgx.Conn
 }
@@ -22,48 +28,236 @@ func NewDocumentRepository(db *pgx.Conn) *DocumentRepository {
 	}
 }
 
-func (r *DocumentRepository) SaveDocument(ctx context.Context, doc *models.Document) error {
-	query := `INSERT INTO documents(user_id, file_name, file_path, uploaded_at) VALUES($1, $2, $3, $4) RETURNING id, uploaded_at`
+// SaveDocument inserts the document together with its first version.
+func (r *DocumentRepository) SaveDocument(ctx context.Context, doc *models.Document, v *models.DocumentVersion) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
 
-	err := r.db.QueryRow(ctx, query, doc.UserID, doc.FileName, doc.FilePath, time.Now()).Scan(&doc.ID, &doc.UploadedAt)
+	query := `INSERT INTO documents(user_id, file_name, storage_key, mime_type, size_bytes, current_version, uploaded_at)
+	VALUES($1, $2, $3, $4, $5, 1, $6) RETURNING id, uploaded_at`
+
+	err = tx.QueryRow(ctx, query, doc.UserID, doc.FileName, doc.StorageKey, doc.MimeType, doc.Size, time.Now()).Scan(&doc.ID, &doc.UploadedAt)
 	if err != nil {
 		return appErrors.ErrDbFailure.Wrap(err, "qury failed")
 	}
+	doc.CurrentVersion = 1
+
+	v.DocumentID = int(doc.ID)
+	v.Version = 1
+	if err := insertVersion(ctx, tx, v); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to commit document")
+	}
 
 	return nil
 }
 
+// AddVersion appends v as the newest version of the document and makes it
+// the current content.
+func (r *DocumentRepository) AddVersion(ctx context.Context, documentID int, v *models.DocumentVersion) (*models.Document, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	// lock the document so concurrent uploads get distinct version numbers
+	var lockedID int
+	err = tx.QueryRow(ctx, `SELECT id FROM documents WHERE id=$1 FOR UPDATE`, documentID).Scan(&lockedID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, appErrors.ErrUserNotFound.New("document not found")
+		}
+		return nil, appErrors.ErrDbFailure.Wrap(err, "failed to lock document")
+	}
+
+	var latest int
+	err = tx.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM document_versions WHERE document_id=$1`, documentID).Scan(&latest)
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+
+	v.DocumentID = documentID
+	v.Version = latest + 1
+	if err := insertVersion(ctx, tx, v); err != nil {
+		return nil, err
+	}
+
+	doc := &models.Document{}
+	query := `UPDATE documents SET file_name=$1, storage_key=$2, mime_type=$3, size_bytes=$4, current_version=$5
+	WHERE id=$6
+	RETURNING ` + documentColumns
+	err = scanDocument(tx.QueryRow(ctx, query, v.FileName, v.StorageKey, v.MimeType, v.Size, v.Version, documentID), doc)
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "failed to update document")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "failed to commit version")
+	}
+
+	return doc, nil
+}
+
+func insertVersion(ctx context.Context, tx pgx.Tx, v *models.DocumentVersion) error {
+	query := `INSERT INTO document_versions (document_id, version, file_name, storage_key, mime_type, size_bytes, sha256, uploaded_by, restored_from)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, created_at`
+
+	err := tx.QueryRow(ctx, query, v.DocumentID, v.Version, v.FileName, v.StorageKey, v.MimeType, v.Size, v.SHA256, v.UploadedBy, v.RestoredFrom).Scan(&v.ID, &v.CreatedAt)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to insert document version")
+	}
+
+	return nil
+}
+
+func (r *DocumentRepository) GetVersions(ctx context.Context, documentID int) ([]*models.DocumentVersion, error) {
+	query := `SELECT ` + versionColumns + ` FROM document_versions WHERE document_id=$1 ORDER BY version DESC`
+
+	rows, err := r.db.Query(ctx, query, documentID)
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+	defer rows.Close()
+
+	var versions []*models.DocumentVersion
+	for rows.Next() {
+		v := &models.DocumentVersion{}
+		if err := scanVersion(rows, v); err != nil {
+			return nil, appErrors.ErrDbFailure.Wrap(err, "Failed to scan version row")
+		}
+		versions = append(versions, v)
+	}
+
+	return versions, nil
+}
+
+func (r *DocumentRepository) GetVersion(ctx context.Context, documentID, version int) (*models.DocumentVersion, error) {
+	query := `SELECT ` + versionColumns + ` FROM document_versions WHERE document_id=$1 AND version=$2`
+
+	v := &models.DocumentVersion{}
+	if err := scanVersion(r.db.QueryRow(ctx, query, documentID, version), v); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, appErrors.ErrUserNotFound.New("document version not found")
+		}
+		return nil, appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+
+	return v, nil
+}
+
+// GetStorageKeys lists every distinct blob referenced by the document's versions.
+func (r *DocumentRepository) GetStorageKeys(ctx context.Context, documentID int) ([]string, error) {
+	rows, err := r.db.Query(ctx, `SELECT DISTINCT storage_key FROM document_versions WHERE document_id=$1`, documentID)
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, appErrors.ErrDbFailure.Wrap(err, "Failed to scan storage key")
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// GetUsage sums the size of every distinct blob kept for the user's
+// documents, so restored versions sharing a blob are only counted once.
+func (r *DocumentRepository) GetUsage(ctx context.Context, userID int) (*models.StorageUsage, error) {
+	query := `
+	SELECT
+		COALESCE((SELECT SUM(size_bytes) FROM (
+			SELECT DISTINCT ON (v.storage_key) v.size_bytes
+			FROM document_versions v JOIN documents d ON d.id = v.document_id
+			WHERE d.user_id=$1
+		) blobs), 0),
+		(SELECT COUNT(*) FROM documents WHERE user_id=$1),
+		(SELECT COUNT(*) FROM document_versions v JOIN documents d ON d.id = v.document_id WHERE d.user_id=$1)`
+
+	usage := &models.StorageUsage{UserID: userID}
+	err := r.db.QueryRow(ctx, query, userID).Scan(&usage.UsedBytes, &usage.Documents, &usage.Versions)
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "failed to compute storage usage")
+	}
+
+	return usage, nil
+}
+
+// GetQuotaSettings returns the user's role and their per user quota
+// override, which is nil when the role default applies.
+func (r *DocumentRepository) GetQuotaSettings(ctx context.Context, userID int) (*int64, string, error) {
+	query := `SELECT u.storage_quota_bytes, COALESCE(r.name, '')
+	FROM users u
+	LEFT JOIN roles r ON r.id = u.role_id
+	WHERE u.id=$1`
+
+	var quota *int64
+	var role string
+	err := r.db.QueryRow(ctx, query, userID).Scan(&quota, &role)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, "", appErrors.ErrUserNotFound.New("user not found")
+		}
+		return nil, "", appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+
+	return quota, role, nil
+}
+
 func (r *DocumentRepository) GetDocumentByID(ctx context.Context, id int) (*models.Document, error) {
-	query := `SELECT user_id, file_name, file_path, uploaded_at FROM documents WHERE id=$1`
+	query := `SELECT ` + documentColumns + ` FROM documents WHERE id=$1`
 
 	doc := &models.Document{}
-	err := r.db.QueryRow(ctx, query, id).Scan(&doc.UserID, &doc.FileName, &doc.FilePath, &doc.UploadedAt)
+	err := scanDocument(r.db.QueryRow(ctx, query, id), doc)
 	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, appErrors.ErrUserNotFound.New("document not found")
+		}
 		return nil, appErrors.ErrDbFailure.Wrap(err, "Query failed")
 	}
 
 	return doc, nil
 }
 
-func (r *DocumentRepository) GetDocumentByUser(ctx context.Context, user_id int, param utility.FilterParam) ([]*models.Document, error) {
-	query := `SELECT id, user_id, file_name, file_path, uploaded_at FROM documents WHERE 1=1`
+// documentListColumns are the columns documents can be filtered and sorted
+// on; the names come from the query string, so nothing else gets through.
+var documentListColumns = map[string]bool{
+	"id": true, "file_name": true, "mime_type": true, "size_bytes": true, "current_version": true, "uploaded_at": true,
+}
 
+var filterOperators = map[string]bool{"=": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true, "ILIKE": true}
+
+func (r *DocumentRepository) GetDocumentByUser(ctx context.Context, user_id int, param utility.FilterParam) ([]*models.Document, error) {
+	query := `SELECT ` + documentColumns + ` FROM documents WHERE user_id=$1`
 	args := []interface{}{user_id}
-	query += " AND user_id=$1"
 	argIdx := 2
 
 	// add filters
 	for _, f := range param.Filters {
-		query += fmt.Sprintf(" AND %s %s $%d", f.ColumnName, f.Operator, argIdx)
+		if !documentListColumns[f.ColumnName] || !filterOperators[strings.ToUpper(f.Operator)] {
+			return nil, appErrors.ErrInvalidPayload.New("can't filter documents on %s %s", f.ColumnName, f.Operator)
+		}
+		query += fmt.Sprintf(" AND %s %s $%d", f.ColumnName, strings.ToUpper(f.Operator), argIdx)
 		args = append(args, f.Value)
 		argIdx++
 	}
 
-	// add search across user_id and file_name
+	// add search on the file name
 	if param.Search != "" {
-		query += fmt.Sprintf(" AND (user_id ILIKE $%d OR file_name ILIKE $%d)", argIdx, argIdx+1)
-		searchVal := "%" + param.Search + "%"
-		args = append(args, searchVal, searchVal)
+		query += fmt.Sprintf(" AND file_name ILIKE $%d", argIdx)
+		args = append(args, "%"+param.Search+"%")
+		argIdx++
 	}
 
 	// add sort
@@ -71,38 +265,65 @@ func (r *DocumentRepository) GetDocumentByUser(ctx context.Context, user_id int,
 	sortOrder := param.Sort.Value
 
 	if sortCol == "" {
-		sortCol = "user_id"
+		sortCol = "id"
 	}
-	if sortOrder == "" {
+	if !documentListColumns[sortCol] {
+		return nil, appErrors.ErrInvalidPayload.New("can't sort documents on %s", sortCol)
+	}
+	if sortOrder != "desc" {
 		sortOrder = "asc"
 	}
-	query += fmt.Sprintf(" ORDER BY %s %s", sortCol, sortOrder)
+	query += fmt.Sprintf(" ORDER BY %s %s, id", sortCol, sortOrder)
 
 	// add pagination
 	offset := (param.Page - 1) * param.PerPage
-	query += fmt.Sprintf(" AND LIMIT $%d OFFSET $%d", argIdx, argIdx+1)
+	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", argIdx, argIdx+1)
 	args = append(args, param.PerPage, offset)
 
 	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
-		return nil, appErrors.ErrDbFailure.New("query failed")
+		return nil, appErrors.ErrDbFailure.Wrap(err, "query failed")
 	}
 	defer rows.Close()
 
-	var docs []*models.Document
-
+	docs := []*models.Document{}
 	for rows.Next() {
 		d := &models.Document{}
-		err := rows.Scan(&d.ID, &d.UserID, &d.FileName, &d.FilePath, &d.UploadedAt)
-		if err != nil {
-			return nil, appErrors.ErrInvalidPayload.Wrap(err, "Invalid payload")
+		if err := scanDocument(rows, d); err != nil {
+			return nil, appErrors.ErrDbFailure.Wrap(err, "failed to scan document")
 		}
-
 		docs = append(docs, d)
 	}
 	return docs, nil
 }
 
+func scanDocument(row pgx.Row, d *models.Document) error {
+	return row.Scan(&d.ID, &d.UserID, &d.FileName, &d.StorageKey, &d.MimeType, &d.Size, &d.CurrentVersion, &d.UploadedAt)
+}
+
+func scanVersion(row pgx.Row, v *models.DocumentVersion) error {
+	return row.Scan(&v.ID, &v.DocumentID, &v.Version, &v.FileName, &v.StorageKey, &v.MimeType, &v.Size, &v.SHA256, &v.UploadedBy, &v.RestoredFrom, &v.CreatedAt)
+}
+
+func (r *DocumentRepository) UpdateDocument(ctx context.Context, id int, p models.DocumentPatch) error {
+	b := utility.NewUpdateBuilder("documents")
+	if p.FileName != nil {
+		b.Set("file_name", *p.FileName)
+	}
+	if b.Empty() {
+		return nil
+	}
+
+	res, err := r.db.Exec(ctx, b.SQL()+" WHERE id="+b.Arg(id), b.Args()...)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to update document")
+	}
+	if res.RowsAffected() == 0 {
+		return appErrors.ErrUserNotFound.New("document not found")
+	}
+	return nil
+}
+
 func (r *DocumentRepository) DeleteDocument(ctx context.Context, id int) error {
 	query := `DELETE FROM documents WHERE id=$1`
 
@@ -113,3 +334,21 @@ func (r *DocumentRepository) DeleteDocument(ctx context.Context, id int) error {
 
 	return nil
 }
+
+// IsSharedWithUser reports whether the document is attached to a complaint
+// owned by userID.
+func (r *DocumentRepository) IsSharedWithUser(ctx context.Context, documentID, userID int) (bool, error) {
+	query := `SELECT EXISTS (
+		SELECT 1 FROM attachments a
+		JOIN complaints c ON c.id = a.complaint_id
+		WHERE a.document_id=$1 AND c.user_id=$2
+	)`
+
+	var shared bool
+	err := r.db.QueryRow(ctx, query, documentID, userID).Scan(&shared)
+	if err != nil {
+		return false, appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+
+	return shared, nil
+}
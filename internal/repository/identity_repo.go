@@ -0,0 +1,8 @@
+package repository
+
+import "context"
+
+type IdentityRepository interface {
+	GetUserIDByIdentity(ctx context.Context, issuer, subject string) (int, error)
+	LinkIdentity(ctx context.Context, userID int, issuer, subject, email string) error
+}
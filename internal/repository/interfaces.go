@@ -3,8 +3,16 @@ package repository
 import (
 	"Complaingo/internal/domain/models"
 	"context"
+
+	"github.com/jackc/pgx/v5"
 )
 
+// querier is satisfied by both *pgx.Conn and pgx.Tx, so helpers can run
+// inside or outside a transaction.
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 type MessageSaver interface {
 	SaveMessage(ctx context.Context, msg *models.MessageEntity) error
 }
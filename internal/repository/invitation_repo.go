@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"Complaingo/internal/domain/models"
+	"context"
+)
+
+type InvitationRepository interface {
+	CreateInvitation(ctx context.Context, inv *models.Invitation) error
+	GetInvitations(ctx context.Context, filter models.InvitationFilter) ([]*models.Invitation, error)
+	RevokeInvitation(ctx context.Context, id int64) error
+	AcceptInvitation(ctx context.Context, tokenHash string, u *models.User) error
+}
@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"Complaingo/internal/domain/models"
+	"context"
+)
+
+type KnowledgeRepository interface {
+	CreateEntry(ctx context.Context, e *models.KnowledgeEntry) error
+	// GetEntries returns the entries of kind, or all of them when kind is "".
+	GetEntries(ctx context.Context, kind string) ([]*models.KnowledgeEntry, error)
+	DeleteEntry(ctx context.Context, id int) error
+	SaveEmbedding(ctx context.Context, id int, embedding []float64, model string) error
+}
@@ -0,0 +1,11 @@
+package repository
+
+import (
+	"Complaingo/internal/domain/models"
+	"context"
+)
+
+type LoginAuditRepository interface {
+	RecordLoginAttempt(ctx context.Context, a *models.LoginAttempt) error
+	GetLoginAttempts(ctx context.Context, filter models.LoginAuditFilter) ([]*models.LoginAttempt, error)
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"Complaingo/internal/domain/models"
+	"context"
+)
+
+type MFARepository interface {
+	GetMFA(ctx context.Context, userID int) (*models.MFA, error)
+	SaveMFASecret(ctx context.Context, userID int, secret string) error
+	EnableMFA(ctx context.Context, userID int, step int64, codeHashes []string) error
+	DisableMFA(ctx context.Context, userID int) error
+	UseTOTPStep(ctx context.Context, userID int, step int64) error
+	UseRecoveryCode(ctx context.Context, userID int, codeHash string) error
+	ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"Complaingo/internal/domain/models"
+	"context"
+
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type PgxAIUsageRepo struct {
+	db *pgx.Conn
+}
+
+func NewPgxAIUsageRepo(db *pgx.Conn) *PgxAIUsageRepo {
+	return &PgxAIUsageRepo{db: db}
+}
+
+func (r *PgxAIUsageRepo) RecordUsage(ctx context.Context, u *models.AIUsage) error {
+	query := `INSERT INTO ai_usage (user_id, complaint_id, feature, model, prompt_tokens, completion_tokens, total_tokens)
+	VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at`
+
+	err := r.db.QueryRow(ctx, query, u.UserID, u.ComplaintID, u.Feature, u.Model, u.PromptTokens, u.CompletionTokens, u.TotalTokens).Scan(&u.ID, &u.CreatedAt)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to record ai usage")
+	}
+	return nil
+}
+
+func (r *PgxAIUsageRepo) GetUsageSummary(ctx context.Context) ([]*models.AIUsageSummary, error) {
+	query := `SELECT feature, model, COUNT(*), SUM(prompt_tokens), SUM(completion_tokens), SUM(total_tokens)
+	FROM ai_usage GROUP BY feature, model ORDER BY feature, model`
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+	defer rows.Close()
+
+	summary := []*models.AIUsageSummary{}
+	for rows.Next() {
+		var s models.AIUsageSummary
+		if err := rows.Scan(&s.Feature, &s.Model, &s.Requests, &s.PromptTokens, &s.CompletionTokens, &s.TotalTokens); err != nil {
+			return nil, appErrors.ErrDbFailure.Wrap(err, "failed to scan ai usage")
+		}
+		summary = append(summary, &s)
+	}
+	return summary, nil
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"Complaingo/internal/domain/models"
+	appErrors "Complaingo/internal/errors"
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const apiKeyColumns = `k.id, k.name, k.prefix, k.key_hash, k.user_id, COALESCE(r.name, ''), u.deactivated_at IS NULL, k.scopes,
+	k.created_by, k.created_at, k.expires_at, k.last_used_at, k.revoked_at`
+
+const apiKeyFrom = ` FROM api_keys k
+JOIN users u ON u.id = k.user_id
+LEFT JOIN roles r ON r.id = u.role_id`
+
+type PgxAPIKeyRepo struct {
+	db *pgx.Conn
+}
+
+func NewPgxAPIKeyRepo(db *pgx.Conn) *PgxAPIKeyRepo {
+	return &PgxAPIKeyRepo{db: db}
+}
+
+func (r *PgxAPIKeyRepo) CreateAPIKey(ctx context.Context, k *models.APIKey) error {
+	query := `INSERT INTO api_keys (name, prefix, key_hash, user_id, scopes, created_by, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at`
+
+	err := r.db.QueryRow(ctx, query, k.Name, k.Prefix, k.KeyHash, k.UserID, k.Scopes, k.CreatedBy, k.ExpiresAt).Scan(&k.ID, &k.CreatedAt)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to create api key")
+	}
+	return nil
+}
+
+// GetAPIKeys returns every key, newest first.
+func (r *PgxAPIKeyRepo) GetAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+	rows, err := r.db.Query(ctx, `SELECT `+apiKeyColumns+apiKeyFrom+` ORDER BY k.created_at DESC, k.id DESC`)
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+	defer rows.Close()
+
+	keys := []*models.APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func (r *PgxAPIKeyRepo) GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	k, err := scanAPIKey(r.db.QueryRow(ctx, `SELECT `+apiKeyColumns+apiKeyFrom+` WHERE k.key_hash=$1`, hash))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, appErrors.ErrUnauthorized.New("api key not recognised")
+		}
+		return nil, err
+	}
+	return k, nil
+}
+
+func (r *PgxAPIKeyRepo) RevokeAPIKey(ctx context.Context, id int64) error {
+	res, err := r.db.Exec(ctx, `UPDATE api_keys SET revoked_at=NOW() WHERE id=$1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to revoke api key")
+	}
+	if res.RowsAffected() == 0 {
+		return appErrors.ErrUserNotFound.New("no active api key with this id")
+	}
+	return nil
+}
+
+// TouchAPIKey records a use, at most once a minute to spare the writes.
+func (r *PgxAPIKeyRepo) TouchAPIKey(ctx context.Context, id int64) error {
+	_, err := r.db.Exec(ctx, `UPDATE api_keys SET last_used_at=NOW()
+	WHERE id=$1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`, id)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to record api key use")
+	}
+	return nil
+}
+
+func scanAPIKey(row pgx.Row) (*models.APIKey, error) {
+	k := &models.APIKey{}
+	err := row.Scan(&k.ID, &k.Name, &k.Prefix, &k.KeyHash, &k.UserID, &k.OwnerRole, &k.OwnerActive, &k.Scopes,
+		&k.CreatedBy, &k.CreatedAt, &k.ExpiresAt, &k.LastUsedAt, &k.RevokedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, err
+		}
+		return nil, appErrors.ErrDbFailure.Wrap(err, "failed to scan api key")
+	}
+	return k, nil
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"Complaingo/internal/domain/models"
+	appErrors "Complaingo/internal/errors"
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const attachmentColumns = `id, uploaded_by, user_id, complaint_id, message_id, document_id, file_name, storage_key, mime_type, size_bytes, sha256, created_at`
+
+type PgxAttachmentRepo struct {
+	db *pgx.Conn
+}
+
+func NewPgxAttachmentRepo(db *pgx.Conn) *PgxAttachmentRepo {
+	return &PgxAttachmentRepo{db: db}
+}
+
+// prefixColumns qualifies a comma separated column list with a table alias.
+func prefixColumns(alias, columns string) string {
+	parts := strings.Split(columns, ", ")
+	for i, p := range parts {
+		parts[i] = alias + "." + p
+	}
+	return strings.Join(parts, ", ")
+}
+
+func scanAttachment(row pgx.Row) (*models.Attachment, error) {
+	a := &models.Attachment{}
+	err := row.Scan(&a.ID, &a.UploadedBy, &a.UserID, &a.ComplaintID, &a.MessageID, &a.DocumentID,
+		&a.FileName, &a.StorageKey, &a.MimeType, &a.Size, &a.SHA256, &a.CreatedAt)
+	return a, err
+}
+
+func (r *PgxAttachmentRepo) CreateAttachment(ctx context.Context, a *models.Attachment) error {
+	query := `INSERT INTO attachments (uploaded_by, user_id, complaint_id, message_id, document_id, file_name, storage_key, mime_type, size_bytes, sha256)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id, created_at`
+
+	err := r.db.QueryRow(ctx, query, a.UploadedBy, a.UserID, a.ComplaintID, a.MessageID, a.DocumentID,
+		a.FileName, a.StorageKey, a.MimeType, a.Size, a.SHA256).Scan(&a.ID, &a.CreatedAt)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to insert attachment")
+	}
+
+	return nil
+}
+
+func (r *PgxAttachmentRepo) GetAttachmentByID(ctx context.Context, id int) (*models.Attachment, error) {
+	query := `SELECT ` + attachmentColumns + ` FROM attachments WHERE id=$1`
+
+	a, err := scanAttachment(r.db.QueryRow(ctx, query, id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, appErrors.ErrUserNotFound.New("attachment not found")
+		}
+		return nil, appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+
+	return a, nil
+}
+
+func (r *PgxAttachmentRepo) GetAttachmentsByComplaint(ctx context.Context, complaintID int) ([]*models.Attachment, error) {
+	query := `SELECT ` + attachmentColumns + ` FROM attachments WHERE complaint_id=$1 ORDER BY created_at, id`
+	return r.queryAttachments(ctx, query, complaintID)
+}
+
+func (r *PgxAttachmentRepo) GetAttachmentsByMessages(ctx context.Context, messageIDs []int) ([]*models.Attachment, error) {
+	if len(messageIDs) == 0 {
+		return nil, nil
+	}
+
+	query := `SELECT ` + attachmentColumns + ` FROM attachments WHERE message_id = ANY($1) ORDER BY created_at, id`
+	return r.queryAttachments(ctx, query, messageIDs)
+}
+
+func (r *PgxAttachmentRepo) LinkDocument(ctx context.Context, attachmentID, documentID int) error {
+	query := `UPDATE attachments SET document_id=$1 WHERE id=$2`
+
+	_, err := r.db.Exec(ctx, query, documentID, attachmentID)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to link attachment to document")
+	}
+
+	return nil
+}
+
+func (r *PgxAttachmentRepo) LinkMessage(ctx context.Context, attachmentIDs []int, messageID int) error {
+	query := `UPDATE attachments SET message_id=$1 WHERE id = ANY($2)`
+
+	_, err := r.db.Exec(ctx, query, messageID, attachmentIDs)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to link attachments to message")
+	}
+
+	return nil
+}
+
+func (r *PgxAttachmentRepo) DeleteAttachment(ctx context.Context, id int) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM attachments WHERE id=$1`, id)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to delete attachment")
+	}
+
+	return nil
+}
+
+func (r *PgxAttachmentRepo) queryAttachments(ctx context.Context, query string, args ...any) ([]*models.Attachment, error) {
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+	defer rows.Close()
+
+	var attachments []*models.Attachment
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, appErrors.ErrDbFailure.Wrap(err, "Failed to scan attachment row")
+		}
+		attachments = append(attachments, a)
+	}
+
+	return attachments, nil
+}
@@ -3,7 +3,6 @@ package repository
 import (
 	"Complaingo/internal/domain/models"
 	appErrors "Complaingo/internal/errors"
-	"Complaingo/internal/middleware"
 	"Complaingo/internal/utility"
 	"context"
 	"fmt"
@@ -31,14 +30,17 @@ func NewPgxComplaintMessageRepo(db *pgx.Conn) *PgxComplaintMessageRepo {
 	}
 }
 
-func (r *PgxComplaintRepo) CreateComplaint(ctx context.Context, c *models.Complaints) error {
-	if middleware.IsAdmin(ctx) {
-		return appErrors.ErrInvalidPayload.New("users only have permission to create complaint")
-	}
+const complaintColumns = `id, user_id, subject, message, status, created_at, version, category, priority, sentiment, language`
+
+func scanComplaint(row pgx.Row, c *models.Complaints) error {
+	return row.Scan(&c.ID, &c.UserID, &c.Subject, &c.Message, &c.Status, &c.CreatedAt, &c.Version,
+		&c.Category, &c.Priority, &c.Sentiment, &c.Language)
+}
 
-	query := `INSERT INTO complaints (user_id, subject, message, status) VALUES($1, $2, $3, $4) RETURNING id`
+func (r *PgxComplaintRepo) CreateComplaint(ctx context.Context, c *models.Complaints) error {
+	query := `INSERT INTO complaints (user_id, subject, message, status) VALUES($1, $2, $3, $4) RETURNING id, created_at, version`
 
-	err := r.db.QueryRow(ctx, query, c.UserID, c.Subject, c.Message, c.Status).Scan(&c.ID)
+	err := r.db.QueryRow(ctx, query, c.UserID, c.Subject, c.Message, c.Status).Scan(&c.ID, &c.CreatedAt, &c.Version)
 	if err != nil {
 		return appErrors.ErrDbFailure.Wrap(err, "failed to query the user")
 	}
@@ -47,7 +49,7 @@ func (r *PgxComplaintRepo) CreateComplaint(ctx context.Context, c *models.Compla
 }
 
 func (r *PgxComplaintRepo) GetComplaintByRole(ctx context.Context, UserID int, param utility.FilterParam) ([]*models.Complaints, error) {
-	query := `SELECT * FROM complaints WHERE 1=1`
+	query := `SELECT ` + complaintColumns + ` FROM complaints WHERE 1=1`
 
 	args := []interface{}{UserID}
 	query += " AND user_id=$1"
@@ -85,7 +87,7 @@ func (r *PgxComplaintRepo) GetComplaintByRole(ctx context.Context, UserID int, p
 	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", argIdx, argIdx+1)
 	args = append(args, param.PerPage, offset)
 
-	rows, err := r.db.Query(ctx, query, args)
+	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, appErrors.ErrUserNotFound.Wrap(err, "Complaint not found")
@@ -97,7 +99,7 @@ func (r *PgxComplaintRepo) GetComplaintByRole(ctx context.Context, UserID int, p
 	var complaint []*models.Complaints
 	for rows.Next() {
 		var c models.Complaints
-		err := rows.Scan(&c.ID, &c.UserID, &c.Subject, &c.Message, &c.Status, &c.CreatedAt)
+		err := scanComplaint(rows, &c)
 		if err != nil {
 			return nil, appErrors.ErrUserNotFound.New("failed to scan complaint row")
 		}
@@ -109,8 +111,8 @@ func (r *PgxComplaintRepo) GetComplaintByRole(ctx context.Context, UserID int, p
 
 func (r *PgxComplaintRepo) GetComplaintByID(ctx context.Context, complaintID int) (*models.Complaints, error) {
 	var c models.Complaints
-	query := `SELECT * FROM complaints WHERE id=$1`
-	err := r.db.QueryRow(ctx, query, complaintID).Scan(&c.ID, &c.UserID, &c.Subject, &c.Message, &c.Status, &c.CreatedAt)
+	query := `SELECT ` + complaintColumns + ` FROM complaints WHERE id=$1`
+	err := scanComplaint(r.db.QueryRow(ctx, query, complaintID), &c)
 
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -122,19 +124,65 @@ func (r *PgxComplaintRepo) GetComplaintByID(ctx context.Context, complaintID int
 	return &c, nil
 }
 
-func (r *PgxComplaintRepo) UpdateComplaints(ctx context.Context, ComplaintId int, status string) error {
-	query := `UPDATE complaints SET status=$1 WHERE id=$2`
+// UpdateComplaints sets the status when the complaint is still at the
+// expected version, or at any version for middleware.AnyVersion.
+func (r *PgxComplaintRepo) UpdateComplaints(ctx context.Context, ComplaintId int, status string, version int) error {
+	query := `UPDATE complaints SET status=$1, version=version+1 WHERE id=$2 AND ($3 = 0 OR version=$3)`
 
-	_, err := r.db.Exec(ctx, query, status, ComplaintId)
+	res, err := r.db.Exec(ctx, query, status, ComplaintId, version)
 	if err != nil {
 		return appErrors.ErrDbFailure.Wrap(err, "failed to update complaint")
 	}
+	if res.RowsAffected() == 0 {
+		return r.missingOrStale(ctx, ComplaintId)
+	}
 
 	return nil
 }
 
+// EditComplaint changes the subject or message of a complaint nobody has
+// acted on yet.
+func (r *PgxComplaintRepo) EditComplaint(ctx context.Context, complaintID int, p models.ComplaintPatch, version int) error {
+	b := utility.NewUpdateBuilder("complaints")
+	if p.Subject != nil {
+		b.Set("subject", *p.Subject)
+	}
+	if p.Message != nil {
+		b.Set("message", *p.Message)
+	}
+	if b.Empty() {
+		return nil
+	}
+	b.SetExpr("version=version+1")
+
+	v := b.Arg(version)
+	query := b.SQL() + " WHERE id=" + b.Arg(complaintID) + " AND status='Created' AND (" + v + " = 0 OR version=" + v + ")"
+	res, err := r.db.Exec(ctx, query, b.Args()...)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to edit complaint")
+	}
+	if res.RowsAffected() == 0 {
+		// accepting it changes the version too
+		return appErrors.ErrPreconditionFailed.New("the complaint has changed, fetch it again")
+	}
+	return nil
+}
+
+// missingOrStale explains why a conditional update touched nothing.
+func (r *PgxComplaintRepo) missingOrStale(ctx context.Context, complaintID int) error {
+	var exists bool
+	err := r.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM complaints WHERE id=$1)`, complaintID).Scan(&exists)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+	if !exists {
+		return appErrors.ErrUserNotFound.New("complaint not found")
+	}
+	return appErrors.ErrPreconditionFailed.New("the complaint has changed, fetch it again")
+}
+
 func (r *PgxComplaintRepo) GetAllComplaintByRole(ctx context.Context, param utility.FilterParam) ([]*models.Complaints, error) {
-	query := `SELECT id, user_id, subject, message, status, created_at FROM complaints WHERE 1=1` //to add AND conditions later.
+	query := `SELECT ` + complaintColumns + ` FROM complaints WHERE 1=1` //to add AND conditions later.
 	var args []interface{}
 	argIdx := 1
 
@@ -169,7 +217,7 @@ func (r *PgxComplaintRepo) GetAllComplaintByRole(ctx context.Context, param util
 	var complaints []*models.Complaints
 	for rows.Next() {
 		var c models.Complaints
-		err := rows.Scan(&c.ID, &c.UserID, &c.Subject, &c.Message, &c.Status, &c.CreatedAt)
+		err := scanComplaint(rows, &c)
 		if err != nil {
 			return nil, appErrors.ErrDbFailure.New("Failed to scan row")
 		}
@@ -203,7 +251,7 @@ func (r *PgxComplaintMessageRepo) AddMessage(ctx context.Context, cm *models.Com
 }
 
 func (r *PgxComplaintMessageRepo) GetMessagesByComplaint(ctx context.Context, complaintID int) ([]*models.ComplaintMessages, error) {
-	query := `SELECT * FROM complaint_messages WHERE complaint_id=$1`
+	query := `SELECT * FROM complaint_messages WHERE complaint_id=$1 ORDER BY created_at, id`
 	rows, err := r.db.Query(ctx, query, complaintID)
 	if err != nil {
 		return nil, appErrors.ErrDbFailure.Wrap(err, "query failed")
@@ -238,4 +286,80 @@ func (r *PgxComplaintMessageRepo) GetMessageByID(ctx context.Context, messageID
 	return &cm, nil
 }
 
+// GetMessageThread loads one page of the subtree below param.ParentID (the
+// root messages when it is nil) and walks the replies with a recursive CTE,
+// keeping at most param.RepliesLimit replies per message down to param.MaxDepth.
+func (r *PgxComplaintMessageRepo) GetMessageThread(ctx context.Context, complaintID int, param utility.ThreadParam) (*models.MessageThread, error) {
+	order := "ASC"
+	if param.Order == "desc" {
+		order = "DESC"
+	}
+
+	thread := &models.MessageThread{
+		ComplaintID: complaintID,
+		ParentID:    param.ParentID,
+		Page:        param.Page,
+		PerPage:     param.PerPage,
+		Messages:    []*models.ComplaintMessageNode{},
+	}
+
+	countQuery := `SELECT COUNT(*) FROM complaint_messages WHERE complaint_id=$1 AND parent_id IS NOT DISTINCT FROM $2`
+	err := r.db.QueryRow(ctx, countQuery, complaintID, param.ParentID).Scan(&thread.Total)
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "failed to count thread messages")
+	}
+
+	query := fmt.Sprintf(`
+	WITH RECURSIVE ranked AS (
+		SELECT id, complaint_id, sender_id, parent_id, message, COALESCE(file_url, '') AS file_url, created_at,
+			ROW_NUMBER() OVER (PARTITION BY parent_id ORDER BY created_at %[1]s, id %[1]s) AS rn
+		FROM complaint_messages
+		WHERE complaint_id=$1
+	), thread AS (
+		SELECT r.*, 0 AS depth, ARRAY[r.rn] AS path
+		FROM ranked r
+		WHERE r.parent_id IS NOT DISTINCT FROM $2 AND r.rn > $3 AND r.rn <= $4
+		UNION ALL
+		SELECT c.*, t.depth + 1, t.path || c.rn
+		FROM ranked c
+		JOIN thread t ON c.parent_id = t.id
+		WHERE t.depth < $5 AND c.rn <= $6
+	)
+	SELECT t.id, t.complaint_id, t.sender_id, t.parent_id, t.message, t.file_url, t.created_at, t.depth,
+		(SELECT COUNT(*) FROM complaint_messages x WHERE x.parent_id = t.id) AS reply_count
+	FROM thread t
+	ORDER BY t.path`, order)
+
+	offset := (param.Page - 1) * param.PerPage
+	rows, err := r.db.Query(ctx, query, complaintID, param.ParentID, offset, offset+param.PerPage, param.MaxDepth, param.RepliesLimit)
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "thread query failed")
+	}
+	defer rows.Close()
+
+	// rows come back in path order, so a parent is always seen before its replies
+	nodes := map[int]*models.ComplaintMessageNode{}
+	for rows.Next() {
+		n := &models.ComplaintMessageNode{Replies: []*models.ComplaintMessageNode{}}
+		err := rows.Scan(&n.ID, &n.ComplaintID, &n.SenderID, &n.ParentID, &n.Message, &n.FileUrl, &n.CreatedAt, &n.Depth, &n.ReplyCount)
+		if err != nil {
+			return nil, appErrors.ErrDbFailure.Wrap(err, "Failed to scan row of thread")
+		}
+		nodes[n.ID] = n
+
+		if n.Depth > 0 && n.ParentID != nil {
+			if parent, ok := nodes[*n.ParentID]; ok {
+				parent.Replies = append(parent.Replies, n)
+				continue
+			}
+		}
+		thread.Messages = append(thread.Messages, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "thread query failed")
+	}
+
+	return thread, nil
+}
+
 // notifier interface
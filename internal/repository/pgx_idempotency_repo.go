@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"Complaingo/internal/domain/models"
+	"Complaingo/internal/idempotency"
+	"context"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// PgxIdempotencyRepo is the idempotency.Store used when redis is not
+// connected. Expired rows are taken over by the next request for their key.
+type PgxIdempotencyRepo struct {
+	db *pgx.Conn
+}
+
+func NewPgxIdempotencyRepo(db *pgx.Conn) *PgxIdempotencyRepo {
+	return &PgxIdempotencyRepo{db: db}
+}
+
+func (r *PgxIdempotencyRepo) Begin(ctx context.Context, req idempotency.Request, lock time.Duration) (*models.IdempotentResponse, error) {
+	claim := `INSERT INTO idempotency_keys (user_id, key, fingerprint, expires_at)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (user_id, key) DO UPDATE
+	SET fingerprint=EXCLUDED.fingerprint, status_code=NULL, content_type='', body=NULL,
+		created_at=NOW(), expires_at=EXCLUDED.expires_at
+	WHERE idempotency_keys.expires_at <= NOW()
+	RETURNING user_id`
+
+	var userID int
+	err := r.db.QueryRow(ctx, claim, req.UserID, req.Key, req.Fingerprint, time.Now().Add(lock)).Scan(&userID)
+	if err == nil {
+		return nil, nil
+	}
+	if err != pgx.ErrNoRows {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "failed to claim idempotency key")
+	}
+
+	// someone else holds the key, or has answered it
+	var fingerprint, contentType string
+	var status *int
+	var body []byte
+	err = r.db.QueryRow(ctx, `SELECT fingerprint, status_code, content_type, body
+	FROM idempotency_keys WHERE user_id=$1 AND key=$2`, req.UserID, req.Key).Scan(&fingerprint, &status, &contentType, &body)
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "failed to read idempotency key")
+	}
+
+	var resp *models.IdempotentResponse
+	if status != nil {
+		resp = &models.IdempotentResponse{StatusCode: *status, ContentType: contentType, Body: body}
+	}
+	return idempotency.Existing(req, fingerprint, resp)
+}
+
+func (r *PgxIdempotencyRepo) Complete(ctx context.Context, req idempotency.Request, resp *models.IdempotentResponse, ttl time.Duration) error {
+	query := `UPDATE idempotency_keys SET status_code=$1, content_type=$2, body=$3, expires_at=$4
+	WHERE user_id=$5 AND key=$6`
+	_, err := r.db.Exec(ctx, query, resp.StatusCode, resp.ContentType, resp.Body, time.Now().Add(ttl), req.UserID, req.Key)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to store idempotent response")
+	}
+	return nil
+}
+
+func (r *PgxIdempotencyRepo) Release(ctx context.Context, req idempotency.Request) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM idempotency_keys WHERE user_id=$1 AND key=$2 AND status_code IS NULL`, req.UserID, req.Key)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to release idempotency key")
+	}
+	return nil
+}
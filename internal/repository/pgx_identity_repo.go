@@ -0,0 +1,45 @@
+package repository
+
+import (
+	appErrors "Complaingo/internal/errors"
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type PgxIdentityRepo struct {
+	db *pgx.Conn
+}
+
+func NewPgxIdentityRepo(db *pgx.Conn) *PgxIdentityRepo {
+	return &PgxIdentityRepo{db: db}
+}
+
+func (r *PgxIdentityRepo) GetUserIDByIdentity(ctx context.Context, issuer, subject string) (int, error) {
+	var userID int
+	err := r.db.QueryRow(ctx, `SELECT user_id FROM user_identities WHERE issuer=$1 AND subject=$2`, issuer, subject).Scan(&userID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return 0, appErrors.ErrUserNotFound.New("identity is not linked to a user")
+		}
+		return 0, appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+	return userID, nil
+}
+
+// LinkIdentity links the identity to the user, or records a new login when
+// it is already linked.
+func (r *PgxIdentityRepo) LinkIdentity(ctx context.Context, userID int, issuer, subject, email string) error {
+	query := `INSERT INTO user_identities (user_id, issuer, subject, email) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (issuer, subject) DO UPDATE SET email=EXCLUDED.email, last_login_at=NOW()
+	WHERE user_identities.user_id = EXCLUDED.user_id`
+
+	res, err := r.db.Exec(ctx, query, userID, issuer, subject, email)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to link identity")
+	}
+	if res.RowsAffected() == 0 {
+		return appErrors.ErrUserDuplicate.New("identity is linked to another user")
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"Complaingo/internal/domain/models"
+	appErrors "Complaingo/internal/errors"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// conditions matching each invitation status
+var invitationStatus = map[string]string{
+	models.InvitationPending:  "i.accepted_at IS NULL AND i.revoked_at IS NULL AND i.expires_at > NOW()",
+	models.InvitationAccepted: "i.accepted_at IS NOT NULL",
+	models.InvitationRevoked:  "i.accepted_at IS NULL AND i.revoked_at IS NOT NULL",
+	models.InvitationExpired:  "i.accepted_at IS NULL AND i.revoked_at IS NULL AND i.expires_at <= NOW()",
+}
+
+type PgxInvitationRepo struct {
+	db *pgx.Conn
+}
+
+func NewPgxInvitationRepo(db *pgx.Conn) *PgxInvitationRepo {
+	return &PgxInvitationRepo{db: db}
+}
+
+// CreateInvitation replaces any invitation still pending for the address.
+func (r *PgxInvitationRepo) CreateInvitation(ctx context.Context, inv *models.Invitation) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `UPDATE invitations i SET revoked_at=NOW() WHERE i.email=$1 AND `+invitationStatus[models.InvitationPending], inv.Email)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to revoke earlier invitations")
+	}
+
+	query := `INSERT INTO invitations (email, role_id, token_hash, invited_by, expires_at)
+	VALUES ($1, (SELECT id FROM roles WHERE name=$2), $3, $4, $5) RETURNING id, created_at`
+	err = tx.QueryRow(ctx, query, inv.Email, inv.Role, inv.TokenHash, inv.InvitedBy, inv.ExpiresAt).Scan(&inv.ID, &inv.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23502" {
+			return appErrors.ErrInvalidPayload.New("role not found")
+		}
+		return appErrors.ErrDbFailure.Wrap(err, "failed to create invitation")
+	}
+	inv.Status = models.InvitationPending
+
+	if err := tx.Commit(ctx); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to commit invitation")
+	}
+	return nil
+}
+
+// GetInvitations returns matching invitations, newest first.
+func (r *PgxInvitationRepo) GetInvitations(ctx context.Context, filter models.InvitationFilter) ([]*models.Invitation, error) {
+	var where []string
+	var args []any
+	if cond, ok := invitationStatus[filter.Status]; ok {
+		where = append(where, cond)
+	}
+	if filter.Email != "" {
+		args = append(args, strings.ToLower(filter.Email))
+		where = append(where, fmt.Sprintf("i.email = $%d", len(args)))
+	}
+
+	query := `SELECT i.id, i.email, r.name, CASE
+		WHEN i.accepted_at IS NOT NULL THEN 'accepted'
+		WHEN i.revoked_at IS NOT NULL THEN 'revoked'
+		WHEN i.expires_at <= NOW() THEN 'expired'
+		ELSE 'pending' END,
+		i.invited_by, i.expires_at, i.created_at, i.accepted_at, i.accepted_user_id, i.revoked_at
+	FROM invitations i
+	JOIN roles r ON r.id = i.role_id`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	args = append(args, filter.PerPage, (filter.Page-1)*filter.PerPage)
+	query += fmt.Sprintf(" ORDER BY i.created_at DESC, i.id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+	defer rows.Close()
+
+	invitations := []*models.Invitation{}
+	for rows.Next() {
+		inv := &models.Invitation{}
+		err := rows.Scan(&inv.ID, &inv.Email, &inv.Role, &inv.Status, &inv.InvitedBy, &inv.ExpiresAt,
+			&inv.CreatedAt, &inv.AcceptedAt, &inv.AcceptedUserID, &inv.RevokedAt)
+		if err != nil {
+			return nil, appErrors.ErrDbFailure.Wrap(err, "failed to scan invitation")
+		}
+		invitations = append(invitations, inv)
+	}
+	return invitations, nil
+}
+
+// RevokeInvitation only revokes invitations that are still pending.
+func (r *PgxInvitationRepo) RevokeInvitation(ctx context.Context, id int64) error {
+	res, err := r.db.Exec(ctx, `UPDATE invitations i SET revoked_at=NOW() WHERE i.id=$1 AND `+invitationStatus[models.InvitationPending], id)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to revoke invitation")
+	}
+	if res.RowsAffected() == 0 {
+		return appErrors.ErrUserNotFound.New("no pending invitation with this id")
+	}
+	return nil
+}
+
+// AcceptInvitation spends a pending invitation and creates the invited user
+// in one go. The email comes from the invitation and counts as verified,
+// since the token was mailed there.
+func (r *PgxInvitationRepo) AcceptInvitation(ctx context.Context, tokenHash string, u *models.User) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	var invitationID int64
+	query := `SELECT i.id, i.email, i.role_id, r.name FROM invitations i
+	JOIN roles r ON r.id = i.role_id
+	WHERE i.token_hash=$1 AND ` + invitationStatus[models.InvitationPending] + ` FOR UPDATE OF i`
+	err = tx.QueryRow(ctx, query, tokenHash).Scan(&invitationID, &u.Email, &u.RoleID, &u.Role)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return appErrors.ErrUnauthorized.New("invitation is invalid, used, revoked or expired")
+		}
+		return appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+
+	err = tx.QueryRow(ctx, `INSERT INTO users (first_name, last_name, email, password, role_id, email_verified_at)
+	VALUES ($1, $2, $3, $4, $5, NOW()) RETURNING id`, u.FirstName, u.LastName, u.Email, u.Password, u.RoleID).Scan(&u.ID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return appErrors.ErrUserDuplicate.New("a user with this email already exists")
+		}
+		return appErrors.ErrDbFailure.Wrap(err, "failed to create user")
+	}
+	u.EmailVerified = true
+
+	_, err = tx.Exec(ctx, `UPDATE invitations SET accepted_at=NOW(), accepted_user_id=$2 WHERE id=$1`, invitationID, u.ID)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to accept invitation")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to commit invitation")
+	}
+	return nil
+}
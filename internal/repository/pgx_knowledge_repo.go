@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"Complaingo/internal/domain/models"
+	"context"
+
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type PgxKnowledgeRepo struct {
+	db *pgx.Conn
+}
+
+func NewPgxKnowledgeRepo(db *pgx.Conn) *PgxKnowledgeRepo {
+	return &PgxKnowledgeRepo{db: db}
+}
+
+func (r *PgxKnowledgeRepo) CreateEntry(ctx context.Context, e *models.KnowledgeEntry) error {
+	query := `INSERT INTO knowledge_entries (kind, title, body, created_by) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+
+	if err := r.db.QueryRow(ctx, query, e.Kind, e.Title, e.Body, e.CreatedBy).Scan(&e.ID, &e.CreatedAt); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to create knowledge entry")
+	}
+	return nil
+}
+
+func (r *PgxKnowledgeRepo) GetEntries(ctx context.Context, kind string) ([]*models.KnowledgeEntry, error) {
+	query := `SELECT id, kind, title, body, COALESCE(embedding, '{}'), embedding_model, created_by, created_at
+	FROM knowledge_entries WHERE $1 = '' OR kind = $1 ORDER BY id`
+	rows, err := r.db.Query(ctx, query, kind)
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+	defer rows.Close()
+
+	entries := []*models.KnowledgeEntry{}
+	for rows.Next() {
+		var e models.KnowledgeEntry
+		if err := rows.Scan(&e.ID, &e.Kind, &e.Title, &e.Body, &e.Embedding, &e.EmbeddingModel, &e.CreatedBy, &e.CreatedAt); err != nil {
+			return nil, appErrors.ErrDbFailure.Wrap(err, "failed to scan knowledge entry")
+		}
+		entries = append(entries, &e)
+	}
+	return entries, nil
+}
+
+func (r *PgxKnowledgeRepo) DeleteEntry(ctx context.Context, id int) error {
+	res, err := r.db.Exec(ctx, `DELETE FROM knowledge_entries WHERE id=$1`, id)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to delete knowledge entry")
+	}
+	if res.RowsAffected() == 0 {
+		return appErrors.ErrUserNotFound.New("knowledge entry not found")
+	}
+	return nil
+}
+
+func (r *PgxKnowledgeRepo) SaveEmbedding(ctx context.Context, id int, embedding []float64, model string) error {
+	_, err := r.db.Exec(ctx, `UPDATE knowledge_entries SET embedding=$1, embedding_model=$2 WHERE id=$3`, embedding, model, id)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to save embedding")
+	}
+	return nil
+}
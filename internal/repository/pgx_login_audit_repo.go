@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"Complaingo/internal/domain/models"
+	appErrors "Complaingo/internal/errors"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type PgxLoginAuditRepo struct {
+	db *pgx.Conn
+}
+
+func NewPgxLoginAuditRepo(db *pgx.Conn) *PgxLoginAuditRepo {
+	return &PgxLoginAuditRepo{db: db}
+}
+
+func (r *PgxLoginAuditRepo) RecordLoginAttempt(ctx context.Context, a *models.LoginAttempt) error {
+	query := `INSERT INTO login_audit (user_id, email, success, reason, ip, user_agent)
+	VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`
+
+	err := r.db.QueryRow(ctx, query, a.UserID, a.Email, a.Success, a.Reason, a.IP, a.UserAgent).Scan(&a.ID, &a.CreatedAt)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to record login attempt")
+	}
+	return nil
+}
+
+// GetLoginAttempts returns matching attempts, newest first.
+func (r *PgxLoginAuditRepo) GetLoginAttempts(ctx context.Context, filter models.LoginAuditFilter) ([]*models.LoginAttempt, error) {
+	var where []string
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+
+	if filter.UserID > 0 {
+		add("user_id = $%d", filter.UserID)
+	}
+	if filter.Email != "" {
+		add("email = $%d", strings.ToLower(filter.Email))
+	}
+	if filter.IP != "" {
+		add("ip = $%d", filter.IP)
+	}
+	if filter.Success != nil {
+		add("success = $%d", *filter.Success)
+	}
+	if !filter.Since.IsZero() {
+		add("created_at >= $%d", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		add("created_at < $%d", filter.Until)
+	}
+
+	query := `SELECT id, user_id, email, success, reason, ip, user_agent, created_at FROM login_audit`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	args = append(args, filter.PerPage, (filter.Page-1)*filter.PerPage)
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+	defer rows.Close()
+
+	attempts := []*models.LoginAttempt{}
+	for rows.Next() {
+		a := &models.LoginAttempt{}
+		if err := rows.Scan(&a.ID, &a.UserID, &a.Email, &a.Success, &a.Reason, &a.IP, &a.UserAgent, &a.CreatedAt); err != nil {
+			return nil, appErrors.ErrDbFailure.Wrap(err, "failed to scan login attempt")
+		}
+		attempts = append(attempts, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "failed to read login attempts")
+	}
+	return attempts, nil
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"Complaingo/internal/domain/models"
+	appErrors "Complaingo/internal/errors"
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type PgxMFARepo struct {
+	db *pgx.Conn
+}
+
+func NewPgxMFARepo(db *pgx.Conn) *PgxMFARepo {
+	return &PgxMFARepo{db: db}
+}
+
+func (r *PgxMFARepo) GetMFA(ctx context.Context, userID int) (*models.MFA, error) {
+	m := &models.MFA{}
+	query := `SELECT user_id, secret, enabled_at, last_used_step, created_at FROM user_mfa WHERE user_id=$1`
+
+	err := r.db.QueryRow(ctx, query, userID).Scan(&m.UserID, &m.Secret, &m.EnabledAt, &m.LastUsedStep, &m.CreatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, appErrors.ErrUserNotFound.New("two-factor authentication is not set up")
+		}
+		return nil, appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+	return m, nil
+}
+
+// SaveMFASecret starts or restarts an enrolment. An enabled enrolment is left
+// alone, it has to be disabled first.
+func (r *PgxMFARepo) SaveMFASecret(ctx context.Context, userID int, secret string) error {
+	query := `INSERT INTO user_mfa (user_id, secret) VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE SET secret=EXCLUDED.secret, last_used_step=0, created_at=NOW()
+	WHERE user_mfa.enabled_at IS NULL`
+
+	res, err := r.db.Exec(ctx, query, userID, secret)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to save mfa secret")
+	}
+	if res.RowsAffected() == 0 {
+		return appErrors.ErrInvalidPayload.New("two-factor authentication is already enabled")
+	}
+	return nil
+}
+
+// EnableMFA confirms the enrolment and stores a fresh set of recovery codes.
+func (r *PgxMFARepo) EnableMFA(ctx context.Context, userID int, step int64, codeHashes []string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	res, err := tx.Exec(ctx, `UPDATE user_mfa SET enabled_at=NOW(), last_used_step=$2 WHERE user_id=$1 AND enabled_at IS NULL`, userID, step)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to enable mfa")
+	}
+	if res.RowsAffected() == 0 {
+		return appErrors.ErrInvalidPayload.New("two-factor authentication is already enabled")
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to commit mfa")
+	}
+	return nil
+}
+
+func (r *PgxMFARepo) DisableMFA(ctx context.Context, userID int) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id=$1`, userID); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to delete recovery codes")
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM user_mfa WHERE user_id=$1`, userID); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to disable mfa")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to commit mfa")
+	}
+	return nil
+}
+
+// UseTOTPStep records the step of an accepted code. A step at or before the
+// last one recorded means the code was already used.
+func (r *PgxMFARepo) UseTOTPStep(ctx context.Context, userID int, step int64) error {
+	res, err := r.db.Exec(ctx, `UPDATE user_mfa SET last_used_step=$2 WHERE user_id=$1 AND last_used_step < $2`, userID, step)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to record totp step")
+	}
+	if res.RowsAffected() == 0 {
+		return appErrors.ErrUnauthorized.New("code has already been used")
+	}
+	return nil
+}
+
+func (r *PgxMFARepo) UseRecoveryCode(ctx context.Context, userID int, codeHash string) error {
+	res, err := r.db.Exec(ctx, `UPDATE mfa_recovery_codes SET used_at=NOW() WHERE user_id=$1 AND code_hash=$2 AND used_at IS NULL`, userID, codeHash)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to use recovery code")
+	}
+	if res.RowsAffected() == 0 {
+		return appErrors.ErrUnauthorized.New("invalid recovery code")
+	}
+	return nil
+}
+
+func (r *PgxMFARepo) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to commit recovery codes")
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id=$1`, userID); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to delete recovery codes")
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.Exec(ctx, `INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash); err != nil {
+			return appErrors.ErrDbFailure.Wrap(err, "failed to insert recovery code")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"Complaingo/internal/domain/models"
+	appErrors "Complaingo/internal/errors"
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const refreshTokenColumns = `id, user_id, family_id, token_hash, expires_at, created_at, revoked_at, replaced_by, user_agent, ip, sso`
+
+type PgxRefreshTokenRepo struct {
+	db *pgx.Conn
+}
+
+func NewPgxRefreshTokenRepo(db *pgx.Conn) *PgxRefreshTokenRepo {
+	return &PgxRefreshTokenRepo{db: db}
+}
+
+func (r *PgxRefreshTokenRepo) CreateRefreshToken(ctx context.Context, t *models.RefreshToken) error {
+	return insertRefreshToken(ctx, r.db, t)
+}
+
+func insertRefreshToken(ctx context.Context, q querier, t *models.RefreshToken) error {
+	query := `INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at, user_agent, ip, sso)
+	VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at`
+
+	err := q.QueryRow(ctx, query, t.UserID, t.FamilyID, t.TokenHash, t.ExpiresAt, t.UserAgent, t.IP, t.SSO).Scan(&t.ID, &t.CreatedAt)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to insert refresh token")
+	}
+	return nil
+}
+
+func (r *PgxRefreshTokenRepo) GetRefreshTokenByHash(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	t := &models.RefreshToken{}
+	query := `SELECT ` + refreshTokenColumns + ` FROM refresh_tokens WHERE token_hash=$1`
+
+	err := r.db.QueryRow(ctx, query, hash).Scan(&t.ID, &t.UserID, &t.FamilyID, &t.TokenHash, &t.ExpiresAt,
+		&t.CreatedAt, &t.RevokedAt, &t.ReplacedBy, &t.UserAgent, &t.IP, &t.SSO)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, appErrors.ErrUnauthorized.New("refresh token not recognised")
+		}
+		return nil, appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+	return t, nil
+}
+
+// RotateRefreshToken spends the token oldID and stores next in its place.
+// Only one caller can spend a token: a concurrent or repeated use finds it
+// already revoked and gets ErrUnauthorized.
+func (r *PgxRefreshTokenRepo) RotateRefreshToken(ctx context.Context, oldID int64, next *models.RefreshToken) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	if err := insertRefreshToken(ctx, tx, next); err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(ctx, `UPDATE refresh_tokens SET revoked_at=NOW(), replaced_by=$1 WHERE id=$2 AND revoked_at IS NULL`, next.ID, oldID)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to rotate refresh token")
+	}
+	if res.RowsAffected() == 0 {
+		return appErrors.ErrUnauthorized.New("refresh token already used")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to commit refresh token")
+	}
+	return nil
+}
+
+func (r *PgxRefreshTokenRepo) RevokeFamily(ctx context.Context, familyID string) error {
+	_, err := r.db.Exec(ctx, `UPDATE refresh_tokens SET revoked_at=NOW() WHERE family_id=$1 AND revoked_at IS NULL`, familyID)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to revoke session")
+	}
+	return nil
+}
+
+func (r *PgxRefreshTokenRepo) RevokeUserTokens(ctx context.Context, userID int) error {
+	_, err := r.db.Exec(ctx, `UPDATE refresh_tokens SET revoked_at=NOW() WHERE user_id=$1 AND revoked_at IS NULL`, userID)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to revoke sessions")
+	}
+	return nil
+}
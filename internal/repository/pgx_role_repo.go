@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"Complaingo/internal/domain/models"
+	appErrors "Complaingo/internal/errors"
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const roleQuery = `SELECT r.id, r.name, r.description, r.built_in,
+	COALESCE(array_agg(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}')
+FROM roles r
+LEFT JOIN role_permissions rp ON rp.role_id = r.id`
+
+type PgxRoleRepo struct {
+	db *pgx.Conn
+}
+
+func NewPgxRoleRepo(db *pgx.Conn) *PgxRoleRepo {
+	return &PgxRoleRepo{db: db}
+}
+
+func (r *PgxRoleRepo) GetRoles(ctx context.Context) ([]*models.RoleDefinition, error) {
+	rows, err := r.db.Query(ctx, roleQuery+` GROUP BY r.id ORDER BY r.id`)
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+	defer rows.Close()
+
+	var roles []*models.RoleDefinition
+	for rows.Next() {
+		role := &models.RoleDefinition{}
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.BuiltIn, &role.Permissions); err != nil {
+			return nil, appErrors.ErrDbFailure.Wrap(err, "failed to scan role row")
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+func (r *PgxRoleRepo) GetRole(ctx context.Context, name string) (*models.RoleDefinition, error) {
+	role := &models.RoleDefinition{}
+	err := r.db.QueryRow(ctx, roleQuery+` WHERE r.name=$1 GROUP BY r.id`, name).
+		Scan(&role.ID, &role.Name, &role.Description, &role.BuiltIn, &role.Permissions)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, appErrors.ErrUserNotFound.New("role not found")
+		}
+		return nil, appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+	return role, nil
+}
+
+func (r *PgxRoleRepo) GetPermissions(ctx context.Context) ([]*models.Permission, error) {
+	rows, err := r.db.Query(ctx, `SELECT name, description FROM permissions ORDER BY name`)
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+	defer rows.Close()
+
+	var perms []*models.Permission
+	for rows.Next() {
+		p := &models.Permission{}
+		if err := rows.Scan(&p.Name, &p.Description); err != nil {
+			return nil, appErrors.ErrDbFailure.Wrap(err, "failed to scan permission row")
+		}
+		perms = append(perms, p)
+	}
+	return perms, nil
+}
+
+// GetRolePermissions is empty for roles that don't exist.
+func (r *PgxRoleRepo) GetRolePermissions(ctx context.Context, role string) ([]string, error) {
+	rows, err := r.db.Query(ctx, `SELECT rp.permission FROM role_permissions rp
+	JOIN roles r ON r.id = rp.role_id WHERE r.name=$1`, role)
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+	defer rows.Close()
+
+	var perms []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, appErrors.ErrDbFailure.Wrap(err, "failed to scan permission row")
+		}
+		perms = append(perms, p)
+	}
+	return perms, nil
+}
+
+func (r *PgxRoleRepo) CreateRole(ctx context.Context, role *models.RoleDefinition) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `INSERT INTO roles (name, description) VALUES ($1, $2)
+	ON CONFLICT (name) DO NOTHING RETURNING id`, role.Name, role.Description).Scan(&role.ID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return appErrors.ErrUserDuplicate.New("role already exists")
+		}
+		return appErrors.ErrDbFailure.Wrap(err, "failed to create role")
+	}
+
+	if err := grantPermissions(ctx, tx, role.ID, role.Permissions); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to commit role")
+	}
+	return nil
+}
+
+// UpdateRole replaces the description and the permissions of a role.
+func (r *PgxRoleRepo) UpdateRole(ctx context.Context, role *models.RoleDefinition) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `UPDATE roles SET description=$2 WHERE name=$1 RETURNING id`, role.Name, role.Description).Scan(&role.ID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return appErrors.ErrUserNotFound.New("role not found")
+		}
+		return appErrors.ErrDbFailure.Wrap(err, "failed to update role")
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM role_permissions WHERE role_id=$1`, role.ID); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to update role permissions")
+	}
+	if err := grantPermissions(ctx, tx, role.ID, role.Permissions); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to commit role")
+	}
+	return nil
+}
+
+func grantPermissions(ctx context.Context, tx pgx.Tx, roleID int, perms []string) error {
+	_, err := tx.Exec(ctx, `INSERT INTO role_permissions (role_id, permission)
+	SELECT $1, unnest($2::text[]) ON CONFLICT DO NOTHING`, roleID, perms)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return appErrors.ErrInvalidPayload.New("unknown permission")
+		}
+		return appErrors.ErrDbFailure.Wrap(err, "failed to grant permissions")
+	}
+	return nil
+}
+
+// DeleteRole refuses built in roles and roles still assigned to users.
+func (r *PgxRoleRepo) DeleteRole(ctx context.Context, name string) error {
+	res, err := r.db.Exec(ctx, `DELETE FROM roles WHERE name=$1 AND NOT built_in`, name)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return appErrors.ErrUserDuplicate.New("role is still assigned to users")
+		}
+		return appErrors.ErrDbFailure.Wrap(err, "failed to delete role")
+	}
+	if res.RowsAffected() == 0 {
+		return appErrors.ErrUserNotFound.New("role not found or built in")
+	}
+	return nil
+}
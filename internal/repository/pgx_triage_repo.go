@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"Complaingo/internal/domain/models"
+	"context"
+
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type PgxTriageRepo struct {
+	db *pgx.Conn
+}
+
+func NewPgxTriageRepo(db *pgx.Conn) *PgxTriageRepo {
+	return &PgxTriageRepo{db: db}
+}
+
+// triageColumns maps each triaged field to its complaints column.
+var triageColumns = map[string]string{
+	models.TriageCategory:  "category",
+	models.TriagePriority:  "priority",
+	models.TriageSentiment: "sentiment",
+	models.TriageLanguage:  "language",
+}
+
+const suggestionColumns = `id, complaint_id, field, value, confidence, model, status, created_at, decided_at`
+
+func scanSuggestion(row pgx.Row, s *models.TriageSuggestion) error {
+	return row.Scan(&s.ID, &s.ComplaintID, &s.Field, &s.Value, &s.Confidence, &s.Model, &s.Status, &s.CreatedAt, &s.DecidedAt)
+}
+
+func (r *PgxTriageRepo) SaveSuggestions(ctx context.Context, complaintID int, suggestions []*models.TriageSuggestion) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	query := `INSERT INTO complaint_triage_suggestions (complaint_id, field, value, confidence, model, status)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (complaint_id, field) DO UPDATE SET value=EXCLUDED.value, confidence=EXCLUDED.confidence,
+		model=EXCLUDED.model, status=EXCLUDED.status, created_at=NOW(), decided_at=NULL
+	RETURNING ` + suggestionColumns
+	for _, s := range suggestions {
+		column, ok := triageColumns[s.Field]
+		if !ok {
+			return appErrors.ErrInvalidPayload.New("unknown triage field %q", s.Field)
+		}
+		if err := scanSuggestion(tx.QueryRow(ctx, query, complaintID, s.Field, s.Value, s.Confidence, s.Model, s.Status), s); err != nil {
+			return appErrors.ErrDbFailure.Wrap(err, "failed to save triage suggestion")
+		}
+		if s.Status != models.TriageAutoApplied {
+			continue
+		}
+
+		// an admin may have been quicker than the model
+		res, err := tx.Exec(ctx, `UPDATE complaints SET `+column+`=$1, version=version+1 WHERE id=$2 AND `+column+`=''`, s.Value, complaintID)
+		if err != nil {
+			return appErrors.ErrDbFailure.Wrap(err, "failed to apply triage suggestion")
+		}
+		if res.RowsAffected() == 0 {
+			s.Status = models.TriagePending
+			if _, err := tx.Exec(ctx, `UPDATE complaint_triage_suggestions SET status=$1 WHERE id=$2`, s.Status, s.ID); err != nil {
+				return appErrors.ErrDbFailure.Wrap(err, "failed to save triage suggestion")
+			}
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to commit triage suggestions")
+	}
+	return nil
+}
+
+func (r *PgxTriageRepo) GetSuggestions(ctx context.Context, complaintID int) ([]*models.TriageSuggestion, error) {
+	rows, err := r.db.Query(ctx, `SELECT `+suggestionColumns+` FROM complaint_triage_suggestions WHERE complaint_id=$1 ORDER BY id`, complaintID)
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+	defer rows.Close()
+
+	suggestions := []*models.TriageSuggestion{}
+	for rows.Next() {
+		var s models.TriageSuggestion
+		if err := scanSuggestion(rows, &s); err != nil {
+			return nil, appErrors.ErrDbFailure.Wrap(err, "failed to scan triage suggestion")
+		}
+		suggestions = append(suggestions, &s)
+	}
+	return suggestions, rows.Err()
+}
+
+func (r *PgxTriageRepo) GetSuggestion(ctx context.Context, complaintID int, field string) (*models.TriageSuggestion, error) {
+	var s models.TriageSuggestion
+	err := scanSuggestion(r.db.QueryRow(ctx, `SELECT `+suggestionColumns+` FROM complaint_triage_suggestions WHERE complaint_id=$1 AND field=$2`, complaintID, field), &s)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, appErrors.ErrUserNotFound.New("no triage suggestion for %s", field)
+		}
+		return nil, appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+	return &s, nil
+}
+
+func (r *PgxTriageRepo) Decide(ctx context.Context, d *models.TriageDecision) error {
+	column, ok := triageColumns[d.Field]
+	if !ok {
+		return appErrors.ErrInvalidPayload.New("unknown triage field %q", d.Field)
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	// only one decision per suggestion, however many admins click at once
+	res, err := tx.Exec(ctx, `UPDATE complaint_triage_suggestions SET status=$1, decided_at=NOW()
+	WHERE complaint_id=$2 AND field=$3 AND status IN ('pending', 'auto_applied')`, d.Decision, d.ComplaintID, d.Field)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to update triage suggestion")
+	}
+	if res.RowsAffected() == 0 {
+		return appErrors.ErrConflict.New("the %s suggestion was already decided", d.Field)
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE complaints SET `+column+`=$1, version=version+1 WHERE id=$2`, d.FinalValue, d.ComplaintID); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to apply triage decision")
+	}
+
+	query := `INSERT INTO complaint_triage_decisions
+	(complaint_id, field, suggested_value, confidence, auto_applied, final_value, decision, decided_by)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, decided_at`
+	err = tx.QueryRow(ctx, query, d.ComplaintID, d.Field, d.SuggestedValue, d.Confidence, d.AutoApplied,
+		d.FinalValue, d.Decision, d.DecidedBy).Scan(&d.ID, &d.DecidedAt)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to log triage decision")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to commit triage decision")
+	}
+	return nil
+}
+
+func (r *PgxTriageRepo) GetAccuracy(ctx context.Context) ([]*models.TriageAccuracy, error) {
+	query := `SELECT field, COUNT(*),
+		COUNT(*) FILTER (WHERE decision='accepted'),
+		COUNT(*) FILTER (WHERE decision='overridden'),
+		COUNT(*) FILTER (WHERE auto_applied),
+		COUNT(*) FILTER (WHERE auto_applied AND decision='overridden')
+	FROM complaint_triage_decisions GROUP BY field ORDER BY field`
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+	defer rows.Close()
+
+	accuracy := []*models.TriageAccuracy{}
+	for rows.Next() {
+		var a models.TriageAccuracy
+		if err := rows.Scan(&a.Field, &a.Decisions, &a.Accepted, &a.Overridden, &a.AutoApplied, &a.AutoAppliedOverridden); err != nil {
+			return nil, appErrors.ErrDbFailure.Wrap(err, "failed to scan triage accuracy")
+		}
+		if a.Decisions > 0 {
+			a.Accuracy = float64(a.Accepted) / float64(a.Decisions)
+		}
+		accuracy = append(accuracy, &a)
+	}
+	return accuracy, rows.Err()
+}
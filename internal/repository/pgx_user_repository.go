@@ -5,9 +5,11 @@ import (
 	appErrors "Complaingo/internal/errors"
 	"Complaingo/internal/utility"
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 type PgxUserRepo struct {
@@ -28,8 +30,8 @@ func (r *PgxUserRepo) CreateUser(ctx context.Context, u *models.User) error {
 	query := `
 	INSERT INTO users (first_name, last_name, email, password, role_id)
 	VALUES ($1, $2, $3, $4, (SELECT id FROM roles WHERE name = $5))
-	RETURNING id`
-	err = r.db.QueryRow(ctx, query, u.FirstName, u.LastName, u.Email, u.Password, u.Role).Scan(&u.ID)
+	RETURNING id, version`
+	err = r.db.QueryRow(ctx, query, u.FirstName, u.LastName, u.Email, u.Password, u.Role).Scan(&u.ID, &u.Version)
 
 	if err != nil {
 		return appErrors.ErrDbFailure.Wrap(err, "failed to query the user")
@@ -42,7 +44,7 @@ func (r *PgxUserRepo) CreateUser(ctx context.Context, u *models.User) error {
 
 func (r *PgxUserRepo) GetAllUser(ctx context.Context, param utility.FilterParam) ([]*models.User, error) {
 	query := `
-	SELECT u.id, u.first_name, u.last_name, u.email, u.password, r.name as role, u.role_id
+	SELECT u.id, u.first_name, u.last_name, u.email, u.password, r.name as role, u.role_id, u.deactivated_at
 	FROM users u
 	LEFT JOIN roles r ON u.role_id = r.id
 	WHERE 1=1
@@ -92,7 +94,7 @@ func (r *PgxUserRepo) GetAllUser(ctx context.Context, param utility.FilterParam)
 	var users []*models.User
 	for rows.Next() {
 		var u models.User
-		err := rows.Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email, &u.Password, &u.Role, &u.RoleID)
+		err := rows.Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email, &u.Password, &u.Role, &u.RoleID, &u.DeactivatedAt)
 		if err != nil {
 			return nil, appErrors.ErrUserNotFound.New("failed to scan user row")
 		}
@@ -104,8 +106,13 @@ func (r *PgxUserRepo) GetAllUser(ctx context.Context, param utility.FilterParam)
 
 func (r *PgxUserRepo) GetUserByID(ctx context.Context, id int) (*models.User, error) {
 	var u models.User
-	query := `SELECT * FROM users WHERE id = $1`
-	err := r.db.QueryRow(ctx, query, id).Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email, &u.Password, &u.Role)
+	query := `SELECT u.id, u.first_name, u.last_name, u.email, u.password, COALESCE(r.name, ''), COALESCE(u.role_id, 0),
+		u.email_verified_at IS NOT NULL, u.deactivated_at, u.anonymized_at, u.version
+	FROM users u
+	LEFT JOIN roles r ON u.role_id = r.id
+	WHERE u.id = $1`
+	err := r.db.QueryRow(ctx, query, id).Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email, &u.Password, &u.Role, &u.RoleID,
+		&u.EmailVerified, &u.DeactivatedAt, &u.AnonymizedAt, &u.Version)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, appErrors.ErrUserNotFound.New("user not found the required id")
@@ -126,35 +133,75 @@ func (r *PgxUserRepo) GetRoleByName(ctx context.Context, roleName string) (int,
 	return id, nil
 }
 
-func (r *PgxUserRepo) UpdateUser(ctx context.Context, u *models.User) error {
-	query := `UPDATE users SET first_name=$1, last_name=$2, email=$3, password=$4, role=$5 WHERE id=$6`
-	_, err := r.db.Exec(ctx, query, u.FirstName, u.LastName, u.Email, u.Password, u.Role, u.ID)
+// UpdateUser writes the fields present in the patch. Passwords and roles have
+// their own methods. A new email address has to be verified again. Nothing is
+// written unless the user is still at version, or version is 0.
+func (r *PgxUserRepo) UpdateUser(ctx context.Context, id int, p models.UserPatch, version int) error {
+	b := utility.NewUpdateBuilder("users")
+	if p.FirstName != nil {
+		b.Set("first_name", *p.FirstName)
+	}
+	if p.LastName != nil {
+		b.Set("last_name", *p.LastName)
+	}
+	if p.Email != nil {
+		email := b.Set("email", *p.Email)
+		b.SetExpr("email_verified_at = CASE WHEN email = " + email + " THEN email_verified_at END")
+	}
+	if b.Empty() {
+		return nil
+	}
+	b.SetExpr("version=version+1")
+
+	v := b.Arg(version)
+	query := b.SQL() + " WHERE id=" + b.Arg(id) + " AND (" + v + " = 0 OR version=" + v + ")"
+	res, err := r.db.Exec(ctx, query, b.Args()...)
 	if err != nil {
-		return appErrors.ErrDbFailure.New("unable to update user")
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return appErrors.ErrUserDuplicate.New("a user with this email already exists")
+		}
+		return appErrors.ErrDbFailure.Wrap(err, "unable to update user")
+	}
+	if res.RowsAffected() == 0 {
+		return r.missingOrStale(ctx, id)
 	}
 	return nil
 }
 
-func (r *PgxUserRepo) DeleteUser(ctx context.Context, id int) error {
-	query := `DELETE FROM users WHERE id=$1`
-	res, err := r.db.Exec(ctx, query, id)
+func (r *PgxUserRepo) DeleteUser(ctx context.Context, id int, version int) error {
+	query := `DELETE FROM users WHERE id=$1 AND ($2 = 0 OR version=$2)`
+	res, err := r.db.Exec(ctx, query, id, version)
 	if err != nil {
-		if res.RowsAffected() == 0 {
-			return appErrors.ErrUserNotFound.New("no user found to delete")
-		}
 		return appErrors.ErrDbFailure.Wrap(err, "failed to excute delete query")
 	}
+	if res.RowsAffected() == 0 {
+		return r.missingOrStale(ctx, id)
+	}
 	return nil
 }
 
+// missingOrStale explains why a conditional write touched nothing.
+func (r *PgxUserRepo) missingOrStale(ctx context.Context, id int) error {
+	var exists bool
+	err := r.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id=$1)`, id).Scan(&exists)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+	if !exists {
+		return appErrors.ErrUserNotFound.New("user not found")
+	}
+	return appErrors.ErrPreconditionFailed.New("the user has changed, fetch it again")
+}
+
 func (r *PgxUserRepo) GetByEmail(ctx context.Context, email string) (*models.User, error) {
 	user := &models.User{}
 
-	query := `SELECT u.id, u.email, u.password, r.name as role
+	query := `SELECT u.id, u.email, u.password, r.name as role, u.email_verified_at IS NOT NULL, u.deactivated_at
 	FROM users u
 	LEFT JOIN roles r on u.role_id = r.id
 	WHERE u.email=$1`
-	err := r.db.QueryRow(ctx, query, email).Scan(&user.ID, &user.Email, &user.Password, &user.Role)
+	err := r.db.QueryRow(ctx, query, email).Scan(&user.ID, &user.Email, &user.Password, &user.Role, &user.EmailVerified, &user.DeactivatedAt)
 
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -165,3 +212,102 @@ func (r *PgxUserRepo) GetByEmail(ctx context.Context, email string) (*models.Use
 
 	return user, nil
 }
+
+func (r *PgxUserRepo) IsEmailVerified(ctx context.Context, id int) (bool, error) {
+	var verified bool
+	err := r.db.QueryRow(ctx, `SELECT email_verified_at IS NOT NULL FROM users WHERE id=$1`, id).Scan(&verified)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return false, appErrors.ErrUserNotFound.New("user not found")
+		}
+		return false, appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+	return verified, nil
+}
+
+func (r *PgxUserRepo) MarkEmailVerified(ctx context.Context, id int) error {
+	_, err := r.db.Exec(ctx, `UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()) WHERE id=$1`, id)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to verify email")
+	}
+	return nil
+}
+
+func (r *PgxUserRepo) UpdatePassword(ctx context.Context, id int, hash string) error {
+	res, err := r.db.Exec(ctx, `UPDATE users SET password=$1 WHERE id=$2`, hash, id)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to update password")
+	}
+	if res.RowsAffected() == 0 {
+		return appErrors.ErrUserNotFound.New("user not found")
+	}
+	return nil
+}
+
+func (r *PgxUserRepo) UpdateRole(ctx context.Context, id int, role string) error {
+	res, err := r.db.Exec(ctx, `UPDATE users SET role_id=(SELECT id FROM roles WHERE name=$1), version=version+1 WHERE id=$2`, role, id)
+	if err != nil {
+		return appErrors.ErrInvalidPayload.Wrap(err, "failed to update role")
+	}
+	if res.RowsAffected() == 0 {
+		return appErrors.ErrUserNotFound.New("user not found")
+	}
+	return nil
+}
+
+// SetDeactivated deactivates or reactivates a user. Anonymized users stay
+// deactivated.
+func (r *PgxUserRepo) SetDeactivated(ctx context.Context, id int, deactivated bool) error {
+	query := `UPDATE users SET deactivated_at = CASE WHEN $1 THEN COALESCE(deactivated_at, NOW()) END,
+		version=version+1
+	WHERE id=$2 AND anonymized_at IS NULL`
+	res, err := r.db.Exec(ctx, query, deactivated, id)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to update user status")
+	}
+	if res.RowsAffected() == 0 {
+		return appErrors.ErrUserNotFound.New("no active or deactivated user with this id")
+	}
+	return nil
+}
+
+// AnonymizeUser scrubs the personal data of a user and everything that
+// lets them sign in, keeping the row so their complaints stay reportable.
+func (r *PgxUserRepo) AnonymizeUser(ctx context.Context, id int) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	// the email stays unique and can't receive mail
+	res, err := tx.Exec(ctx, `UPDATE users SET first_name='Deleted', last_name='User',
+		email='deleted-' || id || '@anonymized.invalid', password='', email_verified_at=NULL,
+		deactivated_at=COALESCE(deactivated_at, NOW()), anonymized_at=NOW(), version=version+1
+	WHERE id=$1 AND anonymized_at IS NULL`, id)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to anonymize user")
+	}
+	if res.RowsAffected() == 0 {
+		return appErrors.ErrUserNotFound.New("no user to anonymize with this id")
+	}
+
+	for _, query := range []string{
+		`DELETE FROM refresh_tokens WHERE user_id=$1`,
+		`DELETE FROM user_tokens WHERE user_id=$1`,
+		`DELETE FROM user_mfa WHERE user_id=$1`,
+		`DELETE FROM mfa_recovery_codes WHERE user_id=$1`,
+		`DELETE FROM user_identities WHERE user_id=$1`,
+		`DELETE FROM api_keys WHERE user_id=$1`,
+		`UPDATE login_audit SET email='', ip='', user_agent='' WHERE user_id=$1`,
+	} {
+		if _, err := tx.Exec(ctx, query, id); err != nil {
+			return appErrors.ErrDbFailure.Wrap(err, "failed to anonymize user")
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to commit anonymization")
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"Complaingo/internal/domain/models"
+	appErrors "Complaingo/internal/errors"
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type PgxUserTokenRepo struct {
+	db *pgx.Conn
+}
+
+func NewPgxUserTokenRepo(db *pgx.Conn) *PgxUserTokenRepo {
+	return &PgxUserTokenRepo{db: db}
+}
+
+func (r *PgxUserTokenRepo) CreateUserToken(ctx context.Context, t *models.UserToken) error {
+	query := `INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at)
+	VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+
+	err := r.db.QueryRow(ctx, query, t.UserID, t.Purpose, t.TokenHash, t.ExpiresAt).Scan(&t.ID, &t.CreatedAt)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to insert user token")
+	}
+	return nil
+}
+
+// ConsumeUserToken marks a valid token used and returns it. The check and the
+// update are one statement, so a token can never be used twice.
+func (r *PgxUserTokenRepo) ConsumeUserToken(ctx context.Context, hash string, purpose models.UserTokenPurpose) (*models.UserToken, error) {
+	t := &models.UserToken{}
+	query := `UPDATE user_tokens SET used_at=NOW()
+	WHERE token_hash=$1 AND purpose=$2 AND used_at IS NULL AND expires_at > NOW()
+	RETURNING id, user_id, purpose, token_hash, expires_at, used_at, created_at`
+
+	err := r.db.QueryRow(ctx, query, hash, purpose).Scan(&t.ID, &t.UserID, &t.Purpose, &t.TokenHash, &t.ExpiresAt, &t.UsedAt, &t.CreatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, appErrors.ErrInvalidPayload.New("token is invalid, expired or already used")
+		}
+		return nil, appErrors.ErrDbFailure.Wrap(err, "query failed")
+	}
+	return t, nil
+}
+
+// InvalidateUserTokens retires outstanding tokens, so only the newest link
+// mailed for a purpose works.
+func (r *PgxUserTokenRepo) InvalidateUserTokens(ctx context.Context, userID int, purpose models.UserTokenPurpose) error {
+	_, err := r.db.Exec(ctx, `UPDATE user_tokens SET used_at=NOW() WHERE user_id=$1 AND purpose=$2 AND used_at IS NULL`, userID, purpose)
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to invalidate user tokens")
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"Complaingo/internal/domain/models"
+	"context"
+)
+
+type RefreshTokenRepository interface {
+	CreateRefreshToken(ctx context.Context, t *models.RefreshToken) error
+	GetRefreshTokenByHash(ctx context.Context, hash string) (*models.RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, oldID int64, next *models.RefreshToken) error
+	RevokeFamily(ctx context.Context, familyID string) error
+	RevokeUserTokens(ctx context.Context, userID int) error
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"Complaingo/internal/domain/models"
+	"context"
+)
+
+type RoleRepository interface {
+	GetRoles(ctx context.Context) ([]*models.RoleDefinition, error)
+	GetRole(ctx context.Context, name string) (*models.RoleDefinition, error)
+	GetPermissions(ctx context.Context) ([]*models.Permission, error)
+	GetRolePermissions(ctx context.Context, role string) ([]string, error)
+	CreateRole(ctx context.Context, role *models.RoleDefinition) error
+	UpdateRole(ctx context.Context, role *models.RoleDefinition) error
+	DeleteRole(ctx context.Context, name string) error
+}
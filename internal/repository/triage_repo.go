@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"Complaingo/internal/domain/models"
+	"context"
+)
+
+type TriageRepository interface {
+	// SaveSuggestions replaces the suggestions for a complaint, and applies
+	// the auto applied ones to fields nobody has set yet.
+	SaveSuggestions(ctx context.Context, complaintID int, suggestions []*models.TriageSuggestion) error
+	GetSuggestions(ctx context.Context, complaintID int) ([]*models.TriageSuggestion, error)
+	GetSuggestion(ctx context.Context, complaintID int, field string) (*models.TriageSuggestion, error)
+	// Decide applies the decision to the complaint, marks the suggestion and
+	// logs the decision.
+	Decide(ctx context.Context, d *models.TriageDecision) error
+	GetAccuracy(ctx context.Context) ([]*models.TriageAccuracy, error)
+}
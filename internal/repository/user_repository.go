@@ -11,7 +11,13 @@ type UserRepository interface {
 	GetAllUser(ctx context.Context, param utility.FilterParam) ([]*models.User, error)
 	GetUserByID(ctx context.Context, id int) (*models.User, error)
 	GetRoleByName(ctx context.Context, roleName string) (int, error)
-	UpdateUser(ctx context.Context, u *models.User) error
-	DeleteUser(ctx context.Context, id int) error
+	UpdateUser(ctx context.Context, id int, p models.UserPatch, version int) error
+	DeleteUser(ctx context.Context, id int, version int) error
 	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	IsEmailVerified(ctx context.Context, id int) (bool, error)
+	MarkEmailVerified(ctx context.Context, id int) error
+	UpdatePassword(ctx context.Context, id int, hash string) error
+	UpdateRole(ctx context.Context, id int, role string) error
+	SetDeactivated(ctx context.Context, id int, deactivated bool) error
+	AnonymizeUser(ctx context.Context, id int) error
 }
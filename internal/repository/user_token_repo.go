@@ -0,0 +1,12 @@
+package repository
+
+import (
+	"Complaingo/internal/domain/models"
+	"context"
+)
+
+type UserTokenRepository interface {
+	CreateUserToken(ctx context.Context, t *models.UserToken) error
+	ConsumeUserToken(ctx context.Context, hash string, purpose models.UserTokenPurpose) (*models.UserToken, error)
+	InvalidateUserTokens(ctx context.Context, userID int, purpose models.UserTokenPurpose) error
+}
@@ -2,74 +2,389 @@ package router
 
 import (
 	"Complaingo/config"
+	"Complaingo/internal/ai"
+	"Complaingo/internal/assist"
+	"Complaingo/internal/auth"
+	"Complaingo/internal/breaker"
+	"Complaingo/internal/cache"
+	"Complaingo/internal/domain/models"
+	"Complaingo/internal/events"
 	"Complaingo/internal/handler"
+	"Complaingo/internal/idempotency"
 	"Complaingo/internal/kafka"
+	"Complaingo/internal/mailer"
 	"Complaingo/internal/middleware"
 	"Complaingo/internal/notifier"
+	"Complaingo/internal/oidc"
+	"Complaingo/internal/preview"
 	"Complaingo/internal/repository"
+	"Complaingo/internal/scanner"
+	"Complaingo/internal/storage"
+	"Complaingo/internal/triage"
+	"Complaingo/internal/upload"
 	"Complaingo/internal/usecase"
 	websocket "Complaingo/internal/websockets"
+	"context"
+	"expvar"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
 )
 
-func NewRouter(cfg *config.Config, db *pgx.Conn, kafkaProducer *kafka.KafkaProducer) *mux.Router {
+// NewRouter wires the service. Without rdb, shared state such as the cache
+// and the token denylist is kept in process.
+func NewRouter(cfg *config.Config, db *pgx.Conn, rdb *redis.Client, kafkaProducer *kafka.KafkaProducer) *mux.Router {
 	r := mux.NewRouter()
 
-	// serve static files
-	fs := http.FileServer(http.Dir("/uploads"))
-	r.PathPrefix("/static").Handler(http.StripPrefix("/static/", fs))
+	// blob storage for uploaded files, downloaded through signed links
+	signer := storage.NewURLSigner(cfg.DownloadURLSecret, "/files/")
+	store, err := storage.NewBlobStore(cfg, signer)
+	if err != nil {
+		log.Fatalf("Failed to set up blob storage: %v", err)
+	}
+
+	// every upload goes through the size, type and malware checks
+	uploadPolicy := upload.NewPolicy(map[string]int64{
+		string(models.UerRole):   cfg.UploadMaxBytesUser,
+		string(models.AdminRole): cfg.UploadMaxBytesAdmin,
+	}, cfg.UploadMaxBytesUser, cfg.UploadAllowedTypes)
+	fileScanner, err := scanner.New(cfg.Scanner, cfg.ClamAVAddr)
+	if err != nil {
+		log.Fatalf("Failed to set up upload scanner: %v", err)
+	}
+
+	// background workers react to events published by the usecases
+	bus := events.NewBus(2, 256, time.Minute)
+	bus.Subscribe(events.DocumentUploaded, preview.NewGenerator(store).HandleDocumentUploaded)
+
+	// serve blobs behind signed, expiring links
+	fileHandler := handler.NewFileHandler(store, signer)
+	r.PathPrefix("/files/").HandlerFunc(fileHandler.ServeSignedFile).Methods("GET")
+
+	// every use of redis goes through one circuit breaker, so that when it
+	// fails the cache, the denylist, the login throttle and the idempotency
+	// keys fall back together, and try it again together
+	var redisBreaker *breaker.Breaker
+	if rdb != nil {
+		redisBreaker = breaker.New("redis", int(cfg.RedisFailureThreshold), cfg.RedisCooldown, cfg.RedisTimeout)
+	}
+
+	// revoked access tokens, shared through redis when it is set up
+	var denylist auth.Denylist = auth.NewMemoryDenylist()
+	if rdb != nil {
+		denylist = auth.NewFallbackDenylist(auth.NewRedisDenylist(rdb), denylist, redisBreaker)
+	} else {
+		log.Println("redis not set up, keeping token revocations in memory")
+	}
+
+	// failed logins per account and per address, shared like the denylist
+	var failures auth.FailureCounter = auth.NewMemoryFailureCounter()
+	if rdb != nil {
+		failures = auth.NewFallbackFailureCounter(auth.NewRedisFailureCounter(rdb), failures, redisBreaker)
+	}
+	loginGuard := auth.NewLoginGuard(failures, auth.LoginPolicy{
+		MaxAccountFailures: cfg.LoginMaxAccountFailures,
+		MaxIPFailures:      cfg.LoginMaxIPFailures,
+		BackoffAfter:       cfg.LoginBackoffAfter,
+		BackoffBase:        cfg.LoginBackoffBase,
+		BackoffMax:         cfg.LoginBackoffMax,
+		Window:             cfg.LoginFailureWindow,
+		Lockout:            cfg.LoginLockout,
+	})
+
+	// read models are cached and invalidated by the usecases that change them,
+	// in process and, when it is set up, in redis
+	var cacheStore cache.Store = cache.NewMemoryStore(int(cfg.LocalCacheSize))
+	if rdb != nil {
+		cacheStore = cache.NewTieredStore(context.Background(), cache.NewRedisStore(rdb), cache.TieredConfig{
+			LocalSize: int(cfg.LocalCacheSize),
+			LocalTTL:  cfg.LocalCacheTTL,
+			Breaker:   redisBreaker,
+		})
+	}
+	appCache := cache.New(cacheStore, cfg.CacheTTL)
+
+	tokenService, err := newTokenService(cfg)
+	if err != nil {
+		log.Fatalf("Failed to set up token signing: %v", err)
+	}
+	r.HandleFunc("/.well-known/jwks.json", handler.JWKS(tokenService)).Methods("GET")
+
+	// verification and password reset links go out by mail
+	mail, err := mailer.New(mailer.Config{
+		Kind:     cfg.Mailer,
+		From:     cfg.MailFrom,
+		Dir:      cfg.MailDir,
+		SMTPHost: cfg.SMTPHost,
+		SMTPPort: cfg.SMTPPort,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+	})
+	if err != nil {
+		log.Fatalf("Failed to set up mailer: %v", err)
+	}
 
 	// ==== auth and users ====
 	repo := repository.NewPgxUserRepo(db)
-	usercase := usecase.NewUserUsecase(repo)
+	refreshRepo := repository.NewPgxRefreshTokenRepo(db)
+	userTokenRepo := repository.NewPgxUserTokenRepo(db)
+	mfaRepo := repository.NewPgxMFARepo(db)
+	loginAuditRepo := repository.NewPgxLoginAuditRepo(db)
+	mfaSecrets, err := auth.NewSecretBox(cfg.MFAEncryptionKey)
+	if err != nil {
+		log.Fatalf("Failed to set up mfa secret encryption: %v", err)
+	}
+	usercase := usecase.NewUserUsecase(repo, refreshRepo, userTokenRepo, mfaRepo, loginAuditRepo, mfaSecrets, tokenService, denylist, loginGuard, mail, appCache, usecase.UserUsecaseConfig{
+		AccessTTL:        cfg.AccessTokenTTL,
+		RefreshTTL:       cfg.RefreshTokenTTL,
+		VerifyEmailTTL:   cfg.EmailVerifyTTL,
+		ResetPasswordTTL: cfg.PasswordResetTTL,
+		AppBaseURL:       cfg.AppBaseURL,
+		MFAIssuer:        cfg.MFAIssuer,
+		MFAChallengeTTL:  cfg.MFAChallengeTTL,
+		MFARequiredRoles: cfg.MFARequiredRoles,
+	})
 	userHandler := handler.NewUserHandler(usercase)
 
+	// single sign-on through the corporate identity provider, when configured
+	if cfg.OIDCIssuerURL != "" {
+		ssoUC := usecase.NewSSOUsecase(oidc.NewProvider(oidc.Config{
+			IssuerURL:    cfg.OIDCIssuerURL,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Scopes:       cfg.OIDCScopes,
+			GroupsClaim:  cfg.OIDCGroupsClaim,
+		}), repo, repository.NewPgxIdentityRepo(db), usercase, mfaSecrets, cfg.OIDCRoleMapping, cfg.OIDCDefaultRole)
+		ssoHandler := handler.NewSSOHandler(ssoUC)
+
+		r.HandleFunc("/auth/oidc/login", ssoHandler.Login).Methods("GET")
+		r.HandleFunc("/auth/oidc/callback", ssoHandler.Callback).Methods("GET")
+	}
+	verified := middleware.RequireVerifiedEmail(usercase)
+
 	r.HandleFunc("/register", userHandler.Register).Methods("POST")
 	r.HandleFunc("/login", userHandler.Login).Methods("POST")
+	r.HandleFunc("/auth/refresh", userHandler.Refresh).Methods("POST")
+	r.HandleFunc("/auth/verify-email", userHandler.VerifyEmail).Methods("POST")
+	r.HandleFunc("/auth/password/forgot", userHandler.ForgotPassword).Methods("POST")
+	r.HandleFunc("/auth/password/reset", userHandler.ResetPassword).Methods("POST")
+	r.HandleFunc("/auth/mfa/verify", userHandler.VerifyMFA).Methods("POST")
+	r.HandleFunc("/auth/mfa/enroll", userHandler.EnrollMFA).Methods("POST")
+	r.HandleFunc("/auth/mfa/enroll/confirm", userHandler.ConfirmMFAEnrollment).Methods("POST")
+
+	// everyone but plain users joins through an invitation
+	roleRepo := repository.NewPgxRoleRepo(db)
+	invitationUC := usecase.NewInvitationUsecase(repository.NewPgxInvitationRepo(db), repo, roleRepo, mail, cfg.InviteTTL, cfg.AppBaseURL)
+	invitationHandler := handler.NewInvitationHandler(invitationUC)
+	r.HandleFunc("/auth/invitations/accept", invitationHandler.AcceptInvitation).Methods("POST")
+
+	// what each role may do lives in the database, cached per role
+	roleUC := usecase.NewRoleUsecase(roleRepo, cfg.PermissionCacheTTL)
+	roleHandler := handler.NewRoleHandler(roleUC)
+	can := middleware.RequirePermission
+
+	// integrations authenticate with scoped api keys instead of tokens
+	apiKeyUC := usecase.NewAPIKeyUsecase(repository.NewPgxAPIKeyRepo(db), repo, roleRepo, cfg.APIKeyTTL)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeyUC)
+
+	// the language model behind the AI features, a local mock without an api key
+	if cfg.AIProvider == "" && cfg.OpenAIAPIKey == "" {
+		log.Println("OPENAI_API_KEY not set, AI features answer with the mock provider")
+	}
+	llm, err := ai.New(ai.Config{
+		Kind:           cfg.AIProvider,
+		BaseURL:        cfg.AIBaseURL,
+		APIKey:         cfg.OpenAIAPIKey,
+		ChatModel:      cfg.AIChatModel,
+		EmbeddingModel: cfg.AIEmbeddingModel,
+		Timeout:        cfg.AITimeout,
+		MaxRetries:     int(cfg.AIMaxRetries),
+		RetryBackoff:   cfg.AIRetryBackoff,
+	})
+	if err != nil {
+		log.Fatalf("Failed to set up the AI provider: %v", err)
+	}
+	aiHandler := handler.NewAIHandler(usecase.NewAIUsecase(llm))
 
 	authR := r.PathPrefix("/").Subrouter()
-	authR.Use(middleware.Authentication)
+	authR.Use(middleware.Authentication(tokenService, denylist, apiKeyUC))
+	authR.Use(middleware.Permissions(roleUC))
 
-	authR.Handle("/ask-ai", middleware.RBAC("admin", "user")(http.HandlerFunc(handler.AIChatHandler))).Methods("POST")
-	authR.Handle("/users", middleware.RBAC("admin", "user")(http.HandlerFunc(userHandler.GetAllUser))).Methods("GET")
-	authR.Handle("/user/{id}", middleware.RBAC("admin", "user")(http.HandlerFunc(userHandler.GetUserByID))).Methods("GET")
-	authR.Handle("/users/{id}", middleware.RBAC("admin")(http.HandlerFunc(userHandler.UpdateUser))).Methods("PATCH")
-	authR.Handle("/users/{id}", middleware.RBAC("admin")(http.HandlerFunc(userHandler.DeleteUser))).Methods("DELETE")
+	// every signed in user manages their own session and second factor,
+	// which api keys have no use for
+	session := middleware.RequireUserSession
+	authR.Handle("/auth/logout", session(http.HandlerFunc(userHandler.Logout))).Methods("POST")
+	authR.Handle("/auth/logout-all", session(http.HandlerFunc(userHandler.LogoutAll))).Methods("POST")
+	authR.Handle("/auth/verify-email/resend", session(http.HandlerFunc(userHandler.ResendVerification))).Methods("POST")
+	authR.Handle("/auth/mfa/setup", session(http.HandlerFunc(userHandler.SetupMFA))).Methods("POST")
+	authR.Handle("/auth/mfa/confirm", session(http.HandlerFunc(userHandler.ConfirmMFASetup))).Methods("POST")
+	authR.Handle("/auth/mfa/disable", session(http.HandlerFunc(userHandler.DisableMFA))).Methods("POST")
+	authR.Handle("/auth/mfa/recovery-codes", session(http.HandlerFunc(userHandler.RegenerateRecoveryCodes))).Methods("POST")
+	authR.Handle("/me", session(http.HandlerFunc(userHandler.GetProfile))).Methods("GET")
+	authR.Handle("/me", session(http.HandlerFunc(userHandler.UpdateProfile))).Methods("PATCH")
+	authR.Handle("/me/password", session(http.HandlerFunc(userHandler.ChangePassword))).Methods("POST")
+
+	authR.Handle("/ask-ai", can(models.PermAIAsk)(http.HandlerFunc(aiHandler.AskAI))).Methods("POST")
+	authR.Handle("/users", can(models.PermUserRead)(http.HandlerFunc(userHandler.GetAllUser))).Methods("GET")
+	authR.Handle("/user/{id}", can(models.PermUserRead)(http.HandlerFunc(userHandler.GetUserByID))).Methods("GET")
+	authR.Handle("/users/{id}", can(models.PermUserUpdate)(http.HandlerFunc(userHandler.UpdateUser))).Methods("PATCH")
+	authR.Handle("/users/{id}", can(models.PermUserDelete)(http.HandlerFunc(userHandler.DeleteUser))).Methods("DELETE")
+	authR.Handle("/users/{id}/role", can(models.PermRoleAssign)(http.HandlerFunc(userHandler.AssignRole))).Methods("PUT")
+	authR.Handle("/users/{id}/deactivate", can(models.PermUserUpdate)(http.HandlerFunc(userHandler.DeactivateUser))).Methods("POST")
+	authR.Handle("/users/{id}/reactivate", can(models.PermUserUpdate)(http.HandlerFunc(userHandler.ReactivateUser))).Methods("POST")
+	authR.Handle("/users/{id}/anonymize", can(models.PermUserDelete)(http.HandlerFunc(userHandler.AnonymizeUser))).Methods("POST")
+	authR.Handle("/users/{id}/unlock", can(models.PermUserUnlock)(http.HandlerFunc(userHandler.UnlockUser))).Methods("POST")
+	authR.Handle("/invitations", can(models.PermUserInvite)(http.HandlerFunc(invitationHandler.CreateInvitation))).Methods("POST")
+	authR.Handle("/invitations", can(models.PermUserInvite)(http.HandlerFunc(invitationHandler.GetInvitations))).Methods("GET")
+	authR.Handle("/invitations/{id}", can(models.PermUserInvite)(http.HandlerFunc(invitationHandler.RevokeInvitation))).Methods("DELETE")
+	authR.Handle("/admin/login-audit", can(models.PermAuditRead)(http.HandlerFunc(userHandler.GetLoginAudit))).Methods("GET")
+	authR.Handle("/debug/vars", can(models.PermMetricsRead)(expvar.Handler())).Methods("GET")
+
+	// ==== roles and permissions ====
+	authR.Handle("/permissions", can(models.PermRoleManage)(http.HandlerFunc(roleHandler.GetPermissions))).Methods("GET")
+	authR.Handle("/roles", can(models.PermRoleManage)(http.HandlerFunc(roleHandler.GetRoles))).Methods("GET")
+	authR.Handle("/roles", can(models.PermRoleManage)(http.HandlerFunc(roleHandler.CreateRole))).Methods("POST")
+	authR.Handle("/roles/{name}", can(models.PermRoleManage)(http.HandlerFunc(roleHandler.GetRole))).Methods("GET")
+	authR.Handle("/roles/{name}", can(models.PermRoleManage)(http.HandlerFunc(roleHandler.UpdateRole))).Methods("PUT")
+	authR.Handle("/roles/{name}", can(models.PermRoleManage)(http.HandlerFunc(roleHandler.DeleteRole))).Methods("DELETE")
+
+	// ==== api keys ====
+	authR.Handle("/api-keys", can(models.PermAPIKeys)(http.HandlerFunc(apiKeyHandler.CreateAPIKey))).Methods("POST")
+	authR.Handle("/api-keys", can(models.PermAPIKeys)(http.HandlerFunc(apiKeyHandler.GetAPIKeys))).Methods("GET")
+	authR.Handle("/api-keys/{id}", can(models.PermAPIKeys)(http.HandlerFunc(apiKeyHandler.RevokeAPIKey))).Methods("DELETE")
 
 	//  === complaint and complain message ===
 	complaintRepo := repository.NewPgxComplaintRepo(db)
 	complaintMessageRepo := repository.NewPgxComplaintMessageRepo(db)
+	attachmentRepo := repository.NewPgxAttachmentRepo(db)
+	attachmentUC := usecase.NewAttachmentUsecase(attachmentRepo, complaintRepo, store, uploadPolicy, fileScanner)
+	attachmentHandler := handler.NewAttachmentHandler(attachmentUC)
 	notif := &notifier.RealTimeNotifier{}
-	complaintUC := usecase.NewComplaintUsecase(complaintRepo, complaintMessageRepo, notif)
+
+	// new complaints are triaged by the model in the background, one at a time
+	// on a connection of their own since a pgx.Conn runs one query at a time
+	triageDB, err := pgx.Connect(context.Background(), cfg.DBUrl)
+	if err != nil {
+		log.Fatalf("Failed to connect the triage worker to the database: %v", err)
+	}
+	complaintEvents := events.NewBus(1, 256, 2*time.Minute)
+	triageCfg := usecase.TriageConfig{Categories: cfg.TriageCategories, AutoApplyThreshold: cfg.TriageAutoApplyThreshold}
+	if len(triageCfg.Categories) == 0 {
+		triageCfg.Categories = triage.DefaultCategories
+	}
+	if mock, ok := llm.(*ai.MockProvider); ok {
+		mock.On(triage.Purpose, triage.MockReply(triageCfg.Categories))
+		mock.On(assist.SummaryPurpose, assist.MockSummary)
+		mock.On(assist.ReplyPurpose, assist.MockReply)
+	}
+	triageWorker := usecase.NewTriageUsecase(repository.NewPgxTriageRepo(triageDB), repository.NewPgxComplaintRepo(triageDB), llm, appCache, triageCfg)
+	complaintEvents.Subscribe(events.ComplaintCreated, triageWorker.HandleComplaintCreated)
+	triageUC := usecase.NewTriageUsecase(repository.NewPgxTriageRepo(db), complaintRepo, llm, appCache, triageCfg)
+	triageHandler := handler.NewTriageHandler(triageUC)
+
+	complaintUC := usecase.NewComplaintUsecase(complaintRepo, complaintMessageRepo, notif, attachmentUC, appCache, complaintEvents)
 	complaintHandler := handler.NewComplaintHandler(complaintUC)
 
-	authR.Handle("/complaints", middleware.RBAC("user")(http.HandlerFunc(complaintHandler.CreateComplaint))).Methods("POST")
-	authR.Handle("/complaints/user/{id}", middleware.RBAC("user")(http.HandlerFunc(complaintHandler.GetComplaintByRole))).Methods("GET")
-	authR.Handle("/complaints/{id}/resolve", middleware.RBAC("user")(http.HandlerFunc(complaintHandler.UserMarkResolved))).Methods("PATCH")
-	authR.Handle("/complaints", middleware.RBAC("admin")(http.HandlerFunc(complaintHandler.GetAllComplaintByRole))).Methods("GET")
-	authR.Handle("/complaints/{id}/status", middleware.RBAC("admin")(http.HandlerFunc(complaintHandler.AdminUpdateComplaints))).Methods("PATCH")
+	// retried creates replay the first response instead of adding duplicates,
+	// keys live in redis and in postgres while redis fails
+	var idempotencyStore idempotency.Store = repository.NewPgxIdempotencyRepo(db)
+	if rdb != nil {
+		idempotencyStore = idempotency.NewFallbackStore(idempotency.NewRedisStore(rdb), idempotencyStore, redisBreaker)
+	}
+	idem := middleware.Idempotency(idempotencyStore, cfg.IdempotencyTTL, cfg.IdempotencyLock)
+
+	authR.Handle("/complaints", can(models.PermComplaintCreate)(verified(idem(http.HandlerFunc(complaintHandler.CreateComplaint))))).Methods("POST")
+	authR.Handle("/complaints/user/{id}", can(models.PermComplaintReadOwn)(http.HandlerFunc(complaintHandler.GetComplaintByRole))).Methods("GET")
+	authR.Handle("/complaints/{id}", can(models.PermComplaintMessage)(http.HandlerFunc(complaintHandler.GetComplaint))).Methods("GET")
+	authR.Handle("/complaints/{id}", can(models.PermComplaintCreate)(http.HandlerFunc(complaintHandler.EditComplaint))).Methods("PATCH")
+	authR.Handle("/complaints/{id}/resolve", can(models.PermComplaintResolve)(http.HandlerFunc(complaintHandler.UserMarkResolved))).Methods("PATCH")
+	authR.Handle("/complaints", can(models.PermComplaintReadAny)(http.HandlerFunc(complaintHandler.GetAllComplaintByRole))).Methods("GET")
+	authR.Handle("/complaints/{id}/status", can(models.PermComplaintUpdateStatus)(http.HandlerFunc(complaintHandler.AdminUpdateComplaints))).Methods("PATCH")
+
+	authR.Handle("/complaints/{id}/messages", can(models.PermComplaintMessage)(http.HandlerFunc(complaintHandler.InsertCoplaintMessage))).Methods("POST")
+	authR.Handle("/complaints/{id}/messages", can(models.PermComplaintMessage)(http.HandlerFunc(complaintHandler.GetMessagesByComplaint))).Methods("GET")
+	authR.Handle("/complaints/{id}/reply", can(models.PermComplaintMessage)(idem(http.HandlerFunc(complaintHandler.ReplyToMessage)))).Methods("POST")
+
+	authR.Handle("/complaints/{id}/attachments", can(models.PermComplaintMessage)(http.HandlerFunc(attachmentHandler.UploadToComplaint))).Methods("POST")
+	authR.Handle("/complaints/{id}/attachments", can(models.PermComplaintMessage)(http.HandlerFunc(attachmentHandler.GetAttachmentsByComplaint))).Methods("GET")
 
-	authR.Handle("/complaints/{id}/messages", middleware.RBAC("admin", "user")(http.HandlerFunc(complaintHandler.InsertCoplaintMessage))).Methods("POST")
-	authR.Handle("/complaints/{id}/messages", middleware.RBAC("admin", "user")(http.HandlerFunc(complaintHandler.GetMessagesByComplaint))).Methods("GET")
-	authR.Handle("/complaints/{id}/reply", middleware.RBAC("admin", "user")(http.HandlerFunc(complaintHandler.ReplyToMessage))).Methods("POST")
+	authR.Handle("/complaints/{id}/triage", can(models.PermComplaintTriage)(http.HandlerFunc(triageHandler.GetTriage))).Methods("GET")
+	authR.Handle("/complaints/{id}/triage/{field}/accept", can(models.PermComplaintTriage)(http.HandlerFunc(triageHandler.AcceptTriage))).Methods("POST")
+	authR.Handle("/complaints/{id}/triage/{field}/override", can(models.PermComplaintTriage)(http.HandlerFunc(triageHandler.OverrideTriage))).Methods("POST")
+	authR.Handle("/admin/triage/accuracy", can(models.PermComplaintTriage)(http.HandlerFunc(triageHandler.GetTriageAccuracy))).Methods("GET")
+
+	// summaries and drafted replies for agents, from threads the caller may read
+	assistUC := usecase.NewAssistUsecase(complaintUC, repository.NewPgxKnowledgeRepo(db), repository.NewPgxAIUsageRepo(db), llm, appCache)
+	assistHandler := handler.NewAssistHandler(assistUC)
+
+	authR.Handle("/complaints/{id}/ai/summary", can(models.PermAIAsk)(http.HandlerFunc(assistHandler.SummarizeComplaint))).Methods("POST")
+	authR.Handle("/complaints/{id}/ai/suggest-reply", can(models.PermAIAsk)(http.HandlerFunc(assistHandler.SuggestReply))).Methods("POST")
+	authR.Handle("/knowledge", can(models.PermKnowledgeManage)(http.HandlerFunc(assistHandler.CreateKnowledgeEntry))).Methods("POST")
+	authR.Handle("/knowledge", can(models.PermKnowledgeManage)(http.HandlerFunc(assistHandler.GetKnowledgeEntries))).Methods("GET")
+	authR.Handle("/knowledge/{id}", can(models.PermKnowledgeManage)(http.HandlerFunc(assistHandler.DeleteKnowledgeEntry))).Methods("DELETE")
+	authR.Handle("/admin/ai/usage", can(models.PermAuditRead)(http.HandlerFunc(assistHandler.GetAIUsage))).Methods("GET")
 
 	//  === document ===
 	docRepo := repository.NewDocumentRepository(db)
-	docUC := usecase.NewDocumentUsecase(docRepo)
+	docUC := usecase.NewDocumentUsecase(docRepo, attachmentUC, store, cfg.DownloadURLTTL, map[string]int64{
+		string(models.UerRole):   cfg.QuotaBytesUser,
+		string(models.AdminRole): cfg.QuotaBytesAdmin,
+	}, bus)
 	docHandler := handler.NewDocumentHandler(docUC)
 
-	authR.Handle("/documents", middleware.RBAC("admin", "user")(http.HandlerFunc(docHandler.Uplod))).Methods("POST")
-	authR.Handle("/documents/{id}", middleware.RBAC("admin", "user")(http.HandlerFunc(docHandler.GetDocumentByID))).Methods("GET")
-	authR.Handle("/documents/user/{id}", middleware.RBAC("admin", "user")(http.HandlerFunc(docHandler.GetDocumentByUser))).Methods("GET")
-	authR.Handle("/documents/{id}", middleware.RBAC("admin", "user")(http.HandlerFunc(docHandler.DeleteDocument))).Methods("DELETE")
+	authR.Handle("/documents", can(models.PermDocumentWrite)(http.HandlerFunc(docHandler.Uplod))).Methods("POST")
+	authR.Handle("/documents/usage", can(models.PermDocumentWrite)(http.HandlerFunc(docHandler.GetUsage))).Methods("GET")
+	authR.Handle("/documents/{id}", can(models.PermDocumentWrite)(http.HandlerFunc(docHandler.GetDocumentByID))).Methods("GET")
+	authR.Handle("/documents/{id}/thumbnail", can(models.PermDocumentWrite)(http.HandlerFunc(docHandler.GetThumbnail))).Methods("GET")
+	authR.Handle("/documents/{id}/preview", can(models.PermDocumentWrite)(http.HandlerFunc(docHandler.GetPreview))).Methods("GET")
+	authR.Handle("/documents/{id}/versions", can(models.PermDocumentWrite)(http.HandlerFunc(docHandler.UploadVersion))).Methods("POST")
+	authR.Handle("/documents/{id}/versions", can(models.PermDocumentWrite)(http.HandlerFunc(docHandler.GetVersions))).Methods("GET")
+	authR.Handle("/documents/{id}/versions/{version}", can(models.PermDocumentWrite)(http.HandlerFunc(docHandler.GetVersion))).Methods("GET")
+	authR.Handle("/documents/{id}/versions/{version}/restore", can(models.PermDocumentWrite)(http.HandlerFunc(docHandler.RestoreVersion))).Methods("POST")
+	authR.Handle("/documents/{id}/download-url", can(models.PermDocumentWrite)(http.HandlerFunc(docHandler.GetDownloadURL))).Methods("GET")
+	authR.Handle("/documents/user/{id}", can(models.PermDocumentWrite)(http.HandlerFunc(docHandler.GetDocumentByUser))).Methods("GET")
+	authR.Handle("/documents/{id}", can(models.PermDocumentWrite)(http.HandlerFunc(docHandler.UpdateDocument))).Methods("PATCH")
+	authR.Handle("/documents/{id}", can(models.PermDocumentWrite)(http.HandlerFunc(docHandler.DeleteDocument))).Methods("DELETE")
+	authR.Handle("/documents/{id}/attach", can(models.PermDocumentWrite)(http.HandlerFunc(docHandler.AttachDocument))).Methods("POST")
 
 	// === websocket ===
 	msgRepo := repository.NewMessageRepository(db)
 	wsHandler := websocket.NewwebsocketHandler(msgRepo, kafkaProducer)
-	authR.HandleFunc("/ws", wsHandler.HandleWebsocket).Methods("GET")
+	authR.Handle("/ws", session(http.HandlerFunc(wsHandler.HandleWebsocket))).Methods("GET")
 
 	return r
 }
+
+// newTokenService signs with JWT_SIGNING_KEY_FILE when set and keeps the keys
+// in JWT_VERIFY_KEY_FILES around to verify tokens issued before a rotation.
+func newTokenService(cfg *config.Config) (*auth.TokenService, error) {
+	tokenCfg := auth.TokenConfig{
+		Issuer:   cfg.JWTIssuer,
+		Audience: cfg.JWTAudience,
+		Secret:   cfg.JWTSecret,
+		Leeway:   30 * time.Second,
+	}
+
+	if cfg.JWTSigningKeyFile != "" {
+		key, err := auth.LoadKeyFile(cfg.JWTSigningKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tokenCfg.SigningKey = key
+	}
+
+	for _, path := range cfg.JWTVerifyKeyFiles {
+		key, err := auth.LoadKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		tokenCfg.VerifyKeys = append(tokenCfg.VerifyKeys, key)
+	}
+
+	return auth.NewTokenService(tokenCfg)
+}
@@ -0,0 +1,96 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+const clamAVChunkSize = 64 * 1024
+
+// ClamAVScanner streams content to clamd with the INSTREAM command.
+type ClamAVScanner struct {
+	addr    string
+	timeout time.Duration
+}
+
+func NewClamAVScanner(addr string) *ClamAVScanner {
+	if addr == "" {
+		addr = "localhost:3310"
+	}
+	return &ClamAVScanner{
+		addr:    addr,
+		timeout: 2 * time.Minute,
+	}
+}
+
+func (c *ClamAVScanner) Scan(ctx context.Context, r io.Reader) (*Result, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "failed to connect to clamd")
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "failed to start clamd stream")
+	}
+
+	// every chunk is prefixed with its length, a zero length ends the stream
+	buf := make([]byte, clamAVChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := conn.Write(size); err != nil {
+				return nil, appErrors.ErrDbFailure.Wrap(err, "failed to stream to clamd")
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				return nil, appErrors.ErrDbFailure.Wrap(err, "failed to stream to clamd")
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, appErrors.ErrDbFailure.Wrap(readErr, "failed to read content to scan")
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "failed to finish clamd stream")
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "failed to read clamd reply")
+	}
+
+	return parseClamAVReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// parseClamAVReply understands "stream: OK" and "stream: <signature> FOUND".
+func parseClamAVReply(reply string) (*Result, error) {
+	reply = strings.TrimPrefix(reply, "stream: ")
+
+	switch {
+	case reply == "OK":
+		return &Result{Clean: true}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return &Result{Clean: false, Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	default:
+		return nil, appErrors.ErrDbFailure.New("clamd error: %s", reply)
+	}
+}
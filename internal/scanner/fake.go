@@ -0,0 +1,44 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+// EICAR is the standard anti-virus test string.
+const EICAR = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// FakeScanner flags content containing the EICAR test string or any extra
+// signature registered with Flag. Meant for tests and local development.
+type FakeScanner struct {
+	signatures map[string][]byte
+	Scanned    int
+}
+
+func NewFakeScanner() *FakeScanner {
+	return &FakeScanner{
+		signatures: map[string][]byte{"Eicar-Test-Signature": []byte(EICAR)},
+	}
+}
+
+func (f *FakeScanner) Flag(name string, pattern []byte) {
+	f.signatures[name] = pattern
+}
+
+func (f *FakeScanner) Scan(ctx context.Context, r io.Reader) (*Result, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "failed to read content to scan")
+	}
+	f.Scanned++
+
+	for name, pattern := range f.signatures {
+		if bytes.Contains(data, pattern) {
+			return &Result{Clean: false, Signature: name}, nil
+		}
+	}
+	return &Result{Clean: true}, nil
+}
@@ -0,0 +1,41 @@
+package scanner
+
+import (
+	"context"
+	"io"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+// Result is the verdict of a scan. Signature names the detected threat when
+// the content is not clean.
+type Result struct {
+	Clean     bool   `json:"clean"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// Scanner inspects uploaded content before it leaves quarantine.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (*Result, error)
+}
+
+// New returns the scanner selected by SCANNER: "clamav", "fake" or "none".
+func New(kind, clamAVAddr string) (Scanner, error) {
+	switch kind {
+	case "", "none":
+		return NoopScanner{}, nil
+	case "clamav":
+		return NewClamAVScanner(clamAVAddr), nil
+	case "fake":
+		return NewFakeScanner(), nil
+	default:
+		return nil, appErrors.ErrInvalidPayload.New("unknown scanner %q", kind)
+	}
+}
+
+// NoopScanner accepts everything, for setups without a virus scanner.
+type NoopScanner struct{}
+
+func (NoopScanner) Scan(ctx context.Context, r io.Reader) (*Result, error) {
+	return &Result{Clean: true}, nil
+}
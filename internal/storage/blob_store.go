@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"Complaingo/config"
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+// BlobInfo describes a stored object.
+type BlobInfo struct {
+	Key         string    `json:"key"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	ModTime     time.Time `json:"mod_time"`
+}
+
+// BlobStore is where uploaded file contents live. Keys are slash separated
+// paths relative to the store root, never absolute paths on a host.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, *BlobInfo, error)
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (*BlobInfo, error)
+	Presign(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// NewBlobStore builds the backend selected by STORAGE_BACKEND. Local blobs
+// are downloaded through URLs signed by signer.
+func NewBlobStore(cfg *config.Config, signer *URLSigner) (BlobStore, error) {
+	switch cfg.StorageBackend {
+	case "", "local":
+		return NewLocalStore(cfg.UploadDir, cfg.LegacyUploadDir, signer), nil
+	case "s3":
+		return NewS3Store(S3Config{
+			Endpoint:     cfg.S3Endpoint,
+			Region:       cfg.S3Region,
+			Bucket:       cfg.S3Bucket,
+			AccessKey:    cfg.S3AccessKey,
+			SecretKey:    cfg.S3SecretKey,
+			UsePathStyle: cfg.S3UsePathStyle,
+		})
+	default:
+		return nil, appErrors.ErrInvalidPayload.New("unknown storage backend %q", cfg.StorageBackend)
+	}
+}
+
+// validateKey rejects keys that could escape the store root.
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return appErrors.ErrInvalidPayload.New("invalid storage key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return appErrors.ErrInvalidPayload.New("invalid storage key %q", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+// legacyPrefix is the key prefix of documents uploaded before storage keys
+// existed, when they were written to a directory of their own.
+const legacyPrefix = "legacy/"
+
+// LocalStore keeps blobs on the local filesystem under root. Blobs are
+// downloaded through the signed URLs of signer. Legacy keys that haven't
+// been moved under root are read from legacyRoot.
+type LocalStore struct {
+	root       string
+	legacyRoot string
+	signer     *URLSigner
+}
+
+func NewLocalStore(root, legacyRoot string, signer *URLSigner) *LocalStore {
+	return &LocalStore{
+		root:       root,
+		legacyRoot: legacyRoot,
+		signer:     signer,
+	}
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+// existingPath is path for blobs being read. A legacy key resolves to the
+// old upload directory until its file is moved to UPLOAD_DIR/legacy/.
+func (s *LocalStore) existingPath(key string) (string, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return "", err
+	}
+
+	rest, ok := strings.CutPrefix(key, legacyPrefix)
+	if !ok || s.legacyRoot == "" {
+		return p, nil
+	}
+	if _, err := os.Stat(p); !os.IsNotExist(err) {
+		return p, nil
+	}
+	return filepath.Join(s.legacyRoot, filepath.FromSlash(rest)), nil
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to create storage directory")
+	}
+
+	// write to a temp file first so readers never see a half written blob
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to create blob")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return appErrors.ErrDbFailure.Wrap(err, "failed to write blob")
+	}
+	if err := tmp.Close(); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to write blob")
+	}
+
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to store blob")
+	}
+
+	return nil
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, *BlobInfo, error) {
+	p, err := s.existingPath(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, appErrors.ErrUserNotFound.New("blob not found")
+		}
+		return nil, nil, appErrors.ErrDbFailure.Wrap(err, "failed to open blob")
+	}
+
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	return f, info, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	p, err := s.existingPath(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to delete blob")
+	}
+
+	return nil
+}
+
+func (s *LocalStore) Stat(ctx context.Context, key string) (*BlobInfo, error) {
+	p, err := s.existingPath(key)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, appErrors.ErrUserNotFound.New("blob not found")
+		}
+		return nil, appErrors.ErrDbFailure.Wrap(err, "failed to stat blob")
+	}
+
+	return &BlobInfo{
+		Key:         key,
+		Size:        fi.Size(),
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+		ModTime:     fi.ModTime(),
+	}, nil
+}
+
+// Presign returns an HMAC signed download URL valid for expiry.
+func (s *LocalStore) Presign(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+
+	return s.signer.Sign(key, expiry), nil
+}
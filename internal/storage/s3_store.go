@@ -0,0 +1,339 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/joomcode/errorx"
+)
+
+const (
+	s3Service       = "s3"
+	s3Algorithm     = "AWS4-HMAC-SHA256"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	amzDateFormat   = "20060102T150405Z"
+	maxPresignTTL   = 7 * 24 * time.Hour
+)
+
+type S3Config struct {
+	Endpoint     string // e.g. https://s3.eu-west-1.amazonaws.com or http://localhost:9000
+	Region       string
+	Bucket       string
+	AccessKey    string
+	SecretKey    string
+	UsePathStyle bool // MinIO and most S3 compatible servers want path style
+}
+
+// S3Store talks to any S3 compatible server with signature v4 requests.
+type S3Store struct {
+	cfg      S3Config
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" || cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, appErrors.ErrInvalidPayload.New("s3 storage needs endpoint, bucket, access key and secret key")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, appErrors.ErrInvalidPayload.New("invalid s3 endpoint %q", cfg.Endpoint)
+	}
+
+	return &S3Store{
+		cfg:      cfg,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 60 * time.Second},
+		now:      time.Now,
+	}, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	// S3 needs a content length up front, spool unknown sizes to disk
+	if size < 0 {
+		tmp, err := os.CreateTemp("", "s3-upload-*")
+		if err != nil {
+			return appErrors.ErrDbFailure.Wrap(err, "failed to buffer upload")
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		if size, err = io.Copy(tmp, r); err != nil {
+			return appErrors.ErrDbFailure.Wrap(err, "failed to buffer upload")
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return appErrors.ErrDbFailure.Wrap(err, "failed to buffer upload")
+		}
+		r = tmp
+	}
+
+	req, err := s.newRequest(ctx, http.MethodPut, key, io.NopCloser(r))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	res, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, *BlobInfo, error) {
+	if err := validateKey(key); err != nil {
+		return nil, nil, err
+	}
+
+	req, err := s.newRequest(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res, err := s.do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return res.Body, blobInfo(key, res), nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	req, err := s.newRequest(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.do(req)
+	if err != nil {
+		if errorx.IsOfType(err, appErrors.ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+	res.Body.Close()
+
+	return nil
+}
+
+func (s *S3Store) Stat(ctx context.Context, key string) (*BlobInfo, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+
+	req, err := s.newRequest(ctx, http.MethodHead, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+
+	return blobInfo(key, res), nil
+}
+
+// Presign returns a query string signed GET URL valid for expiry.
+func (s *S3Store) Presign(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	if expiry <= 0 || expiry > maxPresignTTL {
+		return "", appErrors.ErrInvalidPayload.New("presign expiry must be between 1s and 7 days")
+	}
+
+	u := s.objectURL(key)
+	now := s.now().UTC()
+	amzDate := now.Format(amzDateFormat)
+	scope := s.scope(now)
+
+	q := url.Values{}
+	q.Set("X-Amz-Algorithm", s3Algorithm)
+	q.Set("X-Amz-Credential", s.cfg.AccessKey+"/"+scope)
+	q.Set("X-Amz-Date", amzDate)
+	q.Set("X-Amz-Expires", strconv.Itoa(int(expiry.Seconds())))
+	q.Set("X-Amz-SignedHeaders", "host")
+
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		canonicalQuery(q),
+		"host:" + u.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+
+	q.Set("X-Amz-Signature", s.signature(now, amzDate, scope, canonical))
+	u.RawQuery = canonicalQuery(q)
+
+	return u.String(), nil
+}
+
+func (s *S3Store) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	escapedKey := uriEncode(key, false)
+	if s.cfg.UsePathStyle {
+		u.Path = strings.TrimSuffix(s.endpoint.Path, "/") + "/" + s.cfg.Bucket + "/" + key
+		u.RawPath = strings.TrimSuffix(s.endpoint.EscapedPath(), "/") + "/" + uriEncode(s.cfg.Bucket, false) + "/" + escapedKey
+	} else {
+		u.Host = s.cfg.Bucket + "." + s.endpoint.Host
+		u.Path = "/" + key
+		u.RawPath = "/" + escapedKey
+	}
+	return &u
+}
+
+// newRequest builds a request signed with the Authorization header.
+func (s *S3Store) newRequest(ctx context.Context, method, key string, body io.ReadCloser) (*http.Request, error) {
+	u := s.objectURL(key)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "failed to build s3 request")
+	}
+
+	now := s.now().UTC()
+	amzDate := now.Format(amzDateFormat)
+	scope := s.scope(now)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		"",
+		"host:" + u.Host + "\n" +
+			"x-amz-content-sha256:" + unsignedPayload + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.cfg.AccessKey, scope, signedHeaders, s.signature(now, amzDate, scope, canonical)))
+
+	return req, nil
+}
+
+func (s *S3Store) do(req *http.Request) (*http.Response, error) {
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, appErrors.ErrDbFailure.Wrap(err, "s3 request failed")
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, appErrors.ErrUserNotFound.New("blob not found")
+	}
+	if res.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		res.Body.Close()
+		return nil, appErrors.ErrDbFailure.New("s3 %s failed with status %d: %s", req.Method, res.StatusCode, string(body))
+	}
+
+	return res, nil
+}
+
+func (s *S3Store) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + s.cfg.Region + "/" + s3Service + "/aws4_request"
+}
+
+func (s *S3Store) signature(t time.Time, amzDate, scope, canonicalRequest string) string {
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := s3Algorithm + "\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), t.Format("20060102"))
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, s3Service)
+	key = hmacSHA256(key, "aws4_request")
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func blobInfo(key string, res *http.Response) *BlobInfo {
+	info := &BlobInfo{
+		Key:         key,
+		Size:        res.ContentLength,
+		ContentType: res.Header.Get("Content-Type"),
+	}
+	if modified, err := http.ParseTime(res.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = modified
+	}
+	return info
+}
+
+// canonicalQuery encodes query params the way signature v4 expects: sorted
+// by key and percent encoded per RFC 3986.
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+// URLSigner issues and checks HMAC signed, expiring download URLs for blobs
+// served by this service.
+type URLSigner struct {
+	secret  []byte
+	baseURL string
+	now     func() time.Time
+}
+
+func NewURLSigner(secret, baseURL string) *URLSigner {
+	return &URLSigner{
+		secret:  []byte(secret),
+		baseURL: baseURL,
+		now:     time.Now,
+	}
+}
+
+// Sign returns baseURL/key?expires=...&signature=... valid for expiry.
+func (s *URLSigner) Sign(key string, expiry time.Duration) string {
+	expires := strconv.FormatInt(s.now().Add(expiry).Unix(), 10)
+
+	q := url.Values{}
+	q.Set("expires", expires)
+	q.Set("signature", s.signature(key, expires))
+
+	return s.baseURL + (&url.URL{Path: key}).EscapedPath() + "?" + q.Encode()
+}
+
+// Verify checks the signature and expiry of a signed URL's parameters.
+func (s *URLSigner) Verify(key, expires, signature string) error {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return appErrors.ErrUnauthorized.New("invalid download link")
+	}
+
+	expected := s.signature(key, expires)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return appErrors.ErrUnauthorized.New("invalid download link signature")
+	}
+	if s.now().Unix() > expiresAt {
+		return appErrors.ErrUnauthorized.New("download link expired")
+	}
+
+	return nil
+}
+
+func (s *URLSigner) signature(key, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
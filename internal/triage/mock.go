@@ -0,0 +1,105 @@
+package triage
+
+import (
+	"Complaingo/internal/ai"
+	"encoding/json"
+	"strings"
+	"unicode"
+)
+
+var (
+	urgentWords   = []string{"urgent", "immediately", "asap", "emergency", "dangerous"}
+	highWords     = []string{"refund", "broken", "not working", "charged twice", "lost", "never arrived"}
+	negativeWords = []string{"angry", "terrible", "awful", "worst", "disappointed", "unacceptable", "broken", "bad", "not"}
+	positiveWords = []string{"thanks", "thank you", "great", "happy", "appreciate", "good"}
+
+	// a few common words per language, enough to tell them apart in tests
+	languageWords = map[string][]string{
+		"en": {"the", "and", "is", "my", "not", "was"},
+		"es": {"el", "la", "es", "mi", "no", "por", "que"},
+		"fr": {"le", "la", "est", "mon", "ne", "pas", "et"},
+		"de": {"der", "die", "und", "ist", "mein", "nicht"},
+	}
+)
+
+// MockReply answers triage requests for the mock provider with simple
+// keyword rules, so triage works offline and in tests. Matches are given
+// high confidence, guesses low.
+func MockReply(categories []string) func(req ai.ChatRequest) string {
+	return func(req ai.ChatRequest) string {
+		var text string
+		for _, m := range req.Messages {
+			if m.Role == ai.RoleUser {
+				text = strings.ToLower(m.Content)
+			}
+		}
+		words := strings.FieldsFunc(text, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		// padded so phrases only match whole words
+		text = " " + strings.Join(words, " ") + " "
+
+		type suggestion struct {
+			Value      string  `json:"value"`
+			Confidence float64 `json:"confidence"`
+		}
+		answer := map[string]suggestion{
+			"category":  {fallbackCategory(categories), 0.4},
+			"priority":  {"medium", 0.5},
+			"sentiment": {"neutral", 0.6},
+			"language":  {"en", 0.5},
+		}
+
+		for _, c := range categories {
+			if contains(words, c) {
+				answer["category"] = suggestion{c, 0.9}
+				break
+			}
+		}
+		switch {
+		case containsAny(text, urgentWords):
+			answer["priority"] = suggestion{"urgent", 0.9}
+		case containsAny(text, highWords):
+			answer["priority"] = suggestion{"high", 0.7}
+		}
+		switch {
+		case containsAny(text, negativeWords):
+			answer["sentiment"] = suggestion{"negative", 0.85}
+		case containsAny(text, positiveWords):
+			answer["sentiment"] = suggestion{"positive", 0.85}
+		}
+
+		best := 0
+		for _, lang := range []string{"en", "es", "fr", "de"} {
+			n := 0
+			for _, w := range languageWords[lang] {
+				if contains(words, w) {
+					n++
+				}
+			}
+			if n > best {
+				best = n
+				answer["language"] = suggestion{lang, 0.95}
+			}
+		}
+
+		raw, _ := json.Marshal(answer)
+		return string(raw)
+	}
+}
+
+func fallbackCategory(categories []string) string {
+	if contains(categories, "other") || len(categories) == 0 {
+		return "other"
+	}
+	return categories[len(categories)-1]
+}
+
+func containsAny(text string, phrases []string) bool {
+	for _, p := range phrases {
+		if strings.Contains(text, " "+p+" ") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package upload
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"mime"
+	"path"
+	"strings"
+	"unicode"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+const (
+	maxFileNameLength = 120
+
+	// MaxFilesPerRequest caps how many files one multipart request may carry.
+	MaxFilesPerRequest = 5
+)
+
+// DefaultAllowedTypes are the sniffed MIME types accepted when no allowlist
+// is configured.
+var DefaultAllowedTypes = []string{
+	"image/jpeg",
+	"image/png",
+	"image/gif",
+	"image/webp",
+	"application/pdf",
+	"text/plain",
+}
+
+// Policy decides how large an upload may be and which content is accepted.
+type Policy struct {
+	MaxBytes     map[string]int64 // per role
+	DefaultMax   int64
+	AllowedTypes map[string]bool
+}
+
+func NewPolicy(maxBytes map[string]int64, defaultMax int64, allowedTypes []string) Policy {
+	if len(allowedTypes) == 0 {
+		allowedTypes = DefaultAllowedTypes
+	}
+
+	allowed := make(map[string]bool, len(allowedTypes))
+	for _, t := range allowedTypes {
+		allowed[strings.ToLower(strings.TrimSpace(t))] = true
+	}
+
+	return Policy{
+		MaxBytes:     maxBytes,
+		DefaultMax:   defaultMax,
+		AllowedTypes: allowed,
+	}
+}
+
+func (p Policy) MaxBytesFor(role string) int64 {
+	if max, ok := p.MaxBytes[role]; ok && max > 0 {
+		return max
+	}
+	return p.DefaultMax
+}
+
+// CheckType accepts a sniffed content type when its media type, without
+// parameters such as charset, is on the allowlist.
+func (p Policy) CheckType(contentType string) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", appErrors.ErrUnsupportedFileType.New("could not determine file type")
+	}
+	if !p.AllowedTypes[mediaType] {
+		return "", appErrors.ErrUnsupportedFileType.New("file type %s is not allowed", mediaType)
+	}
+	return mediaType, nil
+}
+
+// SanitizeFilename keeps only the base name of a client supplied file name
+// and replaces anything that isn't a letter, digit, dot, dash or underscore.
+func SanitizeFilename(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = path.Base(name)
+
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), r == '.', r == '-', r == '_':
+			b.WriteRune(r)
+		case unicode.IsSpace(r):
+			b.WriteRune('_')
+		}
+	}
+
+	clean := strings.TrimLeft(b.String(), ".")
+	if len(clean) > maxFileNameLength {
+		ext := path.Ext(clean)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		clean = clean[:maxFileNameLength-len(ext)] + ext
+	}
+	if clean == "" {
+		clean = "file"
+	}
+	return clean
+}
+
+// StorageName generates a random name for a blob, keeping an extension that
+// matches the sniffed media type.
+func StorageName(mediaType, fileName string) string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+
+	ext := strings.ToLower(path.Ext(fileName))
+	if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 && !contains(exts, ext) {
+		ext = exts[0]
+	}
+	return hex.EncodeToString(buf) + ext
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// LimitedReader fails with ErrFileTooLarge once more than max bytes are
+// read, so oversized uploads are rejected while streaming.
+type LimitedReader struct {
+	r         io.Reader
+	remaining int64
+	max       int64
+}
+
+func LimitReader(r io.Reader, max int64) *LimitedReader {
+	return &LimitedReader{r: r, remaining: max, max: max}
+}
+
+func (l *LimitedReader) Read(p []byte) (int, error) {
+	if l.Exceeded() {
+		return 0, l.err()
+	}
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.Exceeded() {
+		return n, l.err()
+	}
+	return n, err
+}
+
+// Exceeded reports whether the limit was hit. Callers whose reads go through
+// other layers use it to recover the typed error.
+func (l *LimitedReader) Exceeded() bool {
+	return l.remaining < 0
+}
+
+func (l *LimitedReader) err() error {
+	return appErrors.ErrFileTooLarge.New("file exceeds the %d byte limit", l.max)
+}
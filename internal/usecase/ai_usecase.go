@@ -0,0 +1,50 @@
+package usecase
+
+import (
+	"Complaingo/internal/ai"
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+// maxPromptLength keeps free-form questions to a reasonable size, in characters.
+const maxPromptLength = 4000
+
+// AIUsecase answers free-form questions with the configured model.
+type AIUsecase struct {
+	provider ai.LLMProvider
+}
+
+func NewAIUsecase(provider ai.LLMProvider) *AIUsecase {
+	return &AIUsecase{provider: provider}
+}
+
+func (uc *AIUsecase) Ask(ctx context.Context, prompt string) (*ai.ChatResponse, error) {
+	req, err := askRequest(prompt)
+	if err != nil {
+		return nil, err
+	}
+	return uc.provider.Chat(ctx, req)
+}
+
+// AskStream is Ask, with onDelta called with each part of the answer as it arrives.
+func (uc *AIUsecase) AskStream(ctx context.Context, prompt string, onDelta func(delta string) error) (*ai.ChatResponse, error) {
+	req, err := askRequest(prompt)
+	if err != nil {
+		return nil, err
+	}
+	return uc.provider.ChatStream(ctx, req, onDelta)
+}
+
+func askRequest(prompt string) (ai.ChatRequest, error) {
+	prompt = strings.TrimSpace(prompt)
+	if prompt == "" {
+		return ai.ChatRequest{}, appErrors.ErrInvalidPayload.New("prompt is required")
+	}
+	if utf8.RuneCountInString(prompt) > maxPromptLength {
+		return ai.ChatRequest{}, appErrors.ErrInvalidPayload.New("prompt must be at most %d characters", maxPromptLength)
+	}
+	return ai.ChatRequest{Messages: []ai.Message{{Role: ai.RoleUser, Content: prompt}}}, nil
+}
@@ -0,0 +1,142 @@
+package usecase
+
+import (
+	"Complaingo/internal/auth"
+	"Complaingo/internal/domain/models"
+	"Complaingo/internal/middleware"
+	"Complaingo/internal/repository"
+	"Complaingo/internal/validation"
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+// APIKeyPrefix starts every key so that they are easy to spot in logs and
+// secret scanners.
+const APIKeyPrefix = "cgk_"
+
+// apiKeyScopes are the permission families a key may be scoped to.
+var apiKeyScopes = []string{"complaint:", "user:", "document:"}
+
+// APIKeyUsecase issues keys for integrations and checks them on requests.
+type APIKeyUsecase struct {
+	repo  repository.APIKeyRepository
+	users repository.UserRepository
+	roles repository.RoleRepository
+	ttl   time.Duration
+}
+
+func NewAPIKeyUsecase(repo repository.APIKeyRepository, users repository.UserRepository, roles repository.RoleRepository, ttl time.Duration) *APIKeyUsecase {
+	return &APIKeyUsecase{
+		repo:  repo,
+		users: users,
+		roles: roles,
+		ttl:   ttl,
+	}
+}
+
+// Create issues a key acting as input.UserID, or the caller when it is
+// unset. Scopes must be permissions the owner's role holds.
+func (uc *APIKeyUsecase) Create(ctx context.Context, input validation.APIKeyInput) (*models.CreatedAPIKey, error) {
+	input.Name = strings.TrimSpace(input.Name)
+	if err := input.ValidateAPIKeyInput(); err != nil {
+		return nil, appErrors.ErrInvalidPayload.Wrap(err, "Validation failed")
+	}
+
+	createdBy := middleware.GetUserId(ctx)
+	if input.UserID == 0 {
+		input.UserID = createdBy
+	}
+	owner, err := uc.users.GetUserByID(ctx, input.UserID)
+	if err != nil {
+		return nil, err
+	}
+	held, err := uc.roles.GetRolePermissions(ctx, owner.Role)
+	if err != nil {
+		return nil, err
+	}
+	ownerPerms := models.NewPermissionSet(held)
+
+	for _, scope := range input.Scopes {
+		if !scopeAllowed(scope) {
+			return nil, appErrors.ErrInvalidPayload.New("scope %s can't be given to an api key", scope)
+		}
+		if !ownerPerms.Has(scope) {
+			return nil, appErrors.ErrInvalidPayload.New("user %d has no permission %s to delegate", owner.ID, scope)
+		}
+	}
+
+	ttl := uc.ttl
+	if input.ExpiresInDays > 0 {
+		ttl = time.Duration(input.ExpiresInDays) * 24 * time.Hour
+	}
+	token, _, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	raw := APIKeyPrefix + token
+
+	key := &models.APIKey{
+		Name:      input.Name,
+		Prefix:    raw[:len(APIKeyPrefix)+8],
+		KeyHash:   auth.HashToken(raw),
+		UserID:    input.UserID,
+		Scopes:    input.Scopes,
+		CreatedBy: &createdBy,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := uc.repo.CreateAPIKey(ctx, key); err != nil {
+		return nil, err
+	}
+
+	return &models.CreatedAPIKey{APIKey: key, Key: raw}, nil
+}
+
+func (uc *APIKeyUsecase) List(ctx context.Context) ([]*models.APIKey, error) {
+	return uc.repo.GetAPIKeys(ctx)
+}
+
+func (uc *APIKeyUsecase) Revoke(ctx context.Context, id int64) error {
+	return uc.repo.RevokeAPIKey(ctx, id)
+}
+
+// VerifyAPIKey returns the key behind raw, refusing revoked and expired ones
+// and those of deactivated users.
+func (uc *APIKeyUsecase) VerifyAPIKey(ctx context.Context, raw string) (*models.APIKey, error) {
+	if !strings.HasPrefix(raw, APIKeyPrefix) {
+		return nil, appErrors.ErrUnauthorized.New("api key not recognised")
+	}
+
+	key, err := uc.repo.GetAPIKeyByHash(ctx, auth.HashToken(raw))
+	if err != nil {
+		return nil, err
+	}
+	if key.RevokedAt != nil {
+		return nil, appErrors.ErrUnauthorized.New("api key has been revoked")
+	}
+	if !time.Now().Before(key.ExpiresAt) {
+		return nil, appErrors.ErrUnauthorized.New("api key has expired")
+	}
+	if !key.OwnerActive {
+		return nil, appErrors.ErrUnauthorized.New("the user of this api key is deactivated")
+	}
+
+	// last use is informational, a failed write shouldn't fail the request
+	if err := uc.repo.TouchAPIKey(ctx, key.ID); err != nil {
+		log.Printf("failed to record use of api key %d: %v", key.ID, err)
+	}
+
+	return key, nil
+}
+
+func scopeAllowed(scope string) bool {
+	for _, prefix := range apiKeyScopes {
+		if strings.HasPrefix(scope, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,214 @@
+package usecase
+
+import (
+	"Complaingo/internal/ai"
+	"Complaingo/internal/assist"
+	"Complaingo/internal/cache"
+	"Complaingo/internal/domain/models"
+	"Complaingo/internal/middleware"
+	"Complaingo/internal/repository"
+	"Complaingo/internal/validation"
+	"context"
+	"log"
+	"strings"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+// AssistResult is a summary or a drafted reply for a complaint thread.
+type AssistResult struct {
+	ComplaintID int             `json:"complaint_id"`
+	Text        string          `json:"text"`
+	Sources     []assist.Source `json:"sources,omitempty"`
+	Model       string          `json:"model"`
+	Usage       ai.Usage        `json:"usage"`
+	// Cached is set when the thread hasn't changed since the last answer,
+	// which is returned again without asking the model
+	Cached bool `json:"cached"`
+}
+
+// AssistUsecase helps agents with complaint threads: it summarises them and
+// drafts replies from the canned responses and knowledge base it keeps.
+type AssistUsecase struct {
+	complaints *ComplaintUsecase
+	knowledge  repository.KnowledgeRepository
+	usage      repository.AIUsageRepository
+	provider   ai.LLMProvider
+	cache      *cache.Cache
+}
+
+func NewAssistUsecase(complaints *ComplaintUsecase, knowledge repository.KnowledgeRepository, usage repository.AIUsageRepository, provider ai.LLMProvider, c *cache.Cache) *AssistUsecase {
+	return &AssistUsecase{
+		complaints: complaints,
+		knowledge:  knowledge,
+		usage:      usage,
+		provider:   provider,
+		cache:      c,
+	}
+}
+
+// Summarize summarises a complaint and its messages.
+func (uc *AssistUsecase) Summarize(ctx context.Context, complaintID int) (*AssistResult, error) {
+	thread, err := uc.thread(ctx, complaintID)
+	if err != nil {
+		return nil, err
+	}
+
+	return uc.cached(ctx, cache.AssistKey(assist.SummaryPurpose, complaintID, thread), func(ctx context.Context) (*AssistResult, error) {
+		res, err := uc.provider.Chat(ctx, assist.SummaryRequest(thread))
+		if err != nil {
+			return nil, err
+		}
+		uc.record(ctx, complaintID, assist.SummaryPurpose, res.Model, res.Usage)
+		return &AssistResult{ComplaintID: complaintID, Text: strings.TrimSpace(res.Content), Model: res.Model, Usage: res.Usage}, nil
+	})
+}
+
+// SuggestReply drafts the next reply to a complaint, with the canned
+// responses and articles closest to the thread as context.
+func (uc *AssistUsecase) SuggestReply(ctx context.Context, complaintID int) (*AssistResult, error) {
+	thread, err := uc.thread(ctx, complaintID)
+	if err != nil {
+		return nil, err
+	}
+
+	key := cache.AssistKey(assist.ReplyPurpose, complaintID, thread).Tagged(cache.KnowledgeTag)
+	return uc.cached(ctx, key, func(ctx context.Context) (*AssistResult, error) {
+		sources, err := uc.sources(ctx, complaintID, thread)
+		if err != nil {
+			return nil, err
+		}
+		res, err := uc.provider.Chat(ctx, assist.ReplyRequest(thread, sources))
+		if err != nil {
+			return nil, err
+		}
+		uc.record(ctx, complaintID, assist.ReplyPurpose, res.Model, res.Usage)
+		return &AssistResult{ComplaintID: complaintID, Text: strings.TrimSpace(res.Content), Sources: sources, Model: res.Model, Usage: res.Usage}, nil
+	})
+}
+
+// thread loads a complaint the caller may read, with its messages.
+func (uc *AssistUsecase) thread(ctx context.Context, complaintID int) (assist.Thread, error) {
+	complaint, err := uc.complaints.GetComplaint(ctx, complaintID)
+	if err != nil {
+		return assist.Thread{}, err
+	}
+	messages, err := uc.complaints.GetMessagesByComplaint(ctx, complaintID)
+	if err != nil {
+		return assist.Thread{}, err
+	}
+	return assist.NewThread(complaint, messages), nil
+}
+
+// sources ranks the knowledge entries against the thread, embedding those
+// that were never embedded, or were with another model, on the way.
+func (uc *AssistUsecase) sources(ctx context.Context, complaintID int, thread assist.Thread) ([]assist.Source, error) {
+	entries, err := uc.knowledge.GetEntries(ctx, "")
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+
+	query, err := uc.provider.Embed(ctx, []string{thread.Query()})
+	if err != nil {
+		return nil, err
+	}
+	usage := query.Usage
+
+	var stale []*models.KnowledgeEntry
+	var texts []string
+	for _, e := range entries {
+		if e.EmbeddingModel != query.Model || len(e.Embedding) == 0 {
+			stale = append(stale, e)
+			texts = append(texts, assist.EntryText(e))
+		}
+	}
+	if len(stale) > 0 {
+		res, err := uc.provider.Embed(ctx, texts)
+		if err != nil {
+			return nil, err
+		}
+		if len(res.Vectors) != len(stale) {
+			return nil, appErrors.ErrUpstreamFailure.New("expected %d embeddings, got %d", len(stale), len(res.Vectors))
+		}
+		for i, e := range stale {
+			e.Embedding, e.EmbeddingModel = res.Vectors[i], res.Model
+			if err := uc.knowledge.SaveEmbedding(ctx, e.ID, e.Embedding, e.EmbeddingModel); err != nil {
+				return nil, err
+			}
+		}
+		usage.PromptTokens += res.Usage.PromptTokens
+		usage.TotalTokens += res.Usage.TotalTokens
+	}
+	uc.record(ctx, complaintID, assist.ReplyPurpose, query.Model, usage)
+
+	return assist.Rank(query.Vectors[0], entries), nil
+}
+
+// cached returns the answer cached under key, loading it on a miss.
+func (uc *AssistUsecase) cached(ctx context.Context, key cache.Key, load func(ctx context.Context) (*AssistResult, error)) (*AssistResult, error) {
+	loaded := false
+	res, err := cache.GetOrLoad(ctx, uc.cache, key, func(ctx context.Context) (*AssistResult, error) {
+		loaded = true
+		return load(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	res.Cached = !loaded
+	return res, nil
+}
+
+// record logs the tokens spent. Failing to is not worth failing the answer
+// the tokens were already spent on.
+func (uc *AssistUsecase) record(ctx context.Context, complaintID int, feature, model string, usage ai.Usage) {
+	u := &models.AIUsage{
+		ComplaintID:      &complaintID,
+		Feature:          feature,
+		Model:            model,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+	}
+	if userID := middleware.GetUserId(ctx); userID != 0 {
+		u.UserID = &userID
+	}
+	if err := uc.usage.RecordUsage(ctx, u); err != nil {
+		log.Printf("failed to record ai usage of complaint %d: %v", complaintID, err)
+	}
+}
+
+// GetUsage adds up the tokens spent per feature and model.
+func (uc *AssistUsecase) GetUsage(ctx context.Context) ([]*models.AIUsageSummary, error) {
+	return uc.usage.GetUsageSummary(ctx)
+}
+
+func (uc *AssistUsecase) CreateKnowledgeEntry(ctx context.Context, input validation.KnowledgeEntryInput) (*models.KnowledgeEntry, error) {
+	input.Kind = strings.TrimSpace(input.Kind)
+	input.Title = strings.TrimSpace(input.Title)
+	input.Body = strings.TrimSpace(input.Body)
+	if err := input.ValidateKnowledgeEntryInput(); err != nil {
+		return nil, appErrors.ErrInvalidPayload.Wrap(err, "Validation failed")
+	}
+
+	e := &models.KnowledgeEntry{Kind: input.Kind, Title: input.Title, Body: input.Body}
+	if userID := middleware.GetUserId(ctx); userID != 0 {
+		e.CreatedBy = &userID
+	}
+	if err := uc.knowledge.CreateEntry(ctx, e); err != nil {
+		return nil, err
+	}
+	uc.cache.Invalidate(ctx, cache.KnowledgeTag)
+	return e, nil
+}
+
+func (uc *AssistUsecase) GetKnowledgeEntries(ctx context.Context, kind string) ([]*models.KnowledgeEntry, error) {
+	return uc.knowledge.GetEntries(ctx, kind)
+}
+
+func (uc *AssistUsecase) DeleteKnowledgeEntry(ctx context.Context, id int) error {
+	if err := uc.knowledge.DeleteEntry(ctx, id); err != nil {
+		return err
+	}
+	uc.cache.Invalidate(ctx, cache.KnowledgeTag)
+	return nil
+}
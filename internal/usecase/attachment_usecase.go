@@ -0,0 +1,338 @@
+package usecase
+
+import (
+	"Complaingo/internal/domain/models"
+	appErrors "Complaingo/internal/errors"
+	"Complaingo/internal/middleware"
+	"Complaingo/internal/repository"
+	"Complaingo/internal/scanner"
+	"Complaingo/internal/storage"
+	"Complaingo/internal/upload"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// attachmentLinkTTL is how long the signed URLs handed out with attachments stay valid.
+const attachmentLinkTTL = time.Hour
+
+// AttachmentUsecase is the single place uploaded files go through, whether
+// they come in as documents, complaint attachments or message replies.
+type AttachmentUsecase struct {
+	repo          repository.AttachmentRepository
+	complaintRepo repository.ComplaintRepository
+	store         storage.BlobStore
+	policy        upload.Policy
+	scanner       scanner.Scanner
+}
+
+func NewAttachmentUsecase(repo repository.AttachmentRepository, cr repository.ComplaintRepository, store storage.BlobStore, policy upload.Policy, sc scanner.Scanner) *AttachmentUsecase {
+	return &AttachmentUsecase{
+		repo:          repo,
+		complaintRepo: cr,
+		store:         store,
+		policy:        policy,
+		scanner:       sc,
+	}
+}
+
+// MaxUploadBytes is the largest single file the caller's role may upload.
+func (au *AttachmentUsecase) MaxUploadBytes(ctx context.Context) int64 {
+	return au.policy.MaxBytesFor(middleware.GetUserRole(ctx))
+}
+
+// Upload runs a file through the upload pipeline and stores it as an
+// attachment of whatever link points at. The content is size capped while
+// streaming, sniffed against the MIME allowlist, written to quarantine under
+// a generated name, scanned and only then promoted to its final key. Pass a
+// negative size when it isn't known up front.
+func (au *AttachmentUsecase) Upload(ctx context.Context, file io.Reader, fileName string, size int64, link models.AttachmentLink) (*models.Attachment, error) {
+	uploadedBy := middleware.GetUserId(ctx)
+
+	maxBytes := au.MaxUploadBytes(ctx)
+	if size > maxBytes {
+		return nil, appErrors.ErrFileTooLarge.New("file exceeds the %d byte limit", maxBytes)
+	}
+	limited := upload.LimitReader(file, maxBytes)
+
+	// sniff the content type from the first bytes
+	head := make([]byte, 512)
+	n, err := io.ReadFull(limited, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		if limited.Exceeded() {
+			return nil, err
+		}
+		return nil, appErrors.ErrInvalidPayload.Wrap(err, "Failed to read uploaded file")
+	}
+	head = head[:n]
+	if len(head) == 0 {
+		return nil, appErrors.ErrInvalidPayload.New("uploaded file is empty")
+	}
+
+	mediaType, err := au.policy.CheckType(http.DetectContentType(head))
+	if err != nil {
+		return nil, err
+	}
+
+	// never trust the client file name for storage
+	fileName = upload.SanitizeFilename(fileName)
+	key := fmt.Sprintf("%d/%s", uploadedBy, upload.StorageName(mediaType, fileName))
+	quarantineKey := "quarantine/" + key
+
+	// hash and count while the blob store reads the content
+	hash := sha256.New()
+	counter := &byteCounter{}
+	content := io.TeeReader(io.MultiReader(bytes.NewReader(head), limited), io.MultiWriter(hash, counter))
+
+	if err := au.store.Put(ctx, quarantineKey, content, size, mediaType); err != nil {
+		au.store.Delete(ctx, quarantineKey)
+		if limited.Exceeded() {
+			return nil, appErrors.ErrFileTooLarge.New("file exceeds the %d byte limit", maxBytes)
+		}
+		return nil, err
+	}
+
+	if err := au.release(ctx, quarantineKey, key, counter.n, mediaType); err != nil {
+		return nil, err
+	}
+
+	a := &models.Attachment{
+		UploadedBy:  uploadedBy,
+		UserID:      link.UserID,
+		ComplaintID: link.ComplaintID,
+		MessageID:   link.MessageID,
+		DocumentID:  link.DocumentID,
+		FileName:    fileName,
+		StorageKey:  key,
+		MimeType:    mediaType,
+		Size:        counter.n,
+		SHA256:      hex.EncodeToString(hash.Sum(nil)),
+	}
+
+	if err := au.repo.CreateAttachment(ctx, a); err != nil {
+		au.store.Delete(ctx, key)
+		return nil, err
+	}
+	au.setURL(ctx, a)
+
+	return a, nil
+}
+
+// release scans a quarantined blob and moves it to its final key when it is
+// clean. Quarantined content is always removed, whatever the verdict.
+func (au *AttachmentUsecase) release(ctx context.Context, quarantineKey, key string, size int64, mediaType string) error {
+	defer au.store.Delete(ctx, quarantineKey)
+
+	content, _, err := au.store.Get(ctx, quarantineKey)
+	if err != nil {
+		return err
+	}
+	result, err := au.scanner.Scan(ctx, content)
+	content.Close()
+	if err != nil {
+		return appErrors.ErrDbFailure.Wrap(err, "failed to scan uploaded file")
+	}
+	if !result.Clean {
+		log.Printf("rejected upload %s: %s", key, result.Signature)
+		return appErrors.ErrInfectedFile.New("file rejected by malware scan: %s", result.Signature)
+	}
+
+	content, _, err = au.store.Get(ctx, quarantineKey)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	return au.store.Put(ctx, key, content, size, mediaType)
+}
+
+// UploadFiles stores every file of a multipart form under the same link.
+func (au *AttachmentUsecase) UploadFiles(ctx context.Context, files []*multipart.FileHeader, link models.AttachmentLink) ([]*models.Attachment, error) {
+	if len(files) > upload.MaxFilesPerRequest {
+		return nil, appErrors.ErrInvalidPayload.New("at most %d files can be uploaded at once", upload.MaxFilesPerRequest)
+	}
+
+	attachments := make([]*models.Attachment, 0, len(files))
+	for _, fh := range files {
+		a, err := au.uploadFile(ctx, fh, link)
+		if err != nil {
+			// all or nothing, so a retry doesn't store the first files twice
+			au.DiscardAll(ctx, attachments)
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+
+	return attachments, nil
+}
+
+func (au *AttachmentUsecase) uploadFile(ctx context.Context, fh *multipart.FileHeader, link models.AttachmentLink) (*models.Attachment, error) {
+	file, err := fh.Open()
+	if err != nil {
+		return nil, appErrors.ErrInvalidPayload.Wrap(err, "can't open uploaded file")
+	}
+	defer file.Close()
+
+	return au.Upload(ctx, file, fh.Filename, fh.Size, link)
+}
+
+// UploadToComplaint attaches files to a complaint owned by the caller.
+func (au *AttachmentUsecase) UploadToComplaint(ctx context.Context, complaintID int, files []*multipart.FileHeader) ([]*models.Attachment, error) {
+	if _, err := au.authorizeComplaint(ctx, complaintID); err != nil {
+		return nil, err
+	}
+
+	return au.UploadFiles(ctx, files, models.AttachmentLink{ComplaintID: &complaintID})
+}
+
+func (au *AttachmentUsecase) GetAttachmentsByComplaint(ctx context.Context, complaintID int) ([]*models.Attachment, error) {
+	if _, err := au.authorizeComplaint(ctx, complaintID); err != nil {
+		return nil, err
+	}
+
+	attachments, err := au.repo.GetAttachmentsByComplaint(ctx, complaintID)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range attachments {
+		au.setURL(ctx, a)
+	}
+
+	return attachments, nil
+}
+
+// AttachDocument links the current version of a document to a complaint.
+// The file itself is shared; only a new attachment row pointing at it is
+// created. The caller must have checked access to the document.
+func (au *AttachmentUsecase) AttachDocument(ctx context.Context, doc *models.Document, sha256 string, complaintID int) (*models.Attachment, error) {
+	if _, err := au.authorizeComplaint(ctx, complaintID); err != nil {
+		return nil, err
+	}
+
+	documentID := int(doc.ID)
+	a := &models.Attachment{
+		UploadedBy:  middleware.GetUserId(ctx),
+		ComplaintID: &complaintID,
+		DocumentID:  &documentID,
+		FileName:    doc.FileName,
+		StorageKey:  doc.StorageKey,
+		MimeType:    doc.MimeType,
+		Size:        doc.Size,
+		SHA256:      sha256,
+	}
+	if err := au.repo.CreateAttachment(ctx, a); err != nil {
+		return nil, err
+	}
+	au.setURL(ctx, a)
+
+	return a, nil
+}
+
+// Discard removes an attachment and its blob, e.g. when a later step of an
+// upload fails.
+func (au *AttachmentUsecase) Discard(ctx context.Context, a *models.Attachment) error {
+	if err := au.repo.DeleteAttachment(ctx, a.ID); err != nil {
+		return err
+	}
+	return au.store.Delete(ctx, a.StorageKey)
+}
+
+// DiscardAll discards attachments, logging the ones that can't be.
+func (au *AttachmentUsecase) DiscardAll(ctx context.Context, attachments []*models.Attachment) {
+	for _, a := range attachments {
+		if err := au.Discard(ctx, a); err != nil {
+			log.Printf("failed to discard attachment %d: %v", a.ID, err)
+		}
+	}
+}
+
+// LinkMessage makes attachments those of a message.
+func (au *AttachmentUsecase) LinkMessage(ctx context.Context, attachments []*models.Attachment, messageID int) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+	ids := make([]int, len(attachments))
+	for i, a := range attachments {
+		ids[i] = a.ID
+		a.MessageID = &messageID
+	}
+	return au.repo.LinkMessage(ctx, ids, messageID)
+}
+
+func (au *AttachmentUsecase) LinkDocument(ctx context.Context, attachmentID, documentID int) error {
+	return au.repo.LinkDocument(ctx, attachmentID, documentID)
+}
+
+// LoadForMessages fills the Attachments field of every message.
+func (au *AttachmentUsecase) LoadForMessages(ctx context.Context, messages []*models.ComplaintMessages) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ids := make([]int, 0, len(messages))
+	byID := make(map[int]*models.ComplaintMessages, len(messages))
+	for _, m := range messages {
+		ids = append(ids, m.ID)
+		byID[m.ID] = m
+	}
+
+	attachments, err := au.repo.GetAttachmentsByMessages(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, a := range attachments {
+		au.setURL(ctx, a)
+		if m, ok := byID[*a.MessageID]; ok {
+			m.Attachments = append(m.Attachments, a)
+		}
+	}
+
+	// replies from before attachments existed point at the old static server
+	for _, m := range messages {
+		if key, ok := strings.CutPrefix(m.FileUrl, "/static/"); ok {
+			if url, err := au.store.Presign(ctx, key, attachmentLinkTTL); err == nil {
+				m.FileUrl = url
+			}
+		}
+	}
+
+	return nil
+}
+
+func (au *AttachmentUsecase) authorizeComplaint(ctx context.Context, complaintID int) (*models.Complaints, error) {
+	complaint, err := au.complaintRepo.GetComplaintByID(ctx, complaintID)
+	if err != nil {
+		return nil, err
+	}
+	if complaint.UserID != middleware.GetUserId(ctx) && !middleware.HasPermission(ctx, models.PermComplaintReadAny) {
+		return nil, appErrors.ErrForbidden.New("user can only access attachments of their own complaint")
+	}
+
+	return complaint, nil
+}
+
+func (au *AttachmentUsecase) setURL(ctx context.Context, a *models.Attachment) {
+	url, err := au.store.Presign(ctx, a.StorageKey, attachmentLinkTTL)
+	if err != nil {
+		log.Printf("failed to presign attachment %d: %v", a.ID, err)
+		return
+	}
+	a.URL = url
+}
+
+type byteCounter struct {
+	n int64
+}
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
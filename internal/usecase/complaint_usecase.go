@@ -1,16 +1,19 @@
 package usecase
 
 import (
+	"Complaingo/internal/cache"
 	"Complaingo/internal/domain/models"
 	appErrors "Complaingo/internal/errors"
+	"Complaingo/internal/events"
 	"Complaingo/internal/middleware"
 	"Complaingo/internal/notifier"
 	"Complaingo/internal/rabbitmq"
 	"Complaingo/internal/repository"
 	"Complaingo/internal/utility"
+	"Complaingo/internal/validation"
 	"context"
 	"encoding/json"
-	"fmt"
+	"mime/multipart"
 	"time"
 
 	"github.com/joomcode/errorx"
@@ -20,23 +23,39 @@ type ComplaintUsecase struct {
 	complaintRepo repository.ComplaintRepository
 	messageRepo   repository.ComplaintMessageRepository
 	notifier      notifier.Notifier
+	attachments   *AttachmentUsecase
+	cache         *cache.Cache
+	events        events.Publisher
 }
 
-func NewComplaintUsecase(cr repository.ComplaintRepository, cm repository.ComplaintMessageRepository, n notifier.Notifier) *ComplaintUsecase {
+func NewComplaintUsecase(cr repository.ComplaintRepository, cm repository.ComplaintMessageRepository, n notifier.Notifier, au *AttachmentUsecase, c *cache.Cache, publisher events.Publisher) *ComplaintUsecase {
 	return &ComplaintUsecase{
 		complaintRepo: cr,
 		messageRepo:   cm,
 		notifier:      n,
+		attachments:   au,
+		cache:         c,
+		events:        publisher,
 	}
 }
 
 func (cr *ComplaintUsecase) CreateComplaint(ctx context.Context, c *models.Complaints) error {
+	// complaints are always filed by the caller, whatever the body says
+	c.UserID = middleware.GetUserId(ctx)
+
 	if err := cr.complaintRepo.CreateComplaint(ctx, c); err != nil {
 		if errorx.IsOfType(err, appErrors.ErrUserDuplicate) {
 			return err
 		}
 		return appErrors.ErrDbFailure.Wrap(err, "usecase: unable to create user")
 	}
+	cr.cache.Invalidate(ctx, cache.UserComplaintsTag(c.UserID))
+
+	// triage runs in the background
+	cr.events.Publish(ctx, events.Event{
+		Type:    events.ComplaintCreated,
+		Payload: events.ComplaintCreatedPayload{ComplaintID: c.ID, UserID: c.UserID},
+	})
 
 	// publish to rabbitmq
 	message := models.NotificationMessage{
@@ -54,8 +73,16 @@ func (cr *ComplaintUsecase) CreateComplaint(ctx context.Context, c *models.Compl
 	return nil
 }
 
+// GetComplaintByRole lists the complaints of a user, to that user or to
+// roles that read any complaint.
 func (cr *ComplaintUsecase) GetComplaintByRole(ctx context.Context, UserID int, param utility.FilterParam) ([]*models.Complaints, error) {
-	complaints, err := cr.complaintRepo.GetComplaintByRole(ctx, UserID, param)
+	if UserID != middleware.GetUserId(ctx) && !middleware.HasPermission(ctx, models.PermComplaintReadAny) {
+		return nil, appErrors.ErrForbidden.New("users can only list their own complaints")
+	}
+
+	complaints, err := cache.GetOrLoad(ctx, cr.cache, cache.UserComplaintsKey(UserID, param), func(ctx context.Context) ([]*models.Complaints, error) {
+		return cr.complaintRepo.GetComplaintByRole(ctx, UserID, param)
+	})
 	if err != nil {
 		if errorx.IsOfType(err, appErrors.ErrUserNotFound) {
 			return nil, appErrors.ErrUnauthorized.Wrap(err, "usecase: complaint not found")
@@ -65,28 +92,78 @@ func (cr *ComplaintUsecase) GetComplaintByRole(ctx context.Context, UserID int,
 	return complaints, nil
 }
 
-func (cr *ComplaintUsecase) UserMarkResolved(ctx context.Context, complaintID int) error {
-	userID := middleware.GetUserId(ctx)
-	fmt.Printf("🔍 Logged-in user ID: %d\n", userID)
+// GetComplaint returns one complaint to its owner or to roles that read any
+// complaint.
+func (cr *ComplaintUsecase) GetComplaint(ctx context.Context, complaintID int) (*models.Complaints, error) {
+	complaint, err := cr.complaintRepo.GetComplaintByID(ctx, complaintID)
+	if err != nil {
+		return nil, err
+	}
+	if !middleware.HasPermission(ctx, models.PermComplaintReadAny) && complaint.UserID != middleware.GetUserId(ctx) {
+		return nil, appErrors.ErrForbidden.New("user can only access their own complaint")
+	}
+	return complaint, nil
+}
+
+// UserMarkResolved resolves the caller's complaint if it is still at version,
+// and returns it as updated.
+func (cr *ComplaintUsecase) UserMarkResolved(ctx context.Context, complaintID int, version int) (*models.Complaints, error) {
 	complaint, err := cr.complaintRepo.GetComplaintByID(ctx, complaintID)
 	if err != nil {
-		return appErrors.ErrDbFailure.Wrap(err, "complaint not found")
+		return nil, err
+	}
+	if complaint.UserID != middleware.GetUserId(ctx) {
+		return nil, appErrors.ErrForbidden.New("user can only update their own complaint")
+	}
+	if err := middleware.CheckVersion(version, complaint.Version); err != nil {
+		return nil, err
+	}
+
+	if err := cr.complaintRepo.UpdateComplaints(ctx, complaintID, "Resolved", version); err != nil {
+		return nil, err
+	}
+	cr.cache.Invalidate(ctx, cache.UserComplaintsTag(complaint.UserID))
+	return cr.complaintRepo.GetComplaintByID(ctx, complaintID)
+}
+
+// EditComplaint lets the author fix the subject or message of a complaint
+// until it is accepted.
+func (cr *ComplaintUsecase) EditComplaint(ctx context.Context, complaintID int, patch models.ComplaintPatch, version int) (*models.Complaints, error) {
+	if patch.IsEmpty() {
+		return nil, appErrors.ErrInvalidPayload.New("nothing to update")
+	}
+	if err := validation.ValidateComplaintPatch(&patch); err != nil {
+		return nil, appErrors.ErrInvalidPayload.Wrap(err, "usecase: validation failed")
 	}
 
-	fmt.Printf("📦 Complaint fetched: %+v\n", complaint)
-	if complaint.UserID != userID {
-		return appErrors.ErrDbFailure.New("user can only update their own complaint")
+	complaint, err := cr.complaintRepo.GetComplaintByID(ctx, complaintID)
+	if err != nil {
+		return nil, err
+	}
+	if complaint.UserID != middleware.GetUserId(ctx) {
+		return nil, appErrors.ErrForbidden.New("users can only edit their own complaints")
+	}
+	if err := middleware.CheckVersion(version, complaint.Version); err != nil {
+		return nil, err
+	}
+	if complaint.Status != "Created" {
+		return nil, appErrors.ErrConflict.New("only complaints that haven't been accepted can be edited")
 	}
 
-	fmt.Printf("Updating complaint ID %d to Resolved\n", complaintID)
-	return cr.complaintRepo.UpdateComplaints(ctx, complaintID, "Resolved")
+	if err := cr.complaintRepo.EditComplaint(ctx, complaintID, patch, version); err != nil {
+		return nil, err
+	}
+	cr.cache.Invalidate(ctx, cache.UserComplaintsTag(complaint.UserID))
+	return cr.complaintRepo.GetComplaintByID(ctx, complaintID)
 }
 
 func (cr *ComplaintUsecase) GetAllComplaintByRole(ctx context.Context, param utility.FilterParam) ([]*models.Complaints, error) {
 	return cr.complaintRepo.GetAllComplaintByRole(ctx, param)
 }
 
-func (cr *ComplaintUsecase) AdminUpdateComplaints(ctx context.Context, complaintID int, status string) error {
+// AdminUpdateComplaints sets the status of a complaint still at version and
+// returns it as updated.
+func (cr *ComplaintUsecase) AdminUpdateComplaints(ctx context.Context, complaintID int, status string, version int) (*models.Complaints, error) {
 	validStatus := map[string]bool{
 		"Created":  true,
 		"Accepted": true,
@@ -94,10 +171,19 @@ func (cr *ComplaintUsecase) AdminUpdateComplaints(ctx context.Context, complaint
 		"Rejected": true,
 	}
 	if !validStatus[status] {
-		return appErrors.ErrInvalidPayload.New("Invalid complaint status")
+		return nil, appErrors.ErrInvalidPayload.New("Invalid complaint status")
+	}
+
+	if err := cr.complaintRepo.UpdateComplaints(ctx, complaintID, status, version); err != nil {
+		return nil, err
 	}
 
-	return cr.complaintRepo.UpdateComplaints(ctx, complaintID, status)
+	complaint, err := cr.complaintRepo.GetComplaintByID(ctx, complaintID)
+	if err != nil {
+		return nil, err
+	}
+	cr.cache.Invalidate(ctx, cache.UserComplaintsTag(complaint.UserID))
+	return complaint, nil
 }
 
 // complaint_messages table
@@ -108,11 +194,19 @@ func (cr *ComplaintUsecase) InsertCoplaintMessage(ctx context.Context, cm *model
 		}
 		return appErrors.ErrDbFailure.Wrap(err, "usecase: unable to create user")
 	}
+	cr.cache.Invalidate(ctx, cache.MessagesTag(cm.ComplaintID))
 
 	return nil
 }
 
-func (cr *ComplaintUsecase) ReplyToMessage(ctx context.Context, msg *models.ComplaintMessages) error {
+// ReplyToMessage adds a reply to a complaint the caller may access. Its
+// files go through the upload pipeline first, so a rejected file leaves no
+// reply behind.
+func (cr *ComplaintUsecase) ReplyToMessage(ctx context.Context, msg *models.ComplaintMessages, files []*multipart.FileHeader) error {
+	complaint, err := cr.accessComplaint(ctx, msg.ComplaintID)
+	if err != nil {
+		return err
+	}
 	if msg.ParentID != nil {
 		parentMsg, err := cr.messageRepo.GetMessageByID(ctx, *msg.ParentID)
 		if err != nil {
@@ -123,33 +217,121 @@ func (cr *ComplaintUsecase) ReplyToMessage(ctx context.Context, msg *models.Comp
 		}
 	}
 
-	role := middleware.GetUserRole(ctx)
+	// staff, who may read any complaint, answer without files
+	staff := middleware.HasPermission(ctx, models.PermComplaintReadAny)
+	if staff && (msg.FileUrl != "" || len(files) > 0) {
+		return appErrors.ErrForbidden.New("staff replies can't carry files")
+	}
 
-	if role == "admin" && msg.FileUrl != "" {
-		return appErrors.ErrUnauthorized.New("admins are not allowed to attach files")
+	var attachments []*models.Attachment
+	if len(files) > 0 {
+		var err error
+		attachments, err = cr.attachments.UploadFiles(ctx, files, models.AttachmentLink{ComplaintID: &msg.ComplaintID})
+		if err != nil {
+			return err
+		}
 	}
 
 	msg.SenderID = middleware.GetUserId(ctx)
-	err := cr.messageRepo.AddMessage(ctx, msg)
-	if err != nil {
+	if err := cr.messageRepo.AddMessage(ctx, msg); err != nil {
+		cr.attachments.DiscardAll(ctx, attachments)
 		return appErrors.ErrDbFailure.Wrap(err, "failed to save reply")
 	}
+	// after the attachments too, the message is listed with them
+	defer cr.cache.Invalidate(ctx, cache.MessagesTag(msg.ComplaintID))
 
-	if role == "user" {
-		cr.notifier.SendToAdmins(msg)
+	if err := cr.attachments.LinkMessage(ctx, attachments, msg.ID); err != nil {
+		cr.attachments.DiscardAll(ctx, attachments)
+		return err
 	}
-	if role == "admin" {
-		cr.notifier.SendToUser(msg.SenderID, msg)
+	msg.Attachments = attachments
+
+	// the owner's replies go to staff, anyone else's to the owner
+	if msg.SenderID == complaint.UserID {
+		cr.notifier.SendToAdmins(msg)
+	} else {
+		cr.notifier.SendToUser(complaint.UserID, msg)
 	}
 
 	return nil
 }
 
-func (cr *ComplaintUsecase) GetMessagesByComplaint(ctx context.Context, complaintID int) ([]*models.ComplaintMessages, error) {
-	complaints, err := cr.messageRepo.GetMessagesByComplaint(ctx, complaintID)
+// CanAccessComplaint lets the complaint owner and roles that read any complaint through.
+func (cr *ComplaintUsecase) CanAccessComplaint(ctx context.Context, complaintID int) error {
+	_, err := cr.accessComplaint(ctx, complaintID)
+	return err
+}
+
+func (cr *ComplaintUsecase) accessComplaint(ctx context.Context, complaintID int) (*models.Complaints, error) {
+	complaint, err := cr.complaintRepo.GetComplaintByID(ctx, complaintID)
 	if err != nil {
-		return nil, appErrors.ErrUserNotFound.Wrap(err, "usecase: message not found")
+		return nil, err
+	}
+	if !middleware.HasPermission(ctx, models.PermComplaintReadAny) && complaint.UserID != middleware.GetUserId(ctx) {
+		return nil, appErrors.ErrForbidden.New("user can only access their own complaint")
 	}
 
-	return complaints, nil
+	return complaint, nil
+}
+
+func (cr *ComplaintUsecase) GetMessagesByComplaint(ctx context.Context, complaintID int) ([]*models.ComplaintMessages, error) {
+	if err := cr.CanAccessComplaint(ctx, complaintID); err != nil {
+		return nil, err
+	}
+
+	return cache.GetOrLoad(ctx, cr.cache, cache.MessagesKey(complaintID, nil), func(ctx context.Context) ([]*models.ComplaintMessages, error) {
+		complaints, err := cr.messageRepo.GetMessagesByComplaint(ctx, complaintID)
+		if err != nil {
+			return nil, appErrors.ErrUserNotFound.Wrap(err, "usecase: message not found")
+		}
+
+		if err := cr.attachments.LoadForMessages(ctx, complaints); err != nil {
+			return nil, err
+		}
+		return complaints, nil
+	})
+}
+
+func (cr *ComplaintUsecase) GetMessageThread(ctx context.Context, complaintID int, param utility.ThreadParam) (*models.MessageThread, error) {
+	if err := cr.CanAccessComplaint(ctx, complaintID); err != nil {
+		return nil, err
+	}
+
+	if param.ParentID != nil {
+		parentMsg, err := cr.messageRepo.GetMessageByID(ctx, *param.ParentID)
+		if err != nil {
+			return nil, appErrors.ErrUserNotFound.Wrap(err, "parent message not found")
+		}
+		if parentMsg.ComplaintID != complaintID {
+			return nil, appErrors.ErrInvalidPayload.New("parent message must belongs to the same complaint")
+		}
+	}
+
+	// the thread shape depends on every param, so all of them are part of the key
+	return cache.GetOrLoad(ctx, cr.cache, cache.MessagesKey(complaintID, param), func(ctx context.Context) (*models.MessageThread, error) {
+		thread, err := cr.messageRepo.GetMessageThread(ctx, complaintID, param)
+		if err != nil {
+			return nil, appErrors.ErrDbFailure.Wrap(err, "usecase: failed to load message thread")
+		}
+
+		var messages []*models.ComplaintMessages
+		var collect func(nodes []*models.ComplaintMessageNode)
+		collect = func(nodes []*models.ComplaintMessageNode) {
+			for _, n := range nodes {
+				messages = append(messages, &n.ComplaintMessages)
+				collect(n.Replies)
+			}
+		}
+		collect(thread.Messages)
+
+		if err := cr.attachments.LoadForMessages(ctx, messages); err != nil {
+			return nil, err
+		}
+		return thread, nil
+	})
+}
+
+// MaxUploadBytes is the largest single file the caller's role may upload.
+func (cr *ComplaintUsecase) MaxUploadBytes(ctx context.Context) int64 {
+	return cr.attachments.MaxUploadBytes(ctx)
 }
@@ -2,33 +2,474 @@ package usecase
 
 import (
 	"Complaingo/internal/domain/models"
+	appErrors "Complaingo/internal/errors"
+	"Complaingo/internal/events"
+	"Complaingo/internal/middleware"
+	"Complaingo/internal/preview"
 	"Complaingo/internal/repository"
+	"Complaingo/internal/storage"
 	"Complaingo/internal/utility"
+	"Complaingo/internal/validation"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"time"
+
+	"github.com/joomcode/errorx"
 )
 
 type DocumentUsecase struct {
-	repo *repository.DocumentRepository
+	repo        *repository.DocumentRepository
+	attachments *AttachmentUsecase
+	store       storage.BlobStore
+	linkTTL     time.Duration
+	quotas      map[string]int64 // default storage quota per role
+	events      events.Publisher
 }
 
-func NewDocumentUsecase(repo *repository.DocumentRepository) *DocumentUsecase {
+func NewDocumentUsecase(repo *repository.DocumentRepository, au *AttachmentUsecase, store storage.BlobStore, linkTTL time.Duration, quotas map[string]int64, publisher events.Publisher) *DocumentUsecase {
 	return &DocumentUsecase{
-		repo: repo,
+		repo:        repo,
+		attachments: au,
+		store:       store,
+		linkTTL:     linkTTL,
+		quotas:      quotas,
+		events:      publisher,
+	}
+}
+
+// DownloadLink is a signed, expiring URL for a document's content.
+type DownloadLink struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Uplod stores the file through the attachment service and records the
+// document pointing at it as its first version.
+func (du *DocumentUsecase) Uplod(ctx context.Context, file io.Reader, fileName string, size int64) (*models.Document, error) {
+	userID := middleware.GetUserId(ctx)
+
+	attachment, err := du.uploadWithinQuota(ctx, userID, file, fileName, size, models.AttachmentLink{UserID: &userID})
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &models.Document{
+		UserID:     userID,
+		FileName:   attachment.FileName,
+		StorageKey: attachment.StorageKey,
+		MimeType:   attachment.MimeType,
+		Size:       attachment.Size,
+	}
+	if err := du.repo.SaveDocument(ctx, doc, versionFromAttachment(attachment)); err != nil {
+		du.attachments.Discard(ctx, attachment)
+		return nil, err
+	}
+
+	if err := du.attachments.LinkDocument(ctx, attachment.ID, int(doc.ID)); err != nil {
+		return nil, err
+	}
+
+	du.publishUploaded(ctx, doc)
+	return doc, nil
+}
+
+// UploadVersion stores a new version of a document and makes it current.
+// The upload counts against the document owner's quota.
+func (du *DocumentUsecase) UploadVersion(ctx context.Context, id int, file io.Reader, fileName string, size int64) (*models.Document, error) {
+	doc, err := du.repo.GetDocumentByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := du.authorizeWrite(ctx, doc); err != nil {
+		return nil, err
+	}
+
+	documentID := int(doc.ID)
+	attachment, err := du.uploadWithinQuota(ctx, doc.UserID, file, fileName, size, models.AttachmentLink{
+		UserID:     &doc.UserID,
+		DocumentID: &documentID,
+	})
+	if err != nil {
+		return nil, err
 	}
+
+	updated, err := du.repo.AddVersion(ctx, documentID, versionFromAttachment(attachment))
+	if err != nil {
+		du.attachments.Discard(ctx, attachment)
+		return nil, err
+	}
+
+	du.publishUploaded(ctx, updated)
+	return updated, nil
+}
+
+// publishUploaded lets background workers build thumbnails and previews.
+func (du *DocumentUsecase) publishUploaded(ctx context.Context, doc *models.Document) {
+	if du.events == nil {
+		return
+	}
+
+	du.events.Publish(ctx, events.Event{
+		Type: events.DocumentUploaded,
+		Payload: events.DocumentUploadedPayload{
+			DocumentID: int(doc.ID),
+			Version:    doc.CurrentVersion,
+			StorageKey: doc.StorageKey,
+			MimeType:   doc.MimeType,
+		},
+	})
 }
 
-func (du *DocumentUsecase) Uplod(ctx context.Context, doc *models.Document) error {
-	return du.repo.SaveDocument(ctx, doc)
+func (du *DocumentUsecase) GetVersions(ctx context.Context, id int) ([]*models.DocumentVersion, error) {
+	if _, err := du.GetDocumentByID(ctx, id); err != nil {
+		return nil, err
+	}
+
+	return du.repo.GetVersions(ctx, id)
+}
+
+// OpenVersion returns a specific version together with a reader over its
+// content. The caller must close the reader.
+func (du *DocumentUsecase) OpenVersion(ctx context.Context, id, version int) (*models.DocumentVersion, io.ReadCloser, *storage.BlobInfo, error) {
+	if _, err := du.GetDocumentByID(ctx, id); err != nil {
+		return nil, nil, nil, err
+	}
+
+	v, err := du.repo.GetVersion(ctx, id, version)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	content, info, err := du.store.Get(ctx, v.StorageKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return v, content, info, nil
+}
+
+// RestoreVersion makes an old version current again by appending a new
+// version that shares its blob, so the history is never rewritten.
+func (du *DocumentUsecase) RestoreVersion(ctx context.Context, id, version int) (*models.Document, error) {
+	doc, err := du.repo.GetDocumentByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := du.authorizeWrite(ctx, doc); err != nil {
+		return nil, err
+	}
+
+	old, err := du.repo.GetVersion(ctx, id, version)
+	if err != nil {
+		return nil, err
+	}
+	if old.Version == doc.CurrentVersion {
+		return nil, appErrors.ErrInvalidPayload.New("version %d is already the current version", version)
+	}
+
+	uploadedBy := middleware.GetUserId(ctx)
+	restored := *old
+	restored.UploadedBy = &uploadedBy
+	restored.RestoredFrom = &old.Version
+
+	return du.repo.AddVersion(ctx, id, &restored)
+}
+
+// GetUsage reports storage consumption. Users can only see their own.
+func (du *DocumentUsecase) GetUsage(ctx context.Context, userID int) (*models.StorageUsage, error) {
+	if !middleware.HasPermission(ctx, models.PermDocumentReadAny) && middleware.GetUserId(ctx) != userID {
+		return nil, appErrors.ErrForbidden.New("users can only see their own storage usage")
+	}
+
+	return du.usage(ctx, userID)
+}
+
+func (du *DocumentUsecase) usage(ctx context.Context, userID int) (*models.StorageUsage, error) {
+	usage, err := du.repo.GetUsage(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	override, role, err := du.repo.GetQuotaSettings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// custom roles get the default user quota until one is set for them
+	quota, ok := du.quotas[role]
+	if !ok {
+		quota = du.quotas[string(models.UerRole)]
+	}
+	usage.QuotaBytes = quota
+	if override != nil {
+		usage.QuotaBytes = *override
+	}
+	usage.RemainingBytes = usage.QuotaBytes - usage.UsedBytes
+	if usage.RemainingBytes < 0 {
+		usage.RemainingBytes = 0
+	}
+
+	return usage, nil
+}
+
+// uploadWithinQuota rejects uploads that would push ownerID over quota. The
+// declared size is checked first, the stored size once the content is known.
+func (du *DocumentUsecase) uploadWithinQuota(ctx context.Context, ownerID int, file io.Reader, fileName string, size int64, link models.AttachmentLink) (*models.Attachment, error) {
+	usage, err := du.usage(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if size > usage.RemainingBytes {
+		return nil, appErrors.ErrQuotaExceeded.New("upload of %d bytes exceeds the remaining quota of %d bytes", size, usage.RemainingBytes)
+	}
+
+	attachment, err := du.attachments.Upload(ctx, file, fileName, size, link)
+	if err != nil {
+		return nil, err
+	}
+	if attachment.Size > usage.RemainingBytes {
+		du.attachments.Discard(ctx, attachment)
+		return nil, appErrors.ErrQuotaExceeded.New("upload of %d bytes exceeds the remaining quota of %d bytes", attachment.Size, usage.RemainingBytes)
+	}
+
+	return attachment, nil
+}
+
+func versionFromAttachment(a *models.Attachment) *models.DocumentVersion {
+	return &models.DocumentVersion{
+		FileName:   a.FileName,
+		StorageKey: a.StorageKey,
+		MimeType:   a.MimeType,
+		Size:       a.Size,
+		SHA256:     a.SHA256,
+		UploadedBy: &a.UploadedBy,
+	}
 }
 
 func (du *DocumentUsecase) GetDocumentByID(ctx context.Context, id int) (*models.Document, error) {
-	return du.repo.GetDocumentByID(ctx, id)
+	doc, err := du.repo.GetDocumentByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := du.authorizeRead(ctx, doc); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// OpenDocument returns the document together with a reader over its content.
+// The caller must close the reader.
+func (du *DocumentUsecase) OpenDocument(ctx context.Context, id int) (*models.Document, io.ReadCloser, *storage.BlobInfo, error) {
+	doc, err := du.GetDocumentByID(ctx, id)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	content, info, err := du.store.Get(ctx, doc.StorageKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return doc, content, info, nil
+}
+
+// OpenThumbnail returns the generated thumbnail of the current version. It is
+// not found until the background generator has processed the upload.
+func (du *DocumentUsecase) OpenThumbnail(ctx context.Context, id int) (io.ReadCloser, *storage.BlobInfo, error) {
+	doc, err := du.GetDocumentByID(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !preview.IsImage(doc.MimeType) {
+		return nil, nil, appErrors.ErrUserNotFound.New("no thumbnail for %s documents", doc.MimeType)
+	}
+
+	return du.openDerivative(ctx, preview.ThumbnailKey(doc.StorageKey))
+}
+
+// OpenPreview returns the generated preview of the current version: a larger
+// image for pictures, or a text extract for PDFs and plain text.
+func (du *DocumentUsecase) OpenPreview(ctx context.Context, id int) (io.ReadCloser, *storage.BlobInfo, error) {
+	doc, err := du.GetDocumentByID(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !preview.Supported(doc.MimeType) {
+		return nil, nil, appErrors.ErrUserNotFound.New("no preview for %s documents", doc.MimeType)
+	}
+
+	return du.openDerivative(ctx, preview.PreviewKey(doc.StorageKey, doc.MimeType))
+}
+
+func (du *DocumentUsecase) openDerivative(ctx context.Context, key string) (io.ReadCloser, *storage.BlobInfo, error) {
+	content, info, err := du.store.Get(ctx, key)
+	if err != nil {
+		if errorx.IsOfType(err, appErrors.ErrUserNotFound) {
+			return nil, nil, appErrors.ErrUserNotFound.New("preview is not ready yet")
+		}
+		return nil, nil, err
+	}
+	return content, info, nil
+}
+
+// DownloadURL signs a short lived link to the document's content.
+func (du *DocumentUsecase) DownloadURL(ctx context.Context, id int) (*DownloadLink, error) {
+	doc, err := du.GetDocumentByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := du.store.Presign(ctx, doc.StorageKey, du.linkTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DownloadLink{
+		URL:       url,
+		ExpiresAt: time.Now().Add(du.linkTTL),
+	}, nil
 }
 
 func (du *DocumentUsecase) GetDocumentByUser(ctx context.Context, user_id int, param utility.FilterParam) ([]*models.Document, error) {
+	if !middleware.HasPermission(ctx, models.PermDocumentReadAny) && middleware.GetUserId(ctx) != user_id {
+		return nil, appErrors.ErrForbidden.New("users can only list their own documents")
+	}
+
 	return du.repo.GetDocumentByUser(ctx, user_id, param)
 }
 
+// UpdateDocument renames a document. Stored versions keep the names they
+// were uploaded with.
+func (du *DocumentUsecase) UpdateDocument(ctx context.Context, id int, patch models.DocumentPatch) (*models.Document, error) {
+	if patch.IsEmpty() {
+		return nil, appErrors.ErrInvalidPayload.New("nothing to update")
+	}
+	if err := validation.ValidateDocumentPatch(&patch); err != nil {
+		return nil, appErrors.ErrInvalidPayload.Wrap(err, "usecase: validation failed")
+	}
+
+	doc, err := du.repo.GetDocumentByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := du.authorizeWrite(ctx, doc); err != nil {
+		return nil, err
+	}
+
+	if err := du.repo.UpdateDocument(ctx, id, patch); err != nil {
+		return nil, err
+	}
+	return du.repo.GetDocumentByID(ctx, id)
+}
+
 func (du *DocumentUsecase) DeleteDocument(ctx context.Context, id int) error {
-	return du.repo.DeleteDocument(ctx, id)
+	doc, err := du.repo.GetDocumentByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := du.authorizeWrite(ctx, doc); err != nil {
+		return err
+	}
+
+	keys, err := du.repo.GetStorageKeys(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := du.repo.DeleteDocument(ctx, id); err != nil {
+		return err
+	}
+
+	// versions and attachments sharing these blobs are removed with the document row
+	for _, key := range keys {
+		if err := du.store.Delete(ctx, key); err != nil {
+			return err
+		}
+		for _, derived := range preview.DerivativeKeys(key) {
+			if err := du.store.Delete(ctx, derived); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// AttachDocument attaches a document of the caller's to one of their
+// complaints.
+func (du *DocumentUsecase) AttachDocument(ctx context.Context, documentID, complaintID int) (*models.Attachment, error) {
+	doc, err := du.repo.GetDocumentByID(ctx, documentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := du.authorizeWrite(ctx, doc); err != nil {
+		return nil, err
+	}
+
+	hash, err := du.contentHash(ctx, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return du.attachments.AttachDocument(ctx, doc, hash, complaintID)
+}
+
+// contentHash is the SHA-256 of the document's current version. Documents
+// from before versioning have none on record, so it is taken from the file.
+func (du *DocumentUsecase) contentHash(ctx context.Context, doc *models.Document) (string, error) {
+	v, err := du.repo.GetVersion(ctx, int(doc.ID), doc.CurrentVersion)
+	if err == nil {
+		return v.SHA256, nil
+	}
+	if !errorx.IsOfType(err, appErrors.ErrUserNotFound) {
+		return "", err
+	}
+
+	content, _, err := du.store.Get(ctx, doc.StorageKey)
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", appErrors.ErrDbFailure.Wrap(err, "failed to read document")
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (du *DocumentUsecase) authorizeWrite(ctx context.Context, doc *models.Document) error {
+	if !middleware.HasPermission(ctx, models.PermDocumentManageAny) && doc.UserID != middleware.GetUserId(ctx) {
+		return appErrors.ErrForbidden.New("users can only change their own documents")
+	}
+	return nil
+}
+
+// authorizeRead lets roles that read any document through, and otherwise
+// users read their own documents or documents attached to their complaints.
+func (du *DocumentUsecase) authorizeRead(ctx context.Context, doc *models.Document) error {
+	userID := middleware.GetUserId(ctx)
+	if middleware.HasPermission(ctx, models.PermDocumentReadAny) || doc.UserID == userID {
+		return nil
+	}
+
+	shared, err := du.repo.IsSharedWithUser(ctx, int(doc.ID), userID)
+	if err != nil {
+		return err
+	}
+	if !shared {
+		return appErrors.ErrForbidden.New("document is not shared with this user")
+	}
+
+	return nil
+}
+
+// MaxUploadBytes is the largest single file the caller's role may upload.
+func (du *DocumentUsecase) MaxUploadBytes(ctx context.Context) int64 {
+	return du.attachments.MaxUploadBytes(ctx)
 }
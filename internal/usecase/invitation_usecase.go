@@ -0,0 +1,140 @@
+package usecase
+
+import (
+	"Complaingo/internal/auth"
+	"Complaingo/internal/domain/models"
+	"Complaingo/internal/mailer"
+	"Complaingo/internal/middleware"
+	"Complaingo/internal/repository"
+	"Complaingo/internal/utility"
+	"Complaingo/internal/validation"
+	"context"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/joomcode/errorx"
+)
+
+// InvitationUsecase lets staff invite people to join with a given role.
+type InvitationUsecase struct {
+	repo  repository.InvitationRepository
+	users repository.UserRepository
+	roles repository.RoleRepository
+	mail  mailer.Mailer
+	ttl   time.Duration
+	base  string
+}
+
+func NewInvitationUsecase(repo repository.InvitationRepository, users repository.UserRepository, roles repository.RoleRepository,
+	mail mailer.Mailer, ttl time.Duration, appBaseURL string) *InvitationUsecase {
+	return &InvitationUsecase{
+		repo:  repo,
+		users: users,
+		roles: roles,
+		mail:  mail,
+		ttl:   ttl,
+		base:  appBaseURL,
+	}
+}
+
+// Invite creates an invitation and mails its link. Nobody can invite to a
+// role that may do more than they can themselves.
+func (uc *InvitationUsecase) Invite(ctx context.Context, input validation.InviteInput) (*models.CreatedInvitation, error) {
+	input.Email = strings.ToLower(strings.TrimSpace(input.Email))
+	if err := input.ValidateInviteInput(); err != nil {
+		return nil, appErrors.ErrInvalidPayload.Wrap(err, "Validation failed")
+	}
+
+	_, err := uc.users.GetByEmail(ctx, input.Email)
+	if err == nil {
+		return nil, appErrors.ErrUserDuplicate.New("a user with this email already exists")
+	}
+	if !errorx.IsOfType(err, appErrors.ErrUserNotFound) {
+		return nil, err
+	}
+
+	role, err := uc.roles.GetRole(ctx, input.Role)
+	if err != nil {
+		if errorx.IsOfType(err, appErrors.ErrUserNotFound) {
+			return nil, appErrors.ErrInvalidPayload.New("role not found")
+		}
+		return nil, err
+	}
+	for _, perm := range role.Permissions {
+		if !middleware.HasPermission(ctx, perm) {
+			return nil, appErrors.ErrForbidden.New("can't invite to a role with permission %s, which you don't have", perm)
+		}
+	}
+
+	ttl := uc.ttl
+	if input.ExpiresInHours > 0 {
+		ttl = time.Duration(input.ExpiresInHours) * time.Hour
+	}
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	invitedBy := middleware.GetUserId(ctx)
+
+	inv := &models.Invitation{
+		Email:     input.Email,
+		Role:      role.Name,
+		TokenHash: hash,
+		InvitedBy: &invitedBy,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := uc.repo.CreateInvitation(ctx, inv); err != nil {
+		return nil, err
+	}
+
+	link := strings.TrimRight(uc.base, "/") + "/accept-invite?token=" + url.QueryEscape(token)
+	err = uc.mail.Send(ctx, mailer.Message{
+		To:      inv.Email,
+		Subject: "You are invited to Complaingo",
+		Body: "You have been invited to join Complaingo as " + inv.Role + ".\n\n" +
+			"Set up your account here:\n" + link + "\n\n" +
+			"The link expires on " + inv.ExpiresAt.UTC().Format(time.RFC1123) + " and works once.\n",
+	})
+	// the inviter gets the link either way and can pass it on
+	if err != nil {
+		log.Printf("failed to mail invitation %d: %v", inv.ID, err)
+	}
+
+	return &models.CreatedInvitation{Invitation: inv, AcceptURL: link}, nil
+}
+
+func (uc *InvitationUsecase) GetInvitations(ctx context.Context, filter models.InvitationFilter) ([]*models.Invitation, error) {
+	return uc.repo.GetInvitations(ctx, filter)
+}
+
+func (uc *InvitationUsecase) RevokeInvitation(ctx context.Context, id int64) error {
+	return uc.repo.RevokeInvitation(ctx, id)
+}
+
+// Accept creates the invited user with the password they chose.
+func (uc *InvitationUsecase) Accept(ctx context.Context, input validation.AcceptInviteInput) (*models.User, error) {
+	if err := input.ValidateAcceptInviteInput(); err != nil {
+		return nil, appErrors.ErrInvalidPayload.Wrap(err, "Validation failed")
+	}
+
+	hashed, err := utility.HashPassword(input.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &models.User{
+		FirstName: input.FirstName,
+		LastName:  input.LastName,
+		Password:  hashed,
+	}
+	if err := uc.repo.AcceptInvitation(ctx, auth.HashToken(input.Token), user); err != nil {
+		return nil, err
+	}
+
+	user.Password = ""
+	return user, nil
+}
@@ -0,0 +1,76 @@
+package usecase
+
+import (
+	"Complaingo/internal/domain/models"
+	"context"
+	"log"
+	"strings"
+
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/joomcode/errorx"
+)
+
+// GetLoginAttempts lists the login audit log for admins.
+func (uc *UserUsecase) GetLoginAttempts(ctx context.Context, filter models.LoginAuditFilter) ([]*models.LoginAttempt, error) {
+	return uc.audit.GetLoginAttempts(ctx, filter)
+}
+
+// UnlockUser lifts a lockout before it expires, e.g. once the owner of the
+// account has been reached.
+func (uc *UserUsecase) UnlockUser(ctx context.Context, id int) error {
+	user, err := uc.repo.GetUserByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	return uc.guard.Unlock(ctx, user.Email)
+}
+
+func (uc *UserUsecase) loginFailed(ctx context.Context, userID *int, email, reason string, client models.ClientInfo) {
+	locked, err := uc.guard.Fail(ctx, email, client.IP)
+	if err != nil {
+		log.Printf("failed to count failed login for %s: %v", email, err)
+	}
+	if locked {
+		log.Printf("account %s locked after too many failed logins", email)
+	}
+	uc.recordLogin(ctx, userID, email, reason, client)
+}
+
+func (uc *UserUsecase) loginSucceeded(ctx context.Context, user *models.User, client models.ClientInfo) {
+	if err := uc.guard.Succeed(ctx, user.Email); err != nil {
+		log.Printf("failed to reset login failures for %s: %v", user.Email, err)
+	}
+	uc.recordLogin(ctx, &user.ID, user.Email, models.LoginSucceeded, client)
+}
+
+// recordLogin writes the audit entry. A broken audit log must not stop
+// people from logging in, so errors are only logged.
+func (uc *UserUsecase) recordLogin(ctx context.Context, userID *int, email, reason string, client models.ClientInfo) {
+	err := uc.audit.RecordLoginAttempt(ctx, &models.LoginAttempt{
+		UserID:    userID,
+		Email:     strings.ToLower(strings.TrimSpace(email)),
+		Success:   reason == models.LoginSucceeded,
+		Reason:    reason,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+	})
+	if err != nil {
+		log.Printf("failed to record login attempt for %s: %v", email, err)
+	}
+}
+
+// checkThrottle refuses and records attempts on locked or backing off
+// accounts and addresses.
+func (uc *UserUsecase) checkThrottle(ctx context.Context, userID *int, email string, client models.ClientInfo) error {
+	err := uc.guard.Check(ctx, email, client.IP)
+	switch {
+	case err == nil:
+		return nil
+	case errorx.IsOfType(err, appErrors.ErrAccountLocked):
+		uc.recordLogin(ctx, userID, email, models.LoginLockedOut, client)
+	case errorx.IsOfType(err, appErrors.ErrTooManyRequests):
+		uc.recordLogin(ctx, userID, email, models.LoginThrottled, client)
+	}
+	return err
+}
@@ -0,0 +1,158 @@
+package usecase
+
+import (
+	"Complaingo/internal/domain/models"
+	"Complaingo/internal/repository"
+	"Complaingo/internal/validation"
+	"context"
+	"sync"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+// RoleUsecase manages roles and answers which permissions a role has.
+// Answers are cached per role. Changes made here drop the cached entry right
+// away, other instances pick them up once theirs expires.
+type RoleUsecase struct {
+	repo repository.RoleRepository
+	ttl  time.Duration
+
+	mu    sync.RWMutex
+	cache map[string]cachedPermissions
+}
+
+type cachedPermissions struct {
+	set       models.PermissionSet
+	expiresAt time.Time
+}
+
+func NewRoleUsecase(repo repository.RoleRepository, ttl time.Duration) *RoleUsecase {
+	return &RoleUsecase{
+		repo:  repo,
+		ttl:   ttl,
+		cache: make(map[string]cachedPermissions),
+	}
+}
+
+// RolePermissions returns what the role may do. Unknown roles may do nothing.
+func (uc *RoleUsecase) RolePermissions(ctx context.Context, role string) (models.PermissionSet, error) {
+	uc.mu.RLock()
+	cached, ok := uc.cache[role]
+	uc.mu.RUnlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.set, nil
+	}
+
+	perms, err := uc.repo.GetRolePermissions(ctx, role)
+	if err != nil {
+		return nil, err
+	}
+	set := models.NewPermissionSet(perms)
+
+	uc.mu.Lock()
+	uc.cache[role] = cachedPermissions{set: set, expiresAt: time.Now().Add(uc.ttl)}
+	uc.mu.Unlock()
+	return set, nil
+}
+
+func (uc *RoleUsecase) GetRoles(ctx context.Context) ([]*models.RoleDefinition, error) {
+	return uc.repo.GetRoles(ctx)
+}
+
+func (uc *RoleUsecase) GetRole(ctx context.Context, name string) (*models.RoleDefinition, error) {
+	return uc.repo.GetRole(ctx, name)
+}
+
+func (uc *RoleUsecase) GetPermissions(ctx context.Context) ([]*models.Permission, error) {
+	return uc.repo.GetPermissions(ctx)
+}
+
+func (uc *RoleUsecase) CreateRole(ctx context.Context, input validation.RoleInput) (*models.RoleDefinition, error) {
+	role, err := uc.roleFromInput(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	if err := uc.repo.CreateRole(ctx, role); err != nil {
+		return nil, err
+	}
+
+	uc.invalidate(role.Name)
+	return role, nil
+}
+
+// UpdateRole replaces the description and permissions of a role. The admin
+// role is left alone so that nobody can lock everyone out of role management.
+func (uc *RoleUsecase) UpdateRole(ctx context.Context, input validation.RoleInput) (*models.RoleDefinition, error) {
+	if input.Name == string(models.AdminRole) {
+		return nil, appErrors.ErrForbidden.New("the admin role can't be changed")
+	}
+
+	role, err := uc.roleFromInput(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	if err := uc.repo.UpdateRole(ctx, role); err != nil {
+		return nil, err
+	}
+
+	uc.invalidate(role.Name)
+	return uc.repo.GetRole(ctx, role.Name)
+}
+
+func (uc *RoleUsecase) DeleteRole(ctx context.Context, name string) error {
+	role, err := uc.repo.GetRole(ctx, name)
+	if err != nil {
+		return err
+	}
+	if role.BuiltIn {
+		return appErrors.ErrForbidden.New("built in roles can't be deleted")
+	}
+	if err := uc.repo.DeleteRole(ctx, name); err != nil {
+		return err
+	}
+
+	uc.invalidate(name)
+	return nil
+}
+
+// roleFromInput validates the role and checks its permissions against the
+// catalogue, so a typo is reported rather than silently granting nothing.
+func (uc *RoleUsecase) roleFromInput(ctx context.Context, input validation.RoleInput) (*models.RoleDefinition, error) {
+	if err := input.ValidateRoleInput(); err != nil {
+		return nil, appErrors.ErrInvalidPayload.Wrap(err, "Validation failed")
+	}
+
+	catalogue, err := uc.repo.GetPermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(catalogue))
+	for _, p := range catalogue {
+		known[p.Name] = true
+	}
+
+	perms := []string{}
+	seen := make(map[string]bool, len(input.Permissions))
+	for _, p := range input.Permissions {
+		if !known[p] {
+			return nil, appErrors.ErrInvalidPayload.New("unknown permission %q", p)
+		}
+		if !seen[p] {
+			seen[p] = true
+			perms = append(perms, p)
+		}
+	}
+
+	return &models.RoleDefinition{
+		Name:        input.Name,
+		Description: input.Description,
+		Permissions: perms,
+	}, nil
+}
+
+func (uc *RoleUsecase) invalidate(role string) {
+	uc.mu.Lock()
+	delete(uc.cache, role)
+	uc.mu.Unlock()
+}
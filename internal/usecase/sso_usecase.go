@@ -0,0 +1,263 @@
+package usecase
+
+import (
+	"Complaingo/internal/auth"
+	"Complaingo/internal/domain/models"
+	"Complaingo/internal/oidc"
+	"Complaingo/internal/repository"
+	"Complaingo/internal/utility"
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/joomcode/errorx"
+)
+
+// how long a user has to finish logging in at the provider
+const ssoFlowTTL = 10 * time.Minute
+
+// SSOUsecase logs users in through an OpenID Connect provider. Users are
+// found by their linked identity, then by email, and are otherwise created
+// on first login. Roles follow the provider's groups through roleMapping.
+type SSOUsecase struct {
+	provider    *oidc.Provider
+	users       repository.UserRepository
+	identities  repository.IdentityRepository
+	sessions    *UserUsecase
+	flows       *auth.SecretBox
+	roleMapping map[string]string
+	defaultRole string
+}
+
+func NewSSOUsecase(provider *oidc.Provider, users repository.UserRepository, identities repository.IdentityRepository,
+	sessions *UserUsecase, flows *auth.SecretBox, roleMapping map[string]string, defaultRole string) *SSOUsecase {
+	return &SSOUsecase{
+		provider:    provider,
+		users:       users,
+		identities:  identities,
+		sessions:    sessions,
+		flows:       flows,
+		roleMapping: roleMapping,
+		defaultRole: defaultRole,
+	}
+}
+
+// ssoFlow is what the callback needs to remember from the start of a login.
+// It travels encrypted in a cookie, so no server side state is needed.
+type ssoFlow struct {
+	State     string    `json:"state"`
+	Nonce     string    `json:"nonce"`
+	Verifier  string    `json:"verifier"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Begin returns the provider URL to send the browser to and the sealed flow
+// to hand back on the callback.
+func (uc *SSOUsecase) Begin(ctx context.Context) (string, string, error) {
+	state, err := oidc.RandomString(24)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := oidc.RandomString(24)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err := uc.provider.AuthCodeURL(ctx, state, nonce, challenge)
+	if err != nil {
+		return "", "", err
+	}
+
+	raw, _ := json.Marshal(ssoFlow{State: state, Nonce: nonce, Verifier: verifier, ExpiresAt: time.Now().Add(ssoFlowTTL)})
+	sealed, err := uc.flows.Seal(string(raw))
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, sealed, nil
+}
+
+// Callback finishes the login the provider redirected back from.
+func (uc *SSOUsecase) Callback(ctx context.Context, sealedFlow, state, code string, client models.ClientInfo) (*models.TokenPair, error) {
+	flow, err := uc.openFlow(sealedFlow)
+	if err != nil {
+		return nil, err
+	}
+	if state == "" || state != flow.State {
+		return nil, appErrors.ErrUnauthorized.New("login state does not match, start again")
+	}
+
+	identity, err := uc.provider.Exchange(ctx, code, flow.Verifier, flow.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := uc.resolveUser(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+	if err := uc.identities.LinkIdentity(ctx, user.ID, identity.Issuer, identity.Subject, identity.Email); err != nil {
+		return nil, err
+	}
+
+	return uc.sessions.ExternalLogin(ctx, user, client)
+}
+
+// resolveUser finds or provisions the local user and syncs their role.
+func (uc *SSOUsecase) resolveUser(ctx context.Context, identity *oidc.Identity) (*models.User, error) {
+	mapped := uc.roleFor(identity.Groups)
+
+	user, err := uc.linkedUser(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		if user, err = uc.userByEmail(ctx, identity); err != nil {
+			return nil, err
+		}
+	}
+	if user == nil {
+		return uc.provision(ctx, identity, mapped)
+	}
+
+	if mapped == "" && uc.defaultRole == "" {
+		return nil, appErrors.ErrForbidden.New("your groups do not grant access to Complaingo")
+	}
+	// the provider decides the role whenever one of the user's groups is mapped
+	if mapped != "" && mapped != user.Role {
+		log.Printf("sso: changing role of user %d from %s to %s", user.ID, user.Role, mapped)
+		if err := uc.users.UpdateRole(ctx, user.ID, mapped); err != nil {
+			return nil, err
+		}
+		user.Role = mapped
+		uc.sessions.ForgetUser(ctx, user.ID)
+	}
+	if identity.EmailVerified && !user.EmailVerified {
+		if err := uc.users.MarkEmailVerified(ctx, user.ID); err != nil {
+			return nil, err
+		}
+		user.EmailVerified = true
+		uc.sessions.ForgetUser(ctx, user.ID)
+	}
+	return user, nil
+}
+
+func (uc *SSOUsecase) linkedUser(ctx context.Context, identity *oidc.Identity) (*models.User, error) {
+	userID, err := uc.identities.GetUserIDByIdentity(ctx, identity.Issuer, identity.Subject)
+	if err != nil {
+		if errorx.IsOfType(err, appErrors.ErrUserNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return uc.users.GetUserByID(ctx, userID)
+}
+
+// userByEmail links an existing account, but only to an address the
+// provider has verified; otherwise anyone could claim any account.
+func (uc *SSOUsecase) userByEmail(ctx context.Context, identity *oidc.Identity) (*models.User, error) {
+	if identity.Email == "" {
+		return nil, appErrors.ErrForbidden.New("identity provider did not share an email address")
+	}
+	if !identity.EmailVerified {
+		return nil, appErrors.ErrForbidden.New("identity provider has not verified the email address")
+	}
+
+	found, err := uc.users.GetByEmail(ctx, identity.Email)
+	if err != nil {
+		if errorx.IsOfType(err, appErrors.ErrUserNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	// GetByEmail only loads login fields
+	return uc.users.GetUserByID(ctx, found.ID)
+}
+
+// provision creates the user on their first login. The random password
+// can't be used, these users always log in through the provider.
+func (uc *SSOUsecase) provision(ctx context.Context, identity *oidc.Identity, role string) (*models.User, error) {
+	if role == "" {
+		role = uc.defaultRole
+	}
+	if role == "" {
+		return nil, appErrors.ErrForbidden.New("your groups do not grant access to Complaingo")
+	}
+
+	random, _, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	hashed, err := utility.HashPassword(random)
+	if err != nil {
+		return nil, err
+	}
+
+	first, last := identity.GivenName, identity.FamilyName
+	if first == "" {
+		first, last, _ = strings.Cut(identity.Name, " ")
+	}
+	if first == "" {
+		first, _, _ = strings.Cut(identity.Email, "@")
+	}
+
+	user := &models.User{
+		FirstName: first,
+		LastName:  last,
+		Email:     identity.Email,
+		Password:  hashed,
+		Role:      role,
+	}
+	if err := uc.users.CreateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	if err := uc.users.MarkEmailVerified(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	user.EmailVerified = true
+
+	log.Printf("sso: provisioned user %d (%s) as %s", user.ID, user.Email, role)
+	return user, nil
+}
+
+// roleFor maps the user's groups to a role. Admin wins over anything else.
+func (uc *SSOUsecase) roleFor(groups []string) string {
+	role := ""
+	for _, g := range groups {
+		mapped, ok := uc.roleMapping[g]
+		if !ok {
+			continue
+		}
+		if mapped == string(models.AdminRole) {
+			return mapped
+		}
+		role = mapped
+	}
+	return role
+}
+
+func (uc *SSOUsecase) openFlow(sealed string) (*ssoFlow, error) {
+	if sealed == "" {
+		return nil, appErrors.ErrUnauthorized.New("login was not started here, start again")
+	}
+	raw, err := uc.flows.Open(sealed)
+	if err != nil {
+		return nil, appErrors.ErrUnauthorized.New("login state is invalid, start again")
+	}
+
+	var flow ssoFlow
+	if err := json.Unmarshal([]byte(raw), &flow); err != nil {
+		return nil, appErrors.ErrUnauthorized.New("login state is invalid, start again")
+	}
+	if time.Now().After(flow.ExpiresAt) {
+		return nil, appErrors.ErrUnauthorized.New("login took too long, start again")
+	}
+	return &flow, nil
+}
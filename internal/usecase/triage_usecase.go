@@ -0,0 +1,159 @@
+package usecase
+
+import (
+	"Complaingo/internal/ai"
+	"Complaingo/internal/cache"
+	"Complaingo/internal/domain/models"
+	"Complaingo/internal/events"
+	"Complaingo/internal/middleware"
+	"Complaingo/internal/repository"
+	"Complaingo/internal/triage"
+	"context"
+	"log"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+type TriageConfig struct {
+	Categories []string
+	// suggestions at least this confident are applied without review
+	AutoApplyThreshold float64
+}
+
+// TriageUsecase asks the model to categorise new complaints, and lets admins
+// accept or override what it suggests.
+type TriageUsecase struct {
+	repo       repository.TriageRepository
+	complaints repository.ComplaintRepository
+	provider   ai.LLMProvider
+	cache      *cache.Cache
+	cfg        TriageConfig
+}
+
+func NewTriageUsecase(repo repository.TriageRepository, complaints repository.ComplaintRepository, provider ai.LLMProvider, c *cache.Cache, cfg TriageConfig) *TriageUsecase {
+	return &TriageUsecase{
+		repo:       repo,
+		complaints: complaints,
+		provider:   provider,
+		cache:      c,
+		cfg:        cfg,
+	}
+}
+
+// HandleComplaintCreated is subscribed to events.ComplaintCreated.
+func (uc *TriageUsecase) HandleComplaintCreated(ctx context.Context, event events.Event) error {
+	payload, ok := event.Payload.(events.ComplaintCreatedPayload)
+	if !ok {
+		return appErrors.ErrInvalidPayload.New("unexpected payload %T", event.Payload)
+	}
+	return uc.Triage(ctx, payload.ComplaintID)
+}
+
+// Triage stores the model's suggestions for a complaint, applying those it
+// is confident enough about.
+func (uc *TriageUsecase) Triage(ctx context.Context, complaintID int) error {
+	complaint, err := uc.complaints.GetComplaintByID(ctx, complaintID)
+	if err != nil {
+		return err
+	}
+
+	res, err := uc.provider.Chat(ctx, triage.Request(complaint, uc.cfg.Categories))
+	if err != nil {
+		return err
+	}
+	suggestions, err := triage.Parse(res.Content, uc.cfg.Categories)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range suggestions {
+		s.Model = res.Model
+		s.Status = models.TriagePending
+		if s.Confidence >= uc.cfg.AutoApplyThreshold {
+			s.Status = models.TriageAutoApplied
+		}
+	}
+	if err := uc.repo.SaveSuggestions(ctx, complaintID, suggestions); err != nil {
+		return err
+	}
+	uc.cache.Invalidate(ctx, cache.UserComplaintsTag(complaint.UserID))
+
+	log.Printf("triaged complaint %d with %s (%d tokens)", complaintID, res.Model, res.Usage.TotalTokens)
+	return nil
+}
+
+func (uc *TriageUsecase) GetSuggestions(ctx context.Context, complaintID int) ([]*models.TriageSuggestion, error) {
+	if _, err := uc.complaints.GetComplaintByID(ctx, complaintID); err != nil {
+		return nil, err
+	}
+	return uc.repo.GetSuggestions(ctx, complaintID)
+}
+
+// Accept confirms the suggestion for field.
+func (uc *TriageUsecase) Accept(ctx context.Context, complaintID int, field string) (*models.TriageDecision, error) {
+	return uc.decide(ctx, complaintID, field, nil)
+}
+
+// Override replaces the suggestion for field with value. Overriding with the
+// suggested value counts as accepting it.
+func (uc *TriageUsecase) Override(ctx context.Context, complaintID int, field, value string) (*models.TriageDecision, error) {
+	if !isTriageField(field) {
+		return nil, appErrors.ErrInvalidPayload.New("unknown triage field %q", field)
+	}
+	normalized, ok := triage.Normalize(field, value, uc.cfg.Categories)
+	if !ok {
+		return nil, appErrors.ErrInvalidPayload.New("%q is not a valid %s", value, field)
+	}
+	return uc.decide(ctx, complaintID, field, &normalized)
+}
+
+func (uc *TriageUsecase) decide(ctx context.Context, complaintID int, field string, value *string) (*models.TriageDecision, error) {
+	if !isTriageField(field) {
+		return nil, appErrors.ErrInvalidPayload.New("unknown triage field %q", field)
+	}
+	complaint, err := uc.complaints.GetComplaintByID(ctx, complaintID)
+	if err != nil {
+		return nil, err
+	}
+	s, err := uc.repo.GetSuggestion(ctx, complaintID, field)
+	if err != nil {
+		return nil, err
+	}
+	if s.Status != models.TriagePending && s.Status != models.TriageAutoApplied {
+		return nil, appErrors.ErrConflict.New("the %s suggestion was already %s", field, s.Status)
+	}
+
+	d := &models.TriageDecision{
+		ComplaintID:    complaintID,
+		Field:          field,
+		SuggestedValue: s.Value,
+		Confidence:     s.Confidence,
+		AutoApplied:    s.Status == models.TriageAutoApplied,
+		FinalValue:     s.Value,
+		Decision:       models.TriageAccepted,
+		DecidedBy:      middleware.GetUserId(ctx),
+	}
+	if value != nil && *value != s.Value {
+		d.FinalValue = *value
+		d.Decision = models.TriageOverridden
+	}
+	if err := uc.repo.Decide(ctx, d); err != nil {
+		return nil, err
+	}
+	uc.cache.Invalidate(ctx, cache.UserComplaintsTag(complaint.UserID))
+	return d, nil
+}
+
+// GetAccuracy sums up the decisions per field.
+func (uc *TriageUsecase) GetAccuracy(ctx context.Context) ([]*models.TriageAccuracy, error) {
+	return uc.repo.GetAccuracy(ctx)
+}
+
+func isTriageField(field string) bool {
+	for _, f := range models.TriageFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
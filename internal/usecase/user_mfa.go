@@ -0,0 +1,313 @@
+package usecase
+
+import (
+	"Complaingo/internal/auth"
+	"Complaingo/internal/domain/models"
+	"Complaingo/internal/middleware"
+	"context"
+	"strings"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/joomcode/errorx"
+)
+
+const recoveryCodeCount = 10
+
+// VerifyMFA completes a login with a TOTP code or a recovery code and
+// starts the session the password alone could not.
+func (uc *UserUsecase) VerifyMFA(ctx context.Context, challengeToken, code, recoveryCode string, client models.ClientInfo) (*models.TokenPair, error) {
+	claims, userID, err := uc.parseChallenge(ctx, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Enroll {
+		return nil, appErrors.ErrForbidden.New("set up two-factor authentication first")
+	}
+
+	user, err := uc.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// codes are guessed under the same limits as passwords
+	if err := uc.checkThrottle(ctx, &user.ID, user.Email, client); err != nil {
+		return nil, err
+	}
+
+	m, err := uc.mfa.GetMFA(ctx, userID)
+	if err != nil {
+		return nil, uc.mfaLookupError(err)
+	}
+	if err := uc.checkSecondFactor(ctx, m, code, recoveryCode); err != nil {
+		if errorx.IsOfType(err, appErrors.ErrUnauthorized) {
+			uc.loginFailed(ctx, &user.ID, user.Email, models.LoginBadMFACode, client)
+		}
+		return nil, err
+	}
+
+	if err := uc.spendChallenge(ctx, claims); err != nil {
+		return nil, err
+	}
+	pair, err := uc.startSession(ctx, user, false, client)
+	if err != nil {
+		return nil, err
+	}
+	uc.loginSucceeded(ctx, user, client)
+	return pair, nil
+}
+
+// BeginMFASetup starts enrolment for the calling user.
+func (uc *UserUsecase) BeginMFASetup(ctx context.Context) (*models.MFASetup, error) {
+	return uc.setupMFA(ctx, middleware.GetUserId(ctx))
+}
+
+// ConfirmMFASetup enables 2FA for the calling user once a code from the
+// authenticator app checks out.
+func (uc *UserUsecase) ConfirmMFASetup(ctx context.Context, code string) (*models.MFAEnrollment, error) {
+	codes, err := uc.confirmMFA(ctx, middleware.GetUserId(ctx), code)
+	if err != nil {
+		return nil, err
+	}
+	return &models.MFAEnrollment{RecoveryCodes: codes}, nil
+}
+
+// BeginMFAEnrollment is BeginMFASetup for users who must enrol before their
+// first login completes; they only hold a challenge token.
+func (uc *UserUsecase) BeginMFAEnrollment(ctx context.Context, challengeToken string) (*models.MFASetup, error) {
+	_, userID, err := uc.parseChallenge(ctx, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+	return uc.setupMFA(ctx, userID)
+}
+
+// ConfirmMFAEnrollment enables 2FA and finishes the login that asked for it.
+func (uc *UserUsecase) ConfirmMFAEnrollment(ctx context.Context, challengeToken, code string, client models.ClientInfo) (*models.MFAEnrollment, error) {
+	claims, userID, err := uc.parseChallenge(ctx, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := uc.confirmMFA(ctx, userID, code)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := uc.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := uc.spendChallenge(ctx, claims); err != nil {
+		return nil, err
+	}
+	pair, err := uc.startSession(ctx, user, false, client)
+	if err != nil {
+		return nil, err
+	}
+	uc.loginSucceeded(ctx, user, client)
+
+	return &models.MFAEnrollment{RecoveryCodes: codes, Tokens: pair}, nil
+}
+
+// DisableMFA turns 2FA off for the calling user, unless their role requires it.
+func (uc *UserUsecase) DisableMFA(ctx context.Context, code, recoveryCode string) error {
+	if uc.mfaRequired(middleware.GetUserRole(ctx)) {
+		return appErrors.ErrForbidden.New("two-factor authentication is required for your role")
+	}
+
+	userID := middleware.GetUserId(ctx)
+	m, err := uc.mfa.GetMFA(ctx, userID)
+	if err != nil {
+		return uc.mfaLookupError(err)
+	}
+	if err := uc.checkSecondFactor(ctx, m, code, recoveryCode); err != nil {
+		return err
+	}
+
+	return uc.mfa.DisableMFA(ctx, userID)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of the calling user.
+func (uc *UserUsecase) RegenerateRecoveryCodes(ctx context.Context, code string) (*models.MFAEnrollment, error) {
+	userID := middleware.GetUserId(ctx)
+	m, err := uc.mfa.GetMFA(ctx, userID)
+	if err != nil {
+		return nil, uc.mfaLookupError(err)
+	}
+	if err := uc.checkSecondFactor(ctx, m, code, ""); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := uc.mfa.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return &models.MFAEnrollment{RecoveryCodes: codes}, nil
+}
+
+func (uc *UserUsecase) setupMFA(ctx context.Context, userID int) (*models.MFASetup, error) {
+	user, err := uc.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := uc.secrets.Seal(secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := uc.mfa.SaveMFASecret(ctx, userID, sealed); err != nil {
+		return nil, err
+	}
+
+	return &models.MFASetup{
+		Secret:          secret,
+		ProvisioningURI: auth.ProvisioningURI(uc.cfg.MFAIssuer, user.Email, secret),
+	}, nil
+}
+
+func (uc *UserUsecase) confirmMFA(ctx context.Context, userID int, code string) ([]string, error) {
+	m, err := uc.mfa.GetMFA(ctx, userID)
+	if err != nil {
+		return nil, uc.mfaLookupError(err)
+	}
+	if m.Enabled() {
+		return nil, appErrors.ErrInvalidPayload.New("two-factor authentication is already enabled")
+	}
+
+	secret, err := uc.secrets.Open(m.Secret)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := auth.VerifyTOTP(secret, code, time.Now(), m.LastUsedStep)
+	if !ok {
+		return nil, appErrors.ErrInvalidPayload.New("invalid verification code")
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := uc.mfa.EnableMFA(ctx, userID, step, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused
+// recovery code. Either one is spent on success.
+func (uc *UserUsecase) checkSecondFactor(ctx context.Context, m *models.MFA, code, recoveryCode string) error {
+	if !m.Enabled() {
+		return appErrors.ErrUnauthorized.New("two-factor authentication is not enabled")
+	}
+
+	if recoveryCode != "" {
+		return uc.mfa.UseRecoveryCode(ctx, m.UserID, auth.HashRecoveryCode(recoveryCode))
+	}
+
+	secret, err := uc.secrets.Open(m.Secret)
+	if err != nil {
+		return err
+	}
+	step, ok := auth.VerifyTOTP(secret, code, time.Now(), m.LastUsedStep)
+	if !ok {
+		return appErrors.ErrUnauthorized.New("invalid verification code")
+	}
+	return uc.mfa.UseTOTPStep(ctx, m.UserID, step)
+}
+
+// mfaChallenge returns a challenge when the user needs a second factor, or
+// nil when the password is enough.
+func (uc *UserUsecase) mfaChallenge(ctx context.Context, user *models.User) (*models.MFAChallenge, error) {
+	enabled, err := uc.mfaEnabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled && !uc.mfaRequired(user.Role) {
+		return nil, nil
+	}
+
+	challenge, err := uc.issuer.IssueChallenge(user.ID, !enabled, uc.cfg.MFAChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &models.MFAChallenge{
+		ChallengeToken:     challenge.Token,
+		ExpiresAt:          challenge.ExpiresAt,
+		EnrollmentRequired: !enabled,
+	}, nil
+}
+
+func (uc *UserUsecase) mfaEnabled(ctx context.Context, userID int) (bool, error) {
+	m, err := uc.mfa.GetMFA(ctx, userID)
+	if err != nil {
+		if errorx.IsOfType(err, appErrors.ErrUserNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return m.Enabled(), nil
+}
+
+func (uc *UserUsecase) mfaRequired(role string) bool {
+	for _, required := range uc.cfg.MFARequiredRoles {
+		if strings.EqualFold(required, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseChallenge verifies a challenge token that has not been spent yet.
+func (uc *UserUsecase) parseChallenge(ctx context.Context, token string) (*auth.ChallengeClaims, int, error) {
+	claims, err := uc.issuer.ParseChallenge(token)
+	if err != nil {
+		return nil, 0, err
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	spent, err := uc.denylist.IsRevoked(ctx, claims.ID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if spent {
+		return nil, 0, appErrors.ErrUnauthorized.New("challenge has already been used")
+	}
+	return claims, userID, nil
+}
+
+// spendChallenge makes a challenge single use once it led to a session.
+func (uc *UserUsecase) spendChallenge(ctx context.Context, claims *auth.ChallengeClaims) error {
+	return uc.denylist.Revoke(ctx, claims.ID, claims.ExpiresAt.Time)
+}
+
+// a missing enrolment is a client error here, not a missing user
+func (uc *UserUsecase) mfaLookupError(err error) error {
+	if errorx.IsOfType(err, appErrors.ErrUserNotFound) {
+		return appErrors.ErrInvalidPayload.New("two-factor authentication is not set up")
+	}
+	return err
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := auth.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, c := range codes {
+		hashes[i] = auth.HashRecoveryCode(c)
+	}
+	return codes, hashes, nil
+}
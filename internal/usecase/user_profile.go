@@ -0,0 +1,164 @@
+package usecase
+
+import (
+	"Complaingo/internal/domain/models"
+	"Complaingo/internal/middleware"
+	"Complaingo/internal/utility"
+	"Complaingo/internal/validation"
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+)
+
+// GetProfile returns the calling user.
+func (uc *UserUsecase) GetProfile(ctx context.Context) (*models.User, error) {
+	user, err := uc.repo.GetUserByID(ctx, middleware.GetUserId(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	user.Password = ""
+	return user, nil
+}
+
+// UpdateProfile lets users change their own name and email. A new email
+// needs the current password, since whoever controls the address can reset it.
+func (uc *UserUsecase) UpdateProfile(ctx context.Context, input validation.ProfilePatch, version int) (*models.User, error) {
+	user, err := uc.repo.GetUserByID(ctx, middleware.GetUserId(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if err := middleware.CheckVersion(version, user.Version); err != nil {
+		return nil, err
+	}
+
+	if input.Email != nil && !strings.EqualFold(strings.TrimSpace(*input.Email), user.Email) {
+		if err := utility.ComparePassword(user.Password, input.CurrentPassword); err != nil {
+			return nil, appErrors.ErrUnauthorized.New("current password is required to change the email")
+		}
+	}
+	return uc.updateProfile(ctx, user, input.UserPatch, version)
+}
+
+// updateProfile applies a partial update and returns the user as stored.
+func (uc *UserUsecase) updateProfile(ctx context.Context, user *models.User, patch models.UserPatch, version int) (*models.User, error) {
+	if patch.IsEmpty() {
+		return nil, appErrors.ErrInvalidPayload.New("nothing to update")
+	}
+	if patch.Email != nil {
+		email := strings.ToLower(strings.TrimSpace(*patch.Email))
+		patch.Email = &email
+	}
+	if err := validation.ValidateUserPatch(&patch); err != nil {
+		return nil, appErrors.ErrInvalidPayload.Wrap(err, "usecase: validation failed")
+	}
+	if user.AnonymizedAt != nil {
+		return nil, appErrors.ErrForbidden.New("anonymized users can't be changed")
+	}
+
+	if err := uc.repo.UpdateUser(ctx, user.ID, patch, version); err != nil {
+		return nil, err
+	}
+	uc.ForgetUser(ctx, user.ID)
+
+	updated, err := uc.repo.GetUserByID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if patch.Email != nil && *patch.Email != user.Email {
+		if err := uc.sendVerification(ctx, updated); err != nil {
+			log.Printf("failed to send verification email to user %d: %v", user.ID, err)
+		}
+	}
+
+	updated.Password = ""
+	return updated, nil
+}
+
+// ChangePassword checks the current password before setting a new one, then
+// ends every other session and starts a fresh one for the caller.
+func (uc *UserUsecase) ChangePassword(ctx context.Context, input validation.ChangePasswordInput, client models.ClientInfo) (*models.TokenPair, error) {
+	if err := input.ValidateChangePasswordInput(); err != nil {
+		return nil, appErrors.ErrInvalidPayload.Wrap(err, "usecase: validation failed")
+	}
+
+	user, err := uc.repo.GetUserByID(ctx, middleware.GetUserId(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if err := utility.ComparePassword(user.Password, input.CurrentPassword); err != nil {
+		return nil, appErrors.ErrUnauthorized.New("current password is wrong")
+	}
+
+	hashed, err := utility.HashPassword(input.NewPassword)
+	if err != nil {
+		return nil, err
+	}
+	if err := uc.repo.UpdatePassword(ctx, user.ID, hashed); err != nil {
+		return nil, err
+	}
+
+	// the cutoff also covers tokens issued in its own millisecond, so the
+	// caller's new session starts in the next one
+	cutoff := time.Now()
+	if err := uc.revokeSessions(ctx, user.ID, cutoff); err != nil {
+		return nil, err
+	}
+	time.Sleep(time.Until(cutoff.Truncate(time.Millisecond).Add(time.Millisecond)))
+	return uc.startSession(ctx, user, false, client)
+}
+
+// Deactivate blocks a user from logging in and ends their sessions. Their
+// data is left alone and Reactivate lets them back in.
+func (uc *UserUsecase) Deactivate(ctx context.Context, id int) error {
+	if id == middleware.GetUserId(ctx) {
+		return appErrors.ErrForbidden.New("you can't deactivate your own account")
+	}
+	if err := uc.repo.SetDeactivated(ctx, id, true); err != nil {
+		return err
+	}
+	uc.ForgetUser(ctx, id)
+	return uc.revokeSessions(ctx, id, time.Now())
+}
+
+func (uc *UserUsecase) Reactivate(ctx context.Context, id int) error {
+	if err := uc.repo.SetDeactivated(ctx, id, false); err != nil {
+		return err
+	}
+	uc.ForgetUser(ctx, id)
+	return nil
+}
+
+// Anonymize scrubs a user's personal data for good. Their complaints and
+// messages stay, attributed to a placeholder, so reports still add up.
+func (uc *UserUsecase) Anonymize(ctx context.Context, id int) error {
+	if id == middleware.GetUserId(ctx) {
+		return appErrors.ErrForbidden.New("you can't anonymize your own account")
+	}
+	if err := uc.repo.AnonymizeUser(ctx, id); err != nil {
+		return err
+	}
+	uc.ForgetUser(ctx, id)
+
+	// refresh tokens are gone with the anonymization, access tokens remain
+	return uc.denylist.RevokeUser(ctx, id, time.Now(), uc.cfg.AccessTTL)
+}
+
+// revokeSessions signs a user out everywhere. Tokens issued up to before are
+// refused, which is also what keeps deactivated users out until they expire.
+func (uc *UserUsecase) revokeSessions(ctx context.Context, userID int, before time.Time) error {
+	if err := uc.tokens.RevokeUserTokens(ctx, userID); err != nil {
+		return err
+	}
+	return uc.denylist.RevokeUser(ctx, userID, before, uc.cfg.AccessTTL)
+}
+
+func checkActive(user *models.User) error {
+	if user.DeactivatedAt != nil {
+		return appErrors.ErrForbidden.New("account is deactivated")
+	}
+	return nil
+}
@@ -1,11 +1,19 @@
 package usecase
 
 import (
+	"Complaingo/internal/auth"
+	"Complaingo/internal/cache"
 	"Complaingo/internal/domain/models"
+	"Complaingo/internal/mailer"
+	"Complaingo/internal/middleware"
 	"Complaingo/internal/repository"
 	"Complaingo/internal/utility"
 	"Complaingo/internal/validation"
 	"context"
+	"log"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/joomcode/errorx"
 
@@ -13,23 +21,75 @@ import (
 )
 
 type UserUsecase struct {
-	repo repository.UserRepository
+	repo       repository.UserRepository
+	tokens     repository.RefreshTokenRepository
+	userTokens repository.UserTokenRepository
+	mfa        repository.MFARepository
+	audit      repository.LoginAuditRepository
+	secrets    *auth.SecretBox
+	issuer     *auth.TokenService
+	denylist   auth.Denylist
+	guard      *auth.LoginGuard
+	mail       mailer.Mailer
+	cache      *cache.Cache
+	cfg        UserUsecaseConfig
 }
 
-func NewUserUsecase(r repository.UserRepository) *UserUsecase {
-	return &UserUsecase{repo: r}
+// UserUsecaseConfig holds token lifetimes and where mailed links point to.
+type UserUsecaseConfig struct {
+	AccessTTL        time.Duration
+	RefreshTTL       time.Duration
+	VerifyEmailTTL   time.Duration
+	ResetPasswordTTL time.Duration
+	AppBaseURL       string
+
+	// two-factor authentication
+	MFAIssuer        string
+	MFAChallengeTTL  time.Duration
+	MFARequiredRoles []string
 }
 
+func NewUserUsecase(r repository.UserRepository, tokens repository.RefreshTokenRepository, userTokens repository.UserTokenRepository,
+	mfa repository.MFARepository, audit repository.LoginAuditRepository, secrets *auth.SecretBox, issuer *auth.TokenService,
+	denylist auth.Denylist, guard *auth.LoginGuard, mail mailer.Mailer, c *cache.Cache, cfg UserUsecaseConfig) *UserUsecase {
+	return &UserUsecase{
+		repo:       r,
+		tokens:     tokens,
+		userTokens: userTokens,
+		mfa:        mfa,
+		audit:      audit,
+		secrets:    secrets,
+		issuer:     issuer,
+		denylist:   denylist,
+		guard:      guard,
+		mail:       mail,
+		cache:      c,
+		cfg:        cfg,
+	}
+}
+
+// LoginResponse carries either Tokens or, when a second factor is needed,
+// a Challenge to complete through the MFA endpoints.
 type LoginResponse struct {
-	Token string
-	User  *models.User
+	Tokens    *models.TokenPair
+	Challenge *models.MFAChallenge
+	User      *models.User
 }
 
+// RegisterUser is public sign up, which only ever creates plain users.
+// Everyone else joins through an invitation.
 func (uc *UserUsecase) RegisterUser(ctx context.Context, u *models.User) error {
+	if u.Role == "" {
+		u.Role = string(models.UerRole)
+	}
+
 	// validate user input
 	if err := validation.ValidateUser(u); err != nil {
 		return appErrors.ErrInvalidPayload.Wrap(err, "usecase: validation failed")
 	}
+	if u.Role != string(models.UerRole) {
+		return appErrors.ErrInvalidPayload.New("registration only creates user accounts, other roles join by invitation")
+	}
 
 	// get role_id from role name
 	roleID, err := uc.repo.GetRoleByName(ctx, u.Role)
@@ -53,6 +113,11 @@ func (uc *UserUsecase) RegisterUser(ctx context.Context, u *models.User) error {
 		}
 		return appErrors.ErrDbFailure.New("usecase: failed to register in usecase")
 	}
+
+	// the account works right away, filing complaints waits for verification
+	if err := uc.sendVerification(ctx, u); err != nil {
+		log.Printf("failed to send verification email to user %d: %v", u.ID, err)
+	}
 	return nil
 }
 
@@ -70,7 +135,15 @@ func (uc *UserUsecase) GetUserByID(ctx context.Context, id int) (*models.User, e
 		return nil, appErrors.ErrInvalidPayload.New("usecase: Invalid user id")
 	}
 
-	user, err := uc.repo.GetUserByID(ctx, id)
+	user, err := cache.GetOrLoad(ctx, uc.cache, cache.UserKey(id), func(ctx context.Context) (*models.User, error) {
+		user, err := uc.repo.GetUserByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		// the hash has no business in a cache
+		user.Password = ""
+		return user, nil
+	})
 	if err != nil {
 		if errorx.IsOfType(err, appErrors.ErrUserNotFound) {
 			return nil, appErrors.ErrUserNotFound.New("user not found in usecase")
@@ -81,29 +154,65 @@ func (uc *UserUsecase) GetUserByID(ctx context.Context, id int) (*models.User, e
 	return user, nil
 }
 
-func (uc *UserUsecase) UpdateUser(ctx context.Context, u *models.User) error {
-	if err := validation.ValidateUser(u); err != nil {
-		return appErrors.ErrDbFailure.Wrap(err, "usecase: validation failed")
+// ForgetUser drops the cached copy of a user after it changed.
+func (uc *UserUsecase) ForgetUser(ctx context.Context, id int) {
+	uc.cache.Invalidate(ctx, cache.UserTag(id))
+}
+
+// UpdateUser changes the profile of any user. Passwords are only changed by
+// their owner or through a reset link.
+func (uc *UserUsecase) UpdateUser(ctx context.Context, id int, patch models.UserPatch, version int) (*models.User, error) {
+	if err := validation.ValidateId(id); err != nil {
+		return nil, appErrors.ErrInvalidPayload.New("validation of id failed")
 	}
 
-	if err := uc.repo.UpdateUser(ctx, u); err != nil {
-		return appErrors.ErrDbFailure.Wrap(err, "failed to update user in usecase")
+	user, err := uc.repo.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	if err := middleware.CheckVersion(version, user.Version); err != nil {
+		return nil, err
+	}
+	return uc.updateProfile(ctx, user, patch, version)
 }
 
-func (uc *UserUsecase) DeleteUser(ctx context.Context, id int) error {
+// DeleteUser removes a user still at version; see middleware.IfMatch.
+func (uc *UserUsecase) DeleteUser(ctx context.Context, id int, version int) error {
 	if err := validation.ValidateId(id); err != nil {
 		return appErrors.ErrInvalidPayload.New("validation of id failed")
 	}
 
-	if err := uc.repo.DeleteUser(ctx, id); err != nil {
-		return appErrors.ErrDbFailure.Wrap(err, "usecase: failed to get user to be deleted")
+	// not found and stale versions keep their own status codes
+	if err := uc.repo.DeleteUser(ctx, id, version); err != nil {
+		return err
+	}
+	uc.ForgetUser(ctx, id)
+
+	// refresh tokens go with the user row, access tokens must be cut off
+	if err := uc.denylist.RevokeUser(ctx, id, time.Now(), uc.cfg.AccessTTL); err != nil {
+		return err
 	}
 	return nil
 }
 
-func (uc *UserUsecase) Login(ctx context.Context, email string, password string) (*LoginResponse, error) {
+// AssignRole moves a user to another role. Their access tokens still carry
+// the old role, so they are cut off and the next refresh picks up the new one.
+func (uc *UserUsecase) AssignRole(ctx context.Context, id int, role string) error {
+	if err := validation.ValidateId(id); err != nil {
+		return appErrors.ErrInvalidPayload.New("validation of id failed")
+	}
+	if _, err := uc.repo.GetRoleByName(ctx, role); err != nil {
+		return err
+	}
+
+	if err := uc.repo.UpdateRole(ctx, id, role); err != nil {
+		return err
+	}
+	uc.ForgetUser(ctx, id)
+	return uc.denylist.RevokeUser(ctx, id, time.Now(), uc.cfg.AccessTTL)
+}
+
+func (uc *UserUsecase) Login(ctx context.Context, email string, password string, client models.ClientInfo) (*LoginResponse, error) {
 	// validate email and password input
 	input := validation.LoginInput{
 		Email:    email,
@@ -114,26 +223,341 @@ func (uc *UserUsecase) Login(ctx context.Context, email string, password string)
 		return nil, appErrors.ErrInvalidPayload.Wrap(err, "usecase: Invalid login input")
 	}
 
+	// locked or backing off accounts don't get to try a password at all
+	if err := uc.checkThrottle(ctx, nil, email, client); err != nil {
+		return nil, err
+	}
+
 	// fetch user by email
 	user, err := uc.repo.GetByEmail(ctx, email)
 	if err != nil {
+		if errorx.IsOfType(err, appErrors.ErrUserNotFound) {
+			uc.loginFailed(ctx, nil, email, models.LoginUnknownEmail, client)
+		}
 		return nil, appErrors.ErrUserNotFound.Wrap(err, "usecase: login failed, email not found")
 	}
 
 	// compare hashed password with the input password
 	err = utility.ComparePassword(user.Password, password)
 	if err != nil {
+		uc.loginFailed(ctx, &user.ID, email, models.LoginBadPassword, client)
 		return nil, appErrors.ErrUnauthorized.New("Invalid credential")
 	}
 
-	// generate jwt token
-	token, err := utility.GenerateJWT(user.ID, user.Email, user.Role)
+	// only told to those who know the password
+	if err := checkActive(user); err != nil {
+		uc.recordLogin(ctx, &user.ID, email, models.LoginDeactivated, client)
+		return nil, err
+	}
+
+	// the password alone is not enough once 2FA is on or required. Failures
+	// are only cleared after the second factor, or guessing codes would be free.
+	challenge, err := uc.mfaChallenge(ctx, user)
 	if err != nil {
-		return nil, appErrors.ErrDbFailure.Wrap(err, "failed to generate jwt")
+		return nil, err
+	}
+	if challenge != nil {
+		uc.recordLogin(ctx, &user.ID, email, models.LoginMFARequired, client)
+		return &LoginResponse{
+			Challenge: challenge,
+			User:      user,
+		}, nil
 	}
 
+	pair, err := uc.startSession(ctx, user, false, client)
+	if err != nil {
+		return nil, err
+	}
+	uc.loginSucceeded(ctx, user, client)
+
 	return &LoginResponse{
-		Token: token,
-		User:  user,
+		Tokens: pair,
+		User:   user,
 	}, nil
 }
+
+// startSession issues the first token pair of a new session family.
+func (uc *UserUsecase) startSession(ctx context.Context, user *models.User, sso bool, client models.ClientInfo) (*models.TokenPair, error) {
+	if err := checkActive(user); err != nil {
+		return nil, err
+	}
+
+	familyID, err := auth.NewID()
+	if err != nil {
+		return nil, err
+	}
+
+	pair, refresh, err := uc.newTokenPair(user, familyID, sso, client)
+	if err != nil {
+		return nil, err
+	}
+	if err := uc.tokens.CreateRefreshToken(ctx, refresh); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// Refresh spends a refresh token and returns a new pair in the same session.
+// Presenting a token that was already rotated means it leaked, so the whole
+// session is revoked.
+func (uc *UserUsecase) Refresh(ctx context.Context, refreshToken string, client models.ClientInfo) (*models.TokenPair, error) {
+	current, err := uc.tokens.GetRefreshTokenByHash(ctx, auth.HashToken(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+
+	if current.RevokedAt != nil {
+		if current.ReplacedBy != nil {
+			log.Printf("refresh token reuse detected for user %d, revoking session %s", current.UserID, current.FamilyID)
+			if err := uc.tokens.RevokeFamily(ctx, current.FamilyID); err != nil {
+				return nil, err
+			}
+		}
+		return nil, appErrors.ErrUnauthorized.New("refresh token has been revoked")
+	}
+	if time.Now().After(current.ExpiresAt) {
+		return nil, appErrors.ErrUnauthorized.New("refresh token expired")
+	}
+
+	user, err := uc.repo.GetUserByID(ctx, current.UserID)
+	if err != nil {
+		if errorx.IsOfType(err, appErrors.ErrUserNotFound) {
+			return nil, appErrors.ErrUnauthorized.New("user no longer exists")
+		}
+		return nil, err
+	}
+	if user.DeactivatedAt != nil {
+		return nil, appErrors.ErrUnauthorized.New("account is deactivated")
+	}
+
+	// sessions from before 2FA became required end here. The provider is in
+	// charge of the second factor for single sign-on sessions.
+	if uc.mfaRequired(user.Role) && !current.SSO {
+		enabled, err := uc.mfaEnabled(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !enabled {
+			return nil, appErrors.ErrUnauthorized.New("two-factor authentication is required, log in again to set it up")
+		}
+	}
+
+	pair, next, err := uc.newTokenPair(user, current.FamilyID, current.SSO, client)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := uc.tokens.RotateRefreshToken(ctx, current.ID, next); err != nil {
+		// lost a race with another use of the same token, treat it as reuse
+		if errorx.IsOfType(err, appErrors.ErrUnauthorized) {
+			if revokeErr := uc.tokens.RevokeFamily(ctx, current.FamilyID); revokeErr != nil {
+				return nil, revokeErr
+			}
+		}
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+// Logout revokes the access token on the request and, when given, the
+// session the refresh token belongs to.
+func (uc *UserUsecase) Logout(ctx context.Context, refreshToken string) error {
+	if refreshToken != "" {
+		current, err := uc.tokens.GetRefreshTokenByHash(ctx, auth.HashToken(refreshToken))
+		if err != nil {
+			return err
+		}
+		if current.UserID != middleware.GetUserId(ctx) {
+			return appErrors.ErrUnauthorized.New("refresh token belongs to another user")
+		}
+		if err := uc.tokens.RevokeFamily(ctx, current.FamilyID); err != nil {
+			return err
+		}
+	}
+
+	jti, expiresAt := middleware.GetToken(ctx)
+	if jti == "" {
+		return nil
+	}
+	return uc.denylist.Revoke(ctx, jti, expiresAt)
+}
+
+// LogoutAll ends every session of the calling user on every device.
+func (uc *UserUsecase) LogoutAll(ctx context.Context) error {
+	userID := middleware.GetUserId(ctx)
+
+	if err := uc.tokens.RevokeUserTokens(ctx, userID); err != nil {
+		return err
+	}
+	return uc.denylist.RevokeUser(ctx, userID, time.Now(), uc.cfg.AccessTTL)
+}
+
+func (uc *UserUsecase) newTokenPair(user *models.User, familyID string, sso bool, client models.ClientInfo) (*models.TokenPair, *models.RefreshToken, error) {
+	access, err := uc.issuer.Issue(user.ID, user.Email, user.Role, uc.cfg.AccessTTL)
+	if err != nil {
+		return nil, nil, appErrors.ErrDbFailure.Wrap(err, "failed to generate jwt")
+	}
+
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refresh := &models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(uc.cfg.RefreshTTL),
+		UserAgent: client.UserAgent,
+		IP:        client.IP,
+		SSO:       sso,
+	}
+
+	return &models.TokenPair{
+		AccessToken:      access.Token,
+		TokenType:        "Bearer",
+		ExpiresAt:        access.ExpiresAt,
+		RefreshToken:     token,
+		RefreshExpiresAt: refresh.ExpiresAt,
+	}, refresh, nil
+}
+
+// ResendVerification mails a new verification link to the calling user.
+func (uc *UserUsecase) ResendVerification(ctx context.Context) error {
+	user, err := uc.repo.GetUserByID(ctx, middleware.GetUserId(ctx))
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return appErrors.ErrInvalidPayload.New("email is already verified")
+	}
+
+	return uc.sendVerification(ctx, user)
+}
+
+func (uc *UserUsecase) VerifyEmail(ctx context.Context, token string) error {
+	t, err := uc.userTokens.ConsumeUserToken(ctx, auth.HashToken(token), models.VerifyEmailToken)
+	if err != nil {
+		return err
+	}
+
+	if err := uc.repo.MarkEmailVerified(ctx, t.UserID); err != nil {
+		return err
+	}
+	uc.ForgetUser(ctx, t.UserID)
+	return nil
+}
+
+func (uc *UserUsecase) IsEmailVerified(ctx context.Context, userID int) (bool, error) {
+	return uc.repo.IsEmailVerified(ctx, userID)
+}
+
+// ForgotPassword mails a reset link. Unknown addresses are ignored without
+// an error, so the endpoint can't be used to find out who has an account.
+func (uc *UserUsecase) ForgotPassword(ctx context.Context, email string) error {
+	user, err := uc.repo.GetByEmail(ctx, email)
+	if err != nil {
+		if errorx.IsOfType(err, appErrors.ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := uc.issueUserToken(ctx, user.ID, models.ResetPasswordToken, uc.cfg.ResetPasswordTTL)
+	if err != nil {
+		return err
+	}
+
+	return uc.mail.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Complaingo password",
+		Body: "Someone asked to reset the password of your Complaingo account.\n\n" +
+			"Choose a new password here:\n" + uc.link("/reset-password", token) + "\n\n" +
+			"The link expires in " + uc.cfg.ResetPasswordTTL.String() + " and works once. " +
+			"If you did not ask for this, ignore this email.\n",
+	})
+}
+
+// ResetPassword sets a new password and signs the user out everywhere, since
+// whoever held the old password may still have sessions.
+func (uc *UserUsecase) ResetPassword(ctx context.Context, token, password string) error {
+	if err := validation.ValidatePassword(password); err != nil {
+		return appErrors.ErrInvalidPayload.Wrap(err, "usecase: validation failed")
+	}
+
+	t, err := uc.userTokens.ConsumeUserToken(ctx, auth.HashToken(token), models.ResetPasswordToken)
+	if err != nil {
+		return err
+	}
+
+	hashed, err := utility.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := uc.repo.UpdatePassword(ctx, t.UserID, hashed); err != nil {
+		return err
+	}
+
+	// receiving the link proves the address belongs to the user
+	if err := uc.repo.MarkEmailVerified(ctx, t.UserID); err != nil {
+		return err
+	}
+	uc.ForgetUser(ctx, t.UserID)
+
+	return uc.revokeSessions(ctx, t.UserID, time.Now())
+}
+
+func (uc *UserUsecase) sendVerification(ctx context.Context, user *models.User) error {
+	token, err := uc.issueUserToken(ctx, user.ID, models.VerifyEmailToken, uc.cfg.VerifyEmailTTL)
+	if err != nil {
+		return err
+	}
+
+	return uc.mail.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your Complaingo email address",
+		Body: "Welcome to Complaingo.\n\n" +
+			"Confirm your email address to start filing complaints:\n" + uc.link("/verify-email", token) + "\n\n" +
+			"The link expires in " + uc.cfg.VerifyEmailTTL.String() + ".\n",
+	})
+}
+
+// issueUserToken replaces any outstanding token for the purpose with a new one.
+func (uc *UserUsecase) issueUserToken(ctx context.Context, userID int, purpose models.UserTokenPurpose, ttl time.Duration) (string, error) {
+	if err := uc.userTokens.InvalidateUserTokens(ctx, userID, purpose); err != nil {
+		return "", err
+	}
+
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = uc.userTokens.CreateUserToken(ctx, &models.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (uc *UserUsecase) link(path, token string) string {
+	return strings.TrimRight(uc.cfg.AppBaseURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+// ExternalLogin starts a session for a user an identity provider has already
+// authenticated. Passwords, throttling and local 2FA don't apply.
+func (uc *UserUsecase) ExternalLogin(ctx context.Context, user *models.User, client models.ClientInfo) (*models.TokenPair, error) {
+	pair, err := uc.startSession(ctx, user, true, client)
+	if err != nil {
+		return nil, err
+	}
+	uc.loginSucceeded(ctx, user, client)
+	return pair, nil
+}
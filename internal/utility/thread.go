@@ -0,0 +1,99 @@
+package utility
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const (
+	defaultThreadDepth   = 3
+	maxThreadDepth       = 10
+	defaultRepliesLimit  = 5
+	maxRepliesLimit      = 50
+	defaultThreadPerPage = 10
+	maxThreadPerPage     = 100
+)
+
+type ThreadParamInput struct {
+	ParentID     string `json:"parent_id"`
+	Page         string `json:"page"`
+	PerPage      string `json:"per_page"`
+	MaxDepth     string `json:"max_depth"`
+	RepliesLimit string `json:"replies_limit"`
+	Order        string `json:"order"`
+}
+
+// ThreadParam controls how a message thread is loaded. Page and PerPage
+// paginate the top level of the requested subtree (root messages, or the
+// direct replies of ParentID), RepliesLimit caps the replies loaded under
+// every nested message and MaxDepth stops the recursion.
+type ThreadParam struct {
+	ParentID     *int   `json:"parent_id"`
+	Page         int    `json:"page"`
+	PerPage      int    `json:"per_page"`
+	MaxDepth     int    `json:"max_depth"`
+	RepliesLimit int    `json:"replies_limit"`
+	Order        string `json:"order"`
+}
+
+func ExtractThreadParam(in ThreadParamInput) (ThreadParam, error) {
+	param := ThreadParam{
+		Page:         1,
+		PerPage:      defaultThreadPerPage,
+		MaxDepth:     defaultThreadDepth,
+		RepliesLimit: defaultRepliesLimit,
+		Order:        "asc",
+	}
+
+	if in.ParentID != "" {
+		parentID, err := strconv.Atoi(in.ParentID)
+		if err != nil || parentID <= 0 {
+			return ThreadParam{}, fmt.Errorf("invalid parent_id")
+		}
+		param.ParentID = &parentID
+	}
+
+	var err error
+	if param.Page, err = parseBounded(in.Page, param.Page, 1, 0); err != nil {
+		return ThreadParam{}, fmt.Errorf("invalid page: %w", err)
+	}
+	if param.PerPage, err = parseBounded(in.PerPage, param.PerPage, 1, maxThreadPerPage); err != nil {
+		return ThreadParam{}, fmt.Errorf("invalid per_page: %w", err)
+	}
+	if param.MaxDepth, err = parseBounded(in.MaxDepth, param.MaxDepth, 0, maxThreadDepth); err != nil {
+		return ThreadParam{}, fmt.Errorf("invalid max_depth: %w", err)
+	}
+	if param.RepliesLimit, err = parseBounded(in.RepliesLimit, param.RepliesLimit, 0, maxRepliesLimit); err != nil {
+		return ThreadParam{}, fmt.Errorf("invalid replies_limit: %w", err)
+	}
+
+	switch in.Order {
+	case "":
+	case "asc", "desc":
+		param.Order = in.Order
+	default:
+		return ThreadParam{}, fmt.Errorf("invalid order: must be 'asc' or 'desc'")
+	}
+
+	return param, nil
+}
+
+// parseBounded parses value as an int in [min, max], falling back to def
+// when value is empty. A max of 0 means no upper bound.
+func parseBounded(value string, def, min, max int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if n < min {
+		return 0, fmt.Errorf("must be at least %d", min)
+	}
+	if max > 0 && n > max {
+		return 0, fmt.Errorf("must be at most %d", max)
+	}
+	return n, nil
+}
@@ -0,0 +1,50 @@
+package utility
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UpdateBuilder writes an UPDATE statement touching only the columns that
+// were set, for partial updates. Column names are never user input.
+type UpdateBuilder struct {
+	table string
+	sets  []string
+	args  []any
+}
+
+func NewUpdateBuilder(table string) *UpdateBuilder {
+	return &UpdateBuilder{table: table}
+}
+
+// Arg adds a query argument and returns its placeholder.
+func (b *UpdateBuilder) Arg(value any) string {
+	b.args = append(b.args, value)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+// Set assigns value to column and returns the placeholder of the value.
+func (b *UpdateBuilder) Set(column string, value any) string {
+	placeholder := b.Arg(value)
+	b.sets = append(b.sets, column+"="+placeholder)
+	return placeholder
+}
+
+// SetExpr adds an assignment written out by the caller, e.g. "updated_at=NOW()".
+func (b *UpdateBuilder) SetExpr(expr string) {
+	b.sets = append(b.sets, expr)
+}
+
+func (b *UpdateBuilder) Empty() bool {
+	return len(b.sets) == 0
+}
+
+// SQL returns the statement up to the WHERE clause, which the caller appends
+// using Arg for its values.
+func (b *UpdateBuilder) SQL() string {
+	return "UPDATE " + b.table + " SET " + strings.Join(b.sets, ", ")
+}
+
+func (b *UpdateBuilder) Args() []any {
+	return b.args
+}
@@ -1,12 +1,8 @@
 package utility
 
 import (
-	"time"
-
-	"Complaingo/config"
 	appErrors "Complaingo/internal/errors"
 
-	"github.com/golang-jwt/jwt"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -21,54 +17,3 @@ func HashPassword(password string) (string, error) {
 func ComparePassword(hashed, plain string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hashed), []byte(plain))
 }
-
-func GenerateJWT(userID int, email string, role string) (string, error) {
-	cfg := config.LoadConfig()
-
-	claims := jwt.MapClaims{
-		"user_id": userID,
-		"email":   email,
-		"role":    role,
-		"exp":     time.Now().Add(24 * time.Hour).Unix(),
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signed, err := token.SignedString([]byte(cfg.JWTSecret))
-	if err != nil {
-		return "", appErrors.ErrUnauthorized.Wrap(err, "Failed to sign JWT token")
-	}
-
-	return signed, nil
-
-}
-
-func ValidateToken(tokenStr string) (jwt.MapClaims, error) {
-	cfg := config.LoadConfig()
-
-	//Decode/validateit
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, appErrors.ErrUnauthorized.New("unexpected signing method")
-		}
-		return []byte(cfg.JWTSecret), nil
-	})
-	// Check for parsing error or invalid token
-	if err != nil || !token.Valid {
-		return nil, appErrors.ErrUnauthorized.Wrap(err, "Invalid or expired token")
-	}
-
-	// Safe type assertion for claims
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return nil, appErrors.ErrUnauthorized.New("token claim not ok")
-	}
-
-	// Explicit expiration check
-	exp, ok := claims["exp"].(float64)
-	if !ok || time.Unix(int64(exp), 0).Before(time.Now()) {
-		return nil, appErrors.ErrUnauthorized.New("token expired")
-	}
-
-	return claims, nil
-
-}
@@ -2,6 +2,7 @@ package validation
 
 import (
 	"Complaingo/internal/domain/models"
+	"regexp"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/go-ozzo/ozzo-validation/v4/is"
@@ -13,7 +14,7 @@ func ValidateUser(u *models.User) error {
 		validation.Field(&u.LastName, validation.Required),
 		validation.Field(&u.Email, validation.Required, is.Email),
 		validation.Field(&u.Password, validation.Required, validation.Length(6, 100)),
-		validation.Field(&u.Role, validation.Required, validation.In("admin", "user")),
+		validation.Field(&u.Role, validation.Required, roleName),
 	)
 }
 
@@ -35,3 +36,236 @@ func (l LoginInput) ValidateLoginInput() error {
 		validation.Field(&l.Password, validation.Required, validation.Length(6, 100)),
 	)
 }
+
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (r RefreshInput) ValidateRefreshInput() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.RefreshToken, validation.Required, validation.Length(20, 200)),
+	)
+}
+
+func ValidatePassword(password string) error {
+	return validation.Validate(password, validation.Required, validation.Length(6, 100))
+}
+
+// ValidateUserPatch only checks the fields that are present.
+func ValidateUserPatch(p *models.UserPatch) error {
+	return validation.ValidateStruct(p,
+		validation.Field(&p.FirstName, validation.NilOrNotEmpty, validation.Length(1, 100)),
+		validation.Field(&p.LastName, validation.NilOrNotEmpty, validation.Length(1, 100)),
+		validation.Field(&p.Email, validation.NilOrNotEmpty, is.Email),
+	)
+}
+
+// ProfilePatch is what users may change about themselves. Changing the
+// email needs CurrentPassword.
+type ProfilePatch struct {
+	models.UserPatch
+	CurrentPassword string `json:"current_password"`
+}
+
+func ValidateComplaintPatch(p *models.ComplaintPatch) error {
+	return validation.ValidateStruct(p,
+		validation.Field(&p.Subject, validation.NilOrNotEmpty, validation.Length(1, 200)),
+		validation.Field(&p.Message, validation.NilOrNotEmpty, validation.Length(1, 10000)),
+	)
+}
+
+var fileName = validation.Match(regexp.MustCompile(`^[^/\\\x00]+$`)).Error("must not contain slashes")
+
+func ValidateDocumentPatch(p *models.DocumentPatch) error {
+	return validation.ValidateStruct(p,
+		validation.Field(&p.FileName, validation.NilOrNotEmpty, validation.Length(1, 255), fileName),
+	)
+}
+
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+func (c ChangePasswordInput) ValidateChangePasswordInput() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.CurrentPassword, validation.Required),
+		validation.Field(&c.NewPassword, validation.Required, validation.Length(6, 100)),
+	)
+}
+
+type EmailInput struct {
+	Email string `json:"email"`
+}
+
+func (e EmailInput) ValidateEmailInput() error {
+	return validation.ValidateStruct(&e,
+		validation.Field(&e.Email, validation.Required, is.Email),
+	)
+}
+
+type TokenInput struct {
+	Token string `json:"token"`
+}
+
+func (t TokenInput) ValidateTokenInput() error {
+	return validation.ValidateStruct(&t,
+		validation.Field(&t.Token, validation.Required, validation.Length(20, 200)),
+	)
+}
+
+type ResetPasswordInput struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (r ResetPasswordInput) ValidateResetPasswordInput() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Token, validation.Required, validation.Length(20, 200)),
+		validation.Field(&r.Password, validation.Required, validation.Length(6, 100)),
+	)
+}
+
+var totpCode = validation.Match(regexp.MustCompile(`^[0-9]{6}$`)).Error("must be a 6 digit code")
+
+type MFACodeInput struct {
+	Code string `json:"code"`
+}
+
+func (m MFACodeInput) ValidateMFACodeInput() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Code, validation.Required, totpCode),
+	)
+}
+
+// SecondFactorInput takes either a TOTP code or a recovery code.
+type SecondFactorInput struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+func (s SecondFactorInput) ValidateSecondFactorInput() error {
+	return validation.ValidateStruct(&s,
+		validation.Field(&s.Code, validation.When(s.RecoveryCode == "", validation.Required).Else(validation.Empty), totpCode),
+		validation.Field(&s.RecoveryCode, validation.Length(10, 20)),
+	)
+}
+
+type MFAChallengeInput struct {
+	ChallengeToken string `json:"challenge_token"`
+}
+
+func (m MFAChallengeInput) ValidateMFAChallengeInput() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.ChallengeToken, validation.Required),
+	)
+}
+
+type MFAVerifyInput struct {
+	ChallengeToken string `json:"challenge_token"`
+	SecondFactorInput
+}
+
+func (m MFAVerifyInput) ValidateMFAVerifyInput() error {
+	if err := (MFAChallengeInput{ChallengeToken: m.ChallengeToken}).ValidateMFAChallengeInput(); err != nil {
+		return err
+	}
+	return m.SecondFactorInput.ValidateSecondFactorInput()
+}
+
+type MFAEnrollInput struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+func (m MFAEnrollInput) ValidateMFAEnrollInput() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.ChallengeToken, validation.Required),
+		validation.Field(&m.Code, validation.Required, totpCode),
+	)
+}
+
+var roleName = validation.Match(regexp.MustCompile(`^[a-z][a-z0-9_-]{1,49}$`)).Error("must be lowercase letters, digits, - or _")
+
+type RoleInput struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+func (r RoleInput) ValidateRoleInput() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Name, validation.Required, roleName),
+		validation.Field(&r.Description, validation.Length(0, 200)),
+	)
+}
+
+type RoleAssignInput struct {
+	Role string `json:"role"`
+}
+
+func (r RoleAssignInput) ValidateRoleAssignInput() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Role, validation.Required, roleName),
+	)
+}
+
+type InviteInput struct {
+	Email          string `json:"email"`
+	Role           string `json:"role"`
+	ExpiresInHours int    `json:"expires_in_hours"`
+}
+
+func (i InviteInput) ValidateInviteInput() error {
+	return validation.ValidateStruct(&i,
+		validation.Field(&i.Email, validation.Required, is.Email),
+		validation.Field(&i.Role, validation.Required, roleName),
+		validation.Field(&i.ExpiresInHours, validation.Min(0), validation.Max(24*30)),
+	)
+}
+
+type AcceptInviteInput struct {
+	Token     string `json:"token"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Password  string `json:"password"`
+}
+
+func (a AcceptInviteInput) ValidateAcceptInviteInput() error {
+	return validation.ValidateStruct(&a,
+		validation.Field(&a.Token, validation.Required, validation.Length(20, 200)),
+		validation.Field(&a.FirstName, validation.Required),
+		validation.Field(&a.LastName, validation.Required),
+		validation.Field(&a.Password, validation.Required, validation.Length(6, 100)),
+	)
+}
+
+type APIKeyInput struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	UserID        int      `json:"user_id"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+func (a APIKeyInput) ValidateAPIKeyInput() error {
+	return validation.ValidateStruct(&a,
+		validation.Field(&a.Name, validation.Required, validation.Length(1, 100)),
+		validation.Field(&a.Scopes, validation.Required),
+		validation.Field(&a.UserID, validation.Min(0)),
+		validation.Field(&a.ExpiresInDays, validation.Min(0), validation.Max(365)),
+	)
+}
+
+type KnowledgeEntryInput struct {
+	Kind  string `json:"kind"`
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+func (k KnowledgeEntryInput) ValidateKnowledgeEntryInput() error {
+	return validation.ValidateStruct(&k,
+		validation.Field(&k.Kind, validation.Required, validation.In(models.KnowledgeCannedResponse, models.KnowledgeArticle)),
+		validation.Field(&k.Title, validation.Required, validation.Length(1, 200)),
+		validation.Field(&k.Body, validation.Required, validation.Length(1, 10000)),
+	)
+}
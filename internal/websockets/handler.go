@@ -24,7 +24,8 @@ type WebsocketHandler struct {
 type Client struct {
 	Conn   *websocket.Conn
 	UserID int
-	Role   string
+	// whether the user handles every complaint, and so gets what is sent to admins
+	ReadsAny bool
 }
 
 // channel hub struct--truck who's in what channel
@@ -138,14 +139,14 @@ func unregisterClient(client *Client) {
 	clients[client.UserID] = newClientsList
 }
 
-// send message to all admins
+// send message to all admins, i.e. users who may read any complaint
 func SendToAdmins(message any) {
 	mutex.RLock()
 	defer mutex.RUnlock()
 
 	for _, list := range clients {
 		for _, c := range list {
-			if c.Role == "admin" {
+			if c.ReadsAny {
 				c.Conn.WriteJSON(message)
 			}
 		}
@@ -176,11 +177,11 @@ func (h *WebsocketHandler) HandleWebsocket(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// extract id and role from middleware
+	// extract id and permissions from middleware
 	userID := middleware.GetUserId(r.Context())
-	role := middleware.GetUserRole(r.Context())
+	readsAny := middleware.HasPermission(r.Context(), models.PermComplaintReadAny)
 
-	client := &Client{Conn: conn, UserID: userID, Role: role}
+	client := &Client{Conn: conn, UserID: userID, ReadsAny: readsAny}
 
 	// add client to the global list
 	registerClient(client)
@@ -0,0 +1,193 @@
+package tests
+
+import (
+	"Complaingo/internal/ai"
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/joomcode/errorx"
+	"github.com/stretchr/testify/assert"
+)
+
+func testOpenAIProvider(url string) *ai.OpenAIProvider {
+	return ai.NewOpenAIProvider(ai.Config{
+		BaseURL:      url,
+		APIKey:       "test-key",
+		ChatModel:    "test-model",
+		Timeout:      time.Second,
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+	})
+}
+
+func TestOpenAIProviderChat(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer test-key", r.Header.Get("Authorization"))
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		assert.Equal(t, "test-model", body["model"])
+
+		// 1, the first attempt fails and is retried
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"model":"test-model","choices":[{"message":{"role":"assistant","content":"hi there"}}],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`)
+	}))
+	defer srv.Close()
+
+	res, err := testOpenAIProvider(srv.URL).Chat(context.Background(), ai.ChatRequest{Messages: []ai.Message{{Role: ai.RoleUser, Content: "hello"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Equal(t, "hi there", res.Content)
+	assert.Equal(t, 5, res.Usage.TotalTokens)
+}
+
+func TestOpenAIProviderErrors(t *testing.T) {
+	var calls atomic.Int32
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			fmt.Fprint(w, `{"error":{"message":"slow down"}}`)
+			return
+		}
+		fmt.Fprint(w, `not json`)
+	}))
+	defer srv.Close()
+	provider := testOpenAIProvider(srv.URL)
+	req := ai.ChatRequest{Messages: []ai.Message{{Role: ai.RoleUser, Content: "hello"}}}
+
+	// 1, a response that isn't json is an error, not an empty answer
+	_, err := provider.Chat(context.Background(), req)
+	assert.True(t, errorx.IsOfType(err, appErrors.ErrUpstreamFailure))
+	assert.Equal(t, int32(1), calls.Load())
+
+	// 2, rate limits are retried, then reported as such
+	status = http.StatusTooManyRequests
+	_, err = provider.Chat(context.Background(), req)
+	assert.True(t, errorx.IsOfType(err, appErrors.ErrTooManyRequests))
+	assert.Contains(t, err.Error(), "slow down")
+	assert.Equal(t, int32(4), calls.Load())
+
+	// 3, client errors are not retried
+	status = http.StatusBadRequest
+	_, err = provider.Chat(context.Background(), req)
+	assert.True(t, errorx.IsOfType(err, appErrors.ErrUpstreamFailure))
+	assert.Equal(t, int32(5), calls.Load())
+}
+
+func TestOpenAIProviderStreamAndEmbed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/embeddings" {
+			// out of order, as the api allows
+			fmt.Fprint(w, `{"model":"emb","data":[{"index":1,"embedding":[0,1]},{"index":0,"embedding":[1,0]}],"usage":{"prompt_tokens":2,"total_tokens":2}}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, part := range []string{"Hel", "lo"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", part)
+		}
+		fmt.Fprint(w, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":1,\"completion_tokens\":2,\"total_tokens\":3}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer srv.Close()
+	provider := testOpenAIProvider(srv.URL)
+
+	var deltas []string
+	res, err := provider.ChatStream(context.Background(), ai.ChatRequest{Messages: []ai.Message{{Role: ai.RoleUser, Content: "hi"}}}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Hel", "lo"}, deltas)
+	assert.Equal(t, "Hello", res.Content)
+	assert.Equal(t, 3, res.Usage.TotalTokens)
+
+	emb, err := provider.Embed(context.Background(), []string{"a", "b"})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]float64{{1, 0}, {0, 1}}, emb.Vectors)
+}
+
+func TestMockProviderIsDeterministic(t *testing.T) {
+	ctx := context.Background()
+	mock := ai.NewMockProvider()
+	req := ai.ChatRequest{Messages: []ai.Message{{Role: ai.RoleSystem, Content: "be nice"}, {Role: ai.RoleUser, Content: "Where is my parcel?"}}}
+
+	first, _ := mock.Chat(ctx, req)
+	second, _ := mock.Chat(ctx, req)
+	assert.Equal(t, first, second)
+	assert.Equal(t, "Mock answer to: Where is my parcel?", first.Content)
+
+	var streamed strings.Builder
+	res, err := mock.ChatStream(ctx, req, func(delta string) error {
+		streamed.WriteString(delta)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, first.Content, streamed.String())
+	assert.Equal(t, first.Content, res.Content)
+
+	// texts sharing words are closer than unrelated ones
+	emb, _ := mock.Embed(ctx, []string{"late parcel delivery", "parcel delivery was late", "billing invoice error"})
+	dot := func(a, b []float64) (sum float64) {
+		for i := range a {
+			sum += a[i] * b[i]
+		}
+		return sum
+	}
+	assert.Greater(t, dot(emb.Vectors[0], emb.Vectors[1]), dot(emb.Vectors[0], emb.Vectors[2]))
+}
+
+func TestAskAIWithMockProvider(t *testing.T) {
+	_, token := createTestUser(t)
+
+	// 1, a plain answer
+	resp := postJSON(t, "/ask-ai", token, map[string]string{"prompt": "How do I file a complaint?"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	answer := decodeData[map[string]any](t, resp)
+	assert.Equal(t, "Mock answer to: How do I file a complaint?", answer["answer"])
+
+	// 2, an empty prompt is rejected
+	resp = postJSON(t, "/ask-ai", token, map[string]string{"prompt": " "})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+
+	// 3, streamed as server-sent events
+	req := authorized(t, "POST", "/ask-ai", token)
+	req.Body = io.NopCloser(strings.NewReader(`{"prompt":"Stream this"}`))
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	var streamed strings.Builder
+	events := bufio.NewScanner(resp.Body)
+	for events.Scan() {
+		data, ok := strings.CutPrefix(events.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var chunk map[string]any
+		json.Unmarshal([]byte(data), &chunk)
+		if delta, ok := chunk["delta"].(string); ok {
+			streamed.WriteString(delta)
+		}
+	}
+	assert.Equal(t, "Mock answer to: Stream this", streamed.String())
+}
@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"Complaingo/internal/domain/models"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func withAPIKey(t *testing.T, method, path, key string, payload any) int {
+	var body bytes.Buffer
+	if payload != nil {
+		assert.NoError(t, json.NewEncoder(&body).Encode(payload))
+	}
+	req, err := http.NewRequest(method, testServer.URL+path, &body)
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "ApiKey "+key)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestAPIKeys(t *testing.T) {
+	admin := getTestJWT(1, "admin")
+	crmUser, _ := createTestUser(t)
+
+	// 1, admins issue a key acting as a service user; the key is shown once
+	resp := postJSON(t, "/api-keys", admin, map[string]any{
+		"name": "crm", "user_id": crmUser, "expires_in_days": 30,
+		"scopes": []string{models.PermComplaintCreate, models.PermComplaintReadOwn},
+	})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	created := decodeData[models.CreatedAPIKey](t, resp)
+	assert.Contains(t, created.Key, created.Prefix)
+	assert.Nil(t, created.LastUsedAt)
+
+	// 2, the key can do what its scopes allow, and nothing else
+	complaint := map[string]any{"subject": "From the CRM", "message": "Customer called", "status": "Created"}
+	assert.Equal(t, http.StatusCreated, withAPIKey(t, "POST", "/complaints", created.Key, complaint))
+	assert.Equal(t, http.StatusOK, withAPIKey(t, "GET", fmt.Sprintf("/complaints/user/%d", crmUser), created.Key, nil))
+	assert.Equal(t, http.StatusForbidden, withAPIKey(t, "GET", "/users", created.Key, nil))
+	assert.Equal(t, http.StatusForbidden, withAPIKey(t, "POST", "/auth/logout-all", created.Key, nil))
+
+	resp, err := http.DefaultClient.Do(authorized(t, "GET", "/api-keys", admin))
+	assert.NoError(t, err)
+	for _, k := range decodeData[[]models.APIKey](t, resp) {
+		if k.ID == created.ID {
+			assert.NotNil(t, k.LastUsedAt)
+		}
+	}
+
+	// 3, scopes are limited to what the owner holds and to resource permissions
+	resp = postJSON(t, "/api-keys", admin, map[string]any{"name": "bad", "user_id": crmUser, "scopes": []string{models.PermUserDelete}})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = postJSON(t, "/api-keys", admin, map[string]any{"name": "bad", "scopes": []string{models.PermRoleManage}})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+
+	// 4, unknown and revoked keys are refused
+	assert.Equal(t, http.StatusUnauthorized, withAPIKey(t, "GET", "/users", "cgk_not-a-real-key", nil))
+	assert.Equal(t, http.StatusOK, deleteWithToken(t, fmt.Sprintf("/api-keys/%d", created.ID), admin))
+	assert.Equal(t, http.StatusUnauthorized, withAPIKey(t, "POST", "/complaints", created.Key, complaint))
+}
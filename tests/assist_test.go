@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"Complaingo/internal/ai"
+	"Complaingo/internal/assist"
+	"Complaingo/internal/domain/models"
+	"Complaingo/internal/usecase"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssistThreadText(t *testing.T) {
+	complaint := &models.Complaints{ID: 1, UserID: 7, Subject: "Broken blender", Message: "It arrived\nbroken.", Status: "Created"}
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	thread := assist.NewThread(complaint, []*models.ComplaintMessages{
+		{ID: 1, SenderID: 7, Message: "Any news?", CreatedAt: at},
+		{ID: 2, SenderID: 3, Message: "We are on it.", CreatedAt: at.Add(time.Hour)},
+	})
+
+	text := thread.Text()
+	assert.Contains(t, text, "Complaint: It arrived broken.")
+	assert.Contains(t, text, "[customer 2024-05-01T10:00:00Z] Any news?\n[agent 2024-05-01T11:00:00Z] We are on it.")
+
+	// 1, long threads keep their latest messages
+	for i := 0; i < 300; i++ {
+		thread.Messages = append(thread.Messages, assist.Message{From: "customer", Text: strings.Repeat("still waiting ", 5), At: at})
+	}
+	text = thread.Text()
+	assert.LessOrEqual(t, len(text), 12000)
+	assert.Contains(t, text, "earlier messages left out")
+	assert.NotContains(t, text, "Any news?")
+}
+
+func TestAssistRankAndMockReply(t *testing.T) {
+	mock := ai.NewMockProvider()
+	entries := []*models.KnowledgeEntry{
+		{ID: 1, Kind: models.KnowledgeCannedResponse, Title: "Password reset", Body: "Use the forgot password link to reset your password."},
+		{ID: 2, Kind: models.KnowledgeCannedResponse, Title: "Refund issued", Body: "We are sorry your order arrived damaged. We issued a full refund."},
+		{ID: 3, Kind: models.KnowledgeArticle, Title: "Refund policy", Body: "Damaged orders get a full refund within 5 days."},
+	}
+	var texts []string
+	for _, e := range entries {
+		texts = append(texts, assist.EntryText(e))
+	}
+	res, err := mock.Embed(context.Background(), texts)
+	assert.NoError(t, err)
+	for i, e := range entries {
+		e.Embedding = res.Vectors[i]
+	}
+
+	thread := assist.NewThread(&models.Complaints{Subject: "Damaged order", Message: "My order arrived damaged, I want a refund"}, nil)
+	query, err := mock.Embed(context.Background(), []string{thread.Query()})
+	assert.NoError(t, err)
+
+	sources := assist.Rank(query.Vectors[0], entries)
+	if assert.NotEmpty(t, sources) {
+		assert.Equal(t, 2, sources[0].ID)
+	}
+	for _, s := range sources {
+		assert.NotEqual(t, 1, s.ID)
+	}
+
+	// the mock drafts its reply from the best canned response
+	reply := assist.MockReply(assist.ReplyRequest(thread, sources))
+	assert.Contains(t, reply, "We issued a full refund.")
+	assert.Contains(t, assist.MockReply(assist.ReplyRequest(thread, nil)), `"Damaged order"`)
+}
+
+func TestComplaintAssist(t *testing.T) {
+	_, token := createTestUser(t)
+	_, admin := createAdminUser(t)
+
+	for _, entry := range []map[string]string{
+		{"kind": "canned_response", "title": "Password reset", "body": "Use the forgot password link to reset your password."},
+		{"kind": "canned_response", "title": "Refund issued", "body": "We are sorry your order arrived damaged. We issued a full refund."},
+		{"kind": "article", "title": "Refund policy", "body": "Damaged orders get a full refund within 5 days."},
+	} {
+		resp := postJSON(t, "/knowledge", admin, entry)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		resp.Body.Close()
+	}
+	resp := postJSON(t, "/knowledge", admin, map[string]string{"kind": "faq", "title": "x", "body": "y"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+	resp = postJSON(t, "/knowledge", token, map[string]string{"kind": "article", "title": "x", "body": "y"})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = postJSON(t, "/complaints", token, map[string]string{
+		"subject": "Damaged order", "message": "My order arrived damaged, I want a refund", "status": "Created",
+	})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	complaint := decodeData[models.Complaints](t, resp)
+	path := fmt.Sprintf("/complaints/%d", complaint.ID)
+
+	resp = postJSON(t, path+"/messages", token, map[string]string{"message": "Any news on my refund?"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp.Body.Close()
+
+	// 1, the summary covers the thread and is cached until it changes
+	resp = postJSON(t, path+"/ai/summary", token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	summary := decodeData[usecase.AssistResult](t, resp)
+	assert.Contains(t, summary.Text, `"Damaged order"`)
+	assert.Contains(t, summary.Text, "Messages in the thread: 1,")
+	assert.False(t, summary.Cached)
+	assert.Positive(t, summary.Usage.TotalTokens)
+
+	resp = postJSON(t, path+"/ai/summary", admin, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	again := decodeData[usecase.AssistResult](t, resp)
+	assert.True(t, again.Cached)
+	assert.Equal(t, summary.Text, again.Text)
+
+	resp = postJSON(t, path+"/messages", admin, map[string]string{"message": "We are checking with the warehouse."})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp.Body.Close()
+	resp = postJSON(t, path+"/ai/summary", admin, nil)
+	summary = decodeData[usecase.AssistResult](t, resp)
+	assert.False(t, summary.Cached)
+	assert.Contains(t, summary.Text, "the latest from the agent")
+
+	// 2, replies draw on the closest canned response and articles
+	resp = postJSON(t, path+"/ai/suggest-reply", admin, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	reply := decodeData[usecase.AssistResult](t, resp)
+	assert.Contains(t, reply.Text, "We issued a full refund.")
+	var titles []string
+	for _, s := range reply.Sources {
+		titles = append(titles, s.Title)
+	}
+	assert.Contains(t, titles, "Refund issued")
+	assert.Contains(t, titles, "Refund policy")
+	assert.NotContains(t, titles, "Password reset")
+
+	// 3, only the owner and admins get to see the thread
+	_, other := createTestUser(t)
+	resp = postJSON(t, path+"/ai/summary", other, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp.Body.Close()
+	resp = postJSON(t, path+"/ai/suggest-reply", other, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp.Body.Close()
+
+	// 4, every request to the model is accounted for
+	resp, err := http.DefaultClient.Do(authorized(t, "GET", "/admin/ai/usage", admin))
+	assert.NoError(t, err)
+	requests := map[string]int{}
+	for _, u := range decodeData[[]models.AIUsageSummary](t, resp) {
+		requests[u.Feature] += u.Requests
+		assert.Positive(t, u.TotalTokens)
+	}
+	assert.Equal(t, 2, requests[assist.SummaryPurpose])
+	// the embeddings, then the reply
+	assert.Equal(t, 2, requests[assist.ReplyPurpose])
+	assert.Equal(t, http.StatusForbidden, getWithToken(t, "/admin/ai/usage", token))
+}
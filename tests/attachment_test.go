@@ -0,0 +1,205 @@
+package tests
+
+import (
+	"Complaingo/internal/domain/models"
+	"Complaingo/internal/scanner"
+	"Complaingo/testutils"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testFile struct {
+	name    string
+	content []byte
+}
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+// postMultipart sends fields and files, every file as a "file" part.
+func postMultipart(t *testing.T, path, token string, fields map[string]string, files ...testFile) *http.Response {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for k, v := range fields {
+		assert.NoError(t, form.WriteField(k, v))
+	}
+	for _, f := range files {
+		part, err := form.CreateFormFile("file", f.name)
+		assert.NoError(t, err)
+		part.Write(f.content)
+	}
+	assert.NoError(t, form.Close())
+
+	req, err := http.NewRequest("POST", testServer.URL+path, &body)
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	return resp
+}
+
+func createComplaint(t *testing.T, token string) int {
+	resp := postJSON(t, "/complaints", token, map[string]string{"subject": "Attachments", "message": "See the files", "status": "Created"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	return decodeData[models.Complaints](t, resp).ID
+}
+
+func listMessages(t *testing.T, complaintID int, token string) []*models.ComplaintMessages {
+	resp, err := http.DefaultClient.Do(authorized(t, "GET", fmt.Sprintf("/complaints/%d/messages", complaintID), token))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	return decodeData[[]*models.ComplaintMessages](t, resp)
+}
+
+func download(t *testing.T, url string) (int, []byte) {
+	resp, err := http.Get(testServer.URL + url)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	content, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, content
+}
+
+func TestReplyWithAttachments(t *testing.T) {
+	_, token := createTestUser(t)
+	complaintID := createComplaint(t, token)
+	path := fmt.Sprintf("/complaints/%d/reply", complaintID)
+
+	resp := postMultipart(t, path, token, map[string]string{"message": "Two files"},
+		testFile{"notes.txt", []byte("the receipt number is 42")},
+		testFile{"../photo.png", pngHeader},
+	)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	reply := decodeData[models.ComplaintMessages](t, resp)
+	assert.Len(t, reply.Attachments, 2)
+
+	// 1, the reply is listed with both files, released from quarantine
+	messages := listMessages(t, complaintID, token)
+	if assert.Len(t, messages, 1) && assert.Len(t, messages[0].Attachments, 2) {
+		notes, photo := messages[0].Attachments[0], messages[0].Attachments[1]
+		assert.Equal(t, "text/plain", notes.MimeType)
+		assert.Equal(t, "image/png", photo.MimeType)
+		assert.Equal(t, "photo.png", photo.FileName)
+
+		code, content := download(t, notes.URL)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "the receipt number is 42", string(content))
+	}
+
+	// 2, only the owner and admins reply
+	_, other := createTestUser(t)
+	resp = postMultipart(t, path, other, map[string]string{"message": "Not mine"}, testFile{"a.txt", []byte("hello")})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp.Body.Close()
+
+	// 3, staff answer without files, whatever their role is called
+	_, admin := createAdminUser(t)
+	supervisor := fmt.Sprintf("supervisor-%d", time.Now().UnixNano()%1000000)
+	resp = postJSON(t, "/roles", admin, map[string]any{"name": supervisor, "permissions": []string{models.PermComplaintReadAny, models.PermComplaintMessage}})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp.Body.Close()
+	staff := getTestJWT(1, supervisor)
+
+	resp = postMultipart(t, path, staff, map[string]string{"message": "Here"}, testFile{"a.txt", []byte("hello")})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp.Body.Close()
+	resp = postMultipart(t, path, staff, map[string]string{"message": "Looking into it"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func TestReplyRejectsBadFilesWithoutReplying(t *testing.T) {
+	_, token := createTestUser(t)
+	complaintID := createComplaint(t, token)
+	path := fmt.Sprintf("/complaints/%d/reply", complaintID)
+	good := testFile{"ok.txt", []byte("fine")}
+
+	for name, bad := range map[string]testFile{
+		"type":     {"tool.exe", append([]byte("MZ\x90\x00\x03\x00\x00\x00"), make([]byte, 64)...)},
+		"size":     {"big.txt", bytes.Repeat([]byte("a"), 1<<20+1)},
+		"infected": {"eicar.txt", []byte(scanner.EICAR)},
+	} {
+		resp := postMultipart(t, path, token, map[string]string{"message": "Rejected " + name}, good, bad)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, name)
+		resp.Body.Close()
+	}
+
+	// no reply was left behind, and neither was the good file
+	assert.Empty(t, listMessages(t, complaintID, token))
+	var attachments int
+	err := testutils.GetTestDB().QueryRow(context.Background(), `SELECT COUNT(*) FROM attachments WHERE complaint_id=$1`, complaintID).Scan(&attachments)
+	assert.NoError(t, err)
+	assert.Zero(t, attachments)
+}
+
+func uploadDocument(t *testing.T, token string, f testFile) *models.Document {
+	resp := postMultipart(t, "/documents", token, nil, f)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	return decodeData[*models.Document](t, resp)
+}
+
+func attachDocument(t *testing.T, documentID, complaintID int, token string) int {
+	resp := postJSON(t, fmt.Sprintf("/documents/%d/attach", documentID), token, map[string]int{"complaint_id": complaintID})
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestAttachDocument(t *testing.T) {
+	ownerID, owner := createTestUser(t)
+	_, other := createTestUser(t)
+	_, admin := createAdminUser(t)
+	complaintID := createComplaint(t, owner)
+	doc := uploadDocument(t, owner, testFile{"invoice.txt", []byte("invoice 1")})
+
+	// 1, owners attach their documents to their complaints
+	assert.Equal(t, http.StatusCreated, attachDocument(t, int(doc.ID), complaintID, owner))
+
+	// 2, nobody else's
+	assert.Equal(t, http.StatusForbidden, attachDocument(t, int(doc.ID), createComplaint(t, other), other))
+	assert.Equal(t, http.StatusForbidden, attachDocument(t, int(doc.ID), complaintID, other))
+
+	// 3, a version uploaded by an admin leaves the document its owner's
+	resp := postMultipart(t, fmt.Sprintf("/documents/%d/versions", doc.ID), admin, nil, testFile{"invoice.txt", []byte("invoice 2")})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, attachDocument(t, int(doc.ID), complaintID, owner))
+
+	// 4, documents from before attachments existed can be attached too, the
+	// hash taken from the file since they have no version on record
+	name := fmt.Sprintf("old-%d.txt", time.Now().UnixNano())
+	assert.NoError(t, os.MkdirAll(legacyUploadDir, 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(legacyUploadDir, name), []byte("old invoice"), 0o644))
+	t.Cleanup(func() { os.Remove(filepath.Join(legacyUploadDir, name)) })
+
+	var legacyID int
+	err := testutils.GetTestDB().QueryRow(context.Background(), `INSERT INTO documents (user_id, file_name, storage_key, uploaded_at)
+	VALUES ($1, 'old.txt', $2, NOW()) RETURNING id`, ownerID, "legacy/"+name).Scan(&legacyID)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, attachDocument(t, legacyID, complaintID, owner))
+
+	resp, err = http.DefaultClient.Do(authorized(t, "GET", fmt.Sprintf("/complaints/%d/attachments", complaintID), owner))
+	assert.NoError(t, err)
+	attachments := decodeData[[]*models.Attachment](t, resp)
+	if assert.Len(t, attachments, 3) {
+		sum := sha256.Sum256([]byte("old invoice"))
+		assert.Equal(t, hex.EncodeToString(sum[:]), attachments[2].SHA256)
+	}
+
+	// 5, and a document whose file is gone can't be
+	var missingID int
+	err = testutils.GetTestDB().QueryRow(context.Background(), `INSERT INTO documents (user_id, file_name, storage_key, uploaded_at)
+	VALUES ($1, 'gone.txt', 'legacy/gone.txt', NOW()) RETURNING id`, ownerID).Scan(&missingID)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, attachDocument(t, missingID, complaintID, owner))
+}
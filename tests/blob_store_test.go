@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"Complaingo/internal/storage"
+	"Complaingo/testutils"
+	"context"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func exerciseBlobStore(t *testing.T, store storage.BlobStore) {
+	ctx := context.Background()
+	key := "7/report.txt"
+
+	// 1, put and read back
+	err := store.Put(ctx, key, strings.NewReader("hello blob"), -1, "text/plain")
+	assert.NoError(t, err)
+
+	info, err := store.Stat(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len("hello blob")), info.Size)
+
+	content, _, err := store.Get(ctx, key)
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(content)
+	content.Close()
+	assert.Equal(t, "hello blob", string(data))
+
+	// 2, keys must not escape the store root
+	err = store.Put(ctx, "../escape.txt", strings.NewReader("x"), 1, "text/plain")
+	assert.Error(t, err)
+
+	// 3, delete removes the blob
+	assert.NoError(t, store.Delete(ctx, key))
+	_, err = store.Stat(ctx, key)
+	assert.Error(t, err)
+}
+
+func TestLocalBlobStore(t *testing.T) {
+	exerciseBlobStore(t, storage.NewLocalStore(t.TempDir(), "", storage.NewURLSigner("test_secret", "/files/")))
+}
+
+func TestLocalBlobStoreLegacyKeys(t *testing.T) {
+	ctx := context.Background()
+	root, legacyRoot := t.TempDir(), t.TempDir()
+	store := storage.NewLocalStore(root, legacyRoot, storage.NewURLSigner("test_secret", "/files/"))
+	assert.NoError(t, os.WriteFile(filepath.Join(legacyRoot, "old contract.pdf"), []byte("old"), 0o644))
+
+	read := func(key string) string {
+		content, _, err := store.Get(ctx, key)
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		defer content.Close()
+		data, _ := io.ReadAll(content)
+		return string(data)
+	}
+
+	// 1, files that were never moved are read from the old directory
+	assert.Equal(t, "old", read("legacy/old contract.pdf"))
+	info, err := store.Stat(ctx, "legacy/old contract.pdf")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), info.Size)
+
+	// 2, moved files win
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "legacy"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "legacy", "old contract.pdf"), []byte("moved"), 0o644))
+	assert.Equal(t, "moved", read("legacy/old contract.pdf"))
+
+	// 3, only legacy keys fall back
+	assert.NoError(t, os.WriteFile(filepath.Join(legacyRoot, "7"), []byte("x"), 0o644))
+	_, err = store.Stat(ctx, "7")
+	assert.Error(t, err)
+}
+
+func TestS3BlobStore(t *testing.T) {
+	fake := testutils.NewFakeS3("test-access")
+	defer fake.Close()
+
+	store, err := storage.NewS3Store(storage.S3Config{
+		Endpoint:     fake.URL,
+		Bucket:       "complaingo",
+		AccessKey:    "test-access",
+		SecretKey:    "test-secret",
+		UsePathStyle: true,
+	})
+	assert.NoError(t, err)
+
+	exerciseBlobStore(t, store)
+
+	// presigned urls are plain GETs without an Authorization header
+	ctx := context.Background()
+	assert.NoError(t, store.Put(ctx, "7/shared.txt", strings.NewReader("shared"), 6, "text/plain"))
+
+	url, err := store.Presign(ctx, "7/shared.txt", 5*time.Minute)
+	assert.NoError(t, err)
+	assert.Contains(t, url, "X-Amz-Signature=")
+
+	resp, err := http.Get(url)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "shared", string(body))
+}
+
+func TestSignedDownloadURL(t *testing.T) {
+	signer := storage.NewURLSigner("test_secret", "/files/")
+
+	parse := func(raw string) (string, string, string) {
+		u, err := neturl.Parse(raw)
+		assert.NoError(t, err)
+		return strings.TrimPrefix(u.Path, "/files/"), u.Query().Get("expires"), u.Query().Get("signature")
+	}
+
+	// a fresh link verifies
+	key, expires, sig := parse(signer.Sign("7/abc.pdf", time.Minute))
+	assert.Equal(t, "7/abc.pdf", key)
+	assert.NoError(t, signer.Verify(key, expires, sig))
+
+	// the signature covers the key and the expiry
+	assert.Error(t, signer.Verify("8/abc.pdf", expires, sig))
+	assert.Error(t, signer.Verify(key, expires+"0", sig))
+
+	// expired links are refused
+	key, expires, sig = parse(signer.Sign("7/abc.pdf", -time.Minute))
+	assert.Error(t, signer.Verify(key, expires, sig))
+}
@@ -0,0 +1,311 @@
+package tests
+
+import (
+	"Complaingo/internal/cache"
+	"Complaingo/internal/domain/models"
+	"Complaingo/internal/utility"
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheGetOrLoad(t *testing.T) {
+	ctx := context.Background()
+	c := cache.New(cache.NewMemoryStore(100), time.Minute)
+	loads := 0
+	load := func(ctx context.Context) (*models.User, error) {
+		loads++
+		return &models.User{ID: 7, FirstName: fmt.Sprint("load ", loads)}, nil
+	}
+
+	// 1, the second read comes from the cache, as a copy
+	first, err := cache.GetOrLoad(ctx, c, cache.UserKey(7), load)
+	assert.NoError(t, err)
+	first.FirstName = "changed by the caller"
+	second, err := cache.GetOrLoad(ctx, c, cache.UserKey(7), load)
+	assert.NoError(t, err)
+	assert.Equal(t, "load 1", second.FirstName)
+	assert.Equal(t, 1, loads)
+
+	// 2, invalidating the tag forces a new load, other tags are untouched
+	c.Invalidate(ctx, cache.UserTag(8))
+	cache.GetOrLoad(ctx, c, cache.UserKey(7), load)
+	assert.Equal(t, 1, loads)
+	c.Invalidate(ctx, cache.UserTag(7))
+	third, _ := cache.GetOrLoad(ctx, c, cache.UserKey(7), load)
+	assert.Equal(t, "load 2", third.FirstName)
+
+	// 3, errors aren't cached
+	_, err = cache.GetOrLoad(ctx, c, cache.UserKey(9), func(ctx context.Context) (*models.User, error) {
+		return nil, fmt.Errorf("db down")
+	})
+	assert.Error(t, err)
+	fourth, err := cache.GetOrLoad(ctx, c, cache.UserKey(9), load)
+	assert.NoError(t, err)
+	assert.Equal(t, "load 3", fourth.FirstName)
+
+	// 4, a nil cache just loads
+	var none *cache.Cache
+	cache.GetOrLoad(ctx, none, cache.UserKey(7), load)
+	none.Invalidate(ctx, cache.UserTag(7))
+	assert.Equal(t, 4, loads)
+}
+
+func TestCacheKeysIncludeParams(t *testing.T) {
+	page1 := utility.FilterParam{Page: 1, PerPage: 10}
+	page2 := utility.FilterParam{Page: 2, PerPage: 10}
+
+	assert.Equal(t, cache.UserComplaintsKey(3, page1).String(), cache.UserComplaintsKey(3, page1).String())
+	assert.NotEqual(t, cache.UserComplaintsKey(3, page1).String(), cache.UserComplaintsKey(3, page2).String())
+	assert.NotEqual(t, cache.UserComplaintsKey(3, page1).String(), cache.UserComplaintsKey(4, page1).String())
+	assert.NotEqual(t, cache.MessagesKey(3, nil).String(), cache.MessagesKey(3, utility.ThreadParam{}).String())
+}
+
+func TestCacheLoadsOnceAndDropsStaleLoads(t *testing.T) {
+	ctx := context.Background()
+	c := cache.New(cache.NewMemoryStore(100), time.Minute)
+	key := cache.NewKey("slow").Tagged("slow")
+
+	// 1, concurrent misses share one load
+	var loads atomic.Int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := cache.GetOrLoad(ctx, c, key, func(ctx context.Context) (int, error) {
+				loads.Add(1)
+				<-release
+				return 1, nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, 1, v)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), loads.Load())
+
+	// 2, a load that finishes after an invalidation isn't served afterwards
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	done := make(chan struct{})
+	c.Invalidate(ctx, "slow")
+	go func() {
+		defer close(done)
+		cache.GetOrLoad(ctx, c, key, func(ctx context.Context) (int, error) {
+			close(started)
+			<-finish
+			return 2, nil
+		})
+	}()
+	<-started
+	c.Invalidate(ctx, "slow")
+	close(finish)
+	<-done
+
+	v, _ := cache.GetOrLoad(ctx, c, key, func(ctx context.Context) (int, error) {
+		return 3, nil
+	})
+	assert.Equal(t, 3, v)
+}
+
+func TestMemoryStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	s := cache.NewMemoryStore(2)
+
+	s.Set(ctx, "a", []byte("1"), time.Minute)
+	s.Set(ctx, "b", []byte("2"), time.Minute)
+	s.Get(ctx, "a")
+	s.Set(ctx, "c", []byte("3"), time.Minute)
+
+	_, ok, _ := s.Get(ctx, "b")
+	assert.False(t, ok)
+	_, ok, _ = s.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, 2, s.Len())
+}
+
+// fakeRedis is a shared store for several tiered stores, which can be made to fail.
+type fakeRedis struct {
+	*cache.MemoryStore
+	mu          sync.Mutex
+	down        bool
+	calls       int
+	subscribers []func(version string, tags []string)
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{MemoryStore: cache.NewMemoryStore(100)}
+}
+
+func (f *fakeRedis) call() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.down {
+		return fmt.Errorf("redis down")
+	}
+	return nil
+}
+
+func (f *fakeRedis) setDown(down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down = down
+}
+
+func (f *fakeRedis) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func (f *fakeRedis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if err := f.call(); err != nil {
+		return nil, false, err
+	}
+	return f.MemoryStore.Get(ctx, key)
+}
+
+func (f *fakeRedis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := f.call(); err != nil {
+		return err
+	}
+	return f.MemoryStore.Set(ctx, key, value, ttl)
+}
+
+func (f *fakeRedis) TagVersions(ctx context.Context, tags []string) ([]string, error) {
+	if err := f.call(); err != nil {
+		return nil, err
+	}
+	return f.MemoryStore.TagVersions(ctx, tags)
+}
+
+func (f *fakeRedis) BumpTags(ctx context.Context, tags ...string) error {
+	if err := f.call(); err != nil {
+		return err
+	}
+	f.MemoryStore.BumpTags(ctx, tags...)
+	versions, _ := f.MemoryStore.TagVersions(ctx, tags[:1])
+	f.mu.Lock()
+	subscribers := f.subscribers
+	f.mu.Unlock()
+	for _, apply := range subscribers {
+		apply(versions[0], tags)
+	}
+	return nil
+}
+
+func (f *fakeRedis) Subscribe(ctx context.Context, apply func(version string, tags []string)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.subscribers = append(f.subscribers, apply)
+}
+
+func TestTieredStoreStaysCoherentAcrossInstances(t *testing.T) {
+	ctx := context.Background()
+	shared := newFakeRedis()
+	cfg := cache.TieredConfig{LocalSize: 100, LocalTTL: time.Minute, FailureThreshold: 3, Cooldown: time.Minute, Timeout: time.Second}
+	a := cache.New(cache.NewTieredStore(ctx, shared, cfg), time.Minute)
+	b := cache.New(cache.NewTieredStore(ctx, shared, cfg), time.Minute)
+
+	var loads atomic.Int32
+	load := func(ctx context.Context) (int32, error) {
+		return loads.Add(1), nil
+	}
+
+	// 1, what one instance loads the other reads from redis
+	first, _ := cache.GetOrLoad(ctx, a, cache.UserKey(1), load)
+	second, _ := cache.GetOrLoad(ctx, b, cache.UserKey(1), load)
+	assert.Equal(t, first, second)
+	assert.Equal(t, int32(1), loads.Load())
+
+	// 2, and an invalidation on one reaches the local tier of the other
+	a.Invalidate(ctx, cache.UserTag(1))
+	third, _ := cache.GetOrLoad(ctx, b, cache.UserKey(1), load)
+	assert.Equal(t, int32(2), third)
+}
+
+func TestTieredStoreKeepsWorkingWithoutRedis(t *testing.T) {
+	ctx := context.Background()
+	shared := newFakeRedis()
+	cfg := cache.TieredConfig{LocalSize: 100, LocalTTL: time.Minute, FailureThreshold: 3, Cooldown: 50 * time.Millisecond, Timeout: time.Second}
+	a := cache.New(cache.NewTieredStore(ctx, shared, cfg), time.Minute)
+	b := cache.New(cache.NewTieredStore(ctx, shared, cfg), time.Minute)
+
+	var loads atomic.Int32
+	load := func(ctx context.Context) (int32, error) {
+		return loads.Add(1), nil
+	}
+	cache.GetOrLoad(ctx, a, cache.UserKey(1), load)
+	cache.GetOrLoad(ctx, b, cache.UserKey(1), load)
+	shared.setDown(true)
+
+	// 1, reads are served locally, invalidations still apply locally
+	v, err := cache.GetOrLoad(ctx, a, cache.UserKey(1), load)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), v)
+	a.Invalidate(ctx, cache.UserTag(1))
+	v, err = cache.GetOrLoad(ctx, a, cache.UserKey(1), load)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), v)
+
+	// 2, once the breaker is open redis isn't called any more
+	for i := 0; i < 5; i++ {
+		cache.GetOrLoad(ctx, a, cache.NewKey("other", i), load)
+	}
+	calls := shared.callCount()
+	for i := 5; i < 10; i++ {
+		_, err := cache.GetOrLoad(ctx, a, cache.NewKey("other", i), load)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, calls, shared.callCount())
+
+	// 3, when redis is back the missed invalidation reaches the other instance
+	shared.setDown(false)
+	time.Sleep(60 * time.Millisecond)
+	cache.GetOrLoad(ctx, a, cache.NewKey("probe"), load)
+	assert.Eventually(t, func() bool {
+		v, _ := cache.GetOrLoad(ctx, b, cache.UserKey(1), load)
+		return v != int32(1)
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestComplaintListIsFreshAfterWrites(t *testing.T) {
+	userID, token := createTestUser(t)
+	path := fmt.Sprintf("/complaints/user/%d", userID)
+
+	list := func() []models.Complaints {
+		req := authorized(t, "GET", path, token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		return decodeData[[]models.Complaints](t, resp)
+	}
+
+	assert.Len(t, list(), 0)
+
+	// 1, a new complaint shows up straight away
+	resp := postJSON(t, "/complaints", token, map[string]string{"subject": "Cached", "message": "Fresh list", "status": "Created"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	created := decodeData[models.Complaints](t, resp)
+	assert.Len(t, list(), 1)
+
+	// 2, and so does its new status
+	resp = patchJSON(t, fmt.Sprintf("/complaints/%d/resolve", created.ID), token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+	complaints := list()
+	if assert.Len(t, complaints, 1) {
+		assert.Equal(t, "Resolved", complaints[0].Status)
+	}
+}
@@ -0,0 +1,33 @@
+package tests
+
+import (
+	"Complaingo/internal/auth"
+	"context"
+	"testing"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserCutoffMillisecondPrecision(t *testing.T) {
+	ctx := context.Background()
+	denylists := map[string]auth.Denylist{"memory": auth.NewMemoryDenylist()}
+
+	client := goredis.NewClient(&goredis.Options{Addr: testRedisAddr})
+	defer client.Close()
+	if err := client.Ping(ctx).Err(); err == nil {
+		denylists["redis"] = auth.NewRedisDenylist(client)
+	}
+
+	// every backend keeps the cutoff at the precision of iat, so a token
+	// issued in the cutoff's millisecond is decided the same way by all
+	userID := int(time.Now().UnixNano() % 1_000_000_000)
+	cutoff := time.UnixMilli(time.Now().UnixMilli()).Add(500 * time.Microsecond)
+	for name, d := range denylists {
+		assert.NoError(t, d.RevokeUser(ctx, userID, cutoff, time.Minute), name)
+		before, err := d.RevokedBefore(ctx, userID)
+		assert.NoError(t, err, name)
+		assert.True(t, before.Equal(cutoff.Truncate(time.Millisecond)), name)
+	}
+}
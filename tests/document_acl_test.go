@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"Complaingo/internal/domain/models"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getDocumentStatus(t *testing.T, path, token string) int {
+	resp, err := http.DefaultClient.Do(authorized(t, "GET", path, token))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestDocumentAccess(t *testing.T) {
+	_, owner := createTestUser(t)
+	_, other := createTestUser(t)
+	doc := uploadDocument(t, owner, testFile{"contract.txt", []byte("contract")})
+	path := fmt.Sprintf("/documents/%d", doc.ID)
+
+	// 1, owners read their documents
+	assert.Equal(t, http.StatusOK, getDocumentStatus(t, path, owner))
+	assert.Equal(t, http.StatusOK, getDocumentStatus(t, path+"/download-url", owner))
+
+	// 2, other users are refused
+	assert.Equal(t, http.StatusForbidden, getDocumentStatus(t, path, other))
+	assert.Equal(t, http.StatusForbidden, getDocumentStatus(t, path+"/download-url", other))
+	assert.Equal(t, http.StatusForbidden, getDocumentStatus(t, path+"/versions", other))
+
+	// 3, unknown documents are not found
+	assert.Equal(t, http.StatusNotFound, getDocumentStatus(t, "/documents/999999999", owner))
+}
+
+func TestDocumentSharedThroughComplaint(t *testing.T) {
+	_, user := createTestUser(t)
+	_, admin := createAdminUser(t)
+	complaintID := createComplaint(t, user)
+	doc := uploadDocument(t, admin, testFile{"policy.txt", []byte("refund policy")})
+	path := fmt.Sprintf("/documents/%d", doc.ID)
+
+	assert.Equal(t, http.StatusForbidden, getDocumentStatus(t, path, user))
+
+	// once attached to their complaint the user can read it, not change it
+	assert.Equal(t, http.StatusCreated, attachDocument(t, int(doc.ID), complaintID, admin))
+	assert.Equal(t, http.StatusOK, getDocumentStatus(t, path, user))
+	assert.Equal(t, http.StatusOK, getDocumentStatus(t, path+"/download-url", user))
+
+	resp := patchJSON(t, path, user, map[string]string{"file_name": "mine.txt"})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestListDocumentsByUser(t *testing.T) {
+	ownerID, owner := createTestUser(t)
+	_, other := createTestUser(t)
+	for _, name := range []string{"a-receipt.txt", "b-receipt.txt", "c-letter.txt"} {
+		uploadDocument(t, owner, testFile{name, []byte(name)})
+	}
+	path := fmt.Sprintf("/documents/user/%d", ownerID)
+
+	list := func(query url.Values) []*models.Document {
+		resp, err := http.DefaultClient.Do(authorized(t, "GET", path+"?"+query.Encode(), owner))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		return decodeData[[]*models.Document](t, resp)
+	}
+	names := func(docs []*models.Document) []string {
+		var out []string
+		for _, d := range docs {
+			out = append(out, d.FileName)
+		}
+		return out
+	}
+
+	// 1, paginated
+	assert.Equal(t, []string{"a-receipt.txt", "b-receipt.txt"}, names(list(url.Values{"per_page": {"2"}})))
+	assert.Equal(t, []string{"c-letter.txt"}, names(list(url.Values{"per_page": {"2"}, "page": {"2"}})))
+
+	// 2, searched and sorted
+	sort := `{"column_name":"file_name","value":"desc"}`
+	assert.Equal(t, []string{"b-receipt.txt", "a-receipt.txt"}, names(list(url.Values{"search": {"receipt"}, "sort": {sort}})))
+
+	// 3, unknown columns are rejected rather than put in the query
+	resp, err := http.DefaultClient.Do(authorized(t, "GET", path+"?"+url.Values{"sort": {`{"column_name":"1; DROP TABLE documents","value":"asc"}`}}.Encode(), owner))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// 4, nobody else's
+	assert.Equal(t, http.StatusForbidden, getDocumentStatus(t, path, other))
+}
@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"Complaingo/internal/events"
+	"Complaingo/internal/preview"
+	"Complaingo/internal/storage"
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// minimalPDF builds a one page pdf showing text, with a valid xref table.
+func minimalPDF(text string) []byte {
+	stream := fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text)
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+func readBlob(t *testing.T, store storage.BlobStore, key string) []byte {
+	content, _, err := store.Get(context.Background(), key)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	defer content.Close()
+	data, _ := io.ReadAll(content)
+	return data
+}
+
+func TestPreviewGenerator(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewLocalStore(t.TempDir(), "", storage.NewURLSigner("test_secret", "/files/"))
+	generator := preview.NewGenerator(store)
+
+	// 1, images get a bounded thumbnail and a larger preview
+	img := image.NewRGBA(image.Rect(0, 0, 1200, 600))
+	for x := 0; x < 1200; x++ {
+		img.Set(x, x%600, color.RGBA{R: 200, A: 255})
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, img))
+	assert.NoError(t, store.Put(ctx, "7/photo.png", bytes.NewReader(buf.Bytes()), int64(buf.Len()), "image/png"))
+
+	assert.NoError(t, generator.Generate(ctx, "7/photo.png", "image/png"))
+
+	thumb, err := jpeg.Decode(bytes.NewReader(readBlob(t, store, preview.ThumbnailKey("7/photo.png"))))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 256, 128), thumb.Bounds())
+
+	large, err := jpeg.Decode(bytes.NewReader(readBlob(t, store, preview.PreviewKey("7/photo.png", "image/png"))))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 1024, 512), large.Bounds())
+
+	// 2, plain text previews are cut on a rune boundary
+	text := strings.Repeat("é", preview.TextPreviewMax)
+	assert.NoError(t, store.Put(ctx, "7/notes.txt", strings.NewReader(text), -1, "text/plain"))
+	assert.NoError(t, generator.Generate(ctx, "7/notes.txt", "text/plain; charset=utf-8"))
+
+	excerpt := readBlob(t, store, preview.PreviewKey("7/notes.txt", "text/plain"))
+	assert.Equal(t, preview.TextPreviewMax, len(excerpt))
+	assert.True(t, strings.HasPrefix(text, string(excerpt)))
+
+	// 3, pdfs get the text of their first page
+	doc := minimalPDF("Broken heater in room 12")
+	assert.NoError(t, store.Put(ctx, "7/letter.pdf", bytes.NewReader(doc), int64(len(doc)), "application/pdf"))
+	assert.NoError(t, generator.Generate(ctx, "7/letter.pdf", "application/pdf"))
+	assert.Contains(t, string(readBlob(t, store, preview.PreviewKey("7/letter.pdf", "application/pdf"))), "Broken heater in room 12")
+
+	// 4, other types are skipped without error
+	assert.NoError(t, generator.Generate(ctx, "7/missing.zip", "application/zip"))
+
+	// 5, corrupt images fail instead of writing a derivative
+	assert.NoError(t, store.Put(ctx, "7/bad.png", strings.NewReader("not a png"), -1, "image/png"))
+	assert.Error(t, generator.Generate(ctx, "7/bad.png", "image/png"))
+	_, err = store.Stat(ctx, preview.ThumbnailKey("7/bad.png"))
+	assert.Error(t, err)
+}
+
+func TestEventBusDispatchesUploads(t *testing.T) {
+	bus := events.NewBus(2, 8, time.Second)
+	defer bus.Close()
+
+	received := make(chan events.DocumentUploadedPayload, 1)
+	bus.Subscribe(events.DocumentUploaded, func(ctx context.Context, e events.Event) error {
+		received <- e.Payload.(events.DocumentUploadedPayload)
+		return nil
+	})
+	// a failing or panicking handler must not stop the others
+	bus.Subscribe(events.DocumentUploaded, func(ctx context.Context, e events.Event) error {
+		panic("boom")
+	})
+
+	bus.Publish(context.Background(), events.Event{
+		Type:    events.DocumentUploaded,
+		Payload: events.DocumentUploadedPayload{DocumentID: 3, StorageKey: "7/a.png", MimeType: "image/png"},
+	})
+	bus.Wait()
+
+	select {
+	case p := <-received:
+		assert.Equal(t, 3, p.DocumentID)
+	default:
+		t.Fatal("handler was not called")
+	}
+}
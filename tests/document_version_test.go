@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"Complaingo/config"
+	"Complaingo/internal/domain/models"
+	"Complaingo/testutils"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getVersionContent(t *testing.T, documentID int32, version int, token string) string {
+	resp, err := http.DefaultClient.Do(authorized(t, "GET", fmt.Sprintf("/documents/%d/versions/%d", documentID, version), token))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	content, _ := io.ReadAll(resp.Body)
+	return string(content)
+}
+
+func getUsage(t *testing.T, path, token string) *models.StorageUsage {
+	resp, err := http.DefaultClient.Do(authorized(t, "GET", path, token))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	return decodeData[*models.StorageUsage](t, resp)
+}
+
+func TestDocumentVersions(t *testing.T) {
+	_, token := createTestUser(t)
+	doc := uploadDocument(t, token, testFile{"terms.txt", []byte("terms, first draft")})
+	assert.Equal(t, 1, doc.CurrentVersion)
+
+	// 1, a re-upload becomes the current version
+	resp := postMultipart(t, fmt.Sprintf("/documents/%d/versions", doc.ID), token, nil, testFile{"terms.txt", []byte("terms, second draft")})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, 2, decodeData[*models.Document](t, resp).CurrentVersion)
+
+	resp, err := http.DefaultClient.Do(authorized(t, "GET", fmt.Sprintf("/documents/%d/versions", doc.ID), token))
+	assert.NoError(t, err)
+	assert.Len(t, decodeData[[]*models.DocumentVersion](t, resp), 2)
+
+	// 2, old versions stay downloadable
+	assert.Equal(t, "terms, first draft", getVersionContent(t, doc.ID, 1, token))
+	assert.Equal(t, "terms, second draft", getVersionContent(t, doc.ID, 2, token))
+
+	// 3, restoring copies the old version on top instead of rewriting history
+	resp = postJSON(t, fmt.Sprintf("/documents/%d/versions/1/restore", doc.ID), token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 3, decodeData[*models.Document](t, resp).CurrentVersion)
+	assert.Equal(t, "terms, first draft", getVersionContent(t, doc.ID, 3, token))
+
+	resp = postJSON(t, fmt.Sprintf("/documents/%d/versions/9/restore", doc.ID), token, nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestDocumentQuota(t *testing.T) {
+	userID, token := createTestUser(t)
+	_, err := testutils.GetTestDB().Exec(context.Background(), `UPDATE users SET storage_quota_bytes=20 WHERE id=$1`, userID)
+	assert.NoError(t, err)
+
+	// 1, uploads within the quota are stored
+	doc := uploadDocument(t, token, testFile{"small.txt", []byte("fifteen bytes..")})
+
+	// 2, the one that doesn't fit is refused, as a version too
+	resp := postMultipart(t, "/documents", token, nil, testFile{"big.txt", []byte("ten bytes.")})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = postMultipart(t, fmt.Sprintf("/documents/%d/versions", doc.ID), token, nil, testFile{"small.txt", []byte("ten bytes.")})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// 3, usage adds it all up
+	usage := getUsage(t, "/documents/usage", token)
+	assert.Equal(t, int64(15), usage.UsedBytes)
+	assert.Equal(t, int64(20), usage.QuotaBytes)
+	assert.Equal(t, int64(5), usage.RemainingBytes)
+	assert.Equal(t, 1, usage.Documents)
+	assert.Equal(t, 1, usage.Versions)
+}
+
+func TestDocumentUsage(t *testing.T) {
+	userID, token := createTestUser(t)
+	_, other := createTestUser(t)
+	_, admin := createAdminUser(t)
+	path := fmt.Sprintf("/documents/usage?user_id=%d", userID)
+
+	// 1, users get the user quota, and only see their own usage
+	assert.Equal(t, config.LoadConfig().QuotaBytesUser, getUsage(t, "/documents/usage", token).QuotaBytes)
+	resp, err := http.DefaultClient.Do(authorized(t, "GET", path, other))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// 2, roles without a quota of their own fall back to the user quota
+	db := testutils.GetTestDB()
+	role := fmt.Sprintf("auditor-%d", userID)
+	_, err = db.Exec(context.Background(), `INSERT INTO roles (name) VALUES ($1)`, role)
+	assert.NoError(t, err)
+	defer func() {
+		db.Exec(context.Background(), `UPDATE users SET role_id=NULL WHERE id=$1`, userID)
+		db.Exec(context.Background(), `DELETE FROM roles WHERE name=$1`, role)
+	}()
+	_, err = db.Exec(context.Background(), `UPDATE users SET role_id=(SELECT id FROM roles WHERE name=$1) WHERE id=$2`, role, userID)
+	assert.NoError(t, err)
+
+	usage := getUsage(t, path, admin)
+	assert.Equal(t, config.LoadConfig().QuotaBytesUser, usage.QuotaBytes)
+	assert.Equal(t, usage.QuotaBytes, usage.RemainingBytes)
+}
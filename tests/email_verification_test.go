@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"Complaingo/internal/auth"
+	"Complaingo/internal/mailer"
+	"Complaingo/testutils"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// insertUserToken stores a verification or reset token the way the usecase
+// does, so the flows can be tested without reading mail.
+func insertUserToken(t *testing.T, email, purpose string) string {
+	token, hash, err := auth.NewOpaqueToken()
+	assert.NoError(t, err)
+
+	_, err = testutils.GetTestDB().Exec(context.Background(), `
+	INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at)
+	SELECT id, $2, $3, NOW() + INTERVAL '1 hour' FROM users WHERE email = $1`,
+		email, purpose, hash)
+	assert.NoError(t, err)
+	return token
+}
+
+func TestEmailVerificationGatesComplaints(t *testing.T) {
+	email := fmt.Sprintf("verify-%d@example.com", time.Now().UnixNano())
+	resp := postJSON(t, "/register", "", map[string]string{
+		"first_name": "Verify", "last_name": "User", "email": email, "password": "alexman", "role": "user",
+	})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = postJSON(t, "/login", "", map[string]string{"email": email, "password": "alexman"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	tokens := decodeTokens(t, resp)
+
+	complaint := map[string]string{"subject": "Broken", "message": "It broke"}
+
+	// 1, an unverified account can log in but not file complaints
+	resp = postJSON(t, "/complaints", tokens.AccessToken, complaint)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp.Body.Close()
+
+	// 2, a bogus token is rejected, the real one verifies the address once
+	resp = postJSON(t, "/auth/verify-email", "", map[string]string{"token": strings.Repeat("x", 43)})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+
+	token := insertUserToken(t, email, "verify_email")
+	resp = postJSON(t, "/auth/verify-email", "", map[string]string{"token": token})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = postJSON(t, "/auth/verify-email", "", map[string]string{"token": token})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = postJSON(t, "/complaints", tokens.AccessToken, complaint)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp.Body.Close()
+
+	// 3, resending to a verified account is refused
+	resp = postJSON(t, "/auth/verify-email/resend", tokens.AccessToken, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func TestPasswordReset(t *testing.T) {
+	session := loginTestUser(t)
+
+	var email string
+	err := testutils.GetTestDB().QueryRow(context.Background(),
+		`SELECT email FROM users ORDER BY id DESC LIMIT 1`).Scan(&email)
+	assert.NoError(t, err)
+
+	// 1, unknown addresses get the same answer as known ones
+	resp := postJSON(t, "/auth/password/forgot", "", map[string]string{"email": "nobody@example.com"})
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	resp.Body.Close()
+
+	// 2, the reset token sets a new password and ends existing sessions
+	token := insertUserToken(t, email, "reset_password")
+	resp = postJSON(t, "/auth/password/reset", "", map[string]string{"token": token, "password": "newsecret"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusUnauthorized, getWithToken(t, "/users", session.AccessToken))
+	resp = postJSON(t, "/auth/refresh", "", map[string]string{"refresh_token": session.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = postJSON(t, "/login", "", map[string]string{"email": email, "password": "alexman"})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+
+	// wait out the second precision of the revocation cutoff
+	time.Sleep(time.Second)
+	resp = postJSON(t, "/login", "", map[string]string{"email": email, "password": "newsecret"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp.Body.Close()
+
+	// 3, the token is single use
+	resp = postJSON(t, "/auth/password/reset", "", map[string]string{"token": token, "password": "another1"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func TestFileMailerWritesMessages(t *testing.T) {
+	dir := t.TempDir()
+	m := mailer.NewFileMailer(dir, "no-reply@complaingo.local")
+
+	err := m.Send(context.Background(), mailer.Message{
+		To:      "a@b.com",
+		Subject: "Verify your email",
+		Body:    "line one\nline two",
+	})
+	assert.NoError(t, err)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	assert.Len(t, files, 1)
+
+	raw, _ := os.ReadFile(files[0])
+	assert.Contains(t, string(raw), "To: a@b.com\r\n")
+	assert.Contains(t, string(raw), "From: no-reply@complaingo.local\r\n")
+	assert.Contains(t, string(raw), "line one\r\nline two")
+}
@@ -0,0 +1,154 @@
+package tests
+
+import (
+	"Complaingo/internal/domain/models"
+	"Complaingo/internal/middleware"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIfMatchHeader(t *testing.T) {
+	cases := []struct {
+		header  string
+		version int
+		status  int
+	}{
+		{`"v3"`, 3, 0},
+		{"*", middleware.AnyVersion, 0},
+		{"", 0, http.StatusPreconditionRequired},
+		{`"3"`, 0, http.StatusPreconditionFailed},
+		{`W/"abc"`, 0, http.StatusPreconditionFailed},
+		{`"v0"`, 0, http.StatusPreconditionFailed},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("PATCH", "/", nil)
+		if c.header != "" {
+			r.Header.Set("If-Match", c.header)
+		}
+
+		version, err := middleware.IfMatch(r)
+		if c.status == 0 {
+			assert.NoError(t, err, c.header)
+			assert.Equal(t, c.version, version, c.header)
+			continue
+		}
+		w := httptest.NewRecorder()
+		middleware.WriteError(w, err)
+		assert.Equal(t, c.status, w.Code, c.header)
+	}
+
+	assert.NoError(t, middleware.CheckVersion(middleware.AnyVersion, 7))
+	assert.Error(t, middleware.CheckVersion(6, 7))
+}
+
+func TestIfNoneMatch(t *testing.T) {
+	data := []string{"a", "b"}
+	etag := middleware.ContentETag(data)
+	assert.Equal(t, etag, middleware.ContentETag([]string{"a", "b"}))
+	assert.NotEqual(t, etag, middleware.ContentETag([]string{"a", "c"}))
+
+	for header, status := range map[string]int{
+		"":                 http.StatusOK,
+		`W/"other"`:        http.StatusOK,
+		etag:               http.StatusNotModified,
+		`"x", ` + etag[2:]: http.StatusNotModified,
+		"*":                http.StatusNotModified,
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		if header != "" {
+			r.Header.Set("If-None-Match", header)
+		}
+		w := httptest.NewRecorder()
+
+		middleware.WriteSuccessETag(w, r, etag, data, "ok", http.StatusOK)
+		assert.Equal(t, status, w.Code, header)
+		assert.Equal(t, etag, w.Header().Get("ETag"))
+		if status == http.StatusNotModified {
+			assert.Empty(t, w.Body.String())
+		}
+	}
+}
+
+func TestConcurrentComplaintUpdates(t *testing.T) {
+	_, token := createTestUser(t)
+	admin := getTestJWT(1, "admin")
+
+	resp := postJSON(t, "/complaints", token, map[string]string{"subject": "Race", "message": "Two admins", "status": "Created"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	complaint := decodeData[models.Complaints](t, resp)
+	path := fmt.Sprintf("/complaints/%d", complaint.ID)
+
+	// 1, both admins read the same version
+	req := authorized(t, "GET", path, admin)
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	etag := resp.Header.Get("ETag")
+	resp.Body.Close()
+	assert.Equal(t, middleware.VersionETag(1), etag)
+
+	// 2, the cached copy is still good
+	req = authorized(t, "GET", path, admin)
+	req.Header.Set("If-None-Match", etag)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	resp.Body.Close()
+
+	// 3, the first write wins, the second is based on a stale copy
+	resp = patchJSONIfMatch(t, path+"/status", admin, etag, map[string]string{"status": "Accepted"})
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, middleware.VersionETag(2), resp.Header.Get("ETag"))
+	resp.Body.Close()
+
+	resp = patchJSONIfMatch(t, path+"/status", admin, etag, map[string]string{"status": "Rejected"})
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	resp.Body.Close()
+
+	// 4, writes must say which version they change
+	resp = patchJSONIfMatch(t, path+"/status", admin, "", map[string]string{"status": "Rejected"})
+	assert.Equal(t, http.StatusPreconditionRequired, resp.StatusCode)
+	resp.Body.Close()
+
+	// 5, the old copy is no longer current
+	req = authorized(t, "GET", path, admin)
+	req.Header.Set("If-None-Match", etag)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	current := decodeData[models.Complaints](t, resp)
+	assert.Equal(t, "Accepted", current.Status)
+	assert.Equal(t, 2, current.Version)
+}
+
+func TestDeleteUserNeedsCurrentVersion(t *testing.T) {
+	userID, _ := createVerifiedUser(t, "etag")
+	admin := getTestJWT(1, "admin")
+	path := fmt.Sprintf("/users/%d", userID)
+
+	resp := patchJSONIfMatch(t, path, admin, middleware.VersionETag(1), map[string]string{"first_name": "Renamed"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	for _, c := range []struct {
+		etag   string
+		status int
+	}{
+		{"", http.StatusPreconditionRequired},
+		{middleware.VersionETag(1), http.StatusPreconditionFailed},
+		{middleware.VersionETag(2), http.StatusAccepted},
+	} {
+		req := authorized(t, "DELETE", path, admin)
+		if c.etag != "" {
+			req.Header.Set("If-Match", c.etag)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, c.status, resp.StatusCode, c.etag)
+		resp.Body.Close()
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"Complaingo/testutils"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"testing"
@@ -57,3 +58,13 @@ func TestGetComplaintsAsAdmin(t *testing.T) {
 	assert.GreaterOrEqual(t, len(respPayload.Data), 1, "Should return at least one complaint")
 
 }
+
+func TestGetComplaintOnlyOwnComplaint(t *testing.T) {
+	_, owner := createTestUser(t)
+	_, other := createTestUser(t)
+	path := fmt.Sprintf("/complaints/%d", createComplaint(t, owner))
+
+	assert.Equal(t, http.StatusOK, getWithToken(t, path, owner))
+	assert.Equal(t, http.StatusForbidden, getWithToken(t, path, other))
+	assert.Equal(t, http.StatusNotFound, getWithToken(t, "/complaints/999999999", owner))
+}
@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"Complaingo/internal/domain/models"
+	"Complaingo/testutils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func insertComplaintMessage(t *testing.T, complaintID, senderID int, parentID *int, message string) int {
+	var id int
+	err := testutils.GetTestDB().QueryRow(context.Background(),
+		`INSERT INTO complaint_messages (complaint_id, sender_id, parent_id, message)
+	VALUES ($1, $2, $3, $4) RETURNING id`, complaintID, senderID, parentID, message).Scan(&id)
+	assert.NoError(t, err)
+	return id
+}
+
+func TestGetMessageThread(t *testing.T) {
+	testutils.CleanTestDB()
+	testutils.InitTestSchema()
+
+	// 1, complaint with a root message, two replies and a nested reply
+	userID, token := createTestUser(t)
+	complaintID := testutils.InsertComplaint(userID, "Thread", "Threaded complaint", "Created")
+
+	rootID := insertComplaintMessage(t, complaintID, userID, nil, "root")
+	firstReply := insertComplaintMessage(t, complaintID, userID, &rootID, "first reply")
+	insertComplaintMessage(t, complaintID, userID, &rootID, "second reply")
+	insertComplaintMessage(t, complaintID, userID, &firstReply, "nested reply")
+
+	// 2, request the thread with one reply per message
+	url := fmt.Sprintf("%s/complaints/%d/messages?view=thread&replies_limit=1&max_depth=5", testServer.URL, complaintID)
+	req, err := http.NewRequest("GET", url, nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// 3, decode and check the tree shape
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	var respPayload testutils.GenericAPIResponse[models.MessageThread]
+	err = json.Unmarshal(body, &respPayload)
+	if err != nil {
+		t.Fatalf("Failed to parse response: %v\nResponse body: %s", err, string(body))
+	}
+
+	thread := respPayload.Data
+	assert.Equal(t, 1, thread.Total)
+	if assert.Len(t, thread.Messages, 1) {
+		root := thread.Messages[0]
+		assert.Equal(t, rootID, root.ID)
+		assert.Equal(t, 2, root.ReplyCount)
+		if assert.Len(t, root.Replies, 1, "replies_limit should cap the loaded replies") {
+			assert.Equal(t, firstReply, root.Replies[0].ID)
+			assert.Equal(t, 1, root.Replies[0].Depth)
+			assert.Len(t, root.Replies[0].Replies, 1)
+		}
+	}
+}
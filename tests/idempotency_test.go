@@ -0,0 +1,225 @@
+package tests
+
+import (
+	"Complaingo/internal/breaker"
+	"Complaingo/internal/domain/models"
+	appErrors "Complaingo/internal/errors"
+	"Complaingo/internal/idempotency"
+	"Complaingo/internal/middleware"
+	"Complaingo/testutils"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/joomcode/errorx"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryIdempotencyStore keeps keys in a map, like the redis store would.
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryIdempotencyEntry
+}
+
+type memoryIdempotencyEntry struct {
+	fingerprint string
+	resp        *models.IdempotentResponse
+}
+
+func (s *memoryIdempotencyStore) Begin(ctx context.Context, req idempotency.Request, lock time.Duration) (*models.IdempotentResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := fmt.Sprintf("%d:%s", req.UserID, req.Key)
+	e, ok := s.entries[k]
+	if !ok {
+		s.entries[k] = &memoryIdempotencyEntry{fingerprint: req.Fingerprint}
+		return nil, nil
+	}
+	return idempotency.Existing(req, e.fingerprint, e.resp)
+}
+
+func (s *memoryIdempotencyStore) Complete(ctx context.Context, req idempotency.Request, resp *models.IdempotentResponse, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[fmt.Sprintf("%d:%s", req.UserID, req.Key)].resp = resp
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(ctx context.Context, req idempotency.Request) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, fmt.Sprintf("%d:%s", req.UserID, req.Key))
+	return nil
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	store := &memoryIdempotencyStore{entries: make(map[string]*memoryIdempotencyEntry)}
+	calls := 0
+	release := make(chan struct{})
+	failNext := false
+	var received []byte
+	h := middleware.Idempotency(store, time.Hour, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		received, _ = io.ReadAll(r.Body)
+		if r.URL.Query().Get("wait") != "" {
+			<-release
+		}
+		if failNext {
+			failNext = false
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		middleware.WriteSuccess(w, calls, "created", http.StatusCreated)
+	}))
+	sendBody := func(path, key, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", path, strings.NewReader(body))
+		r = r.WithContext(context.WithValue(r.Context(), middleware.ContextUserID, 7))
+		if key != "" {
+			r.Header.Set("Idempotency-Key", key)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	send := func(path, key string) *httptest.ResponseRecorder {
+		return sendBody(path, key, "")
+	}
+
+	// 1, a retry gets the first response without running the handler again
+	first := send("/complaints", "k1")
+	retry := send("/complaints", "k1")
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, 1, calls)
+
+	// 2, without a key, every request runs
+	send("/complaints", "")
+	assert.Equal(t, 2, calls)
+
+	// 3, a key can't be reused for another endpoint or body, or be garbage
+	assert.Equal(t, http.StatusUnprocessableEntity, send("/complaints/1/reply", "k1").Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, sendBody("/complaints", "k1", `{"subject":"other"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, send("/complaints", "has space").Code)
+
+	// 4, server errors aren't kept, the retry runs again
+	failNext = true
+	assert.Equal(t, http.StatusInternalServerError, send("/complaints", "k2").Code)
+	assert.Equal(t, http.StatusCreated, send("/complaints", "k2").Code)
+	assert.Equal(t, 4, calls)
+
+	// 5, a duplicate sent while the first is running gets a 409
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- send("/complaints?wait=1", "k3") }()
+	assert.Eventually(t, func() bool {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		_, ok := store.entries["7:k3"]
+		return ok
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, http.StatusConflict, send("/complaints", "k3").Code)
+	close(release)
+	assert.Equal(t, http.StatusCreated, (<-done).Code)
+
+	// 6, large bodies reach the handler whole and are told apart too
+	upload := strings.Repeat("x", 3<<20)
+	assert.Equal(t, http.StatusCreated, sendBody("/complaints", "k4", upload).Code)
+	assert.Equal(t, upload, string(received))
+	assert.Equal(t, "true", sendBody("/complaints", "k4", upload).Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, http.StatusUnprocessableEntity, sendBody("/complaints", "k4", upload+"y").Code)
+}
+
+// failingIdempotencyStore fails like redis does when it is unreachable.
+type failingIdempotencyStore struct {
+	calls atomic.Int32
+}
+
+func (s *failingIdempotencyStore) Begin(ctx context.Context, req idempotency.Request, lock time.Duration) (*models.IdempotentResponse, error) {
+	s.calls.Add(1)
+	return nil, appErrors.ErrDbFailure.New("connection refused")
+}
+
+func (s *failingIdempotencyStore) Complete(ctx context.Context, req idempotency.Request, resp *models.IdempotentResponse, ttl time.Duration) error {
+	s.calls.Add(1)
+	return appErrors.ErrDbFailure.New("connection refused")
+}
+
+func (s *failingIdempotencyStore) Release(ctx context.Context, req idempotency.Request) error {
+	s.calls.Add(1)
+	return appErrors.ErrDbFailure.New("connection refused")
+}
+
+func TestIdempotencyFallbackStore(t *testing.T) {
+	ctx := context.Background()
+	primary := &failingIdempotencyStore{}
+	fallback := &memoryIdempotencyStore{entries: make(map[string]*memoryIdempotencyEntry)}
+	b := breaker.New("redis", 2, time.Minute, time.Second)
+	store := idempotency.NewFallbackStore(primary, fallback, b)
+	req := idempotency.Request{UserID: 7, Key: "k1", Fingerprint: "POST /complaints"}
+
+	// 1, keys are claimed and answered in the fallback while the primary fails
+	resp, err := store.Begin(ctx, req, time.Minute)
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+	assert.NoError(t, store.Complete(ctx, req, &models.IdempotentResponse{StatusCode: http.StatusCreated}, time.Hour))
+
+	resp, err = store.Begin(ctx, req, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// 2, retries and mismatches are answered by the fallback too
+	_, err = store.Begin(ctx, idempotency.Request{UserID: 7, Key: "k1", Fingerprint: "POST /other"}, time.Minute)
+	assert.True(t, errorx.IsOfType(err, appErrors.ErrUnprocessable))
+
+	// 3, once the breaker is open the primary isn't called at all
+	assert.True(t, b.Open())
+	calls := primary.calls.Load()
+	req.Key = "k2"
+	_, err = store.Begin(ctx, req, time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Release(ctx, req))
+	assert.NotContains(t, fallback.entries, "7:k2")
+	assert.Equal(t, calls, primary.calls.Load())
+}
+
+func TestCreateComplaintRetry(t *testing.T) {
+	userID, token := createTestUser(t)
+	key := fmt.Sprintf("retry-%d", time.Now().UnixNano())
+
+	send := func() *http.Response {
+		body, _ := json.Marshal(map[string]string{"subject": "Flaky", "message": "Sent twice", "status": "Created"})
+		req, err := http.NewRequest("POST", testServer.URL+"/complaints", bytes.NewBuffer(body))
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Idempotency-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	first := decodeData[models.Complaints](t, send())
+	resp := send()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "true", resp.Header.Get("Idempotent-Replayed"))
+	retried := decodeData[models.Complaints](t, resp)
+	assert.Equal(t, first.ID, retried.ID)
+
+	var count int
+	err := testutils.GetTestDB().QueryRow(context.Background(),
+		`SELECT COUNT(*) FROM complaints WHERE user_id=$1 AND subject='Flaky'`, userID).Scan(&count)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
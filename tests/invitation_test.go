@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"Complaingo/internal/domain/models"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterCannotPickRole(t *testing.T) {
+	resp := postJSON(t, "/register", "", map[string]string{
+		"first_name": "Sneaky", "last_name": "Admin", "email": fmt.Sprintf("sneaky-%d@example.com", time.Now().UnixNano()),
+		"password": "alexman", "role": "admin",
+	})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func TestInvitations(t *testing.T) {
+	admin := getTestJWT(1, "admin")
+	email := fmt.Sprintf("invited-%d@example.com", time.Now().UnixNano())
+
+	// 1, an admin invites a new admin and gets the link once
+	resp := postJSON(t, "/invitations", admin, map[string]any{"email": email, "role": "admin", "expires_in_hours": 24})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	created := decodeData[models.CreatedInvitation](t, resp)
+	assert.Equal(t, models.InvitationPending, created.Status)
+	link, err := url.Parse(created.AcceptURL)
+	assert.NoError(t, err)
+	token := link.Query().Get("token")
+
+	resp, err = http.DefaultClient.Do(authorized(t, "GET", "/invitations?status=pending&email="+url.QueryEscape(email), admin))
+	assert.NoError(t, err)
+	assert.Len(t, decodeData[[]models.Invitation](t, resp), 1)
+
+	// 2, the invitee picks a password, once
+	accept := map[string]string{"token": token, "first_name": "Invited", "last_name": "Admin", "password": "alexman"}
+	resp = postJSON(t, "/auth/invitations/accept", "", accept)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	user := decodeData[models.User](t, resp)
+	assert.Equal(t, email, user.Email)
+	assert.Equal(t, "admin", user.Role)
+	assert.True(t, user.EmailVerified)
+	assert.Empty(t, user.Password)
+
+	resp = postJSON(t, "/auth/invitations/accept", "", accept)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = postJSON(t, "/login", "", map[string]string{"email": email, "password": "alexman"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp.Body.Close()
+
+	// 3, members can't be invited again, revoked invitations can't be used
+	resp = postJSON(t, "/invitations", admin, map[string]any{"email": email, "role": "user"})
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp.Body.Close()
+
+	other := fmt.Sprintf("revoked-%d@example.com", time.Now().UnixNano())
+	resp = postJSON(t, "/invitations", admin, map[string]any{"email": other, "role": "user"})
+	created = decodeData[models.CreatedInvitation](t, resp)
+	assert.Equal(t, http.StatusOK, deleteWithToken(t, fmt.Sprintf("/invitations/%d", created.ID), admin))
+	assert.Equal(t, http.StatusNotFound, deleteWithToken(t, fmt.Sprintf("/invitations/%d", created.ID), admin))
+
+	link, _ = url.Parse(created.AcceptURL)
+	accept["token"] = link.Query().Get("token")
+	resp = postJSON(t, "/auth/invitations/accept", "", accept)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+
+	// 4, inviters can't hand out more than they have
+	inviter := fmt.Sprintf("inviter-%d", time.Now().UnixNano()%1000000)
+	resp = postJSON(t, "/roles", admin, map[string]any{"name": inviter, "permissions": []string{models.PermUserInvite, models.PermUserRead}})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = postJSON(t, "/invitations", getTestJWT(1, inviter), map[string]any{"email": "boss@example.com", "role": "admin"})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func authorized(t *testing.T, method, path, token string) *http.Request {
+	req, err := http.NewRequest(method, testServer.URL+path, nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"Complaingo/internal/auth"
+	"Complaingo/internal/domain/models"
+	"Complaingo/testutils"
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/joomcode/errorx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginGuard(t *testing.T) {
+	ctx := context.Background()
+	guard := auth.NewLoginGuard(auth.NewMemoryFailureCounter(), auth.LoginPolicy{
+		MaxAccountFailures: 4,
+		MaxIPFailures:      6,
+		BackoffAfter:       2,
+		BackoffBase:        20 * time.Millisecond,
+		BackoffMax:         50 * time.Millisecond,
+		Window:             time.Minute,
+		Lockout:            time.Minute,
+	})
+
+	// 1, the delay doubles per failure and stops at the maximum
+	assert.Equal(t, time.Duration(0), guard.Backoff(1))
+	assert.Equal(t, 20*time.Millisecond, guard.Backoff(2))
+	assert.Equal(t, 40*time.Millisecond, guard.Backoff(3))
+	assert.Equal(t, 50*time.Millisecond, guard.Backoff(10))
+
+	// 2, after two failures the account has to wait, other accounts don't
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, guard.Check(ctx, "a@b.com", "10.0.0.1"))
+		locked, err := guard.Fail(ctx, "A@b.com", "10.0.0.1")
+		assert.NoError(t, err)
+		assert.False(t, locked)
+	}
+	err := guard.Check(ctx, "a@b.com", "10.0.0.1")
+	assert.True(t, errorx.IsOfType(err, appErrors.ErrTooManyRequests))
+	assert.False(t, errorx.IsOfType(err, appErrors.ErrAccountLocked))
+	assert.NoError(t, guard.Check(ctx, "c@d.com", "10.0.0.1"))
+
+	time.Sleep(25 * time.Millisecond)
+	assert.NoError(t, guard.Check(ctx, "a@b.com", "10.0.0.1"))
+
+	// 3, the fourth failure locks the account until an admin unlocks it
+	guard.Fail(ctx, "a@b.com", "10.0.0.1")
+	locked, _ := guard.Fail(ctx, "a@b.com", "10.0.0.1")
+	assert.True(t, locked)
+	time.Sleep(60 * time.Millisecond)
+	err = guard.Check(ctx, "a@b.com", "10.0.0.1")
+	assert.True(t, errorx.IsOfType(err, appErrors.ErrAccountLocked))
+
+	assert.NoError(t, guard.Unlock(ctx, "a@b.com"))
+	assert.NoError(t, guard.Check(ctx, "a@b.com", "10.0.0.2"))
+
+	// 4, the address is locked separately, for every account
+	guard.Fail(ctx, "e@f.com", "10.0.0.1")
+	guard.Fail(ctx, "g@h.com", "10.0.0.1")
+	err = guard.Check(ctx, "new@account.com", "10.0.0.1")
+	assert.True(t, errorx.IsOfType(err, appErrors.ErrTooManyRequests))
+	assert.NoError(t, guard.Check(ctx, "new@account.com", "10.0.0.3"))
+}
+
+func TestLoginLockoutAndAudit(t *testing.T) {
+	email := fmt.Sprintf("lockout-%d@example.com", time.Now().UnixNano())
+	var userID int
+	err := testutils.GetTestDB().QueryRow(context.Background(), `
+	INSERT INTO users (first_name, last_name, email, password, role_id) VALUES ('Lock', 'Out', $1, $2, 2) RETURNING id`,
+		email, testPasswordHash).Scan(&userID)
+	assert.NoError(t, err)
+
+	// 1, repeated wrong passwords make the account back off
+	for i := 0; i < 3; i++ {
+		resp := postJSON(t, "/login", "", map[string]string{"email": email, "password": "wrongpass"})
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		resp.Body.Close()
+	}
+	resp := postJSON(t, "/login", "", map[string]string{"email": email, "password": "alexman"})
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+	resp.Body.Close()
+
+	// 2, every attempt is in the audit log, visible to admins only
+	admin := getTestJWT(1, "admin")
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s/admin/login-audit?user_id=%d", testServer.URL, userID), nil)
+	req.Header.Set("Authorization", "Bearer "+admin)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	attempts := decodeData[[]models.LoginAttempt](t, resp)
+	assert.Len(t, attempts, 4)
+	if len(attempts) == 4 {
+		assert.Equal(t, models.LoginThrottled, attempts[0].Reason)
+		assert.Equal(t, models.LoginBadPassword, attempts[3].Reason)
+		assert.False(t, attempts[3].Success)
+	}
+
+	assert.Equal(t, http.StatusForbidden, getWithToken(t, "/admin/login-audit", getTestJWT(userID, "user")))
+
+	// 3, an admin unlock lets the owner straight back in
+	resp = postJSON(t, fmt.Sprintf("/users/%d/unlock", userID), admin, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = postJSON(t, "/login", "", map[string]string{"email": email, "password": "alexman"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp.Body.Close()
+}
@@ -1,7 +1,7 @@
 package tests
 
 import (
-	redis "Complaingo/internal/redis"
+	"Complaingo/internal/domain/models"
 	"Complaingo/testutils"
 	"bytes"
 	"context"
@@ -18,7 +18,6 @@ func TestUserLogin(t *testing.T) {
 	testutils.CleanTestDB()
 	defer testutils.CleanTestDB()
 
-	redis.ConnectRedis()
 	db := testutils.GetTestDB()
 
 	// 2, insert required role and test user
@@ -49,11 +48,12 @@ func TestUserLogin(t *testing.T) {
 	respBody, _ := io.ReadAll(resp.Body)
 
 	// 5, decode response
-	var response testutils.GenericAPIResponse[string]
+	var response testutils.GenericAPIResponse[models.TokenPair]
 	err = json.Unmarshal(respBody, &response)
 	assert.NoError(t, err)
 
 	// assert values
 	assert.Equal(t, http.StatusCreated, resp.StatusCode)
-	assert.NotEmpty(t, response.Data, "Token should not be empty")
+	assert.NotEmpty(t, response.Data.AccessToken, "Token should not be empty")
+	assert.NotEmpty(t, response.Data.RefreshToken, "Refresh token should not be empty")
 }
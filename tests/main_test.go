@@ -12,6 +12,12 @@ import (
 
 var testServer *httptest.Server
 
+// mockOIDC is the identity provider single sign-on tests log in through
+var mockOIDC *testutils.MockOIDC
+
+// legacyUploadDir is where documents keyed "legacy/" are read from
+var legacyUploadDir string
+
 func TestMain(m *testing.M) {
 	// get the shared DB connection
 	db := testutils.GetTestDB()
@@ -25,8 +31,23 @@ func TestMain(m *testing.M) {
 	// Setup test server
 	// load .env.test environment
 	cfg := config.LoadConfig()
+	legacyUploadDir = cfg.LegacyUploadDir
+	// point single sign-on at a local identity provider
+	mockOIDC = testutils.NewMockOIDC("complaingo-test", "test-client-secret")
+	defer mockOIDC.Close()
+	cfg.OIDCIssuerURL = mockOIDC.URL
+	cfg.OIDCClientID = mockOIDC.ClientID
+	cfg.OIDCClientSecret = mockOIDC.ClientSecret
+	cfg.OIDCRedirectURL = "http://complaingo.test/auth/oidc/callback"
+	cfg.OIDCRoleMapping = map[string]string{"complaingo-admins": "admin", "complaingo-staff": "user"}
+	cfg.OIDCDefaultRole = ""
+	// answer AI requests offline
+	cfg.AIProvider = "mock"
+	// uploads are scanned for the EICAR test string, and kept small
+	cfg.Scanner = "fake"
+	cfg.UploadMaxBytesUser = 1 << 20
 	// build full http.Handler with routes and middleware
-	r := router.NewRouter(cfg, db, nil)
+	r := router.NewRouter(cfg, db, nil, nil)
 	// start a test server
 	testServer = httptest.NewServer(r)
 	// shuts it down after tests
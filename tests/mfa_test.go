@@ -0,0 +1,168 @@
+package tests
+
+import (
+	"Complaingo/internal/auth"
+	"Complaingo/internal/domain/models"
+	"Complaingo/testutils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 test vector, truncated to 6 digits
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	code, err := auth.TOTPCode(secret, 59/auth.TOTPPeriod)
+	assert.NoError(t, err)
+	assert.Equal(t, "287082", code)
+
+	now := time.Unix(59, 0)
+	step, ok := auth.VerifyTOTP(secret, "287082", now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), step)
+
+	// a used step is not accepted again, neither are wrong codes
+	_, ok = auth.VerifyTOTP(secret, "287082", now, step)
+	assert.False(t, ok)
+	_, ok = auth.VerifyTOTP(secret, "000000", now, 0)
+	assert.False(t, ok)
+
+	// one step of clock drift is tolerated, two are not
+	_, ok = auth.VerifyTOTP(secret, "287082", now.Add(auth.TOTPPeriod*time.Second), 0)
+	assert.True(t, ok)
+	_, ok = auth.VerifyTOTP(secret, "287082", now.Add(2*auth.TOTPPeriod*time.Second), 0)
+	assert.False(t, ok)
+
+	uri, err := url.Parse(auth.ProvisioningURI("Complaingo", "a@b.com", secret))
+	assert.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, secret, uri.Query().Get("secret"))
+	assert.Equal(t, "Complaingo", uri.Query().Get("issuer"))
+}
+
+func TestRecoveryCodesAndSecretBox(t *testing.T) {
+	codes, err := auth.NewRecoveryCodes(10)
+	assert.NoError(t, err)
+	assert.Len(t, codes, 10)
+	assert.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, codes[0])
+
+	// typed back without the dash or in capitals it still matches
+	assert.Equal(t, auth.HashRecoveryCode(codes[0]), auth.HashRecoveryCode(strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))))
+
+	box, err := auth.NewSecretBox("test_secret")
+	assert.NoError(t, err)
+	sealed, err := box.Seal("GEZDGNBVGY3TQOJQ")
+	assert.NoError(t, err)
+	assert.NotContains(t, sealed, "GEZDGNBVGY3TQOJQ")
+
+	opened, err := box.Open(sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, "GEZDGNBVGY3TQOJQ", opened)
+
+	other, _ := auth.NewSecretBox("another")
+	_, err = other.Open(sealed)
+	assert.Error(t, err)
+}
+
+func TestChallengeTokensAreNotAccessTokens(t *testing.T) {
+	svc, err := auth.NewTokenService(auth.TokenConfig{Issuer: "complaingo", Audience: "complaingo-api", Secret: "test_secret"})
+	assert.NoError(t, err)
+
+	challenge, err := svc.IssueChallenge(7, true, time.Minute)
+	assert.NoError(t, err)
+	_, err = svc.Parse(challenge.Token)
+	assert.Error(t, err)
+
+	claims, err := svc.ParseChallenge(challenge.Token)
+	assert.NoError(t, err)
+	assert.True(t, claims.Enroll)
+
+	access, _ := svc.Issue(7, "a@b.com", "admin", time.Minute)
+	_, err = svc.ParseChallenge(access.Token)
+	assert.Error(t, err)
+}
+
+func decodeData[T any](t *testing.T, resp *http.Response) T {
+	defer resp.Body.Close()
+	var response testutils.GenericAPIResponse[T]
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+	return response.Data
+}
+
+func currentCode(t *testing.T, secret string, offset int64) string {
+	code, err := auth.TOTPCode(secret, auth.TOTPStep(time.Now())+offset)
+	assert.NoError(t, err)
+	return code
+}
+
+func TestMFALogin(t *testing.T) {
+	email := fmt.Sprintf("mfa-%d@example.com", time.Now().UnixNano())
+	_, err := testutils.GetTestDB().Exec(context.Background(), `
+	INSERT INTO users (first_name, last_name, email, password, role_id) VALUES ('Mfa', 'Admin', $1, $2, 1)`,
+		email, testPasswordHash)
+	assert.NoError(t, err)
+	credentials := map[string]string{"email": email, "password": "alexman"}
+
+	resp := postJSON(t, "/login", "", credentials)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	session := decodeTokens(t, resp)
+
+	// 1, enrol: the setup is only enabled once a code checks out
+	resp = postJSON(t, "/auth/mfa/setup", session.AccessToken, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	setup := decodeData[models.MFASetup](t, resp)
+	assert.Contains(t, setup.ProvisioningURI, "secret="+setup.Secret)
+
+	resp = postJSON(t, "/auth/mfa/confirm", session.AccessToken, map[string]string{"code": "000000"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = postJSON(t, "/auth/mfa/confirm", session.AccessToken, map[string]string{"code": currentCode(t, setup.Secret, 0)})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	enrollment := decodeData[models.MFAEnrollment](t, resp)
+	assert.Len(t, enrollment.RecoveryCodes, 10)
+
+	// 2, the password alone now only yields a challenge
+	resp = postJSON(t, "/login", "", credentials)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	challenge := decodeData[models.MFAChallenge](t, resp)
+	assert.NotEmpty(t, challenge.ChallengeToken)
+	assert.False(t, challenge.EnrollmentRequired)
+	assert.Equal(t, http.StatusUnauthorized, getWithToken(t, "/users", challenge.ChallengeToken))
+
+	// the code used to confirm can't be replayed, the next one works once
+	resp = postJSON(t, "/auth/mfa/verify", "", map[string]string{"challenge_token": challenge.ChallengeToken, "code": currentCode(t, setup.Secret, 0)})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+
+	next := currentCode(t, setup.Secret, 1)
+	resp = postJSON(t, "/auth/mfa/verify", "", map[string]string{"challenge_token": challenge.ChallengeToken, "code": next})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	tokens := decodeTokens(t, resp)
+	assert.Equal(t, http.StatusOK, getWithToken(t, "/users", tokens.AccessToken))
+
+	resp = postJSON(t, "/auth/mfa/verify", "", map[string]string{"challenge_token": challenge.ChallengeToken, "code": next})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+
+	// 3, a recovery code stands in for the app, but only once
+	resp = postJSON(t, "/login", "", credentials)
+	challenge = decodeData[models.MFAChallenge](t, resp)
+	resp = postJSON(t, "/auth/mfa/verify", "", map[string]string{"challenge_token": challenge.ChallengeToken, "recovery_code": enrollment.RecoveryCodes[0]})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = postJSON(t, "/login", "", credentials)
+	challenge = decodeData[models.MFAChallenge](t, resp)
+	resp = postJSON(t, "/auth/mfa/verify", "", map[string]string{"challenge_token": challenge.ChallengeToken, "recovery_code": enrollment.RecoveryCodes[0]})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+}
@@ -0,0 +1,168 @@
+package tests
+
+import (
+	"Complaingo/internal/oidc"
+	"Complaingo/testutils"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"testing"
+	"time"
+
+	appErrors "Complaingo/internal/errors"
+
+	"github.com/joomcode/errorx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOIDCVerifyIDToken(t *testing.T) {
+	provider := testutils.NewMockOIDC("client", "secret")
+	defer provider.Close()
+	p := oidc.NewProvider(oidc.Config{IssuerURL: provider.URL, ClientID: "client", ClientSecret: "secret"})
+	ctx := context.Background()
+	user := testutils.MockOIDCUser{Subject: "s-1", Email: "Sso@Example.com", EmailVerified: true, Groups: []string{"staff"}}
+
+	identity, err := p.VerifyIDToken(ctx, provider.SignIDToken(provider.IDTokenClaims(user, "n-1")), "n-1")
+	assert.NoError(t, err)
+	assert.Equal(t, provider.URL, identity.Issuer)
+	assert.Equal(t, "s-1", identity.Subject)
+	assert.Equal(t, "sso@example.com", identity.Email)
+	assert.Equal(t, []string{"staff"}, identity.Groups)
+
+	// replayed into another login
+	_, err = p.VerifyIDToken(ctx, provider.SignIDToken(provider.IDTokenClaims(user, "n-1")), "n-2")
+	assert.True(t, errorx.IsOfType(err, appErrors.ErrUnauthorized))
+
+	// issued to another client
+	claims := provider.IDTokenClaims(user, "n-1")
+	claims["aud"] = "someone-else"
+	_, err = p.VerifyIDToken(ctx, provider.SignIDToken(claims), "n-1")
+	assert.True(t, errorx.IsOfType(err, appErrors.ErrUnauthorized))
+
+	// expired
+	claims = provider.IDTokenClaims(user, "n-1")
+	claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	_, err = p.VerifyIDToken(ctx, provider.SignIDToken(claims), "n-1")
+	assert.True(t, errorx.IsOfType(err, appErrors.ErrUnauthorized))
+
+	// issued by another provider
+	claims = provider.IDTokenClaims(user, "n-1")
+	claims["iss"] = "https://evil.example.com"
+	_, err = p.VerifyIDToken(ctx, provider.SignIDToken(claims), "n-1")
+	assert.True(t, errorx.IsOfType(err, appErrors.ErrUnauthorized))
+
+	// the code only redeems with the verifier its challenge was made from
+	verifier, challenge, err := oidc.NewPKCE()
+	assert.NoError(t, err)
+	authURL, err := p.AuthCodeURL(ctx, "state", "n-3", challenge)
+	assert.NoError(t, err)
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := noRedirect.Get(authURL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	back, _ := url.Parse(resp.Header.Get("Location"))
+	code := back.Query().Get("code")
+
+	_, err = p.Exchange(ctx, code, verifier+"x", "n-3")
+	assert.Error(t, err)
+	// and only once, even after a failed attempt
+	_, err = p.Exchange(ctx, code, verifier, "n-3")
+	assert.Error(t, err)
+}
+
+// ssoLogin runs the browser side of the login: the API redirects to the
+// provider, which redirects straight back to the callback.
+func ssoLogin(t *testing.T, user testutils.MockOIDCUser) *http.Response {
+	mockOIDC.SetUser(user)
+	jar, _ := cookiejar.New(nil)
+	browser := &http.Client{Jar: jar, CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	resp, err := browser.Get(testServer.URL + "/auth/oidc/login")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+
+	resp, err = browser.Get(resp.Header.Get("Location"))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+
+	// the registered redirect URL is the public one, the test server is elsewhere
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	assert.NoError(t, err)
+	resp, err = browser.Get(testServer.URL + callback.Path + "?" + callback.RawQuery)
+	assert.NoError(t, err)
+	return resp
+}
+
+func TestOIDCLogin(t *testing.T) {
+	suffix := time.Now().UnixNano()
+
+	// 1, a new admin is provisioned with the role their group maps to
+	admin := testutils.MockOIDCUser{
+		Subject: fmt.Sprintf("admin-%d", suffix), Email: fmt.Sprintf("sso-admin-%d@example.com", suffix),
+		EmailVerified: true, GivenName: "Sso", FamilyName: "Admin", Groups: []string{"complaingo-admins"},
+	}
+	resp := ssoLogin(t, admin)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	tokens := decodeTokens(t, resp)
+	assert.Equal(t, http.StatusOK, getWithToken(t, "/users", tokens.AccessToken))
+
+	// the session refreshes like any other
+	resp = postJSON(t, "/auth/refresh", "", map[string]string{"refresh_token": tokens.RefreshToken})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	// logging in again reuses the account
+	resp = ssoLogin(t, admin)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp.Body.Close()
+	var accounts int
+	err := testutils.GetTestDB().QueryRow(context.Background(), `SELECT COUNT(*) FROM users WHERE email=$1`, admin.Email).Scan(&accounts)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, accounts)
+
+	// 2, an existing local account is linked by its verified email and its
+	// role follows the provider
+	email := fmt.Sprintf("sso-local-%d@example.com", suffix)
+	var userID int
+	err = testutils.GetTestDB().QueryRow(context.Background(), `
+	INSERT INTO users (first_name, last_name, email, password, role_id) VALUES ('Local', 'User', $1, $2, 1) RETURNING id`,
+		email, testPasswordHash).Scan(&userID)
+	assert.NoError(t, err)
+
+	local := testutils.MockOIDCUser{Subject: fmt.Sprintf("local-%d", suffix), Email: email, EmailVerified: true, Groups: []string{"complaingo-staff"}}
+	resp = ssoLogin(t, local)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	tokens = decodeTokens(t, resp)
+	assert.Equal(t, http.StatusForbidden, getWithToken(t, "/admin/login-audit", tokens.AccessToken))
+
+	var linked int
+	err = testutils.GetTestDB().QueryRow(context.Background(), `SELECT user_id FROM user_identities WHERE subject=$1`, local.Subject).Scan(&linked)
+	assert.NoError(t, err)
+	assert.Equal(t, userID, linked)
+
+	// 3, an unverified email can't take over an account
+	local.Subject = fmt.Sprintf("impostor-%d", suffix)
+	local.EmailVerified = false
+	resp = ssoLogin(t, local)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp.Body.Close()
+
+	// 4, without a mapped group there is no default role to fall back on
+	resp = ssoLogin(t, testutils.MockOIDCUser{
+		Subject: fmt.Sprintf("outsider-%d", suffix), Email: fmt.Sprintf("sso-outsider-%d@example.com", suffix),
+		EmailVerified: true, Groups: []string{"marketing"},
+	})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp.Body.Close()
+
+	// 5, a callback the browser didn't start is refused
+	req, _ := http.NewRequest("GET", testServer.URL+"/auth/oidc/callback?code=abc&state=def", nil)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+}
@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"Complaingo/internal/domain/models"
+	"Complaingo/testutils"
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatchUserKeepsOtherColumns(t *testing.T) {
+	admin := getTestJWT(1, "admin")
+	userID, email := createVerifiedUser(t, "patch")
+
+	// 1, only the given field changes, password and role stay
+	resp := patchJSON(t, fmt.Sprintf("/users/%d", userID), admin, map[string]string{"last_name": "Patched"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	user := decodeData[models.User](t, resp)
+	assert.Equal(t, "Life", user.FirstName)
+	assert.Equal(t, "Patched", user.LastName)
+	assert.Equal(t, "user", user.Role)
+
+	resp = postJSON(t, "/login", "", map[string]string{"email": email, "password": "alexman"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp.Body.Close()
+
+	// 2, passwords, unknown fields, bad values and empty patches are refused
+	for _, body := range []map[string]any{
+		{"password": "plaintext"},
+		{"role": "admin"},
+		{"email": "not-an-email"},
+		{"first_name": ""},
+		{},
+	} {
+		resp = patchJSON(t, fmt.Sprintf("/users/%d", userID), admin, body)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, body)
+		resp.Body.Close()
+	}
+}
+
+func TestEditComplaintUntilAccepted(t *testing.T) {
+	_, token := createTestUser(t)
+	_, other := createTestUser(t)
+
+	resp := postJSON(t, "/complaints", token, map[string]string{"subject": "Typo", "message": "Orignal text", "status": "Created"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	complaint := decodeData[models.Complaints](t, resp)
+	path := fmt.Sprintf("/complaints/%d", complaint.ID)
+
+	// 1, the author fixes the message, the subject stays
+	resp = patchJSON(t, path, token, map[string]string{"message": "Original text"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	edited := decodeData[models.Complaints](t, resp)
+	assert.Equal(t, "Typo", edited.Subject)
+	assert.Equal(t, "Original text", edited.Message)
+
+	// 2, nobody else can, and nobody can once it is accepted
+	resp = patchJSON(t, path, other, map[string]string{"message": "Hijacked"})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = patchJSON(t, path, token, map[string]string{"status": "Resolved"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = patchJSON(t, path+"/status", getTestJWT(1, "admin"), map[string]string{"status": "Accepted"})
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = patchJSON(t, path, token, map[string]string{"message": "Too late"})
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func TestRenameDocument(t *testing.T) {
+	userID, token := createTestUser(t)
+	var docID int
+	err := testutils.GetTestDB().QueryRow(context.Background(), `
+	INSERT INTO documents (user_id, file_name, storage_key) VALUES ($1, 'scan.pdf', 'test/scan.pdf') RETURNING id`, userID).Scan(&docID)
+	assert.NoError(t, err)
+	path := fmt.Sprintf("/documents/%d", docID)
+
+	resp := patchJSON(t, path, token, map[string]string{"file_name": "invoice.pdf"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	doc := decodeData[models.Document](t, resp)
+	assert.Equal(t, "invoice.pdf", doc.FileName)
+	assert.Equal(t, "test/scan.pdf", doc.StorageKey)
+
+	resp = patchJSON(t, path, token, map[string]string{"file_name": "../../etc/passwd"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+
+	_, other := createTestUser(t)
+	resp = patchJSON(t, path, other, map[string]string{"file_name": "mine.pdf"})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp.Body.Close()
+}
@@ -0,0 +1,168 @@
+package tests
+
+import (
+	"Complaingo/internal/domain/models"
+	"Complaingo/internal/middleware"
+	"Complaingo/internal/repository"
+	"Complaingo/internal/usecase"
+	"Complaingo/internal/validation"
+	"Complaingo/testutils"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingRoleRepo serves permissions from memory and counts the lookups.
+type countingRoleRepo struct {
+	repository.RoleRepository
+	perms   map[string][]string
+	lookups int
+}
+
+func (r *countingRoleRepo) GetRolePermissions(ctx context.Context, role string) ([]string, error) {
+	r.lookups++
+	return r.perms[role], nil
+}
+
+func (r *countingRoleRepo) GetPermissions(ctx context.Context) ([]*models.Permission, error) {
+	return []*models.Permission{{Name: models.PermComplaintReadAny}, {Name: models.PermAuditRead}}, nil
+}
+
+func (r *countingRoleRepo) UpdateRole(ctx context.Context, role *models.RoleDefinition) error {
+	r.perms[role.Name] = role.Permissions
+	return nil
+}
+
+func (r *countingRoleRepo) GetRole(ctx context.Context, name string) (*models.RoleDefinition, error) {
+	return &models.RoleDefinition{Name: name, Permissions: r.perms[name]}, nil
+}
+
+func TestRequirePermission(t *testing.T) {
+	repo := &countingRoleRepo{perms: map[string][]string{"auditor": {models.PermAuditRead}}}
+	roles := usecase.NewRoleUsecase(repo, time.Minute)
+
+	handler := middleware.Permissions(roles)(middleware.RequirePermission(models.PermAuditRead)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.False(t, middleware.HasPermission(r.Context(), models.PermComplaintReadAny))
+			w.WriteHeader(http.StatusOK)
+		})))
+	serve := func(role string) int {
+		req := httptest.NewRequest("GET", "/admin/login-audit", nil)
+		req = req.WithContext(context.WithValue(req.Context(), middleware.ContextRole, role))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// 1, the role's permissions decide, and are only looked up once
+	assert.Equal(t, http.StatusOK, serve("auditor"))
+	assert.Equal(t, http.StatusOK, serve("auditor"))
+	assert.Equal(t, 1, repo.lookups)
+	assert.Equal(t, http.StatusForbidden, serve("nobody"))
+
+	// 2, a change drops the cached answer straight away
+	_, err := roles.UpdateRole(context.Background(), validation.RoleInput{Name: "auditor", Permissions: []string{models.PermComplaintReadAny}})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, serve("auditor"))
+	assert.Equal(t, 3, repo.lookups)
+
+	// 3, unknown permissions and the admin role are refused
+	_, err = roles.UpdateRole(context.Background(), validation.RoleInput{Name: "auditor", Permissions: []string{"complaint:everything"}})
+	assert.Error(t, err)
+	_, err = roles.UpdateRole(context.Background(), validation.RoleInput{Name: "admin"})
+	assert.Error(t, err)
+}
+
+func TestCustomRoles(t *testing.T) {
+	admin := getTestJWT(1, "admin")
+	name := fmt.Sprintf("supervisor-%d", time.Now().UnixNano()%1000000)
+
+	// 1, admins create a role out of the catalogue
+	resp := postJSON(t, "/roles", admin, map[string]any{
+		"name": name, "description": "Handles complaints",
+		"permissions": []string{models.PermComplaintReadAny, models.PermComplaintUpdateStatus},
+	})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	role := decodeData[models.RoleDefinition](t, resp)
+	assert.ElementsMatch(t, []string{models.PermComplaintReadAny, models.PermComplaintUpdateStatus}, role.Permissions)
+
+	resp = postJSON(t, "/roles", admin, map[string]any{"name": name})
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp.Body.Close()
+	resp = postJSON(t, "/roles", admin, map[string]any{"name": "typo", "permissions": []string{"complaint:read:all"}})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+
+	// 2, a user moved to the role is signed out of their old one
+	email := fmt.Sprintf("supervisor-%d@example.com", time.Now().UnixNano())
+	var userID int
+	err := testutils.GetTestDB().QueryRow(context.Background(), `
+	INSERT INTO users (first_name, last_name, email, password, role_id) VALUES ('Super', 'Visor', $1, $2, 2) RETURNING id`,
+		email, testPasswordHash).Scan(&userID)
+	assert.NoError(t, err)
+	resp = postJSON(t, "/login", "", map[string]string{"email": email, "password": "alexman"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	session := decodeTokens(t, resp)
+
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("%s/users/%d/role", testServer.URL, userID), strings.NewReader(`{"role": "`+name+`"}`))
+	req.Header.Set("Authorization", "Bearer "+admin)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusUnauthorized, getWithToken(t, "/complaints", session.AccessToken))
+	resp = postJSON(t, "/auth/refresh", "", map[string]string{"refresh_token": session.RefreshToken})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	supervisor := decodeTokens(t, resp)
+
+	// 3, and can do exactly what the role grants
+	assert.Equal(t, http.StatusOK, getWithToken(t, "/complaints", supervisor.AccessToken))
+	assert.Equal(t, http.StatusForbidden, getWithToken(t, "/admin/login-audit", supervisor.AccessToken))
+	assert.Equal(t, http.StatusForbidden, getWithToken(t, "/roles", supervisor.AccessToken))
+
+	// 4, roles in use and built in roles stay
+	assert.Equal(t, http.StatusConflict, deleteWithToken(t, "/roles/"+name, admin))
+	assert.Equal(t, http.StatusForbidden, deleteWithToken(t, "/roles/user", admin))
+}
+
+func TestComplaintListIsScopedToOwner(t *testing.T) {
+	ownerID, owner := createTestUser(t)
+	_, other := createTestUser(t)
+	_, admin := createAdminUser(t)
+	path := fmt.Sprintf("/complaints/user/%d", ownerID)
+
+	// read own only covers the caller's own list
+	assert.Equal(t, http.StatusOK, getWithToken(t, path, owner))
+	assert.Equal(t, http.StatusForbidden, getWithToken(t, path, other))
+	assert.Equal(t, http.StatusOK, getWithToken(t, path, admin))
+}
+
+func deleteWithToken(t *testing.T, path, token string) int {
+	req, _ := http.NewRequest("DELETE", testServer.URL+path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestDebugVarsIsAdminOnly(t *testing.T) {
+	_, user := createTestUser(t)
+	_, admin := createAdminUser(t)
+	auditor := fmt.Sprintf("auditor-%d", time.Now().UnixNano()%1000000)
+	resp := postJSON(t, "/roles", admin, map[string]any{"name": auditor, "permissions": []string{models.PermAuditRead}})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusUnauthorized, getWithToken(t, "/debug/vars", ""))
+	assert.Equal(t, http.StatusForbidden, getWithToken(t, "/debug/vars", user))
+	assert.Equal(t, http.StatusForbidden, getWithToken(t, "/debug/vars", getTestJWT(1, auditor)))
+	assert.Equal(t, http.StatusOK, getWithToken(t, "/debug/vars", admin))
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"testing"
 	"time"
 
@@ -28,9 +29,9 @@ func createAdminUser(t *testing.T) (int, string) {
 	email := fmt.Sprintf("admin-%d@gmail.com", time.Now().UnixNano())
 	err = db.QueryRow(context.Background(), `
         INSERT INTO users 
-            (first_name, last_name, email, password, role_id) 
+            (first_name, last_name, email, password, role_id, email_verified_at) 
         VALUES 
-            ($1, $2, $3, $4, $5)
+            ($1, $2, $3, $4, $5, NOW())
         RETURNING id`,
 		"Admin", "User", email, "$2a$10$hashedpassword", 1,
 	).Scan(&adminID)
@@ -53,9 +54,9 @@ func createTestUser(t *testing.T) (int, string) {
 	email := fmt.Sprintf("user-%d@example.com", time.Now().UnixNano())
 	err = db.QueryRow(context.Background(), `
         INSERT INTO users 
-            (first_name, last_name, email, password, role_id) 
+            (first_name, last_name, email, password, role_id, email_verified_at) 
         VALUES 
-            ($1, $2, $3, $4, $5)
+            ($1, $2, $3, $4, $5, NOW())
         RETURNING id`,
 		"Test", "User", email, "$2a$10$hashedpassword", 2, // role_id 2 = user
 	).Scan(&userID)
@@ -66,9 +67,13 @@ func createTestUser(t *testing.T) (int, string) {
 
 func getTestJWT(userID int, role string) string {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": userID,
-		"role":    role,
-		"exp":     time.Now().Add(time.Hour * 1).Unix(),
+		"sub":  strconv.Itoa(userID),
+		"role": role,
+		"iss":  "complaingo",
+		"aud":  "complaingo-api",
+		"jti":  fmt.Sprintf("test-%d", time.Now().UnixNano()),
+		"iat":  time.Now().Unix(),
+		"exp":  time.Now().Add(time.Hour * 1).Unix(),
 	})
 	signed, err := token.SignedString([]byte("test_secret"))
 	if err != nil {
@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"Complaingo/internal/auth"
+	"Complaingo/internal/breaker"
+	"Complaingo/internal/idempotency"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+const testRedisAddr = "localhost:6379"
+
+// redisProxy forwards connections to the test Redis until it is stopped,
+// which looks to the service like Redis going away.
+type redisProxy struct {
+	addr string
+
+	mu    sync.Mutex
+	ln    net.Listener
+	conns []net.Conn
+}
+
+func startRedisProxy(t *testing.T) *redisProxy {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	p := &redisProxy{addr: ln.Addr().String()}
+	p.serve(ln)
+	t.Cleanup(p.stop)
+	return p
+}
+
+func (p *redisProxy) serve(ln net.Listener) {
+	p.mu.Lock()
+	p.ln = ln
+	p.mu.Unlock()
+
+	go func() {
+		for {
+			client, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			server, err := net.Dial("tcp", testRedisAddr)
+			if err != nil {
+				client.Close()
+				continue
+			}
+			p.mu.Lock()
+			p.conns = append(p.conns, client, server)
+			p.mu.Unlock()
+			go io.Copy(server, client)
+			go io.Copy(client, server)
+		}
+	}()
+}
+
+// stop closes the listener and every open connection.
+func (p *redisProxy) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.ln != nil {
+		p.ln.Close()
+		p.ln = nil
+	}
+	for _, c := range p.conns {
+		c.Close()
+	}
+	p.conns = nil
+}
+
+func (p *redisProxy) restart(t *testing.T) {
+	ln, err := net.Listen("tcp", p.addr)
+	assert.NoError(t, err)
+	p.serve(ln)
+}
+
+func TestRedisOutageAfterStartup(t *testing.T) {
+	ctx := context.Background()
+	direct := goredis.NewClient(&goredis.Options{Addr: testRedisAddr})
+	defer direct.Close()
+	if err := direct.Ping(ctx).Err(); err != nil {
+		t.Skipf("redis is not running: %v", err)
+	}
+
+	// wired like the router does once redis answered at startup
+	proxy := startRedisProxy(t)
+	client := goredis.NewClient(&goredis.Options{Addr: proxy.addr, ContextTimeoutEnabled: true})
+	defer client.Close()
+	b := breaker.New("redis", 2, 100*time.Millisecond, time.Second)
+	denylist := auth.NewFallbackDenylist(auth.NewRedisDenylist(client), auth.NewMemoryDenylist(), b)
+	failures := auth.NewFallbackFailureCounter(auth.NewRedisFailureCounter(client), auth.NewMemoryFailureCounter(), b)
+	keys := idempotency.NewFallbackStore(idempotency.NewRedisStore(client), &memoryIdempotencyStore{entries: make(map[string]*memoryIdempotencyEntry)}, b)
+
+	suffix := fmt.Sprint(time.Now().UnixNano())
+	expires := time.Now().Add(time.Minute)
+	shared := auth.NewRedisDenylist(direct)
+
+	// 1, while redis is up revocations land there
+	assert.NoError(t, denylist.Revoke(ctx, "before-"+suffix, expires))
+	revoked, err := shared.IsRevoked(ctx, "before-"+suffix)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	// 2, redis stops: nothing fails, the fallbacks take over
+	proxy.stop()
+
+	assert.NoError(t, denylist.Revoke(ctx, "during-"+suffix, expires))
+	revoked, err = denylist.IsRevoked(ctx, "during-"+suffix)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+	revoked, err = denylist.IsRevoked(ctx, "other-"+suffix)
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+	_, err = denylist.RevokedBefore(ctx, 1)
+	assert.NoError(t, err)
+
+	count, err := failures.Add(ctx, "ip:"+suffix, time.Now(), time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.NoError(t, failures.Lock(ctx, "ip:"+suffix, time.Minute))
+
+	req := idempotency.Request{UserID: 7, Key: suffix, Fingerprint: "POST /complaints"}
+	resp, err := keys.Begin(ctx, req, time.Minute)
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+	assert.NoError(t, keys.Release(ctx, req))
+
+	assert.True(t, b.Open())
+
+	// 3, once it is back the revocations made meanwhile are shared, and the
+	// lock set meanwhile still holds
+	proxy.restart(t)
+	assert.Eventually(t, func() bool {
+		// checks probe redis once the cooldown is over
+		denylist.IsRevoked(ctx, "other-"+suffix)
+		revoked, _ := shared.IsRevoked(ctx, "during-"+suffix)
+		return revoked
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.False(t, b.Open())
+
+	state, err := failures.Get(ctx, "ip:"+suffix)
+	assert.NoError(t, err)
+	assert.Positive(t, state.LockedFor)
+}
@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"Complaingo/internal/domain/models"
+	"Complaingo/testutils"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// bcrypt hash of "alexman"
+const testPasswordHash = "$2a$10$aY5Qa2sV0oz6GFeOTn0pFOwmHfxEqmEGGdztj2NSA4xfZgBo2GQvW"
+
+func postJSON(t *testing.T, path, token string, payload any) *http.Response {
+	body, _ := json.Marshal(payload)
+	req, err := http.NewRequest("POST", testServer.URL+path, bytes.NewBuffer(body))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	return resp
+}
+
+func decodeTokens(t *testing.T, resp *http.Response) models.TokenPair {
+	defer resp.Body.Close()
+	var response testutils.GenericAPIResponse[models.TokenPair]
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+	return response.Data
+}
+
+func loginTestUser(t *testing.T) models.TokenPair {
+	return loginAs(t, createLoginUser(t))
+}
+
+// createLoginUser inserts a user that logs in with the test password.
+func createLoginUser(t *testing.T) string {
+	email := fmt.Sprintf("refresh-%d@example.com", time.Now().UnixNano())
+	_, err := testutils.GetTestDB().Exec(context.Background(), `
+	INSERT INTO roles (id, name) VALUES (2, 'user') ON CONFLICT DO NOTHING;`)
+	assert.NoError(t, err)
+	_, err = testutils.GetTestDB().Exec(context.Background(), `
+	INSERT INTO users (first_name, last_name, email, password, role_id) VALUES ('Refresh', 'User', $1, $2, 2)`,
+		email, testPasswordHash)
+	assert.NoError(t, err)
+	return email
+}
+
+func loginAs(t *testing.T, email string) models.TokenPair {
+	resp := postJSON(t, "/login", "", map[string]string{"email": email, "password": "alexman"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	return decodeTokens(t, resp)
+}
+
+func getWithToken(t *testing.T, path, token string) int {
+	req, _ := http.NewRequest("GET", testServer.URL+path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	first := loginTestUser(t)
+
+	// 1, a refresh token can be exchanged once for a new pair
+	resp := postJSON(t, "/auth/refresh", "", map[string]string{"refresh_token": first.RefreshToken})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	second := decodeTokens(t, resp)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+
+	// 2, replaying the spent token is reuse and kills the whole session
+	resp = postJSON(t, "/auth/refresh", "", map[string]string{"refresh_token": first.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = postJSON(t, "/auth/refresh", "", map[string]string{"refresh_token": second.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func TestLogoutRevokesTokens(t *testing.T) {
+	tokens := loginTestUser(t)
+	assert.Equal(t, http.StatusOK, getWithToken(t, "/users", tokens.AccessToken))
+
+	// logout denylists the access token and ends the refresh session
+	resp := postJSON(t, "/auth/logout", tokens.AccessToken, map[string]string{"refresh_token": tokens.RefreshToken})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusUnauthorized, getWithToken(t, "/users", tokens.AccessToken))
+
+	resp = postJSON(t, "/auth/refresh", "", map[string]string{"refresh_token": tokens.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func TestLogoutAllSessions(t *testing.T) {
+	email := createLoginUser(t)
+	tokens := loginAs(t, email)
+
+	resp := postJSON(t, "/auth/logout-all", tokens.AccessToken, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	// tokens issued before the cutoff stop working
+	assert.Equal(t, http.StatusUnauthorized, getWithToken(t, "/users", tokens.AccessToken))
+	resp = postJSON(t, "/auth/refresh", "", map[string]string{"refresh_token": tokens.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+
+	// tokens issued right after it, even within the same second, still work
+	fresh := loginAs(t, email)
+	assert.Equal(t, http.StatusOK, getWithToken(t, "/users", fresh.AccessToken))
+}
@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"Complaingo/internal/auth"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTokenService(t *testing.T, signing *auth.Key, verify ...*auth.Key) *auth.TokenService {
+	svc, err := auth.NewTokenService(auth.TokenConfig{
+		Issuer:     "complaingo",
+		Audience:   "complaingo-api",
+		SigningKey: signing,
+		VerifyKeys: verify,
+	})
+	assert.NoError(t, err)
+	return svc
+}
+
+func TestTokenServiceAsymmetricKeys(t *testing.T) {
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	der, _ := x509.MarshalPKCS8PrivateKey(rsaPriv)
+	rsaKey, err := auth.ParseKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	assert.NoError(t, err)
+
+	_, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+	edKey, err := auth.NewKey(edPriv)
+	assert.NoError(t, err)
+
+	// 1, tokens carry the kid and typed claims
+	oldSvc := newTestTokenService(t, rsaKey)
+	issued, err := oldSvc.Issue(42, "a@b.com", "admin", time.Minute)
+	assert.NoError(t, err)
+
+	claims, err := oldSvc.Parse(issued.Token)
+	assert.NoError(t, err)
+	id, _ := claims.UserID()
+	assert.Equal(t, 42, id)
+	assert.Equal(t, "admin", claims.Role)
+	assert.Equal(t, issued.JTI, claims.ID)
+
+	header, _, err := jwt.NewParser().ParseUnverified(issued.Token, &auth.Claims{})
+	assert.NoError(t, err)
+	assert.Equal(t, rsaKey.ID, header.Header["kid"])
+	assert.Equal(t, "RS256", header.Method.Alg())
+
+	// 2, after rotating to Ed25519 the old RSA key still verifies old tokens
+	newSvc := newTestTokenService(t, edKey, &auth.Key{ID: rsaKey.ID, Method: rsaKey.Method, Public: rsaKey.Public})
+	_, err = newSvc.Parse(issued.Token)
+	assert.NoError(t, err)
+
+	fresh, err := newSvc.Issue(42, "a@b.com", "admin", time.Minute)
+	assert.NoError(t, err)
+	_, err = newSvc.Parse(fresh.Token)
+	assert.NoError(t, err)
+
+	// ...but a service that dropped the new key rejects its tokens
+	_, err = oldSvc.Parse(fresh.Token)
+	assert.Error(t, err)
+
+	// 3, the JWKS lists both public keys and nothing private
+	jwks := newSvc.JWKS()
+	assert.Len(t, jwks.Keys, 2)
+	for _, k := range jwks.Keys {
+		assert.Contains(t, []string{rsaKey.ID, edKey.ID}, k.Kid)
+		assert.Equal(t, "sig", k.Use)
+	}
+
+	// 4, tokens for another audience or past their expiry are refused
+	other, err := auth.NewTokenService(auth.TokenConfig{Issuer: "complaingo", Audience: "other-api", SigningKey: edKey})
+	assert.NoError(t, err)
+	foreign, _ := other.Issue(42, "a@b.com", "admin", time.Minute)
+	_, err = newSvc.Parse(foreign.Token)
+	assert.Error(t, err)
+
+	expired, _ := newSvc.Issue(42, "a@b.com", "admin", -time.Hour)
+	_, err = newSvc.Parse(expired.Token)
+	assert.Error(t, err)
+}
+
+func TestTokenServiceRejectsAlgorithmConfusion(t *testing.T) {
+	_, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+	edKey, _ := auth.NewKey(edPriv)
+	svc := newTestTokenService(t, edKey)
+
+	// an HS256 token naming the public key's kid must not verify
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "1", "iss": "complaingo", "aud": "complaingo-api", "jti": "x",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+	forged.Header["kid"] = edKey.ID
+	signed, _ := forged.SignedString([]byte(edPriv.Public().(ed25519.PublicKey)))
+	_, err := svc.Parse(signed)
+	assert.Error(t, err)
+
+	// tampering with the payload breaks the signature
+	issued, _ := svc.Issue(1, "a@b.com", "user", time.Minute)
+	parts := strings.Split(issued.Token, ".")
+	parts[1] = parts[1][:len(parts[1])-2] + "AA"
+	_, err = svc.Parse(strings.Join(parts, "."))
+	assert.Error(t, err)
+
+	// HS256 mode publishes no keys
+	hs, err := auth.NewTokenService(auth.TokenConfig{Issuer: "complaingo", Audience: "complaingo-api", Secret: "test_secret"})
+	assert.NoError(t, err)
+	assert.Empty(t, hs.JWKS().Keys)
+}
@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"Complaingo/internal/ai"
+	"Complaingo/internal/domain/models"
+	"Complaingo/internal/triage"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTriageParse(t *testing.T) {
+	categories := []string{"billing", "other"}
+
+	// 1, values are normalised, unknown ones dropped, confidence kept within 0 and 1
+	suggestions, err := triage.Parse("```json\n"+`{
+		"category": {"value": " Billing ", "confidence": 1.4},
+		"priority": {"value": "whenever", "confidence": 0.9},
+		"sentiment": {"value": "negative", "confidence": 0.7},
+		"language": {"value": "english", "confidence": 0.9}
+	}`+"\n```", categories)
+	assert.NoError(t, err)
+	if assert.Len(t, suggestions, 2) {
+		assert.Equal(t, "billing", suggestions[0].Value)
+		assert.Equal(t, 1.0, suggestions[0].Confidence)
+		assert.Equal(t, models.TriageSentiment, suggestions[1].Field)
+	}
+
+	// 2, an answer without anything usable is an error
+	_, err = triage.Parse(`{"category": {"value": "weather"}}`, categories)
+	assert.Error(t, err)
+	_, err = triage.Parse(`sorry, I can't`, categories)
+	assert.Error(t, err)
+}
+
+func TestTriageMockReply(t *testing.T) {
+	reply := triage.MockReply(triage.DefaultCategories)
+	complaint := &models.Complaints{Subject: "Urgente", Message: "El cobro de mi factura no es correcto, billing"}
+
+	var answer map[string]struct {
+		Value      string  `json:"value"`
+		Confidence float64 `json:"confidence"`
+	}
+	raw := reply(triage.Request(complaint, triage.DefaultCategories))
+	assert.NoError(t, json.Unmarshal([]byte(raw), &answer))
+	assert.Equal(t, "billing", answer["category"].Value)
+	assert.Equal(t, "es", answer["language"].Value)
+	assert.Equal(t, raw, reply(triage.Request(complaint, triage.DefaultCategories)))
+
+	// the mock provider answers triage requests with it
+	mock := ai.NewMockProvider()
+	mock.On(triage.Purpose, reply)
+	res, err := mock.Chat(context.Background(), triage.Request(complaint, triage.DefaultCategories))
+	assert.NoError(t, err)
+	assert.Equal(t, raw, res.Content)
+}
+
+func TestComplaintTriage(t *testing.T) {
+	_, token := createTestUser(t)
+	_, admin := createAdminUser(t)
+
+	resp := postJSON(t, "/complaints", token, map[string]string{
+		"subject": "Urgent", "message": "I was charged twice on my billing statement", "status": "Created",
+	})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	complaint := decodeData[models.Complaints](t, resp)
+	path := fmt.Sprintf("/complaints/%d", complaint.ID)
+
+	// 1, the worker stores a suggestion per field, in the background
+	var suggestions []models.TriageSuggestion
+	assert.Eventually(t, func() bool {
+		resp, err := http.DefaultClient.Do(authorized(t, "GET", path+"/triage", admin))
+		if err != nil || resp.StatusCode != http.StatusOK {
+			return false
+		}
+		suggestions = decodeData[[]models.TriageSuggestion](t, resp)
+		return len(suggestions) == len(models.TriageFields)
+	}, 5*time.Second, 50*time.Millisecond)
+
+	status := map[string]string{}
+	for _, s := range suggestions {
+		status[s.Field] = s.Status
+	}
+	assert.Equal(t, models.TriageAutoApplied, status[models.TriageCategory])
+	assert.Equal(t, models.TriageAutoApplied, status[models.TriagePriority])
+	assert.Equal(t, models.TriagePending, status[models.TriageSentiment])
+
+	// 2, confident suggestions are applied straight away, the others wait
+	resp, err := http.DefaultClient.Do(authorized(t, "GET", path, token))
+	assert.NoError(t, err)
+	triaged := decodeData[models.Complaints](t, resp)
+	assert.Equal(t, "billing", triaged.Category)
+	assert.Equal(t, "urgent", triaged.Priority)
+	assert.Equal(t, "", triaged.Sentiment)
+
+	// 3, admins override and accept, each only once
+	resp = postJSON(t, path+"/triage/priority/override", admin, map[string]string{"value": "High"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	decision := decodeData[models.TriageDecision](t, resp)
+	assert.Equal(t, models.TriageOverridden, decision.Decision)
+	assert.Equal(t, "high", decision.FinalValue)
+	assert.True(t, decision.AutoApplied)
+
+	resp = postJSON(t, path+"/triage/sentiment/accept", admin, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = postJSON(t, path+"/triage/sentiment/accept", admin, nil)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = postJSON(t, path+"/triage/category/override", admin, map[string]string{"value": "weather"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+
+	resp, err = http.DefaultClient.Do(authorized(t, "GET", path, token))
+	assert.NoError(t, err)
+	triaged = decodeData[models.Complaints](t, resp)
+	assert.Equal(t, "high", triaged.Priority)
+	assert.Equal(t, "neutral", triaged.Sentiment)
+
+	// 4, the decisions add up to how accurate the model is
+	resp, err = http.DefaultClient.Do(authorized(t, "GET", "/admin/triage/accuracy", admin))
+	assert.NoError(t, err)
+	accuracy := map[string]models.TriageAccuracy{}
+	for _, a := range decodeData[[]models.TriageAccuracy](t, resp) {
+		accuracy[a.Field] = a
+	}
+	assert.Equal(t, 1, accuracy[models.TriagePriority].AutoAppliedOverridden)
+	assert.Equal(t, 1.0, accuracy[models.TriageSentiment].Accuracy)
+
+	// 5, plain users can't review triage
+	assert.Equal(t, http.StatusForbidden, getWithToken(t, path+"/triage", token))
+}
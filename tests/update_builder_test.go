@@ -0,0 +1,22 @@
+package tests
+
+import (
+	"Complaingo/internal/utility"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateBuilder(t *testing.T) {
+	b := utility.NewUpdateBuilder("users")
+	assert.True(t, b.Empty())
+
+	b.Set("first_name", "Ada")
+	email := b.Set("email", "ada@example.com")
+	b.SetExpr("email_verified_at = CASE WHEN email = " + email + " THEN email_verified_at END")
+	query := b.SQL() + " WHERE id=" + b.Arg(7)
+
+	assert.False(t, b.Empty())
+	assert.Equal(t, "UPDATE users SET first_name=$1, email=$2, email_verified_at = CASE WHEN email = $2 THEN email_verified_at END WHERE id=$3", query)
+	assert.Equal(t, []any{"Ada", "ada@example.com", 7}, b.Args())
+}
@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"Complaingo/internal/domain/models"
+	appErrors "Complaingo/internal/errors"
+	"Complaingo/internal/middleware"
+	"Complaingo/internal/scanner"
+	"Complaingo/internal/storage"
+	"Complaingo/internal/upload"
+	"Complaingo/internal/usecase"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joomcode/errorx"
+	"github.com/stretchr/testify/assert"
+)
+
+// Mock Attachment Repo
+type MockAttachmentRepo struct {
+	Saved []*models.Attachment
+}
+
+func (m *MockAttachmentRepo) CreateAttachment(ctx context.Context, a *models.Attachment) error {
+	a.ID = len(m.Saved) + 1
+	m.Saved = append(m.Saved, a)
+	return nil
+}
+
+func (m *MockAttachmentRepo) GetAttachmentByID(ctx context.Context, id int) (*models.Attachment, error) {
+	return m.Saved[id-1], nil
+}
+
+func (m *MockAttachmentRepo) GetAttachmentsByComplaint(ctx context.Context, complaintID int) ([]*models.Attachment, error) {
+	return nil, nil
+}
+
+func (m *MockAttachmentRepo) GetAttachmentsByMessages(ctx context.Context, messageIDs []int) ([]*models.Attachment, error) {
+	return nil, nil
+}
+
+func (m *MockAttachmentRepo) LinkDocument(ctx context.Context, attachmentID, documentID int) error {
+	return nil
+}
+
+func (m *MockAttachmentRepo) LinkMessage(ctx context.Context, attachmentIDs []int, messageID int) error {
+	return nil
+}
+
+func (m *MockAttachmentRepo) DeleteAttachment(ctx context.Context, id int) error {
+	return nil
+}
+
+func newTestAttachmentUsecase(t *testing.T, maxBytes int64) (*usecase.AttachmentUsecase, *MockAttachmentRepo, string) {
+	dir := t.TempDir()
+	repo := &MockAttachmentRepo{}
+	policy := upload.NewPolicy(nil, maxBytes, nil)
+	uc := usecase.NewAttachmentUsecase(repo, nil, storage.NewLocalStore(dir, "", storage.NewURLSigner("test_secret", "/files/")), policy, scanner.NewFakeScanner())
+	return uc, repo, dir
+}
+
+func userContext(userID int, role string) context.Context {
+	ctx := context.WithValue(context.Background(), middleware.ContextUserID, userID)
+	return context.WithValue(ctx, middleware.ContextRole, role)
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	assert.Equal(t, "passwd", upload.SanitizeFilename("../../etc/passwd"))
+	assert.Equal(t, "evil.pdf", upload.SanitizeFilename(`C:\temp\evil.pdf`))
+	assert.Equal(t, "my_report.txt", upload.SanitizeFilename("my report.txt"))
+	assert.Equal(t, "file", upload.SanitizeFilename("..."))
+}
+
+func TestUploadPipelineStoresCleanFile(t *testing.T) {
+	uc, repo, dir := newTestAttachmentUsecase(t, 1<<20)
+	ctx := userContext(7, "user")
+
+	a, err := uc.Upload(ctx, strings.NewReader("plain text complaint evidence"), "../../evidence.txt", -1, models.AttachmentLink{})
+	assert.NoError(t, err)
+	assert.Equal(t, "evidence.txt", a.FileName)
+	assert.Equal(t, "text/plain", a.MimeType)
+	assert.Len(t, a.SHA256, 64)
+	assert.NotContains(t, a.StorageKey, "evidence", "storage names are generated")
+	assert.Len(t, repo.Saved, 1)
+
+	// the blob is promoted and nothing is left in quarantine
+	_, err = os.Stat(filepath.Join(dir, filepath.FromSlash(a.StorageKey)))
+	assert.NoError(t, err)
+	entries, _ := os.ReadDir(filepath.Join(dir, "quarantine", "7"))
+	assert.Empty(t, entries)
+}
+
+func TestUploadPipelineRejections(t *testing.T) {
+	uc, repo, _ := newTestAttachmentUsecase(t, 1024)
+	ctx := userContext(7, "user")
+
+	// too large while streaming
+	_, err := uc.Upload(ctx, bytes.NewReader(bytes.Repeat([]byte("a"), 2000)), "big.txt", -1, models.AttachmentLink{})
+	assert.True(t, errorx.IsOfType(err, appErrors.ErrFileTooLarge), "got %v", err)
+
+	// not on the allowlist
+	_, err = uc.Upload(ctx, bytes.NewReader([]byte("MZ\x90\x00\x03\x00\x00\x00")), "tool.exe", -1, models.AttachmentLink{})
+	assert.True(t, errorx.IsOfType(err, appErrors.ErrUnsupportedFileType), "got %v", err)
+
+	// flagged by the scanner
+	_, err = uc.Upload(ctx, strings.NewReader(scanner.EICAR), "eicar.txt", -1, models.AttachmentLink{})
+	assert.True(t, errorx.IsOfType(err, appErrors.ErrInfectedFile), "got %v", err)
+	assert.True(t, errorx.IsOfType(err, appErrors.ErrInvalidPayload))
+
+	assert.Empty(t, repo.Saved)
+}
@@ -0,0 +1,151 @@
+package tests
+
+import (
+	"Complaingo/internal/domain/models"
+	"Complaingo/testutils"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// patchJSON changes whatever version is current, see patchJSONIfMatch.
+func patchJSON(t *testing.T, path, token string, payload any) *http.Response {
+	return patchJSONIfMatch(t, path, token, "*", payload)
+}
+
+func patchJSONIfMatch(t *testing.T, path, token, etag string, payload any) *http.Response {
+	body, _ := json.Marshal(payload)
+	req, err := http.NewRequest("PATCH", testServer.URL+path, bytes.NewBuffer(body))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	if etag != "" {
+		req.Header.Set("If-Match", etag)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	return resp
+}
+
+func createVerifiedUser(t *testing.T, prefix string) (int, string) {
+	email := fmt.Sprintf("%s-%d@example.com", prefix, time.Now().UnixNano())
+	var id int
+	err := testutils.GetTestDB().QueryRow(context.Background(), `
+	INSERT INTO users (first_name, last_name, email, password, role_id, email_verified_at)
+	VALUES ('Life', 'Cycle', $1, $2, 2, NOW()) RETURNING id`, email, testPasswordHash).Scan(&id)
+	assert.NoError(t, err)
+	return id, email
+}
+
+func TestProfileSelfService(t *testing.T) {
+	_, email := createVerifiedUser(t, "profile")
+	resp := postJSON(t, "/login", "", map[string]string{"email": email, "password": "alexman"})
+	session := decodeTokens(t, resp)
+
+	// 1, users see their own profile, without the password hash
+	resp, err := http.DefaultClient.Do(authorized(t, "GET", "/me", session.AccessToken))
+	assert.NoError(t, err)
+	me := decodeData[models.User](t, resp)
+	assert.Equal(t, email, me.Email)
+	assert.Empty(t, me.Password)
+
+	// 2, names change freely, the email only with the password and unverified
+	resp = patchJSON(t, "/me", session.AccessToken, map[string]string{"first_name": "New"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	me = decodeData[models.User](t, resp)
+	assert.Equal(t, "New", me.FirstName)
+	assert.Equal(t, "Cycle", me.LastName)
+
+	newEmail := "moved-" + email
+	resp = patchJSON(t, "/me", session.AccessToken, map[string]string{"email": newEmail})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = patchJSON(t, "/me", session.AccessToken, map[string]string{"email": newEmail, "current_password": "alexman"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.False(t, decodeData[models.User](t, resp).EmailVerified)
+
+	// 3, a password change needs the old one and ends the other sessions
+	resp = postJSON(t, "/me/password", session.AccessToken, map[string]string{"current_password": "wrong-one", "new_password": "newpass"})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = postJSON(t, "/me/password", session.AccessToken, map[string]string{"current_password": "alexman", "new_password": "newpass"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	fresh := decodeTokens(t, resp)
+
+	assert.Equal(t, http.StatusUnauthorized, getWithToken(t, "/me", session.AccessToken))
+	assert.Equal(t, http.StatusOK, getWithToken(t, "/me", fresh.AccessToken))
+
+	resp = postJSON(t, "/login", "", map[string]string{"email": newEmail, "password": "newpass"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func TestUserLifecycle(t *testing.T) {
+	admin := getTestJWT(1, "admin")
+	userID, email := createVerifiedUser(t, "lifecycle")
+	credentials := map[string]string{"email": email, "password": "alexman"}
+
+	resp := postJSON(t, "/login", "", credentials)
+	session := decodeTokens(t, resp)
+
+	resp = postJSON(t, "/complaints", session.AccessToken, map[string]string{"subject": "Kept", "message": "For reporting", "status": "Created"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp.Body.Close()
+
+	// 1, deactivated users are signed out and can't come back
+	resp = postJSON(t, fmt.Sprintf("/users/%d/deactivate", userID), admin, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusUnauthorized, getWithToken(t, "/me", session.AccessToken))
+	resp = postJSON(t, "/auth/refresh", "", map[string]string{"refresh_token": session.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+	resp = postJSON(t, "/login", "", credentials)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp.Body.Close()
+
+	// 2, until an admin lets them back in
+	resp = postJSON(t, fmt.Sprintf("/users/%d/reactivate", userID), admin, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+	resp = postJSON(t, "/login", "", credentials)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp.Body.Close()
+
+	// 3, anonymizing scrubs the person but keeps their complaints
+	resp = postJSON(t, fmt.Sprintf("/users/%d/anonymize", userID), admin, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	var firstName, storedEmail string
+	var complaints int
+	db := testutils.GetTestDB()
+	assert.NoError(t, db.QueryRow(context.Background(), `SELECT first_name, email FROM users WHERE id=$1`, userID).Scan(&firstName, &storedEmail))
+	assert.NoError(t, db.QueryRow(context.Background(), `SELECT COUNT(*) FROM complaints WHERE user_id=$1`, userID).Scan(&complaints))
+	assert.Equal(t, "Deleted", firstName)
+	assert.NotEqual(t, email, storedEmail)
+	assert.Equal(t, 1, complaints)
+
+	resp = postJSON(t, "/login", "", credentials)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = postJSON(t, fmt.Sprintf("/users/%d/reactivate", userID), admin, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp.Body.Close()
+
+	// 4, admins can't lock themselves out
+	resp = postJSON(t, "/users/1/deactivate", admin, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp.Body.Close()
+}
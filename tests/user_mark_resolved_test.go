@@ -37,6 +37,7 @@ func TestUserMarkResolved(t *testing.T) {
 	req, err := http.NewRequest("PATCH", url, nil)
 	assert.NoError(t, err)
 	req.Header.Set("Authorization", "Bearer "+userToken)
+	req.Header.Set("If-Match", "*")
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -53,3 +54,18 @@ func TestUserMarkResolved(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "Resolved", status)
 }
+
+func TestUserMarkResolvedOnlyOwnComplaint(t *testing.T) {
+	_, owner := createTestUser(t)
+	_, other := createTestUser(t)
+	complaintID := createComplaint(t, owner)
+	path := fmt.Sprintf("/complaints/%d/resolve", complaintID)
+
+	resp := patchJSONIfMatch(t, path, other, "*", nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp = patchJSONIfMatch(t, "/complaints/999999999/resolve", owner, "*", nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
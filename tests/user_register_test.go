@@ -21,7 +21,7 @@ func TestUserRegistration(t *testing.T) {
 		"last_name":  "User",
 		"email":      "register_test@gmail.com",
 		"password":   "password123",
-		"role":       "admin",
+		"role":       "user",
 	}
 
 	// Send a POST /register request
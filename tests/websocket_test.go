@@ -98,3 +98,40 @@ func TestWebSocketEndToEnd(t *testing.T) {
 	assert.Equal(t, 1, len(mockRepo.Saved))
 	assert.Equal(t, "Hello Me!", mockRepo.Saved[0].Message)
 }
+
+func TestWebSocketAdminsAreThoseWhoReadAnyComplaint(t *testing.T) {
+	handler := websockets.NewwebsocketHandler(&MockMessageRepo{}, &MockKafkaProducer{})
+
+	// staff is known by permission, not by the name of the role
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		perms := models.PermissionSet{}
+		if r.URL.Query().Get("staff") != "" {
+			perms[models.PermComplaintReadAny] = true
+		}
+		ctx := context.WithValue(r.Context(), middleware.ContextUserID, 456)
+		ctx = context.WithValue(ctx, middleware.ContextRole, "supervisor")
+		ctx = context.WithValue(ctx, middleware.ContextPermissions, perms)
+		handler.HandleWebsocket(w, r.WithContext(ctx))
+	}))
+	defer srv.Close()
+
+	wsURL := "ws" + srv.URL[len("http"):]
+	staff, _, err := websocket.DefaultDialer.Dial(wsURL+"?staff=1", nil)
+	assert.NoError(t, err)
+	defer staff.Close()
+	user, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	assert.NoError(t, err)
+	defer user.Close()
+
+	// the connections are registered once the handler runs
+	time.Sleep(100 * time.Millisecond)
+	websockets.SendToAdmins(websockets.Message{Type: "notification", Message: "new reply"})
+
+	staff.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var received websockets.Message
+	assert.NoError(t, staff.ReadJSON(&received))
+	assert.Equal(t, "new reply", received.Message)
+
+	user.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	assert.Error(t, user.ReadJSON(&received))
+}